@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+func (app *application) createAliasHandler(w http.ResponseWriter, r *http.Request) {
+	tuneID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(tuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Make sure user is in band that owns this tune
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, tune.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+		Note  string `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	alias := &data.TuneAlias{
+		TuneID: tune.ID,
+		Title:  input.Title,
+		Note:   input.Note,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTuneAlias(v, alias); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TuneAliases.Insert(alias)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tunes/%d/aliases/%d", alias.TuneID, alias.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"alias": alias}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAliasesForTuneHandler(w http.ResponseWriter, r *http.Request) {
+	tuneID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(tuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, tune.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	aliases, err := app.models.TuneAliases.GetAllForTune(tune.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tune_id": tune.ID, "aliases": aliases}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAliasHandler(w http.ResponseWriter, r *http.Request) {
+	tuneID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	aliasID, err := app.readIntParam("aliasId", r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	alias, err := app.models.TuneAliases.Get(aliasID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if alias.TuneID != tuneID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(alias.TuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, tune.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.TuneAliases.Delete(alias.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "alias successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
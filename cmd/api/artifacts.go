@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// artifactKey names an artifact after a hash of everything that goes into
+// generating it, so that a change to any input gives a new file.
+func artifactKey(kind, ext string, inputs ...any) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s%v", kind, inputs)
+
+	return kind + "-" + hex.EncodeToString(h.Sum(nil)) + "." + ext
+}
+
+// cachedArtifact returns the path of the named artifact, calling generate to
+// write it first if it doesn't exist yet. Artifacts are files generated from
+// other data, such as click tracks, and are kept in the cache directory on
+// local disk rather than in storage, so they are served with serveArtifact:
+// anything in it can be deleted at any time and will be regenerated when
+// next asked for. The file is written under a
+// temporary name and renamed into place, so concurrent requests for the same
+// artifact never see it half-written.
+func (app *application) cachedArtifact(name string, generate func(io.Writer) error) (string, error) {
+	dir := app.config.storage.cacheDir
+	path := filepath.Join(dir, name)
+
+	_, err := os.Stat(path)
+	if err == nil {
+		return path, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			app.removeFile(tmp.Name())
+		}
+	}()
+
+	err = generate(tmp)
+	if err != nil {
+		return "", err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", err
+	}
+
+	ok = true
+	return path, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/storage"
+	"github.com/julienschmidt/httprouter"
+)
+
+// fakeDB answers each query with the rows given for the first table it
+// names, and with no rows if it names none of them.
+type fakeDB map[string][][]driver.Value
+
+func (db fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeStmt struct {
+	db    fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	for table, rows := range s.db {
+		if strings.Contains(s.query, "FROM "+table) {
+			return &fakeRows{rows: rows}, nil
+		}
+	}
+
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+func TestGetTuneClickTrack(t *testing.T) {
+	db := sql.OpenDB(fakeDB{
+		"tunes": {{
+			int64(1), time.Now(), int64(1), "The Kesh", []byte("{Gmaj}"), int64(6), int64(8),
+			"seedling", int64(1), []byte("{}"), "", int64(0), "",
+		}},
+		"band_members": {{int64(1)}},
+	})
+	t.Cleanup(func() { db.Close() })
+
+	app := &application{
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		models:  data.NewModels(db),
+		storage: storage.NewLocal(t.TempDir()),
+	}
+
+	// The default cache directory is an absolute path, which storage keys
+	// can never be.
+	app.config.storage.cacheDir = filepath.Join(t.TempDir(), "cache")
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/tunes/1/click?bpm=120&bars=2", nil)
+		r.Header = header
+		r = app.contextSetUser(r, &data.User{ID: 1})
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "1"}}))
+
+		w := httptest.NewRecorder()
+		app.getTuneClickTrackHandler(w, r)
+
+		return w
+	}
+
+	w := get(http.Header{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "audio/wav" {
+		t.Errorf("got Content-Type %q; want audio/wav", got)
+	}
+
+	if got, want := w.Header().Get("Content-Disposition"), `inline; filename="The Kesh (click, 120 bpm).wav"`; got != want {
+		t.Errorf("got Content-Disposition %q; want %q", got, want)
+	}
+
+	if !strings.HasPrefix(w.Body.String(), "RIFF") {
+		t.Errorf("got a body starting %q; want a WAV file", w.Body.String()[:min(w.Body.Len(), 12)])
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Error("got no ETag")
+	}
+
+	w = get(http.Header{"Range": {"bytes=0-3"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "RIFF" {
+		t.Errorf("Range request: got status %d and %q; want %d and %q", w.Code, w.Body, http.StatusPartialContent, "RIFF")
+	}
+
+	w = get(http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional request: got status %d; want %d", w.Code, http.StatusNotModified)
+	}
+
+	files, err := filepath.Glob(filepath.Join(app.config.storage.cacheDir, "click-*.wav"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("got cached files %v, %v; want one click track", files, err)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"gazebo.njvanhaute.com/internal/bandbook"
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// Books whose charts add up to no more than this are built while the client
+// waits; larger ones are built in the background.
+const maxInlineBookSize = 8 << 20
+
+func (app *application) createBandBookHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(user.ID, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title      string  `json:"title"`
+		TuneIDs    []int64 `json:"tune_ids"`
+		Instrument string  `json:"instrument"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	book := &data.BandBook{
+		BandID:     bandID,
+		OwnerID:    user.ID,
+		Title:      input.Title,
+		TuneIDs:    input.TuneIDs,
+		Instrument: input.Instrument,
+		Status:     data.BandBookPending,
+	}
+
+	v := validator.New()
+
+	if data.ValidateBandBook(v, book); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	titles, err := app.models.Tunes.GetTitles(bandID, book.TuneIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(titles) != len(book.TuneIDs) {
+		v.AddError("tune_ids", "all tunes must belong to the band")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	docs, err := app.bandBookCharts(book)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var size int64
+
+	for _, doc := range docs {
+		info, err := app.storage.Stat(r.Context(), doc.FilePath)
+		if err == nil {
+			size += info.Size
+		}
+	}
+
+	err = app.models.BandBooks.Insert(book)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/books/%d", book.ID))
+
+	status := http.StatusCreated
+
+	// Small books are built straight away, unless that would mean waiting
+	// for another build to finish.
+	if size > maxInlineBookSize || !app.tryBuildBandBook(book) {
+		// The build gets its own copy, since it updates the book while this
+		// response is being written.
+		pending := *book
+		app.background(func() {
+			app.buildBandBook(&pending)
+		})
+		status = http.StatusAccepted
+	}
+
+	err = app.writeJSON(w, status, envelope{"book": book}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// buildBandBook builds a book's PDF and records the outcome against it.
+// Failures are logged rather than returned, since books are usually built in
+// the background.
+func (app *application) buildBandBook(book *data.BandBook) {
+	// Building holds whole charts in memory, so only one book is built at a
+	// time.
+	app.bookLimiter <- struct{}{}
+	defer func() { <-app.bookLimiter }()
+
+	app.recordBandBook(book)
+}
+
+// tryBuildBandBook builds a book as buildBandBook does if no other book is
+// being built, and otherwise returns false straight away.
+func (app *application) tryBuildBandBook(book *data.BandBook) bool {
+	select {
+	case app.bookLimiter <- struct{}{}:
+	default:
+		return false
+	}
+
+	defer func() { <-app.bookLimiter }()
+
+	app.recordBandBook(book)
+	return true
+}
+
+// recordBandBook compiles a book, marking it as failed if that goes wrong.
+func (app *application) recordBandBook(book *data.BandBook) {
+	err := app.compileBandBook(book)
+	if err == nil || errors.Is(err, data.ErrRecordNotFound) {
+		return
+	}
+
+	app.logger.Error(err.Error(), "book_id", book.ID)
+
+	book.Status = data.BandBookFailed
+
+	err = app.models.BandBooks.SetBuilt(book)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logger.Error(err.Error(), "book_id", book.ID)
+	}
+}
+
+func (app *application) compileBandBook(book *data.BandBook) error {
+	// The tunes and their charts are looked up afresh, since a book may be
+	// built long after it was asked for.
+	titles, err := app.models.Tunes.GetTitles(book.BandID, book.TuneIDs)
+	if err != nil {
+		return err
+	}
+
+	docs, err := app.bandBookCharts(book)
+	if err != nil {
+		return err
+	}
+
+	// Identical charts share a file, so a file that can't be read may stand
+	// for several documents.
+	files := map[int64][]string{}
+	docIDs := map[string][]int64{}
+
+	for _, doc := range docs {
+		files[doc.TuneID] = append(files[doc.TuneID], doc.FilePath)
+		docIDs[doc.FilePath] = append(docIDs[doc.FilePath], doc.ID)
+	}
+
+	contents := bandbook.Book{Title: book.Title}
+
+	for _, id := range book.TuneIDs {
+		title, ok := titles[id]
+		if !ok {
+			continue
+		}
+
+		contents.Tunes = append(contents.Tunes, bandbook.Tune{Title: title, Files: files[id]})
+	}
+
+	// The book is written to a local file first, so that its size is known
+	// when it is stored.
+	err = os.MkdirAll(app.config.storage.uploadDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(app.config.storage.uploadDir, "book-*")
+	if err != nil {
+		return err
+	}
+
+	defer app.removeFile(tmp.Name())
+	defer tmp.Close()
+
+	result, err := bandbook.Build(tmp, contents, app.readStoredFile)
+	if err != nil {
+		return fmt.Errorf("building band book: %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	key, err := app.storeUpload(tmp.Name())
+	if err != nil {
+		return err
+	}
+
+	book.Status = data.BandBookReady
+	book.FilePath = key
+	book.PageCount = result.Pages
+	book.SkippedDocumentIDs = []int64{}
+
+	for _, name := range result.Skipped {
+		book.SkippedDocumentIDs = append(book.SkippedDocumentIDs, docIDs[name]...)
+
+		// Each file is only reported once, however many times it was used.
+		delete(docIDs, name)
+	}
+
+	err = app.models.BandBooks.SetBuilt(book)
+	if err != nil {
+		app.releaseFile(key)
+		return err
+	}
+
+	return nil
+}
+
+// bandBookCharts returns the PDF charts that go into a book. If the book is
+// for an instrument, only each tune's charts that suit it best are used, as
+// with GET /v1/tunes/:id/documents?for=me.
+func (app *application) bandBookCharts(book *data.BandBook) ([]*data.Document, error) {
+	docs, err := app.models.Documents.GetPDFsForTunes(book.TuneIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if book.Instrument == "" {
+		return docs, nil
+	}
+
+	byTune := map[int64][]*data.Document{}
+	for _, doc := range docs {
+		byTune[doc.TuneID] = append(byTune[doc.TuneID], doc)
+	}
+
+	charts := []*data.Document{}
+	for _, id := range book.TuneIDs {
+		charts = append(charts, data.ChartsFor(byTune[id], book.Instrument)...)
+	}
+
+	return charts, nil
+}
+
+// buildPendingBandBooks picks up books that were never built, such as those
+// asked for just before the server last stopped.
+func (app *application) buildPendingBandBooks() {
+	app.background(func() {
+		books, err := app.models.BandBooks.GetAllPending()
+		if err != nil {
+			app.logger.Error(err.Error())
+			return
+		}
+
+		for _, book := range books {
+			app.buildBandBook(book)
+		}
+	})
+}
+
+func (app *application) listBandBooksForBandHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	books, err := app.models.BandBooks.GetAllForBand(bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"band_id": bandID, "books": books}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getBandBookHandler(w http.ResponseWriter, r *http.Request) {
+	book, ok := app.readBandBookForMember(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) downloadBandBookHandler(w http.ResponseWriter, r *http.Request) {
+	book, ok := app.readBandBookForMember(w, r)
+	if !ok {
+		return
+	}
+
+	switch book.Status {
+	case data.BandBookReady:
+	case data.BandBookPending:
+		app.bandBookPendingResponse(w, r)
+		return
+	default:
+		app.bandBookFailedResponse(w, r)
+		return
+	}
+
+	err := app.serveFile(w, r, book.FilePath, "pdf", book.Title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteBandBookHandler(w http.ResponseWriter, r *http.Request) {
+	book, ok := app.readBandBookForMember(w, r)
+	if !ok {
+		return
+	}
+
+	if book.OwnerID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.BandBooks.Delete(book.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if book.FilePath != "" {
+		app.releaseFile(book.FilePath)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "band book successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readBandBookForMember loads the band book named by the :id parameter and
+// checks that the requesting user is in its band. It writes an error
+// response and returns false if either check fails.
+func (app *application) readBandBookForMember(w http.ResponseWriter, r *http.Request) (*data.BandBook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	book, err := app.models.BandBooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, book.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return book, true
+}
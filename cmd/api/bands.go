@@ -181,7 +181,7 @@ func (app *application) deleteBandHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Bands.Delete(id)
+	paths, err := app.models.Bands.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -192,6 +192,10 @@ func (app *application) deleteBandHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.background(func() {
+		app.releaseFiles(paths)
+	})
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "band successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
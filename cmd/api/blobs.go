@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/storage"
+)
+
+// storeUpload puts a finished upload into storage as a blob named after the
+// hash of its contents, returning the file path it is stored under. If an
+// identical file is already stored, that one is used instead. The local copy
+// is removed once the upload is stored.
+func (app *application) storeUpload(tmpPath string) (string, error) {
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	key := data.BlobKey(hash)
+
+	err = app.models.Blobs.Claim(hash, size)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+
+	_, err = app.storage.Stat(ctx, key)
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrNotFound):
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+
+		err = app.storage.Put(ctx, key, f, size)
+		if err != nil {
+			return "", err
+		}
+
+		// Storing a large file can take a while, so the claim is renewed
+		// to give the caller the whole grace period to refer to it.
+		err = app.models.Blobs.Claim(hash, size)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", err
+	}
+
+	f.Close()
+	app.removeFile(tmpPath)
+
+	return key, nil
+}
+
+// copyToBlob stores a copy of a stored file as a blob, returning the file
+// path of the copy.
+func (app *application) copyToBlob(key string) (string, error) {
+	src, err := app.storage.Open(context.Background(), key)
+	if err != nil {
+		return "", err
+	}
+
+	defer src.Close()
+
+	err = os.MkdirAll(app.config.storage.uploadDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(app.config.storage.uploadDir, "copy-*")
+	if err != nil {
+		return "", err
+	}
+
+	defer app.removeFile(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, src)
+	if err != nil {
+		return "", err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return app.storeUpload(tmp.Name())
+}
+
+// releaseFile deletes a stored file if nothing refers to it any more. Blobs
+// claimed by an upload that is still being recorded are kept, as are
+// quarantined files still held by other rows. Failures are logged rather
+// than returned, since callers have already finished with the request by this
+// point.
+func (app *application) releaseFile(key string) {
+	if data.IsQuarantineKey(key) {
+		inUse, err := app.models.Documents.FilePathInUse(key)
+		if err != nil {
+			app.logger.Error(err.Error(), "key", key)
+			return
+		}
+
+		if !inUse {
+			app.deleteStoredFile(key)
+		}
+		return
+	}
+
+	hash, ok := data.BlobHash(key)
+	if !ok {
+		app.deleteStoredFile(key)
+		return
+	}
+
+	_, err := app.models.Blobs.DeleteIfUnused(hash, func() error {
+		return app.storage.Delete(context.Background(), key)
+	})
+
+	if err != nil {
+		app.logger.Error(err.Error(), "key", key)
+	}
+}
+
+// releaseFiles calls releaseFile for each of a deleted row's files.
+func (app *application) releaseFiles(keys []string) {
+	for _, key := range keys {
+		app.releaseFile(key)
+	}
+}
+
+// convertLegacyFiles turns files stored before files were named by their
+// contents into blobs, so that they are deduplicated and served with their
+// hashes.
+func (app *application) convertLegacyFiles() {
+	paths, err := app.models.Blobs.GetLegacyFilePaths()
+	if err != nil {
+		app.logger.Error(err.Error())
+		return
+	}
+
+	for _, path := range paths {
+		key, err := app.copyToBlob(path)
+		if err != nil {
+			app.logger.Error(err.Error(), "key", path)
+			continue
+		}
+
+		err = app.models.Blobs.ReplaceFilePath(path, key)
+		if err != nil {
+			app.logger.Error(err.Error(), "key", path)
+			continue
+		}
+
+		app.deleteStoredFile(path)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gazebo.njvanhaute.com/internal/metronome"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// maxClickTrackDuration keeps generated WAV files to around 100MB.
+const maxClickTrackDuration = 20 * 60
+
+// getTuneClickTrackHandler serves a click track in the tune's time signature,
+// as a WAV file or a MIDI file, generating and caching it on first request.
+func (app *application) getTuneClickTrackHandler(w http.ResponseWriter, r *http.Request) {
+	tune, ok := app.readTuneForMember(w, r)
+	if !ok {
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	format := app.readString(qs, "format", "wav")
+	v.Check(validator.PermittedValue(format, "wav", "midi"), "format", "must be wav or midi")
+
+	opts := metronome.Options{
+		Meter: metronome.Meter{
+			Upper: int(tune.TimeSignatureUpper),
+			Lower: int(tune.TimeSignatureLower),
+		},
+		BPM:       app.readInt(qs, "bpm", 0, v),
+		Bars:      app.readInt(qs, "bars", 8, v),
+		CountIn:   app.readInt(qs, "count_in", 1, v),
+		Subdivide: app.readBool(qs, "subdivide", false, v),
+	}
+
+	opts.Meter.Grouping = app.readGrouping(qs.Get("grouping"), opts.Meter, v)
+
+	v.Check(qs.Has("bpm"), "bpm", "must be provided")
+	v.Check(opts.BPM >= 20 && opts.BPM <= 400, "bpm", "must be between 20 and 400")
+	v.Check(opts.Bars >= 1 && opts.Bars <= 500, "bars", "must be between 1 and 500")
+	v.Check(opts.CountIn >= 0 && opts.CountIn <= 4, "count_in", "must be between 0 and 4")
+
+	if v.Valid() {
+		v.Check(opts.Duration().Seconds() <= maxClickTrackDuration, "bars", "must not make the click track longer than 20 minutes")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	fileType, write := "wav", metronome.WriteWAV
+	if format == "midi" {
+		fileType, write = "mid", metronome.WriteMIDI
+	}
+
+	name := artifactKey("click", fileType, opts)
+
+	path, err := app.cachedArtifact(name, func(w io.Writer) error {
+		return write(w, opts)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	title := fmt.Sprintf("%s (click, %d bpm)", tune.Title, opts.BPM)
+
+	err = app.serveArtifact(w, r, path, fileType, title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readGrouping parses a grouping such as "2,2,3", which must add up to the
+// meter's upper number. An empty string gives the meter's default grouping.
+func (app *application) readGrouping(s string, meter metronome.Meter, v *validator.Validator) []int {
+	if s == "" {
+		return metronome.DefaultGrouping(meter.Upper, meter.Lower)
+	}
+
+	var grouping []int
+	sum := 0
+
+	for _, part := range strings.Split(s, ",") {
+		g, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || g < 1 {
+			v.AddError("grouping", "must be a comma-separated list of positive integers")
+			return nil
+		}
+
+		grouping = append(grouping, g)
+		sum += g
+	}
+
+	v.Check(sum == meter.Upper, "grouping", fmt.Sprintf("must add up to %d", meter.Upper))
+
+	return grouping
+}
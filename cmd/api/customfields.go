@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+func (app *application) createCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	band, err := app.models.Bands.Get(bandID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if band.OwnerID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name     string   `json:"name"`
+		Type     string   `json:"type"`
+		Required bool     `json:"required"`
+		Options  []string `json:"options"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	field := &data.CustomField{
+		BandID:   band.ID,
+		Name:     input.Name,
+		Type:     input.Type,
+		Required: input.Required,
+		Options:  input.Options,
+	}
+
+	v := validator.New()
+
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.CustomFields.Insert(field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordAlreadyExists):
+			v.AddError("name", "a field with this name already exists in this band")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/bands/%d/fields/%d", field.BandID, field.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"field": field}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCustomFieldsForBandHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	fields, err := app.models.CustomFields.GetAllForBand(bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"band_id": bandID, "fields": fields}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	field, ok := app.readCustomFieldForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	// The name and type can't be changed, as existing tunes store values
+	// under the name in the type's JSON representation.
+	var input struct {
+		Required *bool    `json:"required"`
+		Options  []string `json:"options"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Required != nil {
+		field.Required = *input.Required
+	}
+
+	if input.Options != nil {
+		field.Options = input.Options
+	}
+
+	v := validator.New()
+
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.CustomFields.Update(field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"field": field}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	field, ok := app.readCustomFieldForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.CustomFields.Delete(field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "field successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCustomFieldForOwner loads the field named by the :id and :fieldId
+// parameters and checks that the requesting user owns its band. It writes an
+// error response and returns false if either check fails.
+func (app *application) readCustomFieldForOwner(w http.ResponseWriter, r *http.Request) (*data.CustomField, bool) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	fieldID, err := app.readIntParam("fieldId", r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	field, err := app.models.CustomFields.Get(fieldID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if field.BandID != bandID {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	band, err := app.models.Bands.Get(field.BandID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if band.OwnerID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return field, true
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/google/uuid"
+)
+
+// replaceDocumentFileHandler uploads a new version of a document's file. The
+// upload's info may give the version being replaced, in which case the
+// upload is refused with 409 Conflict if someone else has added a version
+// since, and a new file type, which otherwise stays the same.
+func (app *application) replaceDocumentFileHandler(w http.ResponseWriter, r *http.Request) {
+	doc, tune, ok := app.readDocumentForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Version  *int32 `json:"version"`
+		FileType string `json:"file_type"`
+	}
+
+	tmpPath := app.uploadPath(uuid.New().String())
+
+	checkInfo := func() (*storageAllowance, bool) {
+		if input.Version != nil && *input.Version != doc.Version {
+			app.editConflictResponse(w, r)
+			return nil, false
+		}
+
+		if input.FileType != "" {
+			doc.FileType = input.FileType
+		}
+
+		v := validator.New()
+
+		if data.ValidateDocument(v, doc); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return nil, false
+		}
+
+		return app.checkStorageQuota(w, r, app.contextGetUser(r), tune.BandID)
+	}
+
+	if !app.readUpload(w, r, &input, checkInfo, tmpPath) {
+		return
+	}
+
+	doc.PageCount = 0
+	doc.PDFInfo = nil
+	doc.Text = ""
+
+	v := validator.New()
+
+	err := app.checkDocumentFile(doc, tmpPath, v)
+	if err != nil || !v.Valid() {
+		app.removeFile(tmpPath)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		} else {
+			app.failedValidationResponse(w, r, v.Errors)
+		}
+		return
+	}
+
+	key, err := app.storeUpload(tmpPath)
+	if err != nil {
+		app.removeFile(tmpPath)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	doc.FilePath = key
+	doc.ScanStatus = app.initialScanStatus()
+
+	app.addDocumentVersion(w, r, doc, nil)
+}
+
+// restoreDocumentVersionHandler makes an earlier version's file the
+// document's latest version.
+func (app *application) restoreDocumentVersionHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ver, ok := app.readDocumentVersionForMember(w, r)
+	if !ok {
+		return
+	}
+
+	if ver.Version == doc.Version {
+		v := validator.New()
+		v.AddError("version", "is already the document's latest version")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// A file still being scanned may be restored, and is then scanned again
+	// as the new version.
+	if ver.ScanStatus != data.ScanPending && !app.checkScanStatus(w, r, ver.ScanStatus) {
+		return
+	}
+
+	// Both versions share the file, unless it was stored before files were
+	// named by their contents, in which case each version gets its own.
+	key := ver.FilePath
+
+	if _, ok := data.BlobHash(key); !ok {
+		var err error
+
+		key, err = app.copyToBlob(ver.FilePath)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	doc.FilePath = key
+	doc.FileType = ver.FileType
+	doc.PageCount = ver.PageCount
+	doc.PDFInfo = ver.PDFInfo
+	doc.Text = ver.Text
+	doc.ScanStatus = ver.ScanStatus
+
+	app.addDocumentVersion(w, r, doc, &ver.Version)
+}
+
+// addDocumentVersion records the file now set on doc as its latest version
+// and sends the updated document, removing the file again if it can't be
+// recorded.
+func (app *application) addDocumentVersion(w http.ResponseWriter, r *http.Request, doc *data.Document, restoredFrom *int32) {
+	ver, err := app.models.Documents.AddVersion(doc, app.contextGetUser(r).ID, restoredFrom)
+	if err != nil {
+		app.releaseFile(doc.FilePath)
+
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if isImageType(doc.FileType) {
+		app.background(func() {
+			app.generateThumbnails(doc)
+		})
+	}
+
+	if ver.ScanStatus == data.ScanPending {
+		// The scan updates the version it is given, which is still to be
+		// sent, so it gets its own copy.
+		pending := *ver
+
+		app.background(func() {
+			app.scanVersion(&pending)
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"doc": doc, "version": ver}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listDocumentVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	doc, _, ok := app.readDocumentForMember(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := app.models.Documents.GetVersions(doc.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"document_id": doc.ID, "versions": versions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) downloadDocumentVersionHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ver, ok := app.readDocumentVersionForMember(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkScanStatus(w, r, ver.ScanStatus) {
+		return
+	}
+
+	err := app.serveFile(w, r, ver.FilePath, ver.FileType, doc.Title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readDocumentVersionForMember loads the document named by the :id parameter
+// and its version named by the :version parameter, checking that the
+// requesting user is in the band that owns the document's tune. It writes an
+// error response and returns false if any of this fails.
+func (app *application) readDocumentVersionForMember(w http.ResponseWriter, r *http.Request) (*data.Document, *data.DocumentVersion, bool) {
+	doc, _, ok := app.readDocumentForMember(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	version, err := app.readIntParam("version", r)
+	if err != nil || version > math.MaxInt32 {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	ver, err := app.models.Documents.GetVersion(doc.ID, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return doc, ver, true
+}
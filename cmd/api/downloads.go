@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"gazebo.njvanhaute.com/internal/data"
+)
+
+// Content types for each file type the API stores.
+var fileContentTypes = map[string]string{
+	"pdf":      "application/pdf",
+	"mp3":      "audio/mpeg",
+	"wav":      "audio/wav",
+	"flac":     "audio/flac",
+	"ogg":      "audio/ogg",
+	"mid":      "audio/midi",
+	"musicxml": "application/vnd.recordare.musicxml+xml",
+	"mxl":      "application/vnd.recordare.musicxml",
+	"jpg":      "image/jpeg",
+	"png":      "image/png",
+	"webp":     "image/webp",
+}
+
+// serveFile sends a stored file to the client, named after its title. Files
+// stored as blobs have their SHA-256 hash as a strong ETag and in a Digest
+// header, so clients can check what they downloaded.
+func (app *application) serveFile(w http.ResponseWriter, r *http.Request, key, fileType, title string) error {
+	file, err := app.storage.Open(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	var etag string
+
+	if hash, ok := data.BlobHash(key); ok {
+		sum, err := hex.DecodeString(hash)
+		if err != nil {
+			return err
+		}
+
+		etag = `"` + hash + `"`
+		w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+	} else {
+		// Files stored before files were named by their contents are never
+		// modified in place, so the size and modification time are enough
+		// to tell versions apart.
+		etag = fmt.Sprintf(`"%x-%x"`, file.ModTime().UnixNano(), file.Size())
+	}
+
+	app.serveContent(w, r, file, file.ModTime(), etag, fileType, title)
+
+	return nil
+}
+
+// serveArtifact sends an artifact from the cache directory on local disk, at
+// a path returned by cachedArtifact. Artifacts are named after a hash of their
+// inputs, so the name is a strong ETag.
+func (app *application) serveArtifact(w http.ResponseWriter, r *http.Request, path, fileType, title string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	etag := `"` + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + `"`
+
+	app.serveContent(w, r, file, stat.ModTime(), etag, fileType, title)
+
+	return nil
+}
+
+// serveContent sends content named after its title. It answers Range requests
+// with 206 Partial Content and conditional requests (If-None-Match,
+// If-Modified-Since, If-Range) against the given ETag and modification time,
+// so players can seek and viewers can load progressively.
+func (app *application) serveContent(w http.ResponseWriter, r *http.Request, content io.ReadSeeker, modTime time.Time, etag, fileType, title string) {
+	contentType, ok := fileContentTypes[fileType]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+
+	disposition := mime.FormatMediaType("inline", map[string]string{
+		"filename": downloadFilename(title, fileType),
+	})
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent handles Range, the conditional headers and HEAD requests.
+	http.ServeContent(w, r, "", modTime, content)
+}
+
+// downloadFilename turns a title into a filename with the right extension,
+// dropping characters that aren't safe in one.
+func downloadFilename(title, fileType string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == '"':
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		default:
+			return r
+		}
+	}, title)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "download"
+	}
+
+	if fileType != "" && !strings.HasSuffix(strings.ToLower(name), "."+fileType) {
+		name += "." + fileType
+	}
+
+	return name
+}
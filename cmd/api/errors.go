@@ -104,3 +104,81 @@ func (app *application) wrongNumberOfPartsResponse(w http.ResponseWriter, r *htt
 	message := "wrong number of parts sent"
 	app.errorResponse(w, r, http.StatusBadRequest, message)
 }
+
+func (app *application) waveformPendingResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "10")
+
+	message := "the waveform for this recording is still being generated"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) waveformUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "no waveform is available for this recording"
+	app.errorResponse(w, r, http.StatusNotFound, message)
+}
+
+func (app *application) uploadTooLargeResponse(w http.ResponseWriter, r *http.Request, limit int64) {
+	message := fmt.Sprintf("uploads must not be larger than %d bytes", limit)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+func (app *application) storageQuotaExceededResponse(w http.ResponseWriter, r *http.Request, allowance *storageAllowance) {
+	message := fmt.Sprintf("this upload would take the %s over its storage quota of %d bytes", allowance.scope, allowance.quota)
+	app.errorResponse(w, r, http.StatusInsufficientStorage, message)
+}
+
+func (app *application) uploadLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "another request is already writing to this upload, please try again"
+	app.errorResponse(w, r, http.StatusLocked, message)
+}
+
+func (app *application) uploadOffsetMismatchResponse(w http.ResponseWriter, r *http.Request, offset int64) {
+	w.Header().Set("Upload-Offset", fmt.Sprintf("%d", offset))
+
+	message := fmt.Sprintf("the upload is at offset %d", offset)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) missingABCResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this tune has no ABC notation"
+	app.errorResponse(w, r, http.StatusNotFound, message)
+}
+
+func (app *application) noTuneMetadataResponse(w http.ResponseWriter, r *http.Request) {
+	message := "tune metadata can't be read from this type of document"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) noThumbnailResponse(w http.ResponseWriter, r *http.Request) {
+	message := "thumbnails can only be made for image documents"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) bandBookPendingResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "10")
+
+	message := "this band book is still being built"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) bandBookFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this band book could not be built"
+	app.errorResponse(w, r, http.StatusNotFound, message)
+}
+
+func (app *application) scanPendingResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "10")
+
+	message := "this file is still being scanned for malware"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) fileQuarantinedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this file was found to contain malware and has been quarantined"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) scanFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this file could not be scanned for malware, so it cannot be downloaded"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
@@ -1,167 +1,221 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 
 	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/midi"
 	"gazebo.njvanhaute.com/internal/validator"
 	"github.com/google/uuid"
 )
 
+type documentInput struct {
+	TuneID   int64  `json:"tune_id"`
+	FileType string `json:"file_type"`
+	Title    string `json:"title"`
+	data.DocumentPart
+}
+
 func (app *application) uploadDocumentHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		TuneID   int64  `json:"tune_id"`
-		FileType string `json:"file_type"`
-		Title    string `json:"title"`
+	var input documentInput
+
+	id := uuid.New()
+	tmpPath := app.uploadPath(id.String())
+
+	user := app.contextGetUser(r)
+
+	var doc *data.Document
+
+	checkInfo := func() (*storageAllowance, bool) {
+		v := validator.New()
+
+		var (
+			tune *data.Tune
+			err  error
+		)
+
+		doc, tune, err = app.newDocument(user, input, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return nil, false
+		}
+
+		return app.checkStorageQuota(w, r, user, tune.BandID)
 	}
 
-	mr, err := r.MultipartReader()
+	if !app.readUpload(w, r, &input, checkInfo, tmpPath) {
+		return
+	}
+
+	v := validator.New()
+
+	err := app.finishDocument(doc, tmpPath, v)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	id := uuid.New()
-	tmpDir := "./tmp"
-	outDir := "./docs"
-	tmpPath := tmpDir + "/" + id.String()
-	outPath := outDir + "/" + id.String()
-	var doc *data.Document
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
-	gotFile, gotMetadata := false, false
-	numParts := 0
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/documents/%d", doc.ID))
 
-	defer app.cleanDirectory(tmpDir)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"doc": doc}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
 
-	for {
-		part, err := mr.NextPart()
+// newDocument builds a document from upload metadata, checking that it is
+// valid and that the user is in the band that owns its tune, which is
+// returned too. Problems with the metadata are added to v.
+func (app *application) newDocument(user *data.User, input documentInput, v *validator.Validator) (*data.Document, *data.Tune, error) {
+	doc := &data.Document{
+		TuneID:   input.TuneID,
+		OwnerID:  user.ID,
+		FileType: input.FileType,
+		Title:    input.Title,
+
+		DocumentPart: input.DocumentPart,
+	}
 
-		if err == io.EOF {
-			break
-		}
+	if data.ValidateDocument(v, doc); !v.Valid() {
+		return doc, nil, nil
+	}
 
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+	tune, err := app.models.Tunes.Get(doc.TuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("tune_id", "invalid tune ID supplied")
+			return doc, nil, nil
+		default:
+			return nil, nil, err
 		}
+	}
 
-		if part.FormName() == "info" {
-			dec := json.NewDecoder(part)
-			dec.DisallowUnknownFields()
+	userIsInBand, err := app.models.BandMembers.UserIsInBand(user.ID, tune.BandID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-			err = dec.Decode(&input)
-			if err != nil {
-				app.badRequestResponse(w, r, handleJSONDecodingErrors(err))
-				return
-			}
+	if !userIsInBand {
+		v.AddError("tune_id", "you are not in the band that owns this tune")
+	}
 
-			user := app.contextGetUser(r)
+	return doc, tune, nil
+}
 
-			doc = &data.Document{
-				TuneID:   input.TuneID,
-				OwnerID:  user.ID,
-				FilePath: outPath,
-				FileType: input.FileType,
-				Title:    input.Title,
-			}
+// finishDocument checks an uploaded file against its document's type and
+// stores it, queueing thumbnails for images. Problems with the file are added
+// to v, in which case the file is removed and nothing is stored.
+func (app *application) finishDocument(doc *data.Document, tmpPath string, v *validator.Validator) error {
+	err := app.checkDocumentFile(doc, tmpPath, v)
+	if err != nil || !v.Valid() {
+		app.removeFile(tmpPath)
+		return err
+	}
 
-			v := validator.New()
+	err = app.storeDocument(doc, tmpPath)
+	if err != nil {
+		return err
+	}
 
-			if data.ValidateDocument(v, doc); !v.Valid() {
-				app.failedValidationResponse(w, r, v.Errors)
-				return
-			}
+	if isImageType(doc.FileType) {
+		app.background(func() {
+			app.generateThumbnails(doc)
+		})
+	}
 
-			tune, err := app.models.Tunes.Get(doc.TuneID)
-			if err != nil {
-				switch {
-				case errors.Is(err, data.ErrRecordNotFound):
-					v.AddError("tune_id", "invalid tune ID supplied")
-					app.failedValidationResponse(w, r, v.Errors)
-				default:
-					app.serverErrorResponse(w, r, err)
-				}
-				return
-			}
+	return nil
+}
 
-			userIsInBand, err := app.models.BandMembers.UserIsInBand(user.ID, tune.BandID)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
-			}
+// checkDocumentFile adds an error to v if the file's contents don't match the
+// document's type. Details read from PDFs are filled in on doc, and images
+// are rewritten without their metadata, which may change the document's
+// type.
+func (app *application) checkDocumentFile(doc *data.Document, tmpPath string, v *validator.Validator) error {
+	switch doc.FileType {
+	case "pdf":
+		return app.readPDF(doc, tmpPath, v)
 
-			if !userIsInBand {
-				v.AddError("tune_id", "you are not in the band that owns this tune")
-				app.failedValidationResponse(w, r, v.Errors)
-				return
-			}
+	case "jpg", "png", "webp":
+		return app.sanitizeImage(doc, tmpPath, v)
 
-			gotMetadata = true
+	case "mid":
+		f, err := os.Open(tmpPath)
+		if err != nil {
+			return err
 		}
 
-		if part.FormName() == "file" {
-			outfile, err := os.Create(tmpPath)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
-			}
+		defer f.Close()
 
-			_, err = io.Copy(outfile, part)
-			outfile.Close()
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
+		_, err = midi.Read(f)
+		if err != nil {
+			switch {
+			case errors.Is(err, midi.ErrNotMIDI), errors.Is(err, midi.ErrMalformed):
+				v.AddError("file", "must be a valid MIDI file")
+			default:
+				return err
 			}
+		}
 
-			gotFile = true
+	case "musicxml", "mxl":
+		f, err := os.Open(tmpPath)
+		if err != nil {
+			return err
 		}
 
-		numParts += 1
-	}
+		defer f.Close()
 
-	if !gotFile {
-		app.missingFileResponse(w, r)
-		return
-	}
+		_, fileType, err := readMusicXML(f)
+		if err != nil {
+			return checkMusicXMLError(v, err)
+		}
 
-	if numParts != 2 {
-		app.wrongNumberOfPartsResponse(w, r)
-		return
+		v.Check(fileType == doc.FileType, "file_type", "must match the file's contents")
 	}
 
-	if !gotMetadata {
-		app.missingMetadataResponse(w, r)
-		return
-	}
+	return nil
+}
 
-	err = os.Rename(tmpPath, outPath)
+// storeDocument puts an uploaded file into storage and records its document,
+// removing the file again if the document can't be recorded. The file is
+// then scanned for malware in the background if a scanner is configured.
+func (app *application) storeDocument(doc *data.Document, tmpPath string) error {
+	key, err := app.storeUpload(tmpPath)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		app.removeFile(tmpPath)
+		return err
 	}
 
+	doc.FilePath = key
+	doc.ScanStatus = app.initialScanStatus()
+
 	err = app.models.Documents.Insert(doc)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		err = os.Remove(outPath)
-		if err != nil {
-			app.logger.Error(err.Error())
-		}
-		return
+		app.releaseFile(key)
+		return err
 	}
 
-	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/documents/%d", doc.ID))
-
-	err = app.writeJSON(w, http.StatusCreated, envelope{"doc": doc}, headers)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
+	if doc.ScanStatus == data.ScanPending {
+		app.background(func() {
+			app.scanDocument(doc)
+		})
 	}
+
+	return nil
 }
 
 func (app *application) listDocumentsForTuneHandler(w http.ResponseWriter, r *http.Request) {
@@ -182,7 +236,9 @@ func (app *application) listDocumentsForTuneHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, tune.BandID)
+	user := app.contextGetUser(r)
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(user.ID, tune.BandID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -193,12 +249,40 @@ func (app *application) listDocumentsForTuneHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	docs, err := app.models.Documents.GetAllDocsForTune(tuneID)
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	var filters data.DocumentFilters
+
+	filters.Text = app.readString(qs, "text", "")
+	filters.FavoritedOnly = app.readBool(qs, "favorited_only", false, v)
+	filters.Instrument = app.readString(qs, "instrument", "")
+	filters.Transposition = app.readString(qs, "transposition", "")
+	filters.Clef = app.readString(qs, "clef", "")
+	filters.Part = app.readString(qs, "part", "")
+
+	// for=me picks the charts that suit the user's own instrument.
+	forMe := app.readString(qs, "for", "")
+	v.Check(forMe == "" || forMe == "me", "for", "must be me")
+
+	data.ValidateDocumentPart(v, filters.DocumentPart)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	docs, err := app.models.Documents.GetAllDocsForTune(tuneID, user.ID, filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	if forMe != "" {
+		docs = data.ChartsFor(docs, user.Instrument)
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"tune_id": tuneID, "docs": docs}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -248,7 +332,11 @@ func (app *application) downloadDocumentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.serveFile(w, doc.FilePath, nil)
+	if !app.checkScanStatus(w, r, doc.ScanStatus) {
+		return
+	}
+
+	err = app.serveFile(w, r, doc.FilePath, doc.FileType, doc.Title)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -279,7 +367,7 @@ func (app *application) deleteDocumentHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.models.Documents.Delete(id)
+	paths, err := app.models.Documents.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -290,8 +378,58 @@ func (app *application) deleteDocumentHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	app.background(func() {
+		app.releaseFiles(paths)
+	})
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tune successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// readDocumentForMember loads the document named by the :id parameter and
+// its tune, and checks that the requesting user is in the band that owns the
+// tune. It writes an error response and returns false if any of this fails.
+func (app *application) readDocumentForMember(w http.ResponseWriter, r *http.Request) (*data.Document, *data.Tune, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	doc, err := app.models.Documents.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	tune, err := app.models.Tunes.Get(doc.TuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, tune.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, false
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return nil, nil, false
+	}
+
+	return doc, tune, true
+}
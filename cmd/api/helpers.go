@@ -7,28 +7,15 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"gazebo.njvanhaute.com/internal/data"
 	"gazebo.njvanhaute.com/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
-func (app *application) cleanDirectory(dir string) {
-	err := os.RemoveAll(dir)
-	if err != nil {
-		app.logger.Error(err.Error())
-		return
-	}
-	// only owner (i.e. gazebo user) should be able to access
-	err = os.MkdirAll(dir, 0700)
-	if err != nil {
-		app.logger.Error(err.Error())
-		return
-	}
-}
-
 func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return app.readIntParam("id", r)
 }
@@ -122,23 +109,6 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
-func (app *application) serveFile(w http.ResponseWriter, filepath string, headers http.Header) error {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return err
-	}
-
-	for key, value := range headers {
-		w.Header()[key] = value
-	}
-
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.WriteHeader(http.StatusOK)
-	io.Copy(w, file)
-
-	return nil
-}
-
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 
@@ -175,6 +145,62 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, "must be a date in YYYY-MM-DD format")
+		return nil
+	}
+
+	return &t
+}
+
+// readCustomFieldFilters reads "cf.<name>" query string parameters for each
+// of the band's custom fields, converting the values to the field's type.
+func (app *application) readCustomFieldFilters(qs url.Values, fields []*data.CustomField, v *validator.Validator) data.CustomFieldValues {
+	values := data.CustomFieldValues{}
+
+	for _, field := range fields {
+		s := qs.Get("cf." + field.Name)
+
+		if s == "" {
+			continue
+		}
+
+		value, err := field.ParseValue(s)
+		if err != nil {
+			v.AddError("cf."+field.Name, "invalid value for this field")
+			continue
+		}
+
+		values[field.Name] = value
+	}
+
+	return values
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 
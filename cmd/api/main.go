@@ -8,12 +8,15 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
 
+	"gazebo.njvanhaute.com/internal/clamd"
 	"gazebo.njvanhaute.com/internal/data"
 	"gazebo.njvanhaute.com/internal/mailer"
+	"gazebo.njvanhaute.com/internal/storage"
 	"gazebo.njvanhaute.com/internal/vcs"
 
 	_ "github.com/lib/pq"
@@ -45,14 +48,65 @@ type config struct {
 		password string
 		sender   string
 	}
+	storage struct {
+		backend   string
+		root      string
+		uploadDir string
+		cacheDir  string
+		s3        struct {
+			endpoint  string
+			region    string
+			bucket    string
+			accessKey string
+			secretKey string
+			pathStyle bool
+		}
+	}
+	gc struct {
+		interval       time.Duration
+		dryRun         bool
+		deleteMissing  bool
+		maxDeletedRows int
+	}
+	quota struct {
+		band int64
+		user int64
+	}
+	clamd struct {
+		address string
+		timeout time.Duration
+	}
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *slog.Logger
+	models  data.Models
+	mailer  mailer.Mailer
+	storage storage.Storage
+	scanner *clamd.Client
+	wg      sync.WaitGroup
+
+	// waveformLimiter bounds the number of recordings decoded at once.
+	waveformLimiter chan struct{}
+
+	// imageLimiter bounds the number of images decoded at once.
+	imageLimiter chan struct{}
+
+	// bookLimiter bounds the number of band books built at once.
+	bookLimiter chan struct{}
+
+	// scanLimiter bounds the number of files scanned for malware at once.
+	scanLimiter chan struct{}
+
+	// activeUploads holds the IDs of resumable uploads being written to.
+	activeUploads sync.Map
+
+	// activeScans holds the document versions and recordings being scanned.
+	activeScans sync.Map
+
+	// gcMutex is held while the storage reconciler runs.
+	gcMutex sync.Mutex
 }
 
 func main() {
@@ -77,6 +131,29 @@ func main() {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Gazebo <no-reply@gazebo.njvanhaute.com>", "SMTP sender")
 
+	flag.StringVar(&cfg.storage.backend, "storage-backend", "local", "File storage backend (local|s3)")
+	flag.StringVar(&cfg.storage.root, "storage-root", ".", "Local file storage root directory")
+	flag.StringVar(&cfg.storage.uploadDir, "upload-dir", filepath.Join(os.TempDir(), "gazebo-uploads"), "Directory for uploads in progress (must be shared by all instances)")
+	flag.StringVar(&cfg.storage.cacheDir, "cache-dir", filepath.Join(os.TempDir(), "gazebo-cache"), "Directory for generated files such as thumbnails")
+
+	flag.StringVar(&cfg.storage.s3.endpoint, "s3-endpoint", "", "S3 endpoint URL")
+	flag.StringVar(&cfg.storage.s3.region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.storage.s3.bucket, "s3-bucket", "", "S3 bucket")
+	flag.StringVar(&cfg.storage.s3.accessKey, "s3-access-key", "", "S3 access key ID")
+	flag.StringVar(&cfg.storage.s3.secretKey, "s3-secret-key", "", "S3 secret access key")
+	flag.BoolVar(&cfg.storage.s3.pathStyle, "s3-path-style", true, "Address S3 buckets by path rather than host name")
+
+	flag.DurationVar(&cfg.gc.interval, "gc-interval", time.Hour, "Interval between storage reconciler runs (0 to run only at startup)")
+	flag.BoolVar(&cfg.gc.dryRun, "gc-dry-run", false, "Report what the storage reconciler finds without deleting anything")
+	flag.BoolVar(&cfg.gc.deleteMissing, "gc-delete-missing", false, "Let the storage reconciler delete rows whose files are missing, rather than only reporting them")
+	flag.IntVar(&cfg.gc.maxDeletedRows, "gc-max-deleted-rows", 100, "Most rows with missing files the storage reconciler deletes in a pass")
+
+	flag.Int64Var(&cfg.quota.band, "band-storage-quota", 10<<30, "Default storage quota per band in bytes (0 for no limit)")
+	flag.Int64Var(&cfg.quota.user, "user-storage-quota", 5<<30, "Default storage quota per user in bytes (0 for no limit)")
+
+	flag.StringVar(&cfg.clamd.address, "clamd-address", "", "clamd address for malware scanning, such as localhost:3310 or unix:///run/clamd.ctl (empty to disable)")
+	flag.DurationVar(&cfg.clamd.timeout, "clamd-timeout", 2*time.Minute, "Time limit for scanning a file with clamd")
+
 	flag.BoolVar(&cfg.authEnabled, "require-auth", true, "Require authentication")
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
@@ -100,6 +177,22 @@ func main() {
 
 	logger.Info("database connection pool established")
 
+	store, err := openStorage(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	var scanner *clamd.Client
+
+	if cfg.clamd.address != "" {
+		scanner, err = clamd.New(cfg.clamd.address, cfg.clamd.timeout)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	expvar.NewString("version").Set(version)
 	expvar.Publish("goroutines", expvar.Func(func() any {
 		return runtime.NumGoroutine()
@@ -118,8 +211,22 @@ func main() {
 		logger: logger,
 		models: data.NewModels(db),
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+
+		storage: store,
+		scanner: scanner,
+
+		waveformLimiter: make(chan struct{}, 2),
+		imageLimiter:    make(chan struct{}, 2),
+		bookLimiter:     make(chan struct{}, 1),
+		scanLimiter:     make(chan struct{}, 2),
 	}
 
+	app.startStorageReconciler()
+	app.startScanner()
+	app.generatePendingWaveforms()
+	app.buildPendingBandBooks()
+	app.startUploadExpirer()
+
 	err = app.serve()
 	if err != nil {
 		logger.Error(err.Error())
@@ -148,3 +255,21 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func openStorage(cfg config) (storage.Storage, error) {
+	switch cfg.storage.backend {
+	case "local":
+		return storage.NewLocal(cfg.storage.root), nil
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.storage.s3.endpoint,
+			Region:    cfg.storage.s3.region,
+			Bucket:    cfg.storage.s3.bucket,
+			AccessKey: cfg.storage.s3.accessKey,
+			SecretKey: cfg.storage.s3.secretKey,
+			PathStyle: cfg.storage.s3.pathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+func (app *application) createMarkerHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := app.readRecordingForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TuneID *int64  `json:"tune_id"`
+		Start  float64 `json:"start"`
+		End    float64 `json:"end"`
+		Label  string  `json:"label"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	marker := &data.Marker{
+		RecordingID: rec.ID,
+		TuneID:      input.TuneID,
+		CreatedBy:   app.contextGetUser(r).ID,
+		Start:       input.Start,
+		End:         input.End,
+		Label:       input.Label,
+	}
+
+	v := validator.New()
+
+	if data.ValidateMarker(v, marker, rec); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Markers.Insert(rec, marker)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTuneNotInBand):
+			v.AddError("tune_id", "must belong to the recording's band")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/recordings/%d/markers/%d", rec.ID, marker.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"marker": marker}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMarkersForRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := app.readRecordingForMember(w, r)
+	if !ok {
+		return
+	}
+
+	markers, err := app.models.Markers.GetAllForRecording(rec.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recording_id": rec.ID, "markers": markers}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMarkerHandler(w http.ResponseWriter, r *http.Request) {
+	rec, marker, ok := app.readMarkerForMember(w, r)
+	if !ok {
+		return
+	}
+
+	// tune_id is kept raw so that an explicit null, which unlinks the tune,
+	// can be told apart from leaving it out.
+	var input struct {
+		TuneID json.RawMessage `json:"tune_id"`
+		Start  *float64        `json:"start"`
+		End    *float64        `json:"end"`
+		Label  *string         `json:"label"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.TuneID != nil {
+		var tuneID *int64
+
+		err = json.Unmarshal(input.TuneID, &tuneID)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("body contains incorrect JSON type for field \"tune_id\""))
+			return
+		}
+
+		marker.TuneID = tuneID
+	}
+
+	if input.Start != nil {
+		marker.Start = *input.Start
+	}
+
+	if input.End != nil {
+		marker.End = *input.End
+	}
+
+	if input.Label != nil {
+		marker.Label = *input.Label
+	}
+
+	v := validator.New()
+
+	if data.ValidateMarker(v, marker, rec); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Markers.Update(rec, marker)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTuneNotInBand):
+			v.AddError("tune_id", "must belong to the recording's band")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"marker": marker}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMarkerHandler(w http.ResponseWriter, r *http.Request) {
+	_, marker, ok := app.readMarkerForMember(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Markers.Delete(marker.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "marker successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSegmentsForTuneHandler(w http.ResponseWriter, r *http.Request) {
+	tune, ok := app.readTuneForMember(w, r)
+	if !ok {
+		return
+	}
+
+	segments, err := app.models.Markers.GetSegmentsForTune(tune.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tune_id": tune.ID, "segments": segments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMarkerForMember loads the recording and marker named by the :id and
+// :markerId parameters and checks that the requesting user is in the band
+// that owns them. It writes an error response and returns false if not.
+func (app *application) readMarkerForMember(w http.ResponseWriter, r *http.Request) (*data.Recording, *data.Marker, bool) {
+	rec, ok := app.readRecordingForMember(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	markerID, err := app.readIntParam("markerId", r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	marker, err := app.models.Markers.Get(markerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	if marker.RecordingID != rec.ID {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	return rec, marker, true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/abc"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// getTuneMIDIHandler plays the tune's ABC notation into a MIDI file. The
+// melody can be transposed by a number of semitones, and slowed down or sped
+// up by giving a bpm to use in place of the one in its Q: field.
+func (app *application) getTuneMIDIHandler(w http.ResponseWriter, r *http.Request) {
+	tune, ok := app.readTuneForMember(w, r)
+	if !ok {
+		return
+	}
+
+	if tune.ABC == "" {
+		app.missingABCResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	opts := abc.MIDIOptions{
+		Transpose: app.readInt(qs, "transpose", 0, v),
+		BPM:       float64(app.readInt(qs, "bpm", 0, v)),
+	}
+
+	v.Check(opts.Transpose >= -12 && opts.Transpose <= 12, "transpose", "must be between -12 and 12")
+
+	if qs.Has("bpm") {
+		v.Check(opts.BPM >= 20 && opts.BPM <= 400, "bpm", "must be between 20 and 400")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The ABC was checked when it was saved, so it should always parse.
+	parsed, err := abc.Parse(tune.ABC)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	name := artifactKey("abc", "mid", tune.ABC, opts)
+
+	path, err := app.cachedArtifact(name, func(w io.Writer) error {
+		return parsed.WriteMIDI(w, opts)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	title := tune.Title
+	if opts.Transpose != 0 {
+		title = fmt.Sprintf("%s (%+d)", title, opts.Transpose)
+	}
+
+	err = app.serveArtifact(w, r, path, "mid", title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/musicxml"
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/google/uuid"
+)
+
+// maxScoreUploadSize is the largest MusicXML import accepted. Compressed
+// scores are checked again as they are unpacked.
+const maxScoreUploadSize = 64 << 20
+
+// readMusicXML reads the score in a plain or compressed MusicXML file,
+// returning it along with the file type its contents match.
+func readMusicXML(f *os.File) (*musicxml.Score, string, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	header := make([]byte, 4)
+
+	n, err := f.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", err
+	}
+
+	fileType := "musicxml"
+	if musicxml.IsCompressed(header[:n]) {
+		fileType = "mxl"
+	}
+
+	score, err := musicxml.Read(f, stat.Size())
+	if err != nil {
+		return nil, "", err
+	}
+
+	return score, fileType, nil
+}
+
+// checkMusicXMLError adds an error to v if err means a file isn't a usable
+// MusicXML score, returning any other error.
+func checkMusicXMLError(v *validator.Validator, err error) error {
+	switch {
+	case errors.Is(err, musicxml.ErrNotMusicXML), errors.Is(err, musicxml.ErrMalformed):
+		v.AddError("file", "must be a valid MusicXML file")
+	case errors.Is(err, musicxml.ErrUnsupported):
+		v.AddError("file", "must be a score-partwise MusicXML file")
+	case errors.Is(err, musicxml.ErrTooLarge):
+		v.AddError("file", "must not unpack to more than 64MB")
+	default:
+		return err
+	}
+
+	return nil
+}
+
+// importMusicXMLHandler creates a tune from a MusicXML score, or updates an
+// existing one, and attaches the score to it as a document. The upload's info
+// names either the tune to update or the band to create a tune in. Keys and a
+// time signature may be given for scores that lack them.
+func (app *application) importMusicXMLHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TuneID             int64      `json:"tune_id"`
+		BandID             int64      `json:"band_id"`
+		Status             string     `json:"status"`
+		Title              string     `json:"title"`
+		Keys               []data.Key `json:"keys"`
+		TimeSignatureUpper int8       `json:"time_signature_upper"`
+		TimeSignatureLower int8       `json:"time_signature_lower"`
+		data.DocumentPart
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxScoreUploadSize)
+
+	id := uuid.New()
+	tmpPath := app.uploadPath(id.String())
+
+	user := app.contextGetUser(r)
+
+	var tune *data.Tune
+
+	checkInfo := func() (*storageAllowance, bool) {
+		v := validator.New()
+
+		v.Check(input.TuneID != 0 || input.BandID != 0, "tune_id", "must be provided if band_id is not")
+		v.Check(input.TuneID == 0 || input.BandID == 0, "band_id", "must not be provided with tune_id")
+		v.Check(input.TuneID == 0 || input.Status == "", "status", "must not be provided with tune_id")
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return nil, false
+		}
+
+		bandID := input.BandID
+
+		if input.TuneID != 0 {
+			var err error
+			tune, err = app.models.Tunes.Get(input.TuneID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					v.AddError("tune_id", "invalid tune ID supplied")
+					app.failedValidationResponse(w, r, v.Errors)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return nil, false
+			}
+
+			bandID = tune.BandID
+		}
+
+		userIsInBand, err := app.models.BandMembers.UserIsInBand(user.ID, bandID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+
+		if !userIsInBand {
+			app.notPermittedResponse(w, r)
+			return nil, false
+		}
+
+		return app.checkStorageQuota(w, r, user, bandID)
+	}
+
+	if !app.readUpload(w, r, &input, checkInfo, tmpPath) {
+		return
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		app.removeFile(tmpPath)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	score, fileType, err := readMusicXML(f)
+	f.Close()
+
+	if err != nil {
+		app.removeFile(tmpPath)
+
+		v := validator.New()
+
+		err = checkMusicXMLError(v, err)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	md := musicXMLTuneMetadata(score)
+
+	created := tune == nil
+
+	if created {
+		tune = &data.Tune{
+			Title:              score.Title,
+			Keys:               input.Keys,
+			TimeSignatureUpper: input.TimeSignatureUpper,
+			TimeSignatureLower: input.TimeSignatureLower,
+			BandID:             input.BandID,
+			Status:             input.Status,
+			CustomFields:       data.CustomFieldValues{},
+		}
+
+		if tune.Status == "" {
+			tune.Status = "germinating"
+		}
+	}
+
+	md.apply(tune, tuneMetadataFields)
+
+	if created && input.Title != "" {
+		tune.Title = input.Title
+	}
+
+	doc := &data.Document{
+		TuneID:   tune.ID,
+		OwnerID:  user.ID,
+		FileType: fileType,
+		Title:    tune.Title,
+
+		DocumentPart: input.DocumentPart,
+	}
+
+	if !created && input.Title != "" {
+		doc.Title = input.Title
+	}
+
+	customFields, err := app.models.CustomFields.GetAllForBand(tune.BandID)
+	if err != nil {
+		app.removeFile(tmpPath)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateTune(v, tune, customFields)
+	data.ValidateDocument(v, doc)
+
+	if !v.Valid() {
+		app.removeFile(tmpPath)
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if created {
+		err = app.models.Tunes.Insert(tune)
+	} else {
+		err = app.models.Tunes.Update(tune)
+	}
+
+	if err != nil {
+		app.removeFile(tmpPath)
+
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	doc.TuneID = tune.ID
+
+	err = app.storeDocument(doc, tmpPath)
+	if err != nil {
+		if created {
+			app.deleteTune(tune.ID)
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	headers := make(http.Header)
+
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/v1/tunes/%d", tune.ID))
+	}
+
+	err = app.writeJSON(w, status, envelope{"tune": tune, "doc": doc, "score": score}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTune removes a tune that was created as part of a request that then
+// failed, logging rather than returning any error since the request has
+// already failed.
+func (app *application) deleteTune(id int64) {
+	paths, err := app.models.Tunes.Delete(id)
+	if err != nil {
+		app.logger.Error(err.Error())
+		return
+	}
+
+	app.releaseFiles(paths)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/pdf"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// maxDocumentText is how much of a document's text is kept for searching.
+const maxDocumentText = 256 << 10
+
+// readPDF fills in a PDF document's page count, information dictionary and
+// text from its file. Files that aren't PDFs, or are encrypted or damaged
+// beyond reading, are refused with an error added to v.
+func (app *application) readPDF(doc *data.Document, tmpPath string, v *validator.Validator) error {
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	contents, err := pdf.ReadAll(f)
+	f.Close()
+
+	if err != nil {
+		switch {
+		case errors.Is(err, pdf.ErrTooLarge):
+			v.AddError("file", "must not be more than 100MB")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	r, err := pdf.Open(contents)
+	if err == nil {
+		var pages []*pdf.Page
+		pages, err = r.Pages()
+		doc.PageCount = len(pages)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, pdf.ErrNotPDF), errors.Is(err, pdf.ErrMalformed):
+			v.AddError("file", "must be a valid PDF file")
+			return nil
+		case errors.Is(err, pdf.ErrEncrypted):
+			v.AddError("file", "must not be encrypted or password protected")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if doc.PageCount == 0 {
+		v.AddError("file", "must have at least one page")
+		return nil
+	}
+
+	doc.PDFInfo = r.Info()
+
+	doc.Text, err = r.Text(maxDocumentText)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+var errStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// storageAllowance is how much more an upload may store, set by whichever of
+// the band's and the uploader's quotas has less room left.
+type storageAllowance struct {
+	remaining int64
+	quota     int64
+	scope     string
+}
+
+// storageAllowance returns what a user may upload to a band, or nil if
+// neither has a quota.
+//
+// Uploads running at the same time are each allowed the full remainder, so
+// together they can go a little over; the next upload is then refused.
+func (app *application) storageAllowance(user *data.User, bandID int64) (*storageAllowance, error) {
+	var allowance *storageAllowance
+
+	bandUsage, err := app.models.Quotas.GetForBand(bandID, app.config.quota.band)
+	if err != nil {
+		return nil, err
+	}
+
+	if bandUsage.Quota != nil {
+		allowance = &storageAllowance{remaining: *bandUsage.Remaining, quota: *bandUsage.Quota, scope: "band"}
+	}
+
+	// Uploads made with authentication turned off have no user to charge.
+	if user.IsAnonymous() {
+		return allowance, nil
+	}
+
+	userUsage, err := app.models.Quotas.GetForUser(user.ID, app.config.quota.user)
+	if err != nil {
+		return nil, err
+	}
+
+	if userUsage.Quota != nil && (allowance == nil || *userUsage.Remaining < allowance.remaining) {
+		allowance = &storageAllowance{remaining: *userUsage.Remaining, quota: *userUsage.Quota, scope: "user"}
+	}
+
+	return allowance, nil
+}
+
+// checkStorageQuota looks up what a user may upload to a band, sending an
+// error response and returning false if the quota is already used up.
+func (app *application) checkStorageQuota(w http.ResponseWriter, r *http.Request, user *data.User, bandID int64) (*storageAllowance, bool) {
+	allowance, err := app.storageAllowance(user, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if allowance != nil && allowance.remaining <= 0 {
+		app.storageQuotaExceededResponse(w, r, allowance)
+		return nil, false
+	}
+
+	return allowance, true
+}
+
+// quotaReader fails with errStorageQuotaExceeded as soon as more than the
+// allowance has been read, so an upload over quota is cut off part way
+// rather than stored and then thrown away.
+type quotaReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (qr *quotaReader) Read(p []byte) (int, error) {
+	n, err := qr.r.Read(p)
+
+	qr.left -= int64(n)
+	if qr.left < 0 {
+		return n, errStorageQuotaExceeded
+	}
+
+	return n, err
+}
+
+func (app *application) getBandStorageHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if !user.IsAdmin {
+		userInBand, err := app.models.BandMembers.UserIsInBand(user.ID, bandID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !userInBand {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	usage, err := app.models.Quotas.GetForBand(bandID, app.config.quota.band)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"storage": usage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMyStorageHandler(w http.ResponseWriter, r *http.Request) {
+	usage, err := app.models.Quotas.GetForUser(app.contextGetUser(r).ID, app.config.quota.user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"storage": usage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setBandQuotaHandler lets an admin set a band's quota in bytes. As with the
+// default quotas, 0 means no limit. A null quota restores the default.
+func (app *application) setBandQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	app.setQuota(w, r, app.models.Quotas.SetForBand)
+}
+
+// setUserQuotaHandler lets an admin set a user's quota in bytes. As with the
+// default quotas, 0 means no limit. A null quota restores the default.
+func (app *application) setUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	app.setQuota(w, r, app.models.Quotas.SetForUser)
+}
+
+func (app *application) setQuota(w http.ResponseWriter, r *http.Request, set func(id int64, quota *int64) error) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Quota *int64 `json:"quota"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateStorageQuota(v, input.Quota); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = set(id, input.Quota)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"quota": input.Quota}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
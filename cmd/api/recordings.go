@@ -0,0 +1,429 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"gazebo.njvanhaute.com/internal/audio"
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/google/uuid"
+)
+
+type recordingInput struct {
+	BandID   int64   `json:"band_id"`
+	TuneIDs  []int64 `json:"tune_ids"`
+	FileType string  `json:"file_type"`
+	Title    string  `json:"title"`
+}
+
+func (app *application) uploadRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	var input recordingInput
+
+	id := uuid.New()
+	tmpPath := app.uploadPath(id.String())
+
+	user := app.contextGetUser(r)
+
+	var rec *data.Recording
+
+	checkInfo := func() (*storageAllowance, bool) {
+		v := validator.New()
+
+		var err error
+		rec, err = app.newRecording(user, input, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return nil, false
+		}
+
+		return app.checkStorageQuota(w, r, user, rec.BandID)
+	}
+
+	if !app.readUpload(w, r, &input, checkInfo, tmpPath) {
+		return
+	}
+
+	v := validator.New()
+
+	err := app.finishRecording(rec, tmpPath, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/recordings/%d", rec.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"recording": rec}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newRecording builds a recording from upload metadata, checking that it is
+// valid and that the user is in its band. Problems with the metadata are
+// added to v.
+func (app *application) newRecording(user *data.User, input recordingInput, v *validator.Validator) (*data.Recording, error) {
+	rec := &data.Recording{
+		BandID:   input.BandID,
+		OwnerID:  user.ID,
+		FileType: input.FileType,
+		Title:    input.Title,
+		TuneIDs:  input.TuneIDs,
+
+		WaveformStatus: data.WaveformUnsupported,
+	}
+
+	if audio.CanDecode(rec.FileType) {
+		rec.WaveformStatus = data.WaveformPending
+	}
+
+	if data.ValidateRecording(v, rec); !v.Valid() {
+		return rec, nil
+	}
+
+	userIsInBand, err := app.models.BandMembers.UserIsInBand(user.ID, rec.BandID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !userIsInBand {
+		v.AddError("band_id", "you are not in this band")
+	}
+
+	return rec, nil
+}
+
+// finishRecording checks an uploaded recording's file, stores it and queues
+// its waveform. Problems with the file or the recording's tunes are added to
+// v; either way, nothing is left at tmpPath.
+func (app *application) finishRecording(rec *data.Recording, tmpPath string, v *validator.Validator) error {
+	err := app.probeRecording(rec, tmpPath, v)
+	if err != nil || !v.Valid() {
+		app.removeFile(tmpPath)
+		return err
+	}
+
+	err = app.storeRecording(rec, tmpPath)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTuneNotInBand):
+			v.AddError("tune_ids", "all tunes must belong to the recording's band")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if rec.WaveformStatus == data.WaveformPending {
+		app.background(func() {
+			app.generateWaveform(rec)
+		})
+	}
+
+	return nil
+}
+
+// probeRecording reads the stream details and tags from an uploaded
+// recording's file into rec. The file's contents decide its format, so an
+// error is added to v if it isn't audio or doesn't match rec.FileType.
+func (app *application) probeRecording(rec *data.Recording, tmpPath string, v *validator.Validator) error {
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := audio.Probe(f)
+	if err != nil {
+		switch {
+		case errors.Is(err, audio.ErrUnknownFormat), errors.Is(err, audio.ErrMalformed):
+			v.AddError("file", "must be a valid mp3, wav, flac or ogg file")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if info.Format != rec.FileType {
+		v.AddError("file_type", fmt.Sprintf("does not match the uploaded file, which is %s", info.Format))
+		return nil
+	}
+
+	rec.AudioInfo = data.AudioInfo{
+		Duration:      info.Duration,
+		SampleRate:    info.SampleRate,
+		Channels:      info.Channels,
+		Bitrate:       info.Bitrate,
+		BitsPerSample: info.BitsPerSample,
+		Tags:          info.Tags,
+	}
+
+	return nil
+}
+
+// storeRecording puts an uploaded file into storage and records the
+// recording, removing the file again if the recording can't be recorded. The
+// file is then scanned for malware in the background if a scanner is
+// configured.
+func (app *application) storeRecording(rec *data.Recording, tmpPath string) error {
+	key, err := app.storeUpload(tmpPath)
+	if err != nil {
+		app.removeFile(tmpPath)
+		return err
+	}
+
+	rec.FilePath = key
+	rec.ScanStatus = app.initialScanStatus()
+
+	err = app.models.Recordings.Insert(rec)
+	if err != nil {
+		app.releaseFile(key)
+		return err
+	}
+
+	if rec.ScanStatus == data.ScanPending {
+		// The scan updates the recording it is given, so it gets a copy of
+		// the one being sent back to the client.
+		scanned := *rec
+
+		app.background(func() {
+			app.scanRecording(&scanned)
+		})
+	}
+
+	return nil
+}
+
+func (app *application) listRecordingsForBandHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	recs, err := app.models.Recordings.GetAllForBand(bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"band_id": bandID, "recordings": recs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listRecordingsForTuneHandler(w http.ResponseWriter, r *http.Request) {
+	tune, ok := app.readTuneForMember(w, r)
+	if !ok {
+		return
+	}
+
+	recs, err := app.models.Recordings.GetAllForTune(tune.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tune_id": tune.ID, "recordings": recs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) downloadRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := app.readRecordingForMember(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkScanStatus(w, r, rec.ScanStatus) {
+		return
+	}
+
+	err := app.serveFile(w, r, rec.FilePath, rec.FileType, rec.Title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	rec, err := app.models.Recordings.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if rec.OwnerID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Recordings.Delete(rec.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.releaseFile(rec.FilePath)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "recording successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) linkRecordingToTunesHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := app.readRecordingForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TuneIDs []int64 `json:"tune_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.TuneIDs) >= 1, "tune_ids", "must contain at least 1 tune")
+
+	if data.ValidateRecordingTuneIDs(v, input.TuneIDs); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Recordings.LinkTunes(rec, input.TuneIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTuneNotInBand):
+			v.AddError("tune_ids", "all tunes must belong to the recording's band")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rec, err = app.models.Recordings.Get(rec.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recording": rec}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unlinkRecordingFromTuneHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := app.readRecordingForMember(w, r)
+	if !ok {
+		return
+	}
+
+	tuneID, err := app.readIntParam("tuneId", r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Recordings.UnlinkTune(rec.ID, tuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tune successfully unlinked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRecordingForMember loads the recording named by the :id parameter and
+// checks that the requesting user is in the band that owns it. It writes an
+// error response and returns false if either check fails.
+func (app *application) readRecordingForMember(w http.ResponseWriter, r *http.Request) (*data.Recording, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	rec, err := app.models.Recordings.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, rec.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return rec, true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/storage"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestDownloadRecordingScanStatus(t *testing.T) {
+	local := storage.NewLocal(t.TempDir())
+
+	err := local.Put(context.Background(), "blobs/ab/reel", strings.NewReader("ID3 reel"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{data.ScanClean, http.StatusOK},
+		{data.ScanUnscanned, http.StatusOK},
+		{data.ScanPending, http.StatusConflict},
+		{data.ScanInfected, http.StatusForbidden},
+		{data.ScanFailed, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		db := sql.OpenDB(fakeDB{
+			"recordings": {{
+				int64(1), int64(1), int64(1), time.Now(), "blobs/ab/reel", "mp3", "The Kesh",
+				float64(1), int64(44100), int64(2), int64(128000), int64(0), []byte("{}"),
+				data.WaveformUnsupported, tt.status, []byte("{}"),
+			}},
+			"band_members": {{int64(1)}},
+		})
+
+		app := &application{
+			logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+			models:  data.NewModels(db),
+			storage: local,
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/v1/recordings/1", nil)
+		r = app.contextSetUser(r, &data.User{ID: 1})
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "1"}}))
+
+		w := httptest.NewRecorder()
+		app.downloadRecordingHandler(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d; want %d: %s", tt.status, w.Code, tt.want, w.Body)
+		}
+
+		db.Close()
+	}
+}
@@ -23,12 +23,38 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id", app.requireActivatedUser(app.deleteTuneHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/bands/:id/tunes", app.requireActivatedUser(app.listTunesForBandHandler))
 
+	// Tune aliases
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/aliases", app.requireActivatedUser(app.listAliasesForTuneHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/aliases", app.requireActivatedUser(app.createAliasHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id/aliases/:aliasId", app.requireActivatedUser(app.deleteAliasHandler))
+
+	// Saved searches
+	router.HandlerFunc(http.MethodGet, "/v1/bands/:id/searches", app.requireActivatedUser(app.listSavedSearchesForBandHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/bands/:id/searches", app.requireActivatedUser(app.createSavedSearchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/searches/:id", app.requireActivatedUser(app.getSavedSearchHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/searches/:id", app.requireActivatedUser(app.updateSavedSearchHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/searches/:id", app.requireActivatedUser(app.deleteSavedSearchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/searches/:id/tunes", app.requireActivatedUser(app.executeSavedSearchHandler))
+
 	// Bands
 	router.HandlerFunc(http.MethodGet, "/v1/bands/:id", app.requireActivatedUser(app.getBandHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/bands", app.requireActivatedUser(app.createBandHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/bands/:id", app.requireActivatedUser(app.updateBandHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/bands/:id", app.requireActivatedUser(app.deleteBandHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/my/bands", app.requireActivatedUser(app.getMyBandsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/bands/:id/stats", app.requireActivatedUser(app.getBandStatsHandler))
+
+	// Storage quotas
+	router.HandlerFunc(http.MethodGet, "/v1/bands/:id/storage", app.requireActivatedUser(app.getBandStorageHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/bands/:id/quota", app.requireAdmin(app.setBandQuotaHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/my/storage", app.requireActivatedUser(app.getMyStorageHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/quota", app.requireAdmin(app.setUserQuotaHandler))
+
+	// Band custom fields
+	router.HandlerFunc(http.MethodGet, "/v1/bands/:id/fields", app.requireActivatedUser(app.listCustomFieldsForBandHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/bands/:id/fields", app.requireActivatedUser(app.createCustomFieldHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/bands/:id/fields/:fieldId", app.requireActivatedUser(app.updateCustomFieldHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/bands/:id/fields/:fieldId", app.requireActivatedUser(app.deleteCustomFieldHandler))
 
 	// Band members
 	router.HandlerFunc(http.MethodPost, "/v1/bands/:id/users", app.requireActivatedUser(app.addUserToBandHandler))
@@ -39,6 +65,8 @@ func (app *application) routes() http.Handler {
 	// Users
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/my/profile", app.requireActivatedUser(app.getMyProfileHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/my/profile", app.requireActivatedUser(app.updateMyProfileHandler))
 
 	// Authentication
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
@@ -46,8 +74,63 @@ func (app *application) routes() http.Handler {
 	// Documents
 	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/documents", app.requireActivatedUser(app.listDocumentsForTuneHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/documents/:id", app.requireActivatedUser(app.downloadDocumentHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/documents/:id", app.requireActivatedUser(app.downloadDocumentHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/documents", app.requireActivatedUser(app.uploadDocumentHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/documents/:id", app.requireActivatedUser(app.deleteDocumentHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/documents/:id/file", app.requireActivatedUser(app.replaceDocumentFileHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/documents/:id/versions", app.requireActivatedUser(app.listDocumentVersionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/documents/:id/versions/:version", app.requireActivatedUser(app.downloadDocumentVersionHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/documents/:id/versions/:version", app.requireActivatedUser(app.downloadDocumentVersionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/documents/:id/versions/:version/restore", app.requireActivatedUser(app.restoreDocumentVersionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/documents/:id/tune-metadata", app.requireActivatedUser(app.getDocumentTuneMetadataHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/documents/:id/tune-metadata", app.requireActivatedUser(app.applyDocumentTuneMetadataHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/documents/:id/thumbnail", app.requireActivatedUser(app.getDocumentThumbnailHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/documents/:id/thumbnail", app.requireActivatedUser(app.getDocumentThumbnailHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/imports/musicxml", app.requireActivatedUser(app.importMusicXMLHandler))
+
+	// Recordings
+	router.HandlerFunc(http.MethodGet, "/v1/bands/:id/recordings", app.requireActivatedUser(app.listRecordingsForBandHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/recordings", app.requireActivatedUser(app.listRecordingsForTuneHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/recordings/:id", app.requireActivatedUser(app.downloadRecordingHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/recordings/:id", app.requireActivatedUser(app.downloadRecordingHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/recordings", app.requireActivatedUser(app.uploadRecordingHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/recordings/:id", app.requireActivatedUser(app.deleteRecordingHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/recordings/:id/tunes", app.requireActivatedUser(app.linkRecordingToTunesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/recordings/:id/tunes/:tuneId", app.requireActivatedUser(app.unlinkRecordingFromTuneHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/recordings/:id/peaks", app.requireActivatedUser(app.getRecordingPeaksHandler))
+
+	// Recording markers
+	router.HandlerFunc(http.MethodGet, "/v1/recordings/:id/markers", app.requireActivatedUser(app.listMarkersForRecordingHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/recordings/:id/markers", app.requireActivatedUser(app.createMarkerHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/recordings/:id/markers/:markerId", app.requireActivatedUser(app.updateMarkerHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/recordings/:id/markers/:markerId", app.requireActivatedUser(app.deleteMarkerHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/segments", app.requireActivatedUser(app.listSegmentsForTuneHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/click", app.requireActivatedUser(app.getTuneClickTrackHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/tunes/:id/click", app.requireActivatedUser(app.getTuneClickTrackHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/midi", app.requireActivatedUser(app.getTuneMIDIHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/tunes/:id/midi", app.requireActivatedUser(app.getTuneMIDIHandler))
+
+	// Band books
+	router.HandlerFunc(http.MethodGet, "/v1/bands/:id/books", app.requireActivatedUser(app.listBandBooksForBandHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/bands/:id/books", app.requireActivatedUser(app.createBandBookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id", app.requireActivatedUser(app.getBandBookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", app.requireActivatedUser(app.deleteBandBookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/pdf", app.requireActivatedUser(app.downloadBandBookHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/books/:id/pdf", app.requireActivatedUser(app.downloadBandBookHandler))
+
+	// Resumable uploads
+	router.HandlerFunc(http.MethodOptions, "/v1/uploads", app.tusOptionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/uploads", app.requireActivatedUser(app.createUploadHandler))
+	router.HandlerFunc(http.MethodHead, "/v1/uploads/:id", app.requireActivatedUser(app.getUploadOffsetHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/uploads/:id", app.requireActivatedUser(app.patchUploadHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/uploads/:id", app.requireActivatedUser(app.terminateUploadHandler))
+
+	// Favorites
+	router.HandlerFunc(http.MethodPut, "/v1/tunes/:id/favorite", app.requireActivatedUser(app.favoriteTuneHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id/favorite", app.requireActivatedUser(app.unfavoriteTuneHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/documents/:id/favorite", app.requireActivatedUser(app.favoriteDocumentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/documents/:id/favorite", app.requireActivatedUser(app.unfavoriteDocumentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/my/favorites", app.requireActivatedUser(app.getMyFavoritesHandler))
 
 	// Metrics
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
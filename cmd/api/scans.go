@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/clamd"
+	"gazebo.njvanhaute.com/internal/data"
+)
+
+// scanRetryInterval is how often document versions and recordings that are
+// still waiting to be scanned, because clamd couldn't be reached, are tried
+// again.
+const scanRetryInterval = 5 * time.Minute
+
+// scanTarget identifies a row whose file is being scanned in activeScans.
+type scanTarget struct {
+	table string
+	id    int64
+}
+
+// initialScanStatus returns the scan status a newly uploaded file starts
+// with: pending if a scanner is configured, and unscanned otherwise.
+func (app *application) initialScanStatus() string {
+	if app.scanner == nil {
+		return data.ScanUnscanned
+	}
+
+	return data.ScanPending
+}
+
+// startScanner scans the document versions and recordings left pending when
+// the server last stopped, and then tries again every scanRetryInterval for
+// any that couldn't be scanned.
+func (app *application) startScanner() {
+	if app.scanner == nil {
+		return
+	}
+
+	app.background(app.scanPending)
+
+	go func() {
+		ticker := time.NewTicker(scanRetryInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			app.background(app.scanPending)
+		}
+	}()
+}
+
+func (app *application) scanPending() {
+	versions, err := app.models.Documents.GetVersionsPendingScan()
+	if err != nil {
+		app.logger.Error(err.Error())
+		return
+	}
+
+	for _, ver := range versions {
+		app.scanVersion(ver)
+	}
+
+	recs, err := app.models.Recordings.GetAllPendingScan()
+	if err != nil {
+		app.logger.Error(err.Error())
+		return
+	}
+
+	for _, rec := range recs {
+		app.scanRecording(rec)
+	}
+}
+
+// scanDocument scans the file of a document's latest version.
+func (app *application) scanDocument(doc *data.Document) {
+	ver, err := app.models.Documents.GetVersion(doc.ID, doc.Version)
+	if err != nil {
+		// The document was deleted before it could be scanned.
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error(err.Error(), "document_id", doc.ID)
+		}
+		return
+	}
+
+	app.scanVersion(ver)
+}
+
+// scanVersion scans a pending document version's file and records the
+// outcome. If clamd can't be reached, the version is left pending to be tried
+// again later.
+func (app *application) scanVersion(ver *data.DocumentVersion) {
+	if ver.ScanStatus != data.ScanPending {
+		return
+	}
+
+	if _, busy := app.activeScans.LoadOrStore(scanTarget{"document_versions", ver.ID}, struct{}{}); busy {
+		return
+	}
+
+	defer app.activeScans.Delete(scanTarget{"document_versions", ver.ID})
+
+	oldPath := ver.FilePath
+
+	status, path, ok := app.scanFile(oldPath, "document_id", ver.DocumentID, "version", ver.Version)
+	if !ok {
+		return
+	}
+
+	err := app.models.Documents.SetScanStatus(ver, status, path)
+	app.finishScan(oldPath, path, err, "document_id", ver.DocumentID, "version", ver.Version)
+}
+
+// scanRecording scans a pending recording's file and records the outcome, as
+// scanVersion does for document versions.
+func (app *application) scanRecording(rec *data.Recording) {
+	if rec.ScanStatus != data.ScanPending {
+		return
+	}
+
+	if _, busy := app.activeScans.LoadOrStore(scanTarget{"recordings", rec.ID}, struct{}{}); busy {
+		return
+	}
+
+	defer app.activeScans.Delete(scanTarget{"recordings", rec.ID})
+
+	oldPath := rec.FilePath
+
+	status, path, ok := app.scanFile(oldPath, "recording_id", rec.ID)
+	if !ok {
+		return
+	}
+
+	err := app.models.Recordings.SetScanStatus(rec, status, path)
+	app.finishScan(oldPath, path, err, "recording_id", rec.ID)
+}
+
+// scanFile scans a stored file, returning the scan status to record for it
+// and the path it should then be held at. Infected files are copied into
+// quarantine, and their quarantined copy returned. It returns false if the
+// file couldn't be scanned and should be tried again later. args identify
+// whatever holds the file in anything logged.
+func (app *application) scanFile(key string, args ...any) (string, string, bool) {
+	app.scanLimiter <- struct{}{}
+	defer func() { <-app.scanLimiter }()
+
+	result, err := app.scanStoredFile(key)
+
+	var clamdErr *clamd.Error
+
+	switch {
+	case errors.As(err, &clamdErr):
+		app.logger.Warn("file could not be scanned", append(args, "error", clamdErr.Message)...)
+		return data.ScanFailed, key, true
+	case err != nil:
+		app.logger.Error(err.Error(), args...)
+		return "", "", false
+	case result.Infected:
+		app.logger.Warn("infected file quarantined", append(args, "signature", result.Signature)...)
+
+		path := data.QuarantineKey(key)
+
+		err = app.copyStoredFile(key, path)
+		if err != nil {
+			app.logger.Error(err.Error(), args...)
+			return "", "", false
+		}
+
+		return data.ScanInfected, path, true
+	}
+
+	return data.ScanClean, key, true
+}
+
+// finishScan releases whichever of a scanned file and its quarantined copy is
+// no longer held, once the outcome of the scan has been recorded with the
+// error err.
+func (app *application) finishScan(oldPath, path string, err error, args ...any) {
+	if err != nil {
+		// Another row with the same file may have been quarantined already,
+		// in which case the copy is in use.
+		if path != oldPath {
+			app.releaseFile(path)
+		}
+
+		// The row was deleted, or scanned by someone else, in the meantime.
+		if !errors.Is(err, data.ErrEditConflict) {
+			app.logger.Error(err.Error(), args...)
+		}
+		return
+	}
+
+	if path != oldPath {
+		app.releaseFile(oldPath)
+	}
+}
+
+// scanStoredFile streams a stored file to clamd. The verdict is only
+// returned if the whole file was sent.
+func (app *application) scanStoredFile(key string) (*clamd.Result, error) {
+	f, err := app.storage.Open(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	cr := &countingReader{r: f}
+
+	result, err := app.scanner.Scan(context.Background(), cr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cr.n != f.Size() {
+		return nil, fmt.Errorf("scanned %d of the %d bytes of %s", cr.n, f.Size(), key)
+	}
+
+	return result, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// copyStoredFile copies a stored file to another key.
+func (app *application) copyStoredFile(from, to string) error {
+	f, err := app.storage.Open(context.Background(), from)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return app.storage.Put(context.Background(), to, f, f.Size())
+}
+
+// checkScanStatus sends an error response and returns false unless a file
+// with the given scan status may be downloaded.
+func (app *application) checkScanStatus(w http.ResponseWriter, r *http.Request, status string) bool {
+	switch status {
+	case data.ScanClean, data.ScanUnscanned:
+		return true
+	case data.ScanPending:
+		app.scanPendingResponse(w, r)
+	case data.ScanInfected:
+		app.fileQuarantinedResponse(w, r)
+	default:
+		app.scanFailedResponse(w, r)
+	}
+
+	return false
+}
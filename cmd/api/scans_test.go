@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/clamd"
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/storage"
+)
+
+// okClamd starts a clamd that reads each stream in full and finds it clean.
+func okClamd(t *testing.T) *clamd.Client {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				br := bufio.NewReader(conn)
+				br.ReadString(0)
+
+				for {
+					var n uint32
+					if binary.Read(br, binary.BigEndian, &n) != nil {
+						return
+					}
+
+					if n == 0 {
+						break
+					}
+
+					io.CopyN(io.Discard, br, int64(n))
+				}
+
+				conn.Write([]byte("stream: OK\x00"))
+			}()
+		}
+	}()
+
+	c, err := clamd.New(l.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// shortStorage reports every file as longer than it is, as happens when a
+// read is cut short without an error.
+type shortStorage struct {
+	storage.Storage
+}
+
+func (s shortStorage) Open(ctx context.Context, key string) (storage.File, error) {
+	f, err := s.Storage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return shortFile{f}, nil
+}
+
+type shortFile struct {
+	storage.File
+}
+
+func (f shortFile) Size() int64 {
+	return f.File.Size() + 10
+}
+
+func TestScanStoredFile(t *testing.T) {
+	local := storage.NewLocal(t.TempDir())
+
+	body := bytes.Repeat([]byte("chart "), 50000)
+
+	err := local.Put(context.Background(), "blobs/ab/file", bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage:     local,
+		scanner:     okClamd(t),
+		scanLimiter: make(chan struct{}, 1),
+	}
+
+	result, err := app.scanStoredFile("blobs/ab/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Infected {
+		t.Error("got infected; want clean")
+	}
+
+	status, path, ok := app.scanFile("blobs/ab/file")
+	if status != data.ScanClean || path != "blobs/ab/file" || !ok {
+		t.Errorf("scanFile: got %q, %q, %v; want clean at the same path", status, path, ok)
+	}
+
+	app.storage = shortStorage{local}
+
+	_, err = app.scanStoredFile("blobs/ab/file")
+	if err == nil || !strings.Contains(err.Error(), "scanned 300000 of the 300010 bytes") {
+		t.Errorf("got error %v; want the scan to fail for a short read", err)
+	}
+
+	if _, _, ok = app.scanFile("blobs/ab/file"); ok {
+		t.Error("scanFile of a short read: got ok; want the file left pending")
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+func (app *application) createSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(user.ID, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name         string                 `json:"name"`
+		Shared       bool                   `json:"shared"`
+		Title        string                 `json:"title"`
+		Keys         []data.Key             `json:"keys"`
+		Statuses     []string               `json:"statuses"`
+		CustomFields data.CustomFieldValues `json:"custom_fields"`
+		Sort         string                 `json:"sort"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	search := &data.SavedSearch{
+		BandID:       bandID,
+		UserID:       user.ID,
+		Name:         input.Name,
+		Shared:       input.Shared,
+		Title:        input.Title,
+		Keys:         keysToStrings(input.Keys),
+		Statuses:     input.Statuses,
+		CustomFields: input.CustomFields,
+		Sort:         input.Sort,
+	}
+
+	if search.Statuses == nil {
+		search.Statuses = []string{}
+	}
+
+	if search.CustomFields == nil {
+		search.CustomFields = data.CustomFieldValues{}
+	}
+
+	if search.Sort == "" {
+		search.Sort = "id"
+	}
+
+	fields, err := app.models.CustomFields.GetAllForBand(bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateSavedSearch(v, search, fields)
+	v.Check(validator.PermittedValue(search.Sort, tuneSortSafelist(fields)...), "sort", "invalid sort value")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.SavedSearches.Insert(search)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/searches/%d", search.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"search": search}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSavedSearchesForBandHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(user.ID, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	searches, err := app.models.SavedSearches.GetAllVisibleToUser(bandID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"band_id": bandID, "searches": searches}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := app.readVisibleSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"search": search}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	search, err := app.models.SavedSearches.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if search.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name         *string                `json:"name"`
+		Shared       *bool                  `json:"shared"`
+		Title        *string                `json:"title"`
+		Keys         []data.Key             `json:"keys"`
+		Statuses     []string               `json:"statuses"`
+		CustomFields data.CustomFieldValues `json:"custom_fields"`
+		Sort         *string                `json:"sort"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		search.Name = *input.Name
+	}
+
+	if input.Shared != nil {
+		search.Shared = *input.Shared
+	}
+
+	if input.Title != nil {
+		search.Title = *input.Title
+	}
+
+	if input.Keys != nil {
+		search.Keys = keysToStrings(input.Keys)
+	}
+
+	if input.Statuses != nil {
+		search.Statuses = input.Statuses
+	}
+
+	if input.CustomFields != nil {
+		search.CustomFields = input.CustomFields
+	}
+
+	if input.Sort != nil {
+		search.Sort = *input.Sort
+	}
+
+	fields, err := app.models.CustomFields.GetAllForBand(search.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateSavedSearch(v, search, fields)
+	v.Check(validator.PermittedValue(search.Sort, tuneSortSafelist(fields)...), "sort", "invalid sort value")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.SavedSearches.Update(search)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"search": search}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	search, err := app.models.SavedSearches.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if search.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.SavedSearches.Delete(search.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "search successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// executeSavedSearchHandler runs a saved search against the band's tunes,
+// using the same query as listTunesForBandHandler so results are always live.
+func (app *application) executeSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	search, ok := app.readVisibleSavedSearch(w, r)
+	if !ok {
+		return
+	}
+
+	fields, err := app.models.CustomFields.GetAllForBand(search.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.Sort = search.Sort
+	filters.SortSafelist = tuneSortSafelist(fields)
+
+	data.ValidateSavedSearch(v, search, fields)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	tunes, metadata, err := app.models.Tunes.GetAll(search.BandID, user.ID, search.Title, search.Keys, search.Statuses, search.CustomFields, false, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"search": search, "tunes": tunes, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readVisibleSavedSearch loads the search named by the :id parameter and
+// checks that the requesting user can see it: either they created it, or it
+// has been shared with a band they belong to. It writes an error response and
+// returns false if either check fails.
+func (app *application) readVisibleSavedSearch(w http.ResponseWriter, r *http.Request) (*data.SavedSearch, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	search, err := app.models.SavedSearches.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	if search.UserID != user.ID && !search.Shared {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(user.ID, search.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return search, true
+}
+
+func keysToStrings(keys []data.Key) []string {
+	s := make([]string, len(keys))
+
+	for i, key := range keys {
+		s[i] = string(key)
+	}
+
+	return s
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+func (app *application) getBandStatsHandler(w http.ResponseWriter, r *http.Request) {
+	bandID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	// Both bounds are inclusive dates; the upper bound is turned into an
+	// exclusive timestamp at the start of the following day.
+	from := app.readDate(qs, "from", v)
+	to := app.readDate(qs, "to", v)
+
+	if from != nil && to != nil {
+		v.Check(!to.Before(*from), "to", "must not be before from")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var until *time.Time
+	if to != nil {
+		t := to.AddDate(0, 0, 1)
+		until = &t
+	}
+
+	stats, err := app.models.Stats.GetForBand(bandID, from, until)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The ETag covers the figures but not the generation time, so a client
+	// revalidating unchanged stats gets a 304.
+	js, err := json.Marshal(stats)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(js))
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+	headers.Set("Cache-Control", "private, max-age=300")
+
+	if r.Header.Get("If-None-Match") == etag {
+		for key, value := range headers {
+			w.Header()[key] = value
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	env := envelope{
+		"stats":        stats,
+		"generated_at": time.Now().UTC().Truncate(time.Second),
+	}
+
+	if from != nil {
+		env["from"] = from.Format(time.DateOnly)
+	}
+
+	if to != nil {
+		env["to"] = to.Format(time.DateOnly)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/storage"
+)
+
+// storedPrefixes are the key prefixes the reconciler looks through: blobs,
+// quarantined files, and the directories files were kept in before they were
+// named by their contents.
+var storedPrefixes = []string{"blobs/", "quarantine/", "docs/", "recordings/", "books/"}
+
+// staleUploadAge is how old a leftover file in the upload directory must be
+// before it is taken to be from an upload that crashed.
+const staleUploadAge = 24 * time.Hour
+
+// storageReport lists what a pass of the storage reconciler found, and
+// removed unless it was a dry run.
+type storageReport struct {
+	DryRun        bool           `json:"dry_run"`
+	OrphanedFiles []string       `json:"orphaned_files"`
+	MissingFiles  []data.FileRef `json:"missing_files"`
+	DeletedRows   int            `json:"deleted_rows"`
+	UnusedBlobs   []string       `json:"unused_blobs"`
+	StaleUploads  []string       `json:"stale_uploads"`
+}
+
+// startStorageReconciler converts any files left from before files were
+// named by their contents, reconciles storage with the database, and then
+// reconciles again every configured interval.
+func (app *application) startStorageReconciler() {
+	app.background(func() {
+		app.convertLegacyFiles()
+		app.runStorageReconciler()
+	})
+
+	if app.config.gc.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(app.config.gc.interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			app.background(app.runStorageReconciler)
+		}
+	}()
+}
+
+// runStorageReconciler reconciles storage and logs what was found. A pass
+// that starts while another is still running is skipped.
+func (app *application) runStorageReconciler() {
+	if !app.gcMutex.TryLock() {
+		return
+	}
+
+	defer app.gcMutex.Unlock()
+
+	report, err := app.reconcileStorage(app.config.gc.dryRun)
+	if err != nil {
+		app.logger.Error(err.Error())
+		return
+	}
+
+	app.logger.Info("storage reconciled",
+		"dry_run", report.DryRun,
+		"orphaned_files", len(report.OrphanedFiles),
+		"missing_files", len(report.MissingFiles),
+		"deleted_rows", report.DeletedRows,
+		"unused_blobs", len(report.UnusedBlobs),
+		"stale_uploads", len(report.StaleUploads),
+	)
+}
+
+// reconcileStorage looks for stored files that no row refers to, rows that
+// refer to files that aren't stored, blobs that are no longer used and files
+// left in the upload directory by uploads that crashed. Unless dryRun is
+// set, the files are deleted.
+//
+// Rows whose files are missing are only reported, since a misconfigured
+// store would otherwise take users' documents and their histories with it.
+// They are deleted, as data.BlobModel.DeleteFileRef describes, only if
+// -gc-delete-missing is set, and then no more than -gc-max-deleted-rows of
+// them in a pass. Files newer than data.BlobGracePeriod are
+// left alone, since their rows may not have been recorded yet.
+func (app *application) reconcileStorage(dryRun bool) (*storageReport, error) {
+	report := &storageReport{
+		DryRun:        dryRun,
+		OrphanedFiles: []string{},
+		MissingFiles:  []data.FileRef{},
+		UnusedBlobs:   []string{},
+		StaleUploads:  []string{},
+	}
+
+	// Rows are read before files are listed: a file is always stored before
+	// the row that refers to it, so a row's file can't be missed.
+	refs, err := app.models.Blobs.GetFileRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	stored := map[string]storage.Info{}
+
+	for _, prefix := range storedPrefixes {
+		err = app.storage.List(ctx, prefix, func(key string, info storage.Info) error {
+			stored[key] = info
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	referenced := map[string]bool{}
+
+	for _, ref := range refs {
+		key, err := storage.CleanKey(ref.Path)
+		if err != nil {
+			app.logger.Error(err.Error(), "table", ref.Table, "id", ref.ID, "file_path", ref.Path)
+			continue
+		}
+
+		referenced[key] = true
+
+		if _, ok := stored[key]; !ok {
+			report.MissingFiles = append(report.MissingFiles, ref)
+		}
+	}
+
+	deleteMissing := app.config.gc.deleteMissing && !dryRun
+
+	// Storage that holds no files at all is more likely to be misconfigured
+	// than to have lost everything, so nothing is deleted on its say-so.
+	if len(stored) == 0 && len(report.MissingFiles) > 0 && deleteMissing {
+		app.logger.Error("storage holds no files, so rows referring to missing files are kept")
+		deleteMissing = false
+	}
+
+	for _, ref := range report.MissingFiles {
+		app.logger.Warn("missing file", "table", ref.Table, "id", ref.ID, "file_path", ref.Path)
+
+		if !deleteMissing {
+			continue
+		}
+
+		if report.DeletedRows >= app.config.gc.maxDeletedRows {
+			app.logger.Error("too many rows refer to missing files, so the rest are kept until the next pass", "max_deleted_rows", app.config.gc.maxDeletedRows)
+			deleteMissing = false
+			continue
+		}
+
+		err = app.models.Blobs.DeleteFileRef(ref)
+		if err != nil {
+			app.logger.Error(err.Error(), "table", ref.Table, "id", ref.ID)
+			continue
+		}
+
+		report.DeletedRows++
+	}
+
+	unused, err := app.models.Blobs.GetUnused()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range unused {
+		report.UnusedBlobs = append(report.UnusedBlobs, hash)
+
+		if !dryRun {
+			app.releaseFile(data.BlobKey(hash))
+		}
+	}
+
+	cutoff := time.Now().Add(-data.BlobGracePeriod)
+
+	for key, info := range stored {
+		if referenced[key] || info.ModTime.After(cutoff) {
+			continue
+		}
+
+		// Blobs with records are left to their reference counts: either
+		// they were released above, or something still uses them.
+		if hash, ok := data.BlobHash(key); ok {
+			_, err := app.models.Blobs.Get(hash)
+			if err == nil {
+				continue
+			}
+
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				return nil, err
+			}
+		}
+
+		report.OrphanedFiles = append(report.OrphanedFiles, key)
+		app.logger.Info("orphaned file", "key", key, "dry_run", dryRun)
+
+		if !dryRun {
+			app.deleteStoredFile(key)
+		}
+	}
+
+	stale, err := app.staleUploads()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range stale {
+		report.StaleUploads = append(report.StaleUploads, path)
+		app.logger.Info("stale upload", "path", path, "dry_run", dryRun)
+
+		if !dryRun {
+			app.removeFile(path)
+		}
+	}
+
+	return report, nil
+}
+
+// staleUploads returns the paths of files in the upload directory that were
+// left by uploads that crashed: resumable uploads that no longer exist, and
+// anything else that has been there too long to belong to a request still
+// being handled.
+func (app *application) staleUploads() ([]string, error) {
+	entries, err := os.ReadDir(app.config.storage.uploadDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	paths := []string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		age := time.Since(info.ModTime())
+
+		if id, ok := strings.CutPrefix(entry.Name(), "tus-"); ok {
+			if age < data.BlobGracePeriod {
+				continue
+			}
+
+			_, err := app.models.Uploads.Get(id)
+			if err == nil {
+				continue
+			}
+
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				return nil, err
+			}
+		} else if age < staleUploadAge {
+			continue
+		}
+
+		paths = append(paths, filepath.Join(app.config.storage.uploadDir, entry.Name()))
+	}
+
+	return paths, nil
+}
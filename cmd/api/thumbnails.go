@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/images"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// Thumbnail sizes, as the longest side in pixels.
+var thumbnailSizes = map[string]int{
+	"small": 256,
+	"large": 1024,
+}
+
+func isImageType(fileType string) bool {
+	return fileType == images.FormatJPEG || fileType == images.FormatPNG || fileType == images.FormatWebP
+}
+
+// sanitizeImage rewrites an uploaded image without its metadata, such as
+// where a photo was taken, and turned the right way up. The document's type
+// is updated if the image had to be converted. Problems with the file are
+// added to v.
+func (app *application) sanitizeImage(doc *data.Document, tmpPath string, v *validator.Validator) error {
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	contents, err := images.ReadAll(f)
+	f.Close()
+
+	if err != nil {
+		switch {
+		case errors.Is(err, images.ErrTooLarge):
+			v.AddError("file", fmt.Sprintf("must not be more than %d bytes", images.MaxFileSize))
+			return nil
+		default:
+			return err
+		}
+	}
+
+	format := images.Format(contents)
+	if format == "" {
+		v.AddError("file", "must be a valid jpg, png or webp file")
+		return nil
+	}
+
+	if format != doc.FileType {
+		v.AddError("file_type", fmt.Sprintf("does not match the uploaded file, which is %s", format))
+		return nil
+	}
+
+	// Decoding is CPU-heavy, so only let a few run at once.
+	app.imageLimiter <- struct{}{}
+	defer func() { <-app.imageLimiter }()
+
+	sanitized, format, err := images.Sanitize(contents)
+	if err != nil {
+		switch {
+		case errors.Is(err, images.ErrMalformed):
+			v.AddError("file", "must be a valid jpg, png or webp file")
+			return nil
+		case errors.Is(err, images.ErrTooLarge):
+			v.AddError("file", fmt.Sprintf("must not be more than %d pixels", images.MaxPixels))
+			return nil
+		default:
+			return err
+		}
+	}
+
+	err = os.WriteFile(tmpPath, sanitized, 0600)
+	if err != nil {
+		return err
+	}
+
+	doc.FileType = format
+
+	return nil
+}
+
+// thumbnail returns the path of a document's thumbnail at the given size,
+// making it first if need be.
+func (app *application) thumbnail(doc *data.Document, size int) (string, error) {
+	name := artifactKey("thumbnail", "jpg", doc.FilePath, size)
+
+	return app.cachedArtifact(name, func(w io.Writer) error {
+		f, err := app.storage.Open(context.Background(), doc.FilePath)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		contents, err := images.ReadAll(f)
+		if err != nil {
+			return err
+		}
+
+		app.imageLimiter <- struct{}{}
+		defer func() { <-app.imageLimiter }()
+
+		return images.WriteThumbnail(w, contents, size)
+	})
+}
+
+// generateThumbnails makes a newly uploaded image's thumbnails ahead of them
+// being asked for. It is meant to be run in the background, so failures are
+// logged; the thumbnails are tried again when they are requested.
+func (app *application) generateThumbnails(doc *data.Document) {
+	for _, size := range thumbnailSizes {
+		_, err := app.thumbnail(doc, size)
+		if err != nil {
+			app.logger.Error(err.Error(), "document_id", doc.ID)
+			return
+		}
+	}
+}
+
+func (app *application) getDocumentThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	doc, _, ok := app.readDocumentForMember(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	size := app.readString(r.URL.Query(), "size", "small")
+	v.Check(validator.PermittedValue(size, "small", "large"), "size", "must be small or large")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !isImageType(doc.FileType) {
+		app.noThumbnailResponse(w, r)
+		return
+	}
+
+	if !app.checkScanStatus(w, r, doc.ScanStatus) {
+		return
+	}
+
+	path, err := app.thumbnail(doc, thumbnailSizes[size])
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.serveArtifact(w, r, path, images.FormatJPEG, doc.Title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
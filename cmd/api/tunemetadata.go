@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/midi"
+	"gazebo.njvanhaute.com/internal/musicxml"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// Tune fields that can be filled in from a document.
+const (
+	tuneFieldKeys          = "keys"
+	tuneFieldTimeSignature = "time_signature"
+	tuneFieldComposer      = "composer"
+	tuneFieldTempo         = "tempo"
+)
+
+var tuneMetadataFields = []string{tuneFieldKeys, tuneFieldTimeSignature, tuneFieldComposer, tuneFieldTempo}
+
+type timeSignature struct {
+	Upper int8 `json:"upper"`
+	Lower int8 `json:"lower"`
+}
+
+// tuneMetadataChange is a tune field whose value in a document differs from
+// the tune's.
+type tuneMetadataChange struct {
+	Current  any `json:"current"`
+	Proposed any `json:"proposed"`
+}
+
+// midiSummary is what was found in a MIDI file's header and meta events.
+type midiSummary struct {
+	Format         uint16                    `json:"format"`
+	Tracks         int                       `json:"tracks"`
+	TrackNames     []string                  `json:"track_names"`
+	TimeSignatures []midi.TimeSignatureEvent `json:"time_signatures"`
+	KeySignatures  []midi.KeySignatureEvent  `json:"key_signatures"`
+	Tempos         []midi.TempoEvent         `json:"tempos"`
+}
+
+// tuneMetadata is the tune metadata read from a document, along with a
+// summary of where it came from.
+type tuneMetadata struct {
+	source        any
+	keys          []data.Key
+	timeSignature *timeSignature
+	composer      string
+	tempo         int32
+}
+
+// readTuneMetadata reads tune metadata from a document's file. It returns
+// false if metadata can't be read from files of the document's type.
+func (app *application) readTuneMetadata(doc *data.Document) (*tuneMetadata, bool, error) {
+	switch doc.FileType {
+	case "mid":
+		md, err := app.readMIDITuneMetadata(doc.FilePath)
+		return md, true, err
+	case "musicxml", "mxl":
+		md, err := app.readMusicXMLTuneMetadata(doc.FilePath)
+		return md, true, err
+	default:
+		return nil, false, nil
+	}
+}
+
+func (app *application) readMIDITuneMetadata(key string) (*tuneMetadata, error) {
+	f, err := app.storage.Open(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	file, err := midi.Read(f)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &tuneMetadata{
+		source: midiSummary{
+			Format:         file.Format,
+			Tracks:         len(file.Tracks),
+			TrackNames:     file.TrackNames(),
+			TimeSignatures: file.TimeSignatures(),
+			KeySignatures:  file.KeySignatures(),
+			Tempos:         file.Tempos(),
+		},
+	}
+
+	for _, sig := range file.KeySignatures() {
+		key, ok := data.KeyFromSignature(sig.Sharps, sig.Minor)
+		if ok && !slices.Contains(md.keys, key) {
+			md.keys = append(md.keys, key)
+		}
+	}
+
+	// A tune has one time signature, so the first is taken to be it.
+	for _, sig := range file.TimeSignatures() {
+		if sig.Upper > 1 && sig.Upper <= 127 && sig.Lower > 1 && sig.Lower <= 64 {
+			md.timeSignature = &timeSignature{int8(sig.Upper), int8(sig.Lower)}
+			break
+		}
+	}
+
+	return md, nil
+}
+
+func (app *application) readMusicXMLTuneMetadata(key string) (*tuneMetadata, error) {
+	// Compressed scores are read out of order, so the file is fetched whole
+	// rather than a piece at a time.
+	contents, err := app.readStoredFile(key)
+	if err != nil {
+		return nil, err
+	}
+
+	score, err := musicxml.Read(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return nil, err
+	}
+
+	return musicXMLTuneMetadata(score), nil
+}
+
+func musicXMLTuneMetadata(score *musicxml.Score) *tuneMetadata {
+	md := &tuneMetadata{
+		source:   score,
+		composer: score.Composer,
+		tempo:    int32(math.Round(score.Tempo)),
+	}
+
+	// Tunes only have major and minor keys, so other modes are left out.
+	if score.Key != nil {
+		var key data.Key
+		var ok bool
+
+		switch score.Key.Mode {
+		case "", "major", "ionian":
+			key, ok = data.KeyFromSignature(score.Key.Fifths, false)
+		case "minor", "aeolian":
+			key, ok = data.KeyFromSignature(score.Key.Fifths, true)
+		}
+
+		if ok {
+			md.keys = []data.Key{key}
+		}
+	}
+
+	if score.Time != nil && score.Time.Beats > 1 && score.Time.Beats <= 127 && score.Time.BeatType > 1 && score.Time.BeatType <= 64 {
+		md.timeSignature = &timeSignature{int8(score.Time.Beats), int8(score.Time.BeatType)}
+	}
+
+	return md
+}
+
+// changes compares the metadata with the tune, returning the fields where
+// they differ. Fields the document says nothing about are left out.
+func (md *tuneMetadata) changes(tune *data.Tune) map[string]tuneMetadataChange {
+	changes := map[string]tuneMetadataChange{}
+
+	if md.keys != nil && !slices.Equal(md.keys, tune.Keys) {
+		changes[tuneFieldKeys] = tuneMetadataChange{
+			Current:  tune.Keys,
+			Proposed: md.keys,
+		}
+	}
+
+	current := timeSignature{tune.TimeSignatureUpper, tune.TimeSignatureLower}
+
+	if md.timeSignature != nil && *md.timeSignature != current {
+		changes[tuneFieldTimeSignature] = tuneMetadataChange{
+			Current:  current,
+			Proposed: *md.timeSignature,
+		}
+	}
+
+	if md.composer != "" && md.composer != tune.Composer {
+		changes[tuneFieldComposer] = tuneMetadataChange{
+			Current:  tune.Composer,
+			Proposed: md.composer,
+		}
+	}
+
+	if md.tempo > 0 && md.tempo != tune.Tempo {
+		changes[tuneFieldTempo] = tuneMetadataChange{
+			Current:  tune.Tempo,
+			Proposed: md.tempo,
+		}
+	}
+
+	return changes
+}
+
+// apply sets the given fields of the tune from the metadata.
+func (md *tuneMetadata) apply(tune *data.Tune, fields []string) {
+	for _, field := range fields {
+		switch field {
+		case tuneFieldKeys:
+			if md.keys != nil {
+				tune.Keys = md.keys
+			}
+		case tuneFieldTimeSignature:
+			if md.timeSignature != nil {
+				tune.TimeSignatureUpper = md.timeSignature.Upper
+				tune.TimeSignatureLower = md.timeSignature.Lower
+			}
+		case tuneFieldComposer:
+			if md.composer != "" {
+				tune.Composer = md.composer
+			}
+		case tuneFieldTempo:
+			if md.tempo > 0 {
+				tune.Tempo = md.tempo
+			}
+		}
+	}
+}
+
+// getDocumentTuneMetadataHandler previews the changes to its tune that
+// applying a document's metadata would make.
+func (app *application) getDocumentTuneMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	doc, tune, ok := app.readDocumentForMember(w, r)
+	if !ok {
+		return
+	}
+
+	md, supported, err := app.readTuneMetadata(doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !supported {
+		app.noTuneMetadataResponse(w, r)
+		return
+	}
+
+	env := envelope{
+		"document_id":  doc.ID,
+		"tune_id":      tune.ID,
+		"tune_version": tune.Version,
+		"source":       md.source,
+		"changes":      md.changes(tune),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// applyDocumentTuneMetadataHandler fills in the tune's fields from its
+// document's metadata. The tune version from the preview must be given, so
+// that the changes applied are the ones that were shown.
+func (app *application) applyDocumentTuneMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	doc, tune, ok := app.readDocumentForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TuneVersion *int32   `json:"tune_version"`
+		Fields      []string `json:"fields"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.TuneVersion != nil, "tune_version", "must be provided")
+	v.Check(validator.Unique(input.Fields), "fields", "must not contain duplicate values")
+
+	for _, field := range input.Fields {
+		v.Check(validator.PermittedValue(field, tuneMetadataFields...), "fields", "must only contain keys, time_signature, composer or tempo")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if *input.TuneVersion != tune.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	md, supported, err := app.readTuneMetadata(doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !supported {
+		app.noTuneMetadataResponse(w, r)
+		return
+	}
+
+	changes := md.changes(tune)
+
+	fields := input.Fields
+	if fields == nil {
+		fields = tuneMetadataFields
+	}
+
+	applied := []string{}
+	for _, field := range fields {
+		if _, ok := changes[field]; ok {
+			applied = append(applied, field)
+		}
+	}
+
+	md.apply(tune, applied)
+
+	if len(applied) > 0 {
+		customFields, err := app.models.CustomFields.GetAllForBand(tune.BandID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if data.ValidateTune(v, tune, customFields); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = app.models.Tunes.Update(tune)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tune": tune, "applied": applied}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -11,12 +11,16 @@ import (
 
 func (app *application) createTuneHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title              string     `json:"title"`
-		Keys               []data.Key `json:"keys"`
-		TimeSignatureUpper int8       `json:"time_signature_upper"`
-		TimeSignatureLower int8       `json:"time_signature_lower"`
-		BandID             int64      `json:"band_id"`
-		Status             string     `json:"status"`
+		Title              string                 `json:"title"`
+		Keys               []data.Key             `json:"keys"`
+		TimeSignatureUpper int8                   `json:"time_signature_upper"`
+		TimeSignatureLower int8                   `json:"time_signature_lower"`
+		BandID             int64                  `json:"band_id"`
+		Status             string                 `json:"status"`
+		CustomFields       data.CustomFieldValues `json:"custom_fields"`
+		Composer           string                 `json:"composer"`
+		Tempo              int32                  `json:"tempo"`
+		ABC                string                 `json:"abc"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -32,11 +36,27 @@ func (app *application) createTuneHandler(w http.ResponseWriter, r *http.Request
 		TimeSignatureLower: input.TimeSignatureLower,
 		BandID:             input.BandID,
 		Status:             input.Status,
+		CustomFields:       data.CustomFieldValues{},
+		Composer:           input.Composer,
+		Tempo:              input.Tempo,
+		ABC:                input.ABC,
+	}
+
+	for name, value := range input.CustomFields {
+		if value != nil {
+			tune.CustomFields[name] = value
+		}
+	}
+
+	fields, err := app.models.CustomFields.GetAllForBand(tune.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
 
-	if data.ValidateTune(v, tune); !v.Valid() {
+	if data.ValidateTune(v, tune, fields); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -99,11 +119,15 @@ func (app *application) updateTuneHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	var input struct {
-		Title              *string    `json:"title"`
-		Keys               []data.Key `json:"keys"`
-		TimeSignatureUpper *int8      `json:"time_signature_upper"`
-		TimeSignatureLower *int8      `json:"time_signature_lower"`
-		Status             *string    `json:"status"`
+		Title              *string                `json:"title"`
+		Keys               []data.Key             `json:"keys"`
+		TimeSignatureUpper *int8                  `json:"time_signature_upper"`
+		TimeSignatureLower *int8                  `json:"time_signature_lower"`
+		Status             *string                `json:"status"`
+		CustomFields       data.CustomFieldValues `json:"custom_fields"`
+		Composer           *string                `json:"composer"`
+		Tempo              *int32                 `json:"tempo"`
+		ABC                *string                `json:"abc"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -132,9 +156,41 @@ func (app *application) updateTuneHandler(w http.ResponseWriter, r *http.Request
 		tune.Status = *input.Status
 	}
 
+	if input.Composer != nil {
+		tune.Composer = *input.Composer
+	}
+
+	if input.Tempo != nil {
+		tune.Tempo = *input.Tempo
+	}
+
+	if input.ABC != nil {
+		tune.ABC = *input.ABC
+	}
+
+	// Custom fields are merged into the existing values; a null value clears
+	// the field.
+	for name, value := range input.CustomFields {
+		if tune.CustomFields == nil {
+			tune.CustomFields = data.CustomFieldValues{}
+		}
+
+		if value == nil {
+			delete(tune.CustomFields, name)
+		} else {
+			tune.CustomFields[name] = value
+		}
+	}
+
+	fields, err := app.models.CustomFields.GetAllForBand(tune.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
 
-	if data.ValidateTune(v, tune); !v.Valid() {
+	if data.ValidateTune(v, tune, fields); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -163,10 +219,18 @@ func (app *application) listTunesForBandHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	fields, err := app.models.CustomFields.GetAllForBand(bandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	var input struct {
-		Title    string
-		Keys     []string
-		Statuses []string
+		Title         string
+		Keys          []string
+		Statuses      []string
+		CustomFields  data.CustomFieldValues
+		FavoritedOnly bool
 		data.Filters
 	}
 
@@ -176,19 +240,23 @@ func (app *application) listTunesForBandHandler(w http.ResponseWriter, r *http.R
 	input.Title = app.readString(qs, "title", "")
 	input.Keys = app.readCSV(qs, "keys", []string{})
 	input.Statuses = app.readCSV(qs, "statuses", []string{})
+	input.CustomFields = app.readCustomFieldFilters(qs, fields, v)
+	input.FavoritedOnly = app.readBool(qs, "favorited_only", false, v)
 
 	input.Page = app.readInt(qs, "page", 1, v)
 	input.PageSize = app.readInt(qs, "page_size", 20, v)
 
 	input.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "band_id", "title", "status", "-id", "-band_id", "-title", "-status"}
+	input.Filters.SortSafelist = tuneSortSafelist(fields)
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	tunes, metadata, err := app.models.Tunes.GetAll(bandID, input.Title, input.Keys, input.Statuses, input.Filters)
+	user := app.contextGetUser(r)
+
+	tunes, metadata, err := app.models.Tunes.GetAll(bandID, user.ID, input.Title, input.Keys, input.Statuses, input.CustomFields, input.FavoritedOnly, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -231,7 +299,7 @@ func (app *application) deleteTuneHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Tunes.Delete(id)
+	paths, err := app.models.Tunes.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -242,8 +310,59 @@ func (app *application) deleteTuneHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.background(func() {
+		app.releaseFiles(paths)
+	})
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tune successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// tuneSortSafelist returns the permitted sort values for a band's tune list,
+// including ascending and descending sorts on each of its custom fields.
+func tuneSortSafelist(fields []*data.CustomField) []string {
+	safelist := []string{"id", "band_id", "title", "status", "-id", "-band_id", "-title", "-status"}
+
+	for _, field := range fields {
+		safelist = append(safelist, "cf."+field.Name, "-cf."+field.Name)
+	}
+
+	return safelist
+}
+
+// readTuneForMember loads the tune named by the :id parameter and checks that
+// the requesting user is in the band that owns it. It writes an error
+// response and returns false if either check fails.
+func (app *application) readTuneForMember(w http.ResponseWriter, r *http.Request) (*data.Tune, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	userInBand, err := app.models.BandMembers.UserIsInBand(app.contextGetUser(r).ID, tune.BandID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !userInBand {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return tune, true
+}
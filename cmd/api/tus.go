@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Resumable uploads follow the tus 1.0 protocol (https://tus.io), with the
+// creation, termination and expiration extensions. A client creates an upload
+// with the same JSON metadata as a single-shot upload, base64-encoded in the
+// "info" key of Upload-Metadata alongside a "kind" of document or recording,
+// then sends the file in as many PATCH requests as it needs.
+//
+// An upload's partial file is kept in the upload directory of the instance
+// that created it, so when several instances serve the API, -upload-dir must
+// be a volume they share. A PATCH that reaches an instance without the file
+// is answered with 404 Not Found, and the client starts a new upload.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+
+	maxUploadSize = 2 << 30
+
+	// Uploads that go this long without progress are abandoned.
+	uploadExpiry = 24 * time.Hour
+
+	// expiredUploadInterval is how often abandoned uploads are removed.
+	expiredUploadInterval = time.Hour
+)
+
+func (app *application) tusOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.checkTusResumable(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 1 {
+		app.badRequestResponse(w, r, errors.New("the Upload-Length header must be a positive integer"))
+		return
+	}
+
+	if length > maxUploadSize {
+		app.uploadTooLargeResponse(w, r, maxUploadSize)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	upload := &data.Upload{
+		ID:        uuid.New().String(),
+		OwnerID:   app.contextGetUser(r).ID,
+		ExpiresAt: time.Now().Add(uploadExpiry),
+		Kind:      metadata["kind"],
+		Info:      json.RawMessage(metadata["info"]),
+		Length:    length,
+	}
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(upload.Kind, data.UploadKindDocument, data.UploadKindRecording), "kind", "must be document or recording")
+	v.Check(len(upload.Info) > 0, "info", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Check the metadata now so that the client finds out about problems
+	// before sending the file. It is checked again once the file is in.
+	bandID, err := app.checkUploadInfo(app.contextGetUser(r), upload, v)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkUploadQuota(w, r, upload, bandID) {
+		return
+	}
+
+	err = os.MkdirAll(app.config.storage.uploadDir, 0700)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	file, err := os.OpenFile(app.tusFilePath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	file.Close()
+
+	err = app.models.Uploads.Insert(upload)
+	if err != nil {
+		app.removeFile(app.tusFilePath(upload.ID))
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Location", "/v1/uploads/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (app *application) getUploadOffsetHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.checkTusResumable(w, r) {
+		return
+	}
+
+	upload, ok := app.readUploadForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+
+	if upload.Resource != "" {
+		w.Header().Set("Upload-Resource", upload.Resource)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) patchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.checkTusResumable(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, "the Content-Type header must be application/offset+octet-stream")
+		return
+	}
+
+	upload, ok := app.readUploadForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		app.badRequestResponse(w, r, errors.New("the Upload-Offset header must be a non-negative integer"))
+		return
+	}
+
+	// Only one request may write to an upload at a time.
+	if _, busy := app.activeUploads.LoadOrStore(upload.ID, struct{}{}); busy {
+		app.uploadLockedResponse(w, r)
+		return
+	}
+
+	defer app.activeUploads.Delete(upload.ID)
+
+	// Another request may have written to the upload before this one got
+	// the lock, so read its progress again.
+	upload, err = app.models.Uploads.Get(upload.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if offset != upload.Offset || upload.Resource != "" {
+		app.uploadOffsetMismatchResponse(w, r, upload.Offset)
+		return
+	}
+
+	// Metadata that is no longer valid is reported once the file is in, when
+	// the upload is finished.
+	v := validator.New()
+
+	bandID, err := app.checkUploadInfo(app.contextGetUser(r), upload, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if v.Valid() && !app.checkUploadQuota(w, r, upload, bandID) {
+		return
+	}
+
+	file, err := os.OpenFile(app.tusFilePath(upload.ID), os.O_WRONLY, 0600)
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	defer file.Close()
+
+	// Anything past the recorded offset was written by a request that
+	// failed before it could record its progress, so can't be trusted.
+	err = file.Truncate(upload.Offset)
+	if err == nil {
+		_, err = file.Seek(upload.Offset, io.SeekStart)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	body := app.newDeadlineReader(w, r.Body)
+	remaining := upload.Length - upload.Offset
+
+	// Keep whatever arrived even if the connection drops, so the client can
+	// resume from there.
+	n, copyErr := io.Copy(file, io.LimitReader(body, remaining))
+
+	err = file.Sync()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	upload.ExpiresAt = time.Now().Add(uploadExpiry)
+
+	err = app.models.Uploads.UpdateOffset(upload, upload.Offset+n)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.uploadLockedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if copyErr != nil {
+		app.badRequestResponse(w, r, copyErr)
+		return
+	}
+
+	// Allow time to process the file, however long the upload took.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+
+	if upload.Offset == upload.Length {
+		file.Close()
+
+		v := validator.New()
+
+		err = app.finishUpload(app.contextGetUser(r), upload, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		w.Header().Set("Upload-Resource", upload.Resource)
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) terminateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.checkTusResumable(w, r) {
+		return
+	}
+
+	upload, ok := app.readUploadForOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if _, busy := app.activeUploads.LoadOrStore(upload.ID, struct{}{}); busy {
+		app.uploadLockedResponse(w, r)
+		return
+	}
+
+	defer app.activeUploads.Delete(upload.ID)
+
+	err := app.models.Uploads.Delete(upload.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.removeFile(app.tusFilePath(upload.ID))
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkUploadInfo decodes an upload's metadata and checks it in the same way
+// as a single-shot upload's, adding any problems to v. It returns the ID of
+// the band the file is for.
+func (app *application) checkUploadInfo(user *data.User, upload *data.Upload, v *validator.Validator) (int64, error) {
+	switch upload.Kind {
+	case data.UploadKindDocument:
+		var input documentInput
+
+		err := decodeUploadInfo(upload.Info, &input)
+		if err != nil {
+			return 0, err
+		}
+
+		_, tune, err := app.newDocument(user, input, v)
+		if err != nil || !v.Valid() {
+			return 0, err
+		}
+
+		return tune.BandID, nil
+	default:
+		var input recordingInput
+
+		err := decodeUploadInfo(upload.Info, &input)
+		if err != nil {
+			return 0, err
+		}
+
+		rec, err := app.newRecording(user, input, v)
+		if err != nil || !v.Valid() {
+			return 0, err
+		}
+
+		return rec.BandID, nil
+	}
+}
+
+// checkUploadQuota sends an error response and returns false if the whole of
+// an upload won't fit in the quota of the user or their band. It is checked
+// when the upload is created and again before each part is sent, since other
+// files may have been stored in between.
+func (app *application) checkUploadQuota(w http.ResponseWriter, r *http.Request, upload *data.Upload, bandID int64) bool {
+	allowance, ok := app.checkStorageQuota(w, r, app.contextGetUser(r), bandID)
+	if !ok {
+		return false
+	}
+
+	if allowance != nil && upload.Length > allowance.remaining {
+		app.storageQuotaExceededResponse(w, r, allowance)
+		return false
+	}
+
+	return true
+}
+
+// finishUpload hands a completed upload to the same logic as a single-shot
+// upload, checking its metadata and the user's permissions afresh. On
+// success upload.Resource is set; if the file is rejected, problems are added
+// to v and the upload is discarded.
+func (app *application) finishUpload(user *data.User, upload *data.Upload, v *validator.Validator) error {
+	var err error
+
+	tmpPath := app.tusFilePath(upload.ID)
+
+	switch upload.Kind {
+	case data.UploadKindDocument:
+		var input documentInput
+
+		err = decodeUploadInfo(upload.Info, &input)
+		if err != nil {
+			return err
+		}
+
+		doc, _, err := app.newDocument(user, input, v)
+		if err != nil {
+			return err
+		}
+
+		if v.Valid() {
+			err = app.finishDocument(doc, tmpPath, v)
+			if err != nil {
+				return err
+			}
+		}
+
+		if v.Valid() {
+			upload.Resource = fmt.Sprintf("/v1/documents/%d", doc.ID)
+		}
+	default:
+		var input recordingInput
+
+		err = decodeUploadInfo(upload.Info, &input)
+		if err != nil {
+			return err
+		}
+
+		rec, err := app.newRecording(user, input, v)
+		if err != nil {
+			return err
+		}
+
+		if v.Valid() {
+			err = app.finishRecording(rec, tmpPath, v)
+			if err != nil {
+				return err
+			}
+		}
+
+		if v.Valid() {
+			upload.Resource = fmt.Sprintf("/v1/recordings/%d", rec.ID)
+		}
+	}
+
+	if !v.Valid() {
+		app.removeFile(tmpPath)
+		return app.models.Uploads.Delete(upload.ID)
+	}
+
+	return app.models.Uploads.Complete(upload)
+}
+
+// startUploadExpirer removes abandoned uploads now and then every
+// expiredUploadInterval.
+func (app *application) startUploadExpirer() {
+	app.background(app.removeExpiredUploads)
+
+	go func() {
+		ticker := time.NewTicker(expiredUploadInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			app.background(app.removeExpiredUploads)
+		}
+	}()
+}
+
+// removeExpiredUploads deletes abandoned uploads and their partial files.
+func (app *application) removeExpiredUploads() {
+	ids, err := app.models.Uploads.DeleteExpired()
+	if err != nil {
+		app.logger.Error(err.Error())
+		return
+	}
+
+	for _, id := range ids {
+		app.removeFile(app.tusFilePath(id))
+	}
+}
+
+// readUploadForOwner loads the upload named by the :id parameter. Uploads
+// belonging to other users are reported as not found.
+func (app *application) readUploadForOwner(w http.ResponseWriter, r *http.Request) (*data.Upload, bool) {
+	id, err := uuid.Parse(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	upload, err := app.models.Uploads.Get(id.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if upload.OwnerID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// checkTusResumable rejects requests made with a tus version other than the
+// one supported.
+func (app *application) checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		app.errorResponse(w, r, http.StatusPreconditionFailed, fmt.Sprintf("the Tus-Resumable header must be %s", tusVersion))
+		return false
+	}
+
+	return true
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated
+// pairs of a key and an optional base64-encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+
+		if key == "" {
+			return nil, errors.New("the Upload-Metadata header contains an empty key")
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("the Upload-Metadata value for %q is not valid base64", key)
+		}
+
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+func decodeUploadInfo(info json.RawMessage, dst any) error {
+	dec := json.NewDecoder(bytes.NewReader(info))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return handleJSONDecodingErrors(err)
+	}
+
+	return nil
+}
+
+func (app *application) tusFilePath(id string) string {
+	return app.uploadPath("tus-" + id)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// uploadIdleTimeout is how long an upload may go without receiving any data.
+// It replaces the server's read timeout, which is far too short for a whole
+// file.
+const uploadIdleTimeout = 30 * time.Second
+
+// readUpload reads a multipart upload made up of an "info" part holding the
+// upload's JSON metadata, which is decoded into info, and a "file" part, which
+// is streamed to tmpPath. checkInfo is called as soon as the metadata has been
+// decoded so that a request can be rejected before its file is read; it
+// should write an error response and return false to stop the upload.
+// Otherwise it returns how much the upload may store, or nil for no limit,
+// and the file is cut off once it goes over.
+//
+// readUpload returns false if the upload was stopped, in which case an error
+// response has already been sent and nothing is left at tmpPath.
+func (app *application) readUpload(w http.ResponseWriter, r *http.Request, info any, checkInfo func() (*storageAllowance, bool), tmpPath string) bool {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	err = os.MkdirAll(app.config.storage.uploadDir, 0700)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	gotFile, gotMetadata := false, false
+	numParts := 0
+
+	var allowance *storageAllowance
+
+	ok := false
+	defer func() {
+		if !ok {
+			app.removeFile(tmpPath)
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+
+		if part.FormName() == "info" {
+			dec := json.NewDecoder(part)
+			dec.DisallowUnknownFields()
+
+			err = dec.Decode(info)
+			if err != nil {
+				app.badRequestResponse(w, r, handleJSONDecodingErrors(err))
+				return false
+			}
+
+			var allowed bool
+
+			allowance, allowed = checkInfo()
+			if !allowed {
+				return false
+			}
+
+			// A file sent ahead of its metadata couldn't be cut off, so it
+			// is checked against the quota now instead.
+			if gotFile && allowance != nil {
+				stat, err := os.Stat(tmpPath)
+				if err != nil {
+					app.serverErrorResponse(w, r, err)
+					return false
+				}
+
+				if stat.Size() > allowance.remaining {
+					app.storageQuotaExceededResponse(w, r, allowance)
+					return false
+				}
+			}
+
+			gotMetadata = true
+		}
+
+		if part.FormName() == "file" {
+			outfile, err := os.Create(tmpPath)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return false
+			}
+
+			body := app.newDeadlineReader(w, part)
+			if allowance != nil {
+				body = &quotaReader{r: body, left: allowance.remaining}
+			}
+
+			_, err = io.Copy(outfile, body)
+			outfile.Close()
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+
+				switch {
+				case errors.As(err, &maxBytesError):
+					app.uploadTooLargeResponse(w, r, maxBytesError.Limit)
+				case errors.Is(err, errStorageQuotaExceeded):
+					app.storageQuotaExceededResponse(w, r, allowance)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return false
+			}
+
+			gotFile = true
+		}
+
+		numParts += 1
+	}
+
+	if !gotFile {
+		app.missingFileResponse(w, r)
+		return false
+	}
+
+	if numParts != 2 {
+		app.wrongNumberOfPartsResponse(w, r)
+		return false
+	}
+
+	if !gotMetadata {
+		app.missingMetadataResponse(w, r)
+		return false
+	}
+
+	ok = true
+	return true
+}
+
+// deadlineReader pushes back the connection's read deadline each time data
+// arrives, so that a large upload is only cut off if it stalls.
+type deadlineReader struct {
+	r  io.Reader
+	rc *http.ResponseController
+}
+
+func (app *application) newDeadlineReader(w http.ResponseWriter, r io.Reader) io.Reader {
+	dr := &deadlineReader{
+		r:  r,
+		rc: http.NewResponseController(w),
+	}
+
+	dr.extend()
+
+	return dr
+}
+
+func (dr *deadlineReader) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	if n > 0 {
+		dr.extend()
+	}
+
+	return n, err
+}
+
+func (dr *deadlineReader) extend() {
+	// Not every ResponseWriter supports deadlines; those that don't are left
+	// with the server's timeouts.
+	deadline := time.Now().Add(uploadIdleTimeout)
+
+	dr.rc.SetReadDeadline(deadline)
+	dr.rc.SetWriteDeadline(deadline.Add(uploadIdleTimeout))
+}
+
+// uploadPath returns the local path an upload in progress is written to.
+func (app *application) uploadPath(name string) string {
+	return filepath.Join(app.config.storage.uploadDir, name)
+}
+
+// readStoredFile returns the whole of a stored file.
+func (app *application) readStoredFile(key string) ([]byte, error) {
+	f, err := app.storage.Open(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	contents := make([]byte, f.Size())
+
+	_, err = io.ReadFull(f, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
+// deleteStoredFile removes a file from storage, logging rather than
+// returning any error since callers have already finished with the request
+// by this point.
+func (app *application) deleteStoredFile(key string) {
+	err := app.storage.Delete(context.Background(), key)
+	if err != nil {
+		app.logger.Error(err.Error(), "key", key)
+	}
+}
+
+// removeFile removes a local file, logging rather than returning any error
+// since callers have already finished with the request by this point.
+func (app *application) removeFile(path string) {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		app.logger.Error(err.Error())
+	}
+}
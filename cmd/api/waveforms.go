@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gazebo.njvanhaute.com/internal/audio"
+	"gazebo.njvanhaute.com/internal/data"
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// Waveform resolutions in samples per pixel. Each must be a multiple of the
+// first, since the coarser ones are built from it.
+var waveformResolutions = []int{256, 1024, 4096}
+
+const defaultWaveformResolution = 1024
+
+// waveformJSON is audiowaveform's JSON waveform format.
+type waveformJSON struct {
+	Version         int    `json:"version"`
+	Channels        int    `json:"channels"`
+	SampleRate      int    `json:"sample_rate"`
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Bits            int    `json:"bits"`
+	Length          int    `json:"length"`
+	Data            []int8 `json:"data"`
+}
+
+// generateWaveform decodes a recording and stores its peaks at each of the
+// waveform resolutions. It is meant to be run in the background, so failures
+// are logged and recorded against the recording rather than returned.
+func (app *application) generateWaveform(rec *data.Recording) {
+	// Decoding is CPU-heavy, so only let a few run at once.
+	app.waveformLimiter <- struct{}{}
+	defer func() { <-app.waveformLimiter }()
+
+	err := app.computeWaveform(rec)
+	if err == nil || errors.Is(err, data.ErrRecordNotFound) {
+		return
+	}
+
+	app.logger.Error(err.Error(), "recording_id", rec.ID)
+
+	status := data.WaveformFailed
+	if errors.Is(err, audio.ErrCannotDecode) {
+		status = data.WaveformUnsupported
+	}
+
+	err = app.models.Recordings.SetWaveformStatus(rec.ID, status)
+	if err != nil {
+		app.logger.Error(err.Error(), "recording_id", rec.ID)
+	}
+}
+
+func (app *application) computeWaveform(rec *data.Recording) error {
+	file, err := app.storage.Open(context.Background(), rec.FilePath)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	computed, err := audio.ComputePeaks(file, waveformResolutions)
+	if err != nil {
+		return fmt.Errorf("generating waveform: %w", err)
+	}
+
+	peaks := make([]*data.Peaks, len(computed))
+
+	for i, p := range computed {
+		peaks[i] = &data.Peaks{
+			RecordingID:     rec.ID,
+			SampleRate:      p.SampleRate,
+			SamplesPerPixel: p.SamplesPerPixel,
+			Data:            p.Data,
+		}
+	}
+
+	return app.models.Peaks.ReplaceAll(rec.ID, peaks)
+}
+
+// generatePendingWaveforms picks up recordings whose waveforms were never
+// generated, such as those uploaded just before the server last stopped.
+func (app *application) generatePendingWaveforms() {
+	app.background(func() {
+		recs, err := app.models.Recordings.GetAllWithPendingWaveforms()
+		if err != nil {
+			app.logger.Error(err.Error())
+			return
+		}
+
+		for _, rec := range recs {
+			app.generateWaveform(rec)
+		}
+	})
+}
+
+// getRecordingPeaksHandler serves a recording's waveform in audiowaveform's
+// JSON format (version 2, one channel, 8 bits).
+func (app *application) getRecordingPeaksHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := app.readRecordingForMember(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	resolution := app.readInt(r.URL.Query(), "resolution", defaultWaveformResolution, v)
+	v.Check(validator.PermittedValue(resolution, waveformResolutions...), "resolution", fmt.Sprintf("must be one of %v", waveformResolutions))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	switch rec.WaveformStatus {
+	case data.WaveformReady:
+	case data.WaveformPending:
+		app.waveformPendingResponse(w, r)
+		return
+	default:
+		app.waveformUnavailableResponse(w, r)
+		return
+	}
+
+	peaks, err := app.models.Peaks.Get(rec.ID, resolution)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The data array can run to millions of values, so it is written compactly
+	// rather than through writeJSON, which would put each on its own line.
+	js, err := json.Marshal(waveformJSON{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      peaks.SampleRate,
+		SamplesPerPixel: peaks.SamplesPerPixel,
+		Bits:            8,
+		Length:          len(peaks.Data) / 2,
+		Data:            peaks.Data,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Peaks never change once generated.
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+}
@@ -11,6 +11,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
 	golang.org/x/crypto v0.26.0
+	golang.org/x/image v0.19.0
 	golang.org/x/time v0.6.0
 )
 
@@ -0,0 +1,189 @@
+// Package abc parses tunes written in ABC notation and renders their melody
+// as a Standard MIDI File.
+//
+// Only what is needed to play the melody back is kept: notes, rests, chords,
+// ties, tuplets, broken rhythm, repeats and numbered endings, and changes of
+// key, meter, unit note length and tempo. Decorations, chord symbols, grace
+// notes, lyrics and slurs are accepted and ignored. When a tune has several
+// voices only the first is played.
+package abc
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Meter is a time signature. A free meter (M:none) has Upper and Lower set to
+// zero.
+type Meter struct {
+	Upper int
+	Lower int
+}
+
+func (m Meter) free() bool {
+	return m.Upper == 0 || m.Lower == 0
+}
+
+// barLength is the length of a bar in whole notes.
+func (m Meter) barLength() float64 {
+	if m.free() {
+		return 1
+	}
+
+	return float64(m.Upper) / float64(m.Lower)
+}
+
+// Key is a key signature, given as a count of sharps (negative for flats)
+// like a MIDI key signature event. Modal keys are given the signature of
+// their relative major; only Aeolian is marked as minor. Extra holds any
+// explicit accidentals added to the signature, by note letter.
+type Key struct {
+	Sharps int
+	Minor  bool
+	Extra  map[byte]int
+}
+
+// Tempo is a number of beats per minute, each Beat long in whole notes.
+type Tempo struct {
+	Beat float64
+	BPM  float64
+}
+
+// quartersPerMinute converts the tempo into quarter notes per minute.
+func (t Tempo) quartersPerMinute() float64 {
+	return t.BPM * t.Beat * 4
+}
+
+// Tune is a parsed ABC tune. Meter, Key and Tempo are those in force at the
+// start of the tune; any changes part way through are kept with its notes.
+type Tune struct {
+	Title   string
+	Meter   Meter
+	Key     Key
+	Tempo   Tempo
+	Program int
+
+	elements []element
+}
+
+// Error is a syntax error, reported against the line it was found on.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse parses the first tune in s. Anything before its X: field is skipped,
+// as is anything after the blank line that ends it.
+func Parse(s string) (*Tune, error) {
+	p := &parser{
+		tune: &Tune{
+			Meter: Meter{4, 4},
+			Tempo: Tempo{Beat: 0.25, BPM: 120},
+		},
+		meter:    Meter{4, 4},
+		lastNote: -1,
+	}
+
+	seenX := !strings.HasPrefix(s, "X:") && !strings.Contains(s, "\nX:")
+	gotUnitLength := false
+
+	sc := bufio.NewScanner(strings.NewReader(s))
+	sc.Buffer(make([]byte, 0, 4096), len(s)+1)
+
+	for sc.Scan() {
+		p.line++
+		line := strings.TrimRight(sc.Text(), " \t\r")
+
+		if !seenX {
+			seenX = strings.HasPrefix(line, "X:")
+			if !seenX {
+				continue
+			}
+		}
+
+		if rest, ok := strings.CutPrefix(line, "%%MIDI program"); ok {
+			var program int
+			_, err := fmt.Sscan(rest, &program)
+			if err != nil || program < 0 || program > 127 {
+				return nil, p.errorf("invalid MIDI program")
+			}
+			p.tune.Program = program
+			continue
+		}
+
+		if i := strings.IndexByte(line, '%'); i >= 0 {
+			line = line[:i]
+		}
+
+		if strings.TrimSpace(line) == "" {
+			// A blank line ends the tune, but comment lines don't.
+			if p.inBody && strings.TrimSpace(sc.Text()) == "" {
+				break
+			}
+			continue
+		}
+
+		// Note letters can't start a field line in the body, so that a line
+		// such as "A:|" is read as music.
+		if isField(line) && !(p.inBody && isNoteLetter(line[0])) {
+			name, value := line[0], strings.TrimSpace(line[2:])
+
+			if !p.inBody {
+				switch name {
+				case 'T':
+					if p.tune.Title == "" {
+						p.tune.Title = value
+					}
+					continue
+				case 'L':
+					gotUnitLength = true
+				case 'K':
+					// The default unit note length depends on the meter.
+					if !gotUnitLength {
+						p.unitLength = 1.0 / 8
+						if !p.meter.free() && p.meter.barLength() < 0.75 {
+							p.unitLength = 1.0 / 16
+						}
+					}
+					p.inBody = true
+				}
+			}
+
+			err := p.field(name, value)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !p.inBody {
+			// Free text in the header is ignored.
+			continue
+		}
+
+		err := p.body(line)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if !p.inBody {
+		return nil, &Error{Line: p.line, Msg: "no K: field"}
+	}
+
+	return p.tune, nil
+}
+
+// isField reports whether a line is an information field such as "K:G".
+func isField(line string) bool {
+	return len(line) >= 2 && line[1] == ':' && isLetter(line[0])
+}
@@ -0,0 +1,550 @@
+package abc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type elementKind int
+
+const (
+	elemNote elementKind = iota
+	elemBar
+	elemEnding
+	elemMeter
+	elemKey
+	elemTempo
+)
+
+// element is one item of a tune's body. Notes, rests and chords are all
+// elemNote; a rest has no pitches. Lengths are in whole notes.
+type element struct {
+	kind elementKind
+
+	pitches []int
+	length  float64
+	tie     bool
+
+	// Bar lines.
+	repeatEnd   bool
+	repeatStart bool
+	double      bool
+
+	endings []int
+	meter   Meter
+	key     Key
+	tempo   Tempo
+}
+
+type parser struct {
+	tune *Tune
+	line int
+
+	meter      Meter
+	key        Key
+	unitLength float64
+
+	// Accidentals written earlier in the bar, by pitch without them.
+	barAccidentals map[int]int
+
+	lastNote      int
+	brokenFactor  float64
+	tupletLeft    int
+	tupletFactor  float64
+	inBody        bool
+	firstVoice    string
+	skipVoice     bool
+	skipToBarLine bool
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &Error{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) add(e element) {
+	if p.skipVoice {
+		return
+	}
+
+	p.tune.elements = append(p.tune.elements, e)
+}
+
+// body parses a line of music.
+func (p *parser) body(line string) error {
+	s := line
+	i := 0
+
+	for i < len(s) {
+		c := s[i]
+
+		if p.skipToBarLine && c != '|' && c != ':' {
+			i++
+			continue
+		}
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\\' || c == '$' || c == '`' || c == 'y' || c == ')':
+			i++
+
+		case strings.IndexByte(".~HLMOPSTuv", c) >= 0:
+			// Decorations.
+			i++
+
+		case c == '"' || c == '!' || c == '+' || c == '{':
+			// Chord symbols and annotations, decorations and grace notes.
+			end := byte('}')
+			if c != '{' {
+				end = c
+			}
+
+			j := strings.IndexByte(s[i+1:], end)
+			if j < 0 {
+				return p.errorf("unterminated %q", c)
+			}
+			i += j + 2
+
+		case c == '&':
+			// Only the first voice of an overlay is played.
+			p.skipToBarLine = true
+			i++
+
+		case c == '(':
+			i++
+			if i < len(s) && isDigit(s[i]) {
+				n, err := p.tuplet(s[i:])
+				if err != nil {
+					return err
+				}
+				i += n
+			}
+
+		case (c == '-' || c == '>' || c == '<') && p.skipVoice:
+			i++
+
+		case c == '-':
+			if p.lastNote < 0 {
+				return p.errorf("tie without a note")
+			}
+			p.tune.elements[p.lastNote].tie = true
+			i++
+
+		case c == '>' || c == '<':
+			n := 1
+			for i+n < len(s) && s[i+n] == c {
+				n++
+			}
+
+			if p.lastNote < 0 || n > 3 {
+				return p.errorf("invalid broken rhythm")
+			}
+
+			short := 1 / float64(int(1)<<n)
+			long := 2 - short
+
+			if c == '<' {
+				long, short = short, long
+			}
+
+			p.tune.elements[p.lastNote].length *= long
+			p.brokenFactor = short
+			i += n
+
+		case c == '^' || c == '_' || c == '=' || isNoteLetter(c):
+			pitch, n, err := p.note(s[i:])
+			if err != nil {
+				return err
+			}
+			i += n
+
+			length, n := parseLength(s[i:])
+			i += n
+
+			p.addNote([]int{pitch}, length)
+
+		case c == 'z' || c == 'x':
+			length, n := parseLength(s[i+1:])
+			i += n + 1
+
+			p.addNote(nil, length)
+
+		case c == 'Z' || c == 'X':
+			bars, n := parseLength(s[i+1:])
+			i += n + 1
+
+			p.addNote(nil, bars*p.meter.barLength()/p.unitLength)
+
+		case c == '[':
+			n, err := p.bracket(s[i:])
+			if err != nil {
+				return err
+			}
+			i += n
+
+		case c == '|' || c == ':':
+			i += p.barLine(s[i:])
+
+		default:
+			return p.errorf("unexpected %q", c)
+		}
+	}
+
+	return nil
+}
+
+// addNote adds a note, chord or rest of the given number of unit lengths,
+// applying any broken rhythm or tuplet in progress.
+func (p *parser) addNote(pitches []int, units float64) {
+	length := units * p.unitLength
+
+	if p.brokenFactor != 0 {
+		length *= p.brokenFactor
+		p.brokenFactor = 0
+	}
+
+	if p.tupletLeft > 0 {
+		length *= p.tupletFactor
+		p.tupletLeft--
+	}
+
+	if p.skipVoice {
+		return
+	}
+
+	p.add(element{kind: elemNote, pitches: pitches, length: length})
+	p.lastNote = len(p.tune.elements) - 1
+}
+
+// note parses a note's accidental, letter and octave marks, returning its
+// MIDI pitch and the number of bytes read.
+func (p *parser) note(s string) (int, int, error) {
+	i := 0
+	alter, explicit := 0, false
+
+	for i < len(s) && (s[i] == '^' || s[i] == '_' || s[i] == '=') {
+		switch s[i] {
+		case '^':
+			alter++
+		case '_':
+			alter--
+		}
+		explicit = true
+		i++
+	}
+
+	if i >= len(s) || !isNoteLetter(s[i]) || alter > 2 || alter < -2 {
+		return 0, 0, p.errorf("invalid note")
+	}
+
+	letter := s[i]
+	i++
+
+	pitch := 60 + strings.IndexByte("C D EF G A B", strings.ToUpper(string(letter))[0])
+	if letter >= 'a' {
+		pitch += 12
+	}
+
+	for i < len(s) && (s[i] == '\'' || s[i] == ',') {
+		if s[i] == '\'' {
+			pitch += 12
+		} else {
+			pitch -= 12
+		}
+		i++
+	}
+
+	if p.barAccidentals == nil {
+		p.barAccidentals = map[int]int{}
+	}
+
+	switch {
+	case explicit:
+		p.barAccidentals[pitch] = alter
+	default:
+		var ok bool
+		alter, ok = p.barAccidentals[pitch]
+		if !ok {
+			alter = p.key.alteration(strings.ToUpper(string(letter))[0])
+		}
+	}
+
+	return pitch + alter, i, nil
+}
+
+// tuplet parses a tuplet such as 3 or 3:2:3 after its opening parenthesis.
+func (p *parser) tuplet(s string) (int, error) {
+	var nums [3]int
+	i := 0
+
+	for k := 0; k < 3; k++ {
+		if k > 0 {
+			if i >= len(s) || s[i] != ':' {
+				break
+			}
+			i++
+		}
+
+		j := i
+		for j < len(s) && isDigit(s[j]) {
+			j++
+		}
+
+		if j > i {
+			nums[k], _ = strconv.Atoi(s[i:j])
+		}
+		i = j
+	}
+
+	pn, q, r := nums[0], nums[1], nums[2]
+
+	if pn < 2 || pn > 9 {
+		return 0, p.errorf("invalid tuplet")
+	}
+
+	if q == 0 {
+		switch pn {
+		case 2, 4, 8:
+			q = 3
+		case 3, 6:
+			q = 2
+		default:
+			q = 2
+			if !p.meter.free() && p.meter.Upper%3 == 0 && p.meter.Upper > 3 {
+				q = 3
+			}
+		}
+	}
+
+	if r == 0 {
+		r = pn
+	}
+
+	p.tupletLeft = r
+	p.tupletFactor = float64(q) / float64(pn)
+
+	return i, nil
+}
+
+// bracket parses something starting with "[": a chord, an inline field, a
+// numbered ending or a [| bar line.
+func (p *parser) bracket(s string) (int, error) {
+	switch {
+	case len(s) > 1 && s[1] == '|':
+		return p.barLine(s), nil
+
+	case len(s) > 1 && isDigit(s[1]):
+		n := p.ending(s[1:])
+		return n + 1, nil
+
+	case len(s) > 2 && s[2] == ':' && isLetter(s[1]):
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return 0, p.errorf("unterminated inline field")
+		}
+
+		err := p.field(s[1], strings.TrimSpace(s[3:end]))
+		return end + 1, err
+	}
+
+	// A chord. Its length is that of its first note, times any length
+	// written after it.
+	i := 1
+	var pitches []int
+	first := 0.0
+	tie := false
+
+	for i < len(s) && s[i] != ']' {
+		c := s[i]
+
+		switch {
+		case c == '^' || c == '_' || c == '=' || isNoteLetter(c):
+			pitch, n, err := p.note(s[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+
+			length, n := parseLength(s[i:])
+			i += n
+
+			if pitches == nil {
+				first = length
+			}
+			pitches = append(pitches, pitch)
+
+		case c == '-':
+			tie = true
+			i++
+
+		case c == ' ' || strings.IndexByte(".~HLMOPSTuv", c) >= 0:
+			i++
+
+		case c == '!':
+			j := strings.IndexByte(s[i+1:], '!')
+			if j < 0 {
+				return 0, p.errorf("unterminated %q", c)
+			}
+			i += j + 2
+
+		default:
+			return 0, p.errorf("unexpected %q in chord", c)
+		}
+	}
+
+	if i >= len(s) {
+		return 0, p.errorf("unterminated chord")
+	}
+
+	if pitches == nil {
+		return 0, p.errorf("empty chord")
+	}
+
+	i++
+	length, n := parseLength(s[i:])
+	i += n
+
+	p.addNote(pitches, first*length)
+
+	if tie {
+		p.tune.elements[p.lastNote].tie = true
+	}
+
+	return i, nil
+}
+
+// barLine parses a bar line, with any repeat marks and a numbered ending
+// straight after it.
+func (p *parser) barLine(s string) int {
+	i := 0
+	bar := element{kind: elemBar}
+
+	for i < len(s) && s[i] == ':' {
+		i++
+	}
+
+	colons := i
+	bar.repeatEnd = colons > 0
+
+	start := i
+	for i < len(s) && (s[i] == '|' || s[i] == ']' && i > start || s[i] == '[' && i+1 < len(s) && s[i+1] == '|') {
+		i++
+	}
+
+	symbol := s[start:i]
+	bar.double = strings.Contains(symbol, "||") || strings.Contains(symbol, "|]") || strings.Contains(symbol, "[|")
+
+	for i < len(s) && s[i] == ':' {
+		bar.repeatStart = true
+		i++
+	}
+
+	// "::" is both ends of a repeat.
+	if symbol == "" && colons >= 2 {
+		bar.repeatStart = true
+	}
+
+	p.add(bar)
+	p.barAccidentals = nil
+	p.skipToBarLine = false
+
+	if i < len(s) && isDigit(s[i]) {
+		i += p.ending(s[i:])
+	}
+
+	return i
+}
+
+// ending parses the numbers of a numbered ending, such as 1, 1,3 or 1-3.
+func (p *parser) ending(s string) int {
+	i := 0
+	var endings []int
+
+	for i < len(s) {
+		j := i
+		for j < len(s) && isDigit(s[j]) {
+			j++
+		}
+
+		if j == i {
+			break
+		}
+
+		n, _ := strconv.Atoi(s[i:j])
+		i = j
+
+		if i+1 < len(s) && s[i] == '-' && isDigit(s[i+1]) {
+			j := i + 1
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+
+			m, _ := strconv.Atoi(s[i+1 : j])
+			for k := n; k <= m && k <= maxEnding; k++ {
+				endings = append(endings, k)
+			}
+			i = j
+		} else if n <= maxEnding {
+			endings = append(endings, n)
+		}
+
+		if i < len(s) && s[i] == ',' {
+			i++
+			continue
+		}
+
+		break
+	}
+
+	p.add(element{kind: elemEnding, endings: endings})
+
+	return i
+}
+
+// parseLength parses a note length multiplier such as 2, /2, 3/2 or //,
+// returning 1 if there is none.
+func parseLength(s string) (float64, int) {
+	i := 0
+	num, den := 1, 1
+
+	j := i
+	for j < len(s) && isDigit(s[j]) {
+		j++
+	}
+
+	if j > i {
+		num, _ = strconv.Atoi(s[i:j])
+		i = j
+	}
+
+	for i < len(s) && s[i] == '/' {
+		i++
+
+		j := i
+		for j < len(s) && isDigit(s[j]) {
+			j++
+		}
+
+		if j > i {
+			d, _ := strconv.Atoi(s[i:j])
+			den *= max(d, 1)
+			i = j
+			break
+		}
+
+		den *= 2
+	}
+
+	return float64(num) / float64(den), i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isNoteLetter(c byte) bool {
+	return c >= 'A' && c <= 'G' || c >= 'a' && c <= 'g'
+}
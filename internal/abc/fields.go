@@ -0,0 +1,329 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// field applies an information field. Fields before the first note set the
+// tune's starting meter, key and tempo; later ones are recorded as changes.
+func (p *parser) field(name byte, value string) error {
+	initial := len(p.tune.elements) == 0
+
+	switch name {
+	case 'M':
+		meter, ok := parseMeter(value)
+		if !ok {
+			return p.errorf("invalid meter %q", value)
+		}
+
+		p.meter = meter
+
+		if initial {
+			p.tune.Meter = meter
+		} else {
+			p.add(element{kind: elemMeter, meter: meter})
+		}
+
+	case 'L':
+		length, ok := parseFraction(value)
+		if !ok {
+			return p.errorf("invalid unit note length %q", value)
+		}
+
+		p.unitLength = length
+
+	case 'Q':
+		tempo, ok := parseTempo(value, p.unitLength)
+		if !ok {
+			return p.errorf("invalid tempo %q", value)
+		}
+
+		if initial {
+			p.tune.Tempo = tempo
+		} else {
+			p.add(element{kind: elemTempo, tempo: tempo})
+		}
+
+	case 'K':
+		key, ok := parseKey(value)
+		if !ok {
+			return p.errorf("invalid key %q", value)
+		}
+
+		p.key = key
+
+		if initial {
+			p.tune.Key = key
+		} else {
+			p.add(element{kind: elemKey, key: key})
+		}
+
+	case 'V':
+		voice, _, _ := strings.Cut(value, " ")
+
+		if p.firstVoice == "" {
+			p.firstVoice = voice
+		}
+
+		// Voices are only switched between in the body; the header just
+		// declares them.
+		if p.inBody {
+			p.skipVoice = voice != p.firstVoice
+		}
+	}
+
+	return nil
+}
+
+// parseMeter parses an M: field: a fraction such as 6/8, C for common time,
+// C| for cut time, or none. Complex meters such as (2+3)/8 are summed.
+func parseMeter(s string) (Meter, bool) {
+	switch s {
+	case "C":
+		return Meter{4, 4}, true
+	case "C|":
+		return Meter{2, 2}, true
+	case "none", "":
+		return Meter{}, true
+	}
+
+	upper, lower, ok := strings.Cut(s, "/")
+	if !ok {
+		return Meter{}, false
+	}
+
+	n := 0
+	for _, part := range strings.Split(strings.Trim(upper, "()"), "+") {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || i < 1 {
+			return Meter{}, false
+		}
+		n += i
+	}
+
+	d, err := strconv.Atoi(strings.TrimSpace(lower))
+	if err != nil || d < 1 || d&(d-1) != 0 || n > 255 || d > 64 {
+		return Meter{}, false
+	}
+
+	return Meter{n, d}, true
+}
+
+// parseFraction parses a note length such as 1/8.
+func parseFraction(s string) (float64, bool) {
+	num, den, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		den = "1"
+	}
+
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	d, err := strconv.Atoi(den)
+	if err != nil || d < 1 {
+		return 0, false
+	}
+
+	return float64(n) / float64(d), true
+}
+
+// parseTempo parses a Q: field such as "1/4=120", "3/8=100", or
+// "\"Allegro\" 1/4=120". Several beat lengths before the = are added
+// together. A bare number counts unit note lengths, as older tunes do.
+func parseTempo(s string, unitLength float64) (Tempo, bool) {
+	// Drop any quoted text.
+	var b strings.Builder
+	quoted := false
+
+	for _, r := range s {
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted {
+			b.WriteRune(r)
+		}
+	}
+
+	s = strings.TrimSpace(b.String())
+
+	beats, bpm, ok := strings.Cut(s, "=")
+	if !ok {
+		bpm, beats = beats, ""
+	}
+
+	t := Tempo{Beat: unitLength}
+
+	if beats = strings.TrimSpace(beats); beats != "" && beats != "C" && beats != "L" {
+		t.Beat = 0
+
+		for _, f := range strings.Fields(beats) {
+			length, ok := parseFraction(f)
+			if !ok {
+				return Tempo{}, false
+			}
+			t.Beat += length
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(bpm), 64)
+	if err != nil || n < 1 || n > 1000 {
+		return Tempo{}, false
+	}
+
+	t.BPM = n
+
+	return t, true
+}
+
+// Sharps in the major key on each tonic.
+var majorSharps = map[string]int{
+	"C": 0, "G": 1, "D": 2, "A": 3, "E": 4, "B": 5, "F#": 6, "C#": 7,
+	"F": -1, "Bb": -2, "Eb": -3, "Ab": -4, "Db": -5, "Gb": -6, "Cb": -7,
+	// Keys needing double sharps or flats are spelt enharmonically.
+	"G#": -4, "D#": -3, "A#": -2, "E#": -1, "B#": 0, "Fb": 4,
+}
+
+// Sharps to add to the major key for each mode, by its first three letters.
+var modeOffsets = map[string]int{
+	"":    0,
+	"maj": 0,
+	"ion": 0,
+	"m":   -3,
+	"min": -3,
+	"aeo": -3,
+	"dor": -2,
+	"phr": -4,
+	"lyd": 1,
+	"mix": -1,
+	"loc": -5,
+}
+
+// parseKey parses a K: field such as G, Ador, F#m, "D mix" or "D ^g". The
+// Highland bagpipe keys HP and Hp, and none, are accepted too. Clef and other
+// named settings after the key are ignored.
+func parseKey(s string) (Key, bool) {
+	fields := strings.Fields(s)
+
+	if len(fields) == 0 || fields[0] == "none" || fields[0] == "HP" {
+		return Key{}, true
+	}
+
+	if fields[0] == "Hp" {
+		return Key{Sharps: 2}, true
+	}
+
+	tonic := fields[0]
+	if tonic[0] < 'A' || tonic[0] > 'G' {
+		return Key{}, false
+	}
+
+	n := 1
+	if len(tonic) > 1 && (tonic[1] == '#' || tonic[1] == 'b') {
+		n = 2
+	}
+
+	mode := strings.ToLower(tonic[n:])
+	rest := fields[1:]
+
+	// The mode can be written apart from the tonic.
+	if mode == "" && len(rest) > 0 && rest[0][0] != '^' && rest[0][0] != '_' && rest[0][0] != '=' && !strings.Contains(rest[0], "=") {
+		mode = strings.ToLower(rest[0])
+		rest = rest[1:]
+	}
+
+	if len(mode) > 3 {
+		mode = mode[:3]
+	}
+
+	offset, ok := modeOffsets[mode]
+	if !ok {
+		return Key{}, false
+	}
+
+	sharps, ok := majorSharps[tonic[:n]]
+	if !ok {
+		return Key{}, false
+	}
+
+	key := Key{
+		Sharps: sharps + offset,
+		Minor:  offset == -3,
+	}
+
+	if key.Sharps > 7 || key.Sharps < -7 {
+		return Key{}, false
+	}
+
+	for _, f := range rest {
+		alter, letter, ok := parseAccidental(f)
+		if !ok {
+			// Named settings such as clef=bass.
+			if strings.Contains(f, "=") {
+				continue
+			}
+			return Key{}, false
+		}
+
+		if key.Extra == nil {
+			key.Extra = map[byte]int{}
+		}
+		key.Extra[letter] = alter
+	}
+
+	return key, true
+}
+
+// parseAccidental parses an accidental and note letter such as ^f or _B,
+// returning the letter in upper case.
+func parseAccidental(s string) (int, byte, bool) {
+	alter := 0
+
+	switch {
+	case strings.HasPrefix(s, "^^"):
+		alter, s = 2, s[2:]
+	case strings.HasPrefix(s, "__"):
+		alter, s = -2, s[2:]
+	case strings.HasPrefix(s, "^"):
+		alter, s = 1, s[1:]
+	case strings.HasPrefix(s, "_"):
+		alter, s = -1, s[1:]
+	case strings.HasPrefix(s, "="):
+		alter, s = 0, s[1:]
+	default:
+		return 0, 0, false
+	}
+
+	if len(s) != 1 || !strings.Contains("ABCDEFGabcdefg", s) {
+		return 0, 0, false
+	}
+
+	return alter, strings.ToUpper(s)[0], true
+}
+
+// Order in which sharps and flats are added to a key signature.
+const (
+	sharpOrder = "FCGDAEB"
+	flatOrder  = "BEADGCF"
+)
+
+// alteration returns the number of semitones the key signature raises or
+// lowers a note letter by.
+func (k Key) alteration(letter byte) int {
+	if alter, ok := k.Extra[letter]; ok {
+		return alter
+	}
+
+	if k.Sharps > 0 && strings.IndexByte(sharpOrder, letter) < k.Sharps {
+		return 1
+	}
+
+	if k.Sharps < 0 && strings.IndexByte(flatOrder, letter) < -k.Sharps {
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,186 @@
+package abc
+
+import (
+	"io"
+	"math"
+	"slices"
+
+	"gazebo.njvanhaute.com/internal/midi"
+)
+
+// midiDivision is the number of ticks per quarter note.
+const midiDivision = 480
+
+// Note velocities, with the first note of each bar slightly accented.
+const (
+	velocityDownbeat = 100
+	velocity         = 80
+)
+
+// MIDIOptions changes how a tune is played back.
+type MIDIOptions struct {
+	// Transpose moves every note by this many semitones.
+	Transpose int
+	// BPM, if set, replaces the tempo in the tune's Q: field, keeping its
+	// beat length. Any later tempo changes are scaled to match.
+	BPM float64
+}
+
+// WriteMIDI plays the tune's melody, with its repeats unfolded, into a
+// single-track Standard MIDI File with tempo, time signature and key
+// signature events.
+func (t *Tune) WriteMIDI(w io.Writer, opts MIDIOptions) error {
+	elements, err := t.perform()
+	if err != nil {
+		return err
+	}
+
+	scale := 1.0
+	if opts.BPM > 0 {
+		scale = opts.BPM / t.Tempo.BPM
+	}
+
+	track := &midi.Track{}
+
+	if t.Title != "" {
+		track.Name(0, t.Title)
+	}
+
+	track.ProgramChange(0, 0, uint8(t.Program))
+	addTempo(track, 0, t.Tempo, scale)
+	addMeter(track, 0, t.Meter)
+	addKey(track, 0, t.Key, opts.Transpose)
+
+	// Positions are kept in whole notes and only rounded to ticks as each
+	// event is added, so that tuplets don't drift.
+	pos := 0.0
+	barStart := true
+	var held []int
+
+	release := func(at float64, keep []int) {
+		held = slices.DeleteFunc(held, func(pitch int) bool {
+			if slices.Contains(keep, pitch) {
+				return false
+			}
+
+			track.NoteOff(ticks(at), 0, uint8(pitch))
+			return true
+		})
+	}
+
+	for _, e := range elements {
+		switch e.kind {
+		case elemBar:
+			barStart = true
+
+		case elemMeter:
+			addMeter(track, ticks(pos), e.meter)
+
+		case elemKey:
+			addKey(track, ticks(pos), e.key, opts.Transpose)
+
+		case elemTempo:
+			addTempo(track, ticks(pos), e.tempo, scale)
+
+		case elemNote:
+			var pitches []int
+
+			for _, pitch := range e.pitches {
+				pitch += opts.Transpose
+				if pitch >= 0 && pitch <= 127 {
+					pitches = append(pitches, pitch)
+				}
+			}
+
+			// Notes tied into this one carry on sounding; anything else
+			// that was tied stops.
+			release(pos, pitches)
+
+			v := uint8(velocity)
+			if barStart {
+				v = velocityDownbeat
+			}
+
+			for _, pitch := range pitches {
+				if !slices.Contains(held, pitch) {
+					track.NoteOn(ticks(pos), 0, uint8(pitch), v)
+				}
+			}
+
+			pos += e.length
+			barStart = false
+
+			for _, pitch := range pitches {
+				switch {
+				case e.tie && !slices.Contains(held, pitch):
+					held = append(held, pitch)
+				case !e.tie:
+					track.NoteOff(ticks(pos), 0, uint8(pitch))
+					held = slices.DeleteFunc(held, func(p int) bool { return p == pitch })
+				}
+			}
+		}
+	}
+
+	release(pos, nil)
+
+	file := &midi.File{
+		Format:   0,
+		Division: midiDivision,
+		Tracks:   []*midi.Track{track},
+	}
+
+	_, err = file.WriteTo(w)
+	return err
+}
+
+func ticks(pos float64) uint32 {
+	return uint32(math.Round(pos * 4 * midiDivision))
+}
+
+func addTempo(track *midi.Track, tick uint32, tempo Tempo, scale float64) {
+	qpm := tempo.quartersPerMinute() * scale
+	track.Tempo(tick, uint32(math.Round(60e6/qpm)))
+}
+
+func addMeter(track *midi.Track, tick uint32, meter Meter) {
+	if meter.free() {
+		return
+	}
+
+	// A click every beat: dotted quarters in compound meters, otherwise one
+	// per 1/Lower note.
+	clocks := 24 * 4 / meter.Lower
+	if meter.Lower >= 8 && meter.Upper%3 == 0 && meter.Upper > 3 {
+		clocks *= 3
+	}
+
+	track.TimeSignature(tick, uint8(meter.Upper), uint8(meter.Lower), uint8(clocks))
+}
+
+func addKey(track *midi.Track, tick uint32, key Key, transpose int) {
+	sharps := transposeKey(key.Sharps, transpose)
+
+	minor := byte(0)
+	if key.Minor {
+		minor = 1
+	}
+
+	track.Meta(tick, midi.MetaKeySignature, []byte{byte(int8(sharps)), minor})
+}
+
+// transposeKey moves a key signature by a number of semitones, choosing
+// the spelling with the fewest sharps or flats.
+func transposeKey(sharps, semitones int) int {
+	if semitones == 0 {
+		return sharps
+	}
+
+	// Each semitone up adds seven sharps, modulo twelve.
+	s := ((sharps+7*semitones)%12 + 12) % 12
+	if s > 6 {
+		s -= 12
+	}
+
+	return s
+}
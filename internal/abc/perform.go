@@ -0,0 +1,120 @@
+package abc
+
+import (
+	"errors"
+	"slices"
+)
+
+// maxEnding is the highest numbered ending that is recognised.
+const maxEnding = 9
+
+// maxPerformance caps the number of elements a tune may unfold to once its
+// repeats are played out.
+const maxPerformance = 1 << 20
+
+var errTooLong = errors.New("abc: tune is too long once repeats are played")
+
+// perform unfolds the tune's repeats and numbered endings into the order
+// the elements are played in. A repeat goes back to the last start repeat,
+// the end of the last repeat, or the start of the tune, and is played once
+// more than it has endings if it has any, otherwise twice.
+func (t *Tune) perform() ([]element, error) {
+	elements := t.elements
+	var out []element
+
+	start := 0
+	pass := 1
+	skipping := false
+	inEnding := false
+
+	for i := 0; i < len(elements); i++ {
+		e := elements[i]
+
+		switch e.kind {
+		case elemEnding:
+			inEnding = true
+			skipping = !slices.Contains(e.endings, pass)
+			continue
+
+		case elemBar:
+			if e.repeatEnd && !skipping {
+				if pass < passes(elements, i) {
+					pass++
+					i = start - 1
+					inEnding = false
+					continue
+				}
+
+				// The repeat is done, and anything after it that isn't an
+				// ending starts a new section.
+				start = i + 1
+				if !(i+1 < len(elements) && elements[i+1].kind == elemEnding) {
+					pass = 1
+				}
+			}
+
+			if e.repeatEnd && skipping {
+				// Still within the ending being skipped.
+				continue
+			}
+
+			if inEnding && (e.double || e.repeatStart && i != start) {
+				inEnding = false
+				skipping = false
+				pass = 1
+				start = i + 1
+			}
+
+			if e.repeatStart && i != start-1 && i != start {
+				start = i
+				pass = 1
+			}
+		}
+
+		if skipping {
+			continue
+		}
+
+		out = append(out, e)
+
+		if len(out) > maxPerformance {
+			return nil, errTooLong
+		}
+	}
+
+	return out, nil
+}
+
+// passes returns how many times the repeat ending at i is played: once for
+// each of the endings that follow it, and at least twice.
+func passes(elements []element, i int) int {
+	n := 2
+
+	for _, e := range elements[i+1:] {
+		if e.kind == elemBar && (e.double || e.repeatStart) {
+			break
+		}
+
+		if e.kind == elemEnding {
+			for _, ending := range e.endings {
+				n = max(n, ending)
+			}
+		}
+	}
+
+	// Endings before the repeat count too, as in |: A |1 B :|2 C ||.
+	for j := i - 1; j >= 0; j-- {
+		e := elements[j]
+		if e.kind == elemBar && (e.double || e.repeatStart || e.repeatEnd) {
+			break
+		}
+
+		if e.kind == elemEnding {
+			for _, ending := range e.endings {
+				n = max(n, ending+1)
+			}
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,76 @@
+package abc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// played parses a tune with the given body in C major and returns the
+// letters of the notes it plays once its repeats are unfolded.
+func played(t *testing.T, body string) (string, error) {
+	t.Helper()
+
+	tune, err := Parse("X:1\nT:Test\nK:C\n" + body + "\n")
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", body, err)
+	}
+
+	elements, err := tune.perform()
+	if err != nil {
+		return "", err
+	}
+
+	letters := map[int]byte{60: 'C', 62: 'D', 64: 'E', 65: 'F', 67: 'G', 69: 'A', 71: 'B'}
+
+	var b strings.Builder
+
+	for _, e := range elements {
+		if e.kind == elemNote && len(e.pitches) > 0 {
+			b.WriteByte(letters[e.pitches[0]])
+		}
+	}
+
+	return b.String(), nil
+}
+
+func TestPerform(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"A B C |", "ABC"},
+		{"|: A :| B ||", "AAB"},
+		{"A :| B", "AAB"},
+		{"[| A :| B", "AAB"},
+		{"A |: B :| C |: D :|", "ABBCDD"},
+		{"|: A :|: B :|", "AABB"},
+		{"|: A :: B :|", "AABB"},
+		{"|: A |1 B :|2 C ||", "ABAC"},
+		{"|: A |[1 B :|[2 C |]", "ABAC"},
+		{"A |1 B :|2 C |]", "ABAC"},
+		{"|: A |1 B :|2 C :|3 D ||", "ABACAD"},
+		{"|: A |1,3 B :|2 C :|4 D |]", "ABACABAD"},
+		{"|: A |1-3 B :|4 C |]", "ABABABAC"},
+		{"|: A |1 B :|2 C || |: D |1 E :|2 F ||", "ABACDEDF"},
+	}
+
+	for _, tt := range tests {
+		got, err := played(t, tt.body)
+		if err != nil {
+			t.Errorf("%q: %v", tt.body, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: played %s; want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPerformTooLong(t *testing.T) {
+	_, err := played(t, strings.Repeat("A", maxPerformance/2+1)+" :|")
+	if !errors.Is(err, errTooLong) {
+		t.Errorf("got %v; want errTooLong", err)
+	}
+}
@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// bitReader reads big-endian bit fields, most significant bit first, as
+// FLAC frames are laid out.
+type bitReader struct {
+	r   *bufio.Reader
+	buf uint64
+	n   uint // number of unread bits in the low end of buf
+}
+
+func newBitReader(r io.Reader) *bitReader {
+	return &bitReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// read returns the next n bits, where n is at most 56.
+func (b *bitReader) read(n uint) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+
+	for b.n < n {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		b.buf = b.buf<<8 | uint64(c)
+		b.n += 8
+	}
+
+	b.n -= n
+
+	return (b.buf >> b.n) & (1<<n - 1), nil
+}
+
+// readSigned returns the next n bits as a two's complement integer.
+func (b *bitReader) readSigned(n uint) (int64, error) {
+	v, err := b.read(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// readUnary counts zero bits up to the next one bit, which is consumed.
+func (b *bitReader) readUnary() (uint64, error) {
+	var count uint64
+
+	for {
+		if b.n == 0 {
+			c, err := b.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					return 0, io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+
+			b.buf = uint64(c)
+			b.n = 8
+		}
+
+		rest := b.buf & (1<<b.n - 1)
+		if rest == 0 {
+			count += uint64(b.n)
+			b.n = 0
+			continue
+		}
+
+		zeros := uint(bits.LeadingZeros64(rest)) - (64 - b.n)
+		b.n -= zeros + 1
+
+		return count + uint64(zeros), nil
+	}
+}
+
+// align discards any bits left over in the current byte.
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+}
+
+// readByte reads a whole byte, returning io.EOF if the stream ended cleanly
+// on a byte boundary. It must only be called when aligned.
+func (b *bitReader) readByte() (byte, error) {
+	if b.n >= 8 {
+		v, err := b.read(8)
+		return byte(v), err
+	}
+
+	return b.r.ReadByte()
+}
@@ -0,0 +1,197 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrCannotDecode is returned when asked to decode a format that is only
+// supported for probing.
+var ErrCannotDecode = errors.New("audio: format cannot be decoded")
+
+// CanDecode reports whether files of the given format can be decoded.
+func CanDecode(format string) bool {
+	return format == FormatWAV || format == FormatFLAC
+}
+
+// decoder produces the samples of a stream, mixed down to mono and scaled
+// to the range [-1, 1].
+type decoder interface {
+	// next returns the next block of samples, or io.EOF at the end of the
+	// stream. The slice is only valid until the next call.
+	next() ([]float32, error)
+	sampleRate() int
+}
+
+// newDecoder identifies the format of the file in r and returns a decoder
+// for it.
+func newDecoder(r io.ReadSeeker) (decoder, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 12)
+
+	_, err = io.ReadFull(r, head)
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	switch {
+	case bytes.Equal(head[0:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		return newWAVDecoder(r, size)
+	case bytes.Equal(head[0:4], []byte("fLaC")):
+		return newFLACDecoder(r, size, 0)
+	case bytes.Equal(head[0:3], []byte("ID3")):
+		_, err = r.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+
+		_, tagSize, err := readID3v2(r)
+		if err != nil {
+			return nil, err
+		}
+
+		magic := make([]byte, 4)
+
+		_, err = r.Seek(tagSize, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.ReadFull(r, magic)
+		if err != nil || !bytes.Equal(magic, []byte("fLaC")) {
+			return nil, ErrCannotDecode
+		}
+
+		return newFLACDecoder(r, size, tagSize)
+	case bytes.Equal(head[0:4], []byte("OggS")), isFrameHeader(head):
+		return nil, ErrCannotDecode
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Samples are decoded in blocks of this many frames.
+const decodeBlockFrames = 4096
+
+type wavDecoder struct {
+	r         io.Reader
+	format    *wavFormat
+	remaining int64
+	buf       []byte
+	out       []float32
+}
+
+func newWAVDecoder(r io.ReadSeeker, size int64) (*wavDecoder, error) {
+	format, dataOffset, dataSize, _, err := readWAVChunks(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	bytesPerSample := int(format.BitsPerSample+7) / 8
+
+	switch format.AudioFormat {
+	case wavFormatPCM:
+		if bytesPerSample < 1 || bytesPerSample > 4 {
+			return nil, ErrCannotDecode
+		}
+	case wavFormatFloat:
+		if bytesPerSample != 4 && bytesPerSample != 8 {
+			return nil, ErrCannotDecode
+		}
+	default:
+		return nil, ErrCannotDecode
+	}
+
+	if int(format.BlockAlign) != bytesPerSample*int(format.Channels) {
+		return nil, ErrMalformed
+	}
+
+	_, err = r.Seek(dataOffset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wavDecoder{
+		r:         bufio.NewReader(r),
+		format:    format,
+		remaining: dataSize - dataSize%int64(format.BlockAlign),
+		buf:       make([]byte, decodeBlockFrames*int(format.BlockAlign)),
+		out:       make([]float32, decodeBlockFrames),
+	}, nil
+}
+
+func (d *wavDecoder) sampleRate() int {
+	return int(d.format.SampleRate)
+}
+
+func (d *wavDecoder) next() ([]float32, error) {
+	if d.remaining <= 0 {
+		return nil, io.EOF
+	}
+
+	n := int64(len(d.buf))
+	if n > d.remaining {
+		n = d.remaining
+	}
+
+	_, err := io.ReadFull(d.r, d.buf[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	d.remaining -= n
+
+	channels := int(d.format.Channels)
+	width := int(d.format.BlockAlign) / channels
+	frames := int(n) / int(d.format.BlockAlign)
+	float := d.format.AudioFormat == wavFormatFloat
+
+	// Integer samples are scaled by their full container width, since
+	// narrower samples are left-justified within it.
+	scale := 1 / float32(uint64(1)<<(8*width-1))
+
+	for i := 0; i < frames; i++ {
+		var sum float32
+
+		for c := 0; c < channels; c++ {
+			b := d.buf[(i*channels+c)*width:]
+
+			var s float32
+
+			switch {
+			case float && width == 4:
+				s = math.Float32frombits(binary.LittleEndian.Uint32(b))
+			case float:
+				s = float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			case width == 1:
+				// 8-bit samples are unsigned.
+				s = float32(int(b[0])-128) * scale
+			case width == 2:
+				s = float32(int16(binary.LittleEndian.Uint16(b))) * scale
+			case width == 3:
+				s = float32(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) * scale
+			default:
+				s = float32(int32(binary.LittleEndian.Uint32(b))) * scale
+			}
+
+			sum += s
+		}
+
+		d.out[i] = sum / float32(channels)
+	}
+
+	return d.out[:frames], nil
+}
@@ -0,0 +1,171 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	flacStreamInfoBlock    = 0
+	flacVorbisCommentBlock = 4
+)
+
+// flacStreamInfo is the contents of a FLAC file's STREAMINFO block.
+type flacStreamInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  int64
+}
+
+// probeFLAC reads the metadata blocks of a FLAC stream whose "fLaC" marker
+// starts at offset.
+func probeFLAC(r io.ReadSeeker, size int64, offset int64) (*Info, error) {
+	streamInfo, tags, audioOffset, err := readFLACMetadata(r, size, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Format:        FormatFLAC,
+		SampleRate:    streamInfo.SampleRate,
+		Channels:      streamInfo.Channels,
+		BitsPerSample: streamInfo.BitsPerSample,
+		Tags:          tags,
+	}
+
+	// The total is zero when the encoder didn't know it.
+	if streamInfo.TotalSamples > 0 {
+		info.Duration = float64(streamInfo.TotalSamples) / float64(info.SampleRate)
+		info.Bitrate = bitrate(size-audioOffset, info.Duration)
+	}
+
+	return info, nil
+}
+
+// readFLACMetadata reads the metadata blocks of a FLAC stream whose "fLaC"
+// marker starts at offset, returning its stream info, its tags and the
+// offset of its first audio frame.
+func readFLACMetadata(r io.ReadSeeker, size int64, offset int64) (*flacStreamInfo, map[string]string, int64, error) {
+	_, err := r.Seek(offset+4, io.SeekStart)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var streamInfo *flacStreamInfo
+	tags := map[string]string{}
+
+	pos := offset + 4
+	header := make([]byte, 4)
+
+	for {
+		_, err = io.ReadFull(r, header)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4
+
+		if pos+length > size {
+			return nil, nil, 0, ErrMalformed
+		}
+
+		switch blockType {
+		case flacStreamInfoBlock:
+			if length < 34 {
+				return nil, nil, 0, ErrMalformed
+			}
+
+			b := make([]byte, 34)
+
+			_, err = io.ReadFull(r, b)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+
+			// Sample rate, channels, bits per sample and total samples are
+			// packed into 64 bits after the block and frame sizes.
+			packed := binary.BigEndian.Uint64(b[10:18])
+
+			streamInfo = &flacStreamInfo{
+				SampleRate:    int(packed >> 44),
+				Channels:      int((packed>>41)&0x07) + 1,
+				BitsPerSample: int((packed>>36)&0x1f) + 1,
+				TotalSamples:  int64(packed & 0xfffffffff),
+			}
+
+		case flacVorbisCommentBlock:
+			b := make([]byte, length)
+
+			_, err = io.ReadFull(r, b)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+
+			readVorbisComment(b, tags)
+		}
+
+		pos += length
+
+		if last {
+			break
+		}
+
+		_, err = r.Seek(pos, io.SeekStart)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	if streamInfo == nil || streamInfo.SampleRate == 0 {
+		return nil, nil, 0, ErrMalformed
+	}
+
+	return streamInfo, tags, pos, nil
+}
+
+// readVorbisComment reads the tags from a Vorbis comment block, as used by
+// both FLAC and Ogg Vorbis. Malformed blocks are read as far as possible.
+func readVorbisComment(b []byte, tags map[string]string) {
+	if len(b) < 4 {
+		return
+	}
+
+	vendorLength := int64(binary.LittleEndian.Uint32(b[0:4]))
+	b = b[4:]
+
+	if vendorLength > int64(len(b)) {
+		return
+	}
+
+	b = b[vendorLength:]
+
+	if len(b) < 4 {
+		return
+	}
+
+	count := binary.LittleEndian.Uint32(b[0:4])
+	b = b[4:]
+
+	for i := uint32(0); i < count && len(b) >= 4; i++ {
+		n := int64(binary.LittleEndian.Uint32(b[0:4]))
+		b = b[4:]
+
+		if n > int64(len(b)) {
+			return
+		}
+
+		comment := string(b[:n])
+		b = b[n:]
+
+		for j := 0; j < len(comment); j++ {
+			if comment[j] == '=' {
+				addTag(tags, comment[:j], comment[j+1:])
+				break
+			}
+		}
+	}
+}
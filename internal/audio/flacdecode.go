@@ -0,0 +1,506 @@
+package audio
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Channel assignments for stereo decorrelation.
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+type flacDecoder struct {
+	br         *bitReader
+	streamInfo *flacStreamInfo
+	channels   [][]int64
+	out        []float32
+}
+
+func newFLACDecoder(r io.ReadSeeker, size int64, offset int64) (*flacDecoder, error) {
+	streamInfo, _, audioOffset, err := readFLACMetadata(r, size, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.Seek(audioOffset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flacDecoder{
+		br:         newBitReader(r),
+		streamInfo: streamInfo,
+	}, nil
+}
+
+func (d *flacDecoder) sampleRate() int {
+	return d.streamInfo.SampleRate
+}
+
+func (d *flacDecoder) next() ([]float32, error) {
+	blockSize, bitsPerSample, err := d.readFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	if cap(d.out) < blockSize {
+		d.out = make([]float32, blockSize)
+	}
+
+	out := d.out[:blockSize]
+	scale := 1 / float32(uint64(1)<<(bitsPerSample-1))
+	channels := len(d.channels)
+
+	for i := range out {
+		var sum int64
+		for c := 0; c < channels; c++ {
+			sum += d.channels[c][i]
+		}
+
+		out[i] = float32(sum) * scale / float32(channels)
+	}
+
+	return out, nil
+}
+
+// readFrame decodes the next frame into d.channels, returning its block size
+// and sample size. It returns io.EOF when there are no more frames.
+func (d *flacDecoder) readFrame() (int, uint, error) {
+	br := d.br
+
+	br.align()
+
+	// Frames start with a 14-bit sync code. Anything else after the last
+	// frame (such as a trailing ID3v1 tag) ends the stream.
+	first, err := br.readByte()
+	if err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, 0, io.EOF
+		}
+		return 0, 0, err
+	}
+
+	second, err := br.readByte()
+	if err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, 0, io.EOF
+		}
+		return 0, 0, err
+	}
+
+	if first != 0xff || second&0xfe != 0xf8 {
+		return 0, 0, io.EOF
+	}
+
+	header, err := br.read(16)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	blockSizeCode := header >> 12
+	sampleRateCode := (header >> 8) & 0x0f
+	assignment := int((header >> 4) & 0x0f)
+	sampleSizeCode := (header >> 1) & 0x07
+
+	// The coded frame or sample number is UTF-8 style: the number of leading
+	// ones in the first byte gives the length of the whole number.
+	lead, err := br.read(8)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length := bits.LeadingZeros8(^uint8(lead))
+	if length == 1 || length > 7 {
+		return 0, 0, ErrMalformed
+	}
+
+	for i := 1; i < length; i++ {
+		_, err = br.read(8)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var blockSize int
+
+	switch {
+	case blockSizeCode == 1:
+		blockSize = 192
+	case blockSizeCode >= 2 && blockSizeCode <= 5:
+		blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		n, err := br.read(8)
+		if err != nil {
+			return 0, 0, err
+		}
+		blockSize = int(n) + 1
+	case blockSizeCode == 7:
+		n, err := br.read(16)
+		if err != nil {
+			return 0, 0, err
+		}
+		blockSize = int(n) + 1
+	case blockSizeCode >= 8:
+		blockSize = 256 << (blockSizeCode - 8)
+	default:
+		return 0, 0, ErrMalformed
+	}
+
+	// Only the size of any explicit sample rate matters here.
+	switch sampleRateCode {
+	case 12:
+		_, err = br.read(8)
+	case 13, 14:
+		_, err = br.read(16)
+	case 15:
+		return 0, 0, ErrMalformed
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var bitsPerSample uint
+
+	switch sampleSizeCode {
+	case 0:
+		bitsPerSample = uint(d.streamInfo.BitsPerSample)
+	case 1:
+		bitsPerSample = 8
+	case 2:
+		bitsPerSample = 12
+	case 4:
+		bitsPerSample = 16
+	case 5:
+		bitsPerSample = 20
+	case 6:
+		bitsPerSample = 24
+	case 7:
+		bitsPerSample = 32
+	default:
+		return 0, 0, ErrMalformed
+	}
+
+	// CRC-8 of the header.
+	_, err = br.read(8)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	channels := assignment + 1
+	if assignment >= flacLeftSide {
+		if assignment > flacMidSide {
+			return 0, 0, ErrMalformed
+		}
+		channels = 2
+	}
+
+	if len(d.channels) != channels {
+		d.channels = make([][]int64, channels)
+	}
+
+	for c := range d.channels {
+		if cap(d.channels[c]) < blockSize {
+			d.channels[c] = make([]int64, blockSize)
+		}
+		d.channels[c] = d.channels[c][:blockSize]
+
+		// The side channel needs an extra bit.
+		bps := bitsPerSample
+		if (assignment == flacLeftSide || assignment == flacMidSide) && c == 1 ||
+			assignment == flacSideRight && c == 0 {
+			bps++
+		}
+
+		err = d.readSubframe(d.channels[c], bps)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	decorrelate(d.channels, assignment)
+
+	// Frames end with padding to a byte boundary and a CRC-16.
+	br.align()
+
+	_, err = br.read(16)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return blockSize, bitsPerSample, nil
+}
+
+func (d *flacDecoder) readSubframe(samples []int64, bps uint) error {
+	br := d.br
+
+	header, err := br.read(8)
+	if err != nil {
+		return err
+	}
+
+	if header&0x80 != 0 {
+		return ErrMalformed
+	}
+
+	kind := (header >> 1) & 0x3f
+
+	var wasted uint
+	if header&0x01 != 0 {
+		n, err := br.readUnary()
+		if err != nil {
+			return err
+		}
+
+		wasted = uint(n) + 1
+		if wasted >= bps {
+			return ErrMalformed
+		}
+
+		bps -= wasted
+	}
+
+	switch {
+	case kind == 0:
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+
+		for i := range samples {
+			samples[i] = v
+		}
+
+	case kind == 1:
+		for i := range samples {
+			samples[i], err = br.readSigned(bps)
+			if err != nil {
+				return err
+			}
+		}
+
+	case kind >= 8 && kind <= 12:
+		err = d.readFixed(samples, bps, int(kind-8))
+		if err != nil {
+			return err
+		}
+
+	case kind >= 32:
+		err = d.readLPC(samples, bps, int(kind-31))
+		if err != nil {
+			return err
+		}
+
+	default:
+		return ErrMalformed
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+
+	return nil
+}
+
+func (d *flacDecoder) readFixed(samples []int64, bps uint, order int) error {
+	if order > len(samples) {
+		return ErrMalformed
+	}
+
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = v
+	}
+
+	err := d.readResidual(samples, order)
+	if err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		switch order {
+		case 1:
+			samples[i] += samples[i-1]
+		case 2:
+			samples[i] += 2*samples[i-1] - samples[i-2]
+		case 3:
+			samples[i] += 3*samples[i-1] - 3*samples[i-2] + samples[i-3]
+		case 4:
+			samples[i] += 4*samples[i-1] - 6*samples[i-2] + 4*samples[i-3] - samples[i-4]
+		}
+	}
+
+	return nil
+}
+
+func (d *flacDecoder) readLPC(samples []int64, bps uint, order int) error {
+	br := d.br
+
+	if order > len(samples) {
+		return ErrMalformed
+	}
+
+	for i := 0; i < order; i++ {
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = v
+	}
+
+	precision, err := br.read(4)
+	if err != nil {
+		return err
+	}
+
+	if precision == 0x0f {
+		return ErrMalformed
+	}
+
+	shift, err := br.readSigned(5)
+	if err != nil {
+		return err
+	}
+
+	if shift < 0 {
+		return ErrMalformed
+	}
+
+	coefficients := make([]int64, order)
+	for i := range coefficients {
+		coefficients[i], err = br.readSigned(uint(precision) + 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.readResidual(samples, order)
+	if err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coefficients {
+			sum += c * samples[i-1-j]
+		}
+
+		samples[i] += sum >> shift
+	}
+
+	return nil
+}
+
+// readResidual reads the Rice-coded prediction residual into samples after
+// the warm-up samples.
+func (d *flacDecoder) readResidual(samples []int64, order int) error {
+	br := d.br
+
+	method, err := br.read(2)
+	if err != nil {
+		return err
+	}
+
+	if method > 1 {
+		return ErrMalformed
+	}
+
+	paramBits, escape := uint(4), uint64(0x0f)
+	if method == 1 {
+		paramBits, escape = 5, 0x1f
+	}
+
+	partitionOrder, err := br.read(4)
+	if err != nil {
+		return err
+	}
+
+	partitions := 1 << partitionOrder
+	partitionSize := len(samples) >> partitionOrder
+
+	if partitionSize*partitions != len(samples) || partitionSize < order {
+		return ErrMalformed
+	}
+
+	i := order
+
+	for p := 0; p < partitions; p++ {
+		n := partitionSize
+		if p == 0 {
+			n -= order
+		}
+
+		param, err := br.read(paramBits)
+		if err != nil {
+			return err
+		}
+
+		if param == escape {
+			raw, err := br.read(5)
+			if err != nil {
+				return err
+			}
+
+			for k := 0; k < n; k++ {
+				samples[i], err = br.readSigned(uint(raw))
+				if err != nil {
+					return err
+				}
+				i++
+			}
+
+			continue
+		}
+
+		for k := 0; k < n; k++ {
+			high, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+
+			low, err := br.read(uint(param))
+			if err != nil {
+				return err
+			}
+
+			v := high<<param | low
+			samples[i] = int64(v>>1) ^ -int64(v&1)
+			i++
+		}
+	}
+
+	return nil
+}
+
+// decorrelate restores left and right channels from stereo side coding.
+func decorrelate(channels [][]int64, assignment int) {
+	switch assignment {
+	case flacLeftSide:
+		left, side := channels[0], channels[1]
+		for i := range side {
+			side[i] = left[i] - side[i]
+		}
+
+	case flacSideRight:
+		side, right := channels[0], channels[1]
+		for i := range side {
+			side[i] += right[i]
+		}
+
+	case flacMidSide:
+		mid, side := channels[0], channels[1]
+		for i := range mid {
+			m := mid[i]<<1 | side[i]&1
+			mid[i] = (m + side[i]) >> 1
+			side[i] = (m - side[i]) >> 1
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// bitWriter writes big-endian bit fields, the reverse of bitReader.
+type bitWriter struct {
+	b []byte
+	n uint // number of bits used in the last byte
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+			w.n = 0
+		}
+
+		w.b[len(w.b)-1] |= byte(v>>uint(i)&1) << (7 - w.n)
+		w.n++
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, n uint) {
+	w.write(uint64(v)&(1<<n-1), n)
+}
+
+func (w *bitWriter) writeUnary(n uint64) {
+	for ; n > 0; n-- {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+// writeRice writes v Rice-coded with parameter k.
+func (w *bitWriter) writeRice(v int64, k uint) {
+	u := uint64(v<<1 ^ v>>63)
+	w.writeUnary(u >> k)
+	w.write(u&(1<<k-1), k)
+}
+
+// subframe writes a subframe header for the given type, with no wasted bits.
+func (w *bitWriter) subframe(kind uint64) {
+	w.write(kind<<1, 8)
+}
+
+// flacFrame builds a frame with an explicit 16-bit block size, the stream's
+// sample rate, and CRCs left as zero since the decoder doesn't check them.
+func flacFrame(blockSize, assignment int, sampleSizeCode uint64, subframes func(w *bitWriter)) []byte {
+	w := &bitWriter{}
+
+	w.write(0xfff8, 16)
+	w.write(7, 4)
+	w.write(0, 4)
+	w.write(uint64(assignment), 4)
+	w.write(sampleSizeCode, 3)
+	w.write(0, 1)
+	w.write(0, 8)
+	w.write(uint64(blockSize-1), 16)
+	w.write(0, 8)
+
+	subframes(w)
+
+	w.n = 0
+	w.write(0, 16)
+
+	return w.b
+}
+
+// flacFile builds a stream with only a STREAMINFO block followed by frames.
+func flacFile(sampleRate, channels, bitsPerSample int, frames ...[]byte) []byte {
+	b := []byte("fLaC\x80\x00\x00\x22")
+
+	w := &bitWriter{}
+	w.write(4096, 16)
+	w.write(4096, 16)
+	w.write(0, 24)
+	w.write(0, 24)
+	w.write(uint64(sampleRate), 20)
+	w.write(uint64(channels-1), 3)
+	w.write(uint64(bitsPerSample-1), 5)
+	w.write(0, 36)
+
+	b = append(b, w.b...)
+	b = append(b, make([]byte, 16)...)
+
+	for _, f := range frames {
+		b = append(b, f...)
+	}
+
+	return b
+}
+
+// verbatim writes a verbatim subframe.
+func verbatim(w *bitWriter, bps uint, samples ...int64) {
+	w.subframe(1)
+	for _, s := range samples {
+		w.writeSigned(s, bps)
+	}
+}
+
+func TestFLACFrame(t *testing.T) {
+	tests := []struct {
+		name          string
+		bitsPerSample int
+		frame         []byte
+		want          [][]int64
+	}{
+		{
+			"constant",
+			16,
+			flacFrame(4, 0, 0, func(w *bitWriter) {
+				w.subframe(0)
+				w.writeSigned(-300, 16)
+			}),
+			[][]int64{{-300, -300, -300, -300}},
+		},
+		{
+			"verbatim",
+			8,
+			flacFrame(3, 1, 1, func(w *bitWriter) {
+				verbatim(w, 8, 1, -2, 3)
+				verbatim(w, 8, -128, 127, 0)
+			}),
+			[][]int64{{1, -2, 3}, {-128, 127, 0}},
+		},
+		{
+			"fixed",
+			16,
+			flacFrame(5, 0, 4, func(w *bitWriter) {
+				w.subframe(8 + 2)
+				w.writeSigned(10, 16)
+				w.writeSigned(12, 16)
+				w.write(0, 2)
+				w.write(0, 4)
+				w.write(1, 4)
+				w.writeRice(0, 1)
+				w.writeRice(1, 1)
+				w.writeRice(0, 1)
+			}),
+			[][]int64{{10, 12, 14, 17, 20}},
+		},
+		{
+			"LPC",
+			16,
+			flacFrame(5, 0, 4, func(w *bitWriter) {
+				w.subframe(31 + 2)
+				w.writeSigned(10, 16)
+				w.writeSigned(12, 16)
+				w.write(3, 4)
+				w.writeSigned(1, 5)
+				w.writeSigned(4, 4)
+				w.writeSigned(-2, 4)
+				w.write(1, 2)
+				w.write(0, 4)
+				w.write(2, 5)
+				w.writeRice(0, 2)
+				w.writeRice(1, 2)
+				w.writeRice(0, 2)
+			}),
+			[][]int64{{10, 12, 14, 17, 20}},
+		},
+		{
+			"escaped partition",
+			8,
+			flacFrame(4, 0, 1, func(w *bitWriter) {
+				w.subframe(8)
+				w.write(0, 2)
+				w.write(1, 4)
+				w.write(0x0f, 4)
+				w.write(6, 5)
+				w.writeSigned(-3, 6)
+				w.writeSigned(31, 6)
+				w.write(0, 4)
+				w.writeRice(0, 0)
+				w.writeRice(-1, 0)
+			}),
+			[][]int64{{-3, 31, 0, -1}},
+		},
+		{
+			"wasted bits",
+			16,
+			flacFrame(2, 0, 4, func(w *bitWriter) {
+				w.write(1, 8)
+				w.writeUnary(1)
+				w.writeSigned(25, 14)
+			}),
+			[][]int64{{100, 100}},
+		},
+		{
+			"left and side",
+			8,
+			flacFrame(2, flacLeftSide, 1, func(w *bitWriter) {
+				verbatim(w, 8, 10, -5)
+				verbatim(w, 9, 6, -5)
+			}),
+			[][]int64{{10, -5}, {4, 0}},
+		},
+		{
+			"side and right",
+			8,
+			flacFrame(2, flacSideRight, 1, func(w *bitWriter) {
+				verbatim(w, 9, 6, -5)
+				verbatim(w, 8, 4, 0)
+			}),
+			[][]int64{{10, -5}, {4, 0}},
+		},
+		{
+			"mid and side",
+			8,
+			flacFrame(2, flacMidSide, 1, func(w *bitWriter) {
+				verbatim(w, 8, 7, -3)
+				verbatim(w, 9, 6, -5)
+			}),
+			[][]int64{{10, -5}, {4, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		data := flacFile(44100, len(tt.want), tt.bitsPerSample, tt.frame)
+
+		d, err := newFLACDecoder(bytes.NewReader(data), int64(len(data)), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = d.readFrame()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(d.channels, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.name, d.channels, tt.want)
+		}
+
+		if _, _, err = d.readFrame(); err != io.EOF {
+			t.Errorf("%s: got %v after the last frame; want io.EOF", tt.name, err)
+		}
+	}
+}
+
+func TestFLACFrameInvalid(t *testing.T) {
+	valid := flacFrame(4, 0, 1, func(w *bitWriter) {
+		verbatim(w, 8, 1, 2, 3, 4)
+	})
+
+	// header changes one byte of a valid frame.
+	header := func(i int, b byte) []byte {
+		f := bytes.Clone(valid)
+		f[i] = b
+		return f
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		err   error
+	}{
+		{"reserved sample rate", header(2, 0x7f), ErrMalformed},
+		{"reserved channel assignment", header(3, 0xb2), ErrMalformed},
+		{"reserved sample size", header(3, 0x06), ErrMalformed},
+		{"invalid frame number", header(4, 0x80), ErrMalformed},
+		{"truncated", valid[:len(valid)-4], io.ErrUnexpectedEOF},
+		{
+			"subframe padding bit set",
+			flacFrame(4, 0, 1, func(w *bitWriter) { w.write(0x80, 8) }),
+			ErrMalformed,
+		},
+		{
+			"reserved subframe type",
+			flacFrame(4, 0, 1, func(w *bitWriter) { w.subframe(2) }),
+			ErrMalformed,
+		},
+		{
+			"all bits wasted",
+			flacFrame(4, 0, 1, func(w *bitWriter) {
+				w.write(1, 8)
+				w.writeUnary(7)
+			}),
+			ErrMalformed,
+		},
+		{
+			"fixed order above the block size",
+			flacFrame(2, 0, 1, func(w *bitWriter) { w.subframe(8 + 4) }),
+			ErrMalformed,
+		},
+		{
+			"reserved residual method",
+			flacFrame(4, 0, 1, func(w *bitWriter) {
+				w.subframe(8)
+				w.write(2, 2)
+			}),
+			ErrMalformed,
+		},
+		{
+			"partitions smaller than the order",
+			flacFrame(4, 0, 1, func(w *bitWriter) {
+				w.subframe(8 + 2)
+				w.writeSigned(0, 8)
+				w.writeSigned(0, 8)
+				w.write(0, 2)
+				w.write(2, 4)
+			}),
+			ErrMalformed,
+		},
+		{
+			"reserved LPC precision",
+			flacFrame(4, 0, 1, func(w *bitWriter) {
+				w.subframe(31 + 1)
+				w.writeSigned(0, 8)
+				w.write(0x0f, 4)
+			}),
+			ErrMalformed,
+		},
+		{
+			"negative LPC shift",
+			flacFrame(4, 0, 1, func(w *bitWriter) {
+				w.subframe(31 + 1)
+				w.writeSigned(0, 8)
+				w.write(3, 4)
+				w.writeSigned(-1, 5)
+			}),
+			ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		data := flacFile(44100, 1, 8, tt.frame)
+
+		d, err := newFLACDecoder(bytes.NewReader(data), int64(len(data)), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = d.readFrame()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestComputePeaksFLAC(t *testing.T) {
+	constant := func(v int64) []byte {
+		return flacFrame(4, 0, 4, func(w *bitWriter) {
+			w.subframe(0)
+			w.writeSigned(v, 16)
+		})
+	}
+
+	// A trailing ID3v1 tag ends the stream like the end of the file.
+	data := flacFile(8000, 1, 16, constant(16384), constant(-16384), []byte("TAG"))
+
+	peaks, err := ComputePeaks(bytes.NewReader(data), []int{4, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]int8{{64, 64, -64, -64}, {-64, 64}}
+
+	for i, p := range peaks {
+		if p.SampleRate != 8000 || !reflect.DeepEqual(p.Data, want[i]) {
+			t.Errorf("%d samples per pixel: got %d Hz, %v; want 8000 Hz, %v", p.SamplesPerPixel, p.SampleRate, p.Data, want[i])
+		}
+	}
+}
+
+// FuzzComputePeaks checks that no FLAC stream can make the decoder panic.
+func FuzzComputePeaks(f *testing.F) {
+	f.Add(flacFile(44100, 2, 8, flacFrame(2, flacMidSide, 1, func(w *bitWriter) {
+		verbatim(w, 8, 7, -3)
+		verbatim(w, 9, 6, -5)
+	})))
+	f.Add(flacFile(44100, 1, 16, flacFrame(5, 0, 4, func(w *bitWriter) {
+		w.subframe(31 + 2)
+		w.writeSigned(10, 16)
+		w.writeSigned(12, 16)
+		w.write(3, 4)
+		w.writeSigned(1, 5)
+		w.writeSigned(4, 4)
+		w.writeSigned(-2, 4)
+		w.write(0, 2)
+		w.write(0, 4)
+		w.write(1, 4)
+		w.writeRice(0, 1)
+		w.writeRice(1, 1)
+		w.writeRice(0, 1)
+	})))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ComputePeaks(bytes.NewReader(data), []int{256})
+	})
+}
@@ -0,0 +1,323 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// ID3v2 text frames worth keeping, mapped to the names used by the other
+// formats. The three-character IDs are from ID3v2.2.
+var id3TextFrames = map[string]string{
+	"TIT2": "title",
+	"TT2":  "title",
+	"TPE1": "artist",
+	"TP1":  "artist",
+	"TALB": "album",
+	"TAL":  "album",
+	"TYER": "date",
+	"TYE":  "date",
+	"TDRC": "date",
+	"TCON": "genre",
+	"TCO":  "genre",
+	"TRCK": "tracknumber",
+	"TRK":  "tracknumber",
+	"TCOP": "copyright",
+	"TCR":  "copyright",
+	"TSSE": "encoder",
+	"TSS":  "encoder",
+	"COMM": "comment",
+	"COM":  "comment",
+}
+
+// Frames bigger than this (usually embedded pictures) are skipped unread.
+const maxID3FrameSize = 64 * 1024
+
+// maxID3TagSize bounds the amount of a tag that is read into memory.
+const maxID3TagSize = 16 * 1024 * 1024
+
+// readID3v2 reads the ID3v2 tag at the start of r, returning its text tags
+// and the total size of the tag so the audio that follows can be found.
+func readID3v2(r io.ReadSeeker) (map[string]string, int64, error) {
+	header := make([]byte, 10)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !bytes.Equal(header[0:3], []byte("ID3")) {
+		return nil, 0, ErrMalformed
+	}
+
+	major := header[3]
+	flags := header[5]
+
+	size, ok := syncsafe(header[6:10])
+	if !ok {
+		return nil, 0, ErrMalformed
+	}
+
+	total := int64(size) + 10
+	if flags&0x10 != 0 {
+		total += 10 // footer
+	}
+
+	tags := map[string]string{}
+
+	if major < 2 || major > 4 || size > maxID3TagSize {
+		return tags, total, nil
+	}
+
+	body := make([]byte, size)
+
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Before v2.4 unsynchronisation applies to the whole tag.
+	if flags&0x80 != 0 && major < 4 {
+		body = bytes.ReplaceAll(body, []byte{0xff, 0x00}, []byte{0xff})
+	}
+
+	// Skip the extended header.
+	if flags&0x40 != 0 && len(body) >= 4 {
+		var extSize int
+
+		if major == 4 {
+			n, ok := syncsafe(body[0:4])
+			if !ok {
+				return tags, total, nil
+			}
+			extSize = int(n)
+		} else {
+			extSize = int(binary.BigEndian.Uint32(body[0:4])) + 4
+		}
+
+		if extSize > len(body) {
+			return tags, total, nil
+		}
+
+		body = body[extSize:]
+	}
+
+	readID3Frames(body, major, tags)
+
+	return tags, total, nil
+}
+
+func readID3Frames(b []byte, major byte, tags map[string]string) {
+	idLen, headerLen := 4, 10
+	if major == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(b) >= headerLen {
+		if b[0] == 0 {
+			return // padding
+		}
+
+		id := string(b[:idLen])
+
+		var size int
+		var frameFlags uint16
+
+		switch major {
+		case 2:
+			size = int(b[3])<<16 | int(b[4])<<8 | int(b[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(b[4:8]))
+			frameFlags = binary.BigEndian.Uint16(b[8:10])
+		case 4:
+			n, ok := syncsafe(b[4:8])
+			if !ok {
+				return
+			}
+			size = int(n)
+			frameFlags = binary.BigEndian.Uint16(b[8:10])
+		}
+
+		b = b[headerLen:]
+
+		if size < 0 || size > len(b) {
+			return
+		}
+
+		frame := b[:size]
+		b = b[size:]
+
+		name, ok := id3TextFrames[id]
+		if !ok || size > maxID3FrameSize {
+			continue
+		}
+
+		// Compressed or encrypted frames can't be read as text.
+		if (major == 3 && frameFlags&0x00c0 != 0) || (major == 4 && frameFlags&0x000c != 0) {
+			continue
+		}
+
+		if major == 4 && frameFlags&0x0002 != 0 {
+			frame = bytes.ReplaceAll(frame, []byte{0xff, 0x00}, []byte{0xff})
+		}
+
+		// v2.4 frames can carry a data length indicator ahead of the data.
+		if major == 4 && frameFlags&0x0001 != 0 {
+			if len(frame) < 4 {
+				continue
+			}
+			frame = frame[4:]
+		}
+
+		if len(frame) < 1 {
+			continue
+		}
+
+		encoding := frame[0]
+		text := frame[1:]
+
+		// Comment frames have a language and a short description before the
+		// text itself.
+		if name == "comment" {
+			if len(text) < 3 {
+				continue
+			}
+			_, text = splitID3String(text[3:], encoding)
+		}
+
+		value, _ := splitID3String(text, encoding)
+
+		// v2.4 separates multiple values with NULs; keep the first.
+		addTag(tags, name, value)
+	}
+}
+
+// splitID3String decodes the first string in b, returning it and whatever
+// follows its terminator.
+func splitID3String(b []byte, encoding byte) (string, []byte) {
+	switch encoding {
+	case 1, 2:
+		// UTF-16 is terminated by a 16-bit NUL.
+		end := len(b)
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+
+		rest := b[end:]
+		if len(rest) >= 2 {
+			rest = rest[2:]
+		}
+
+		return decodeUTF16(b[:end], encoding == 2), rest
+	default:
+		end := bytes.IndexByte(b, 0)
+		rest := []byte{}
+
+		if end < 0 {
+			end = len(b)
+		} else {
+			rest = b[end+1:]
+		}
+
+		if encoding == 0 {
+			return decodeLatin1(b[:end]), rest
+		}
+
+		return string(b[:end]), rest
+	}
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xff && b[1] == 0xfe:
+			bigEndian = false
+			b = b[2:]
+		case b[0] == 0xfe && b[1] == 0xff:
+			bigEndian = true
+			b = b[2:]
+		}
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func decodeLatin1(b []byte) string {
+	var sb strings.Builder
+
+	for _, c := range b {
+		sb.WriteRune(rune(c))
+	}
+
+	return sb.String()
+}
+
+// syncsafe decodes a 28-bit integer stored in four bytes with the top bit of
+// each byte clear.
+func syncsafe(b []byte) (uint32, bool) {
+	var n uint32
+
+	for _, c := range b[:4] {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		n = n<<7 | uint32(c)
+	}
+
+	return n, true
+}
+
+// readID3v1 reads the fixed-size ID3v1 tag found in the last 128 bytes of
+// some MP3 files. It returns nil if there isn't one.
+func readID3v1(r io.ReadSeeker, size int64) (map[string]string, error) {
+	if size < 128 {
+		return nil, nil
+	}
+
+	_, err := r.Seek(size-128, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 128)
+
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(b[0:3], []byte("TAG")) {
+		return nil, nil
+	}
+
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return decodeLatin1(bytes.TrimRight(b, " "))
+	}
+
+	tags := map[string]string{}
+
+	addTag(tags, "title", field(b[3:33]))
+	addTag(tags, "artist", field(b[33:63]))
+	addTag(tags, "album", field(b[63:93]))
+	addTag(tags, "date", field(b[93:97]))
+	addTag(tags, "comment", field(b[97:127]))
+
+	return tags, nil
+}
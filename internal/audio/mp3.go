@@ -0,0 +1,312 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Bitrates in kbit/s indexed by [version row][layer][index], where the
+// version row is 0 for MPEG-1 and 1 for MPEG-2 and 2.5.
+var mp3Bitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+// Sample rates indexed by [version][index] for MPEG-1, 2 and 2.5.
+var mp3SampleRates = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// How far to look past the ID3 tag for the first frame before giving up.
+const maxMP3SyncSearch = 64 * 1024
+
+type mp3Frame struct {
+	version    int // 0 for MPEG-1, 1 for MPEG-2, 2 for MPEG-2.5
+	layer      int // 1, 2 or 3
+	bitrate    int // bits per second
+	sampleRate int
+	padding    int
+	channels   int
+	length     int
+	samples    int
+}
+
+func isFrameHeader(b []byte) bool {
+	_, ok := parseFrameHeader(b)
+	return ok
+}
+
+func parseFrameHeader(b []byte) (mp3Frame, bool) {
+	var f mp3Frame
+
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return f, false
+	}
+
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		f.version = 2
+	case 2:
+		f.version = 1
+	case 3:
+		f.version = 0
+	default:
+		return f, false
+	}
+
+	layerBits := (b[1] >> 1) & 0x03
+	if layerBits == 0 {
+		return f, false
+	}
+	f.layer = 4 - int(layerBits)
+
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 0x03
+
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return f, false
+	}
+
+	row := 0
+	if f.version != 0 {
+		row = 1
+	}
+
+	f.bitrate = mp3Bitrates[row][f.layer-1][bitrateIndex] * 1000
+	f.sampleRate = mp3SampleRates[f.version][sampleRateIndex]
+	f.padding = int(b[2]>>1) & 0x01
+
+	f.channels = 2
+	if b[3]>>6 == 3 {
+		f.channels = 1
+	}
+
+	switch f.layer {
+	case 1:
+		f.samples = 384
+		f.length = (12*f.bitrate/f.sampleRate + f.padding) * 4
+	case 2:
+		f.samples = 1152
+		f.length = 144*f.bitrate/f.sampleRate + f.padding
+	case 3:
+		if f.version == 0 {
+			f.samples = 1152
+			f.length = 144*f.bitrate/f.sampleRate + f.padding
+		} else {
+			f.samples = 576
+			f.length = 72*f.bitrate/f.sampleRate + f.padding
+		}
+	}
+
+	return f, f.length > 4
+}
+
+// sideInfoLength is the size of a Layer III frame's side information, which
+// sits between the header and any Xing/Info tag.
+func (f mp3Frame) sideInfoLength() int {
+	switch {
+	case f.version == 0 && f.channels == 2:
+		return 32
+	case f.version == 0:
+		return 17
+	case f.channels == 2:
+		return 17
+	default:
+		return 9
+	}
+}
+
+// probeMP3 reads the MPEG audio stream starting at or shortly after offset.
+// tags holds any ID3v2 tags that have already been read.
+func probeMP3(r io.ReadSeeker, size int64, offset int64, tags map[string]string) (*Info, error) {
+	frame, frameOffset, err := findFirstFrame(r, size, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Format:     FormatMP3,
+		SampleRate: frame.sampleRate,
+		Channels:   frame.channels,
+		Tags:       map[string]string{},
+	}
+
+	for key, value := range tags {
+		addTag(info.Tags, key, value)
+	}
+
+	audioEnd := size
+
+	v1, err := readID3v1(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if v1 != nil {
+		audioEnd -= 128
+
+		for key, value := range v1 {
+			if _, exists := info.Tags[key]; !exists {
+				addTag(info.Tags, key, value)
+			}
+		}
+	}
+
+	audioBytes := audioEnd - frameOffset
+
+	_, err = r.Seek(frameOffset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, frame.length)
+
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// VBR files carry a Xing/Info or VBRI tag in their first frame giving the
+	// real frame count, which the duration can't be worked out without.
+	frames, streamBytes, ok := readXingHeader(buf, frame)
+	if !ok {
+		frames, streamBytes, ok = readVBRIHeader(buf)
+	}
+
+	if ok && frames > 0 {
+		info.Duration = float64(frames) * float64(frame.samples) / float64(frame.sampleRate)
+
+		if streamBytes <= 0 {
+			streamBytes = audioBytes
+		}
+
+		info.Bitrate = bitrate(streamBytes, info.Duration)
+		return info, nil
+	}
+
+	// Otherwise assume a constant bitrate.
+	info.Bitrate = frame.bitrate
+	info.Duration = float64(audioBytes) * 8 / float64(frame.bitrate)
+
+	return info, nil
+}
+
+// findFirstFrame scans for the first MPEG audio frame header at or after
+// offset. A candidate is only accepted if another valid header follows it,
+// so stray sync bytes in leftover tag data aren't mistaken for audio.
+func findFirstFrame(r io.ReadSeeker, size int64, offset int64) (mp3Frame, int64, error) {
+	_, err := r.Seek(offset, io.SeekStart)
+	if err != nil {
+		return mp3Frame{}, 0, err
+	}
+
+	window := make([]byte, maxMP3SyncSearch+4)
+
+	n, err := io.ReadFull(r, window)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return mp3Frame{}, 0, err
+	}
+
+	window = window[:n]
+
+	for i := 0; i+4 <= len(window); i++ {
+		frame, ok := parseFrameHeader(window[i:])
+		if !ok {
+			continue
+		}
+
+		next := offset + int64(i) + int64(frame.length)
+
+		// A single frame that runs to the end of the file is fine.
+		if next+4 > size {
+			if next <= size {
+				return frame, offset + int64(i), nil
+			}
+			continue
+		}
+
+		header := make([]byte, 4)
+
+		_, err = r.Seek(next, io.SeekStart)
+		if err != nil {
+			return mp3Frame{}, 0, err
+		}
+
+		_, err = io.ReadFull(r, header)
+		if err != nil {
+			return mp3Frame{}, 0, err
+		}
+
+		if isFrameHeader(header) {
+			return frame, offset + int64(i), nil
+		}
+	}
+
+	return mp3Frame{}, 0, ErrMalformed
+}
+
+// readXingHeader reads the frame and byte counts from a Xing or Info tag in
+// the first frame of a Layer III stream.
+func readXingHeader(frame []byte, f mp3Frame) (int64, int64, bool) {
+	if f.layer != 3 {
+		return 0, 0, false
+	}
+
+	i := 4 + f.sideInfoLength()
+	if len(frame) < i+8 {
+		return 0, 0, false
+	}
+
+	id := frame[i : i+4]
+	if !bytes.Equal(id, []byte("Xing")) && !bytes.Equal(id, []byte("Info")) {
+		return 0, 0, false
+	}
+
+	flags := binary.BigEndian.Uint32(frame[i+4 : i+8])
+	i += 8
+
+	var frames, streamBytes int64
+
+	if flags&0x01 != 0 {
+		if len(frame) < i+4 {
+			return 0, 0, false
+		}
+		frames = int64(binary.BigEndian.Uint32(frame[i : i+4]))
+		i += 4
+	}
+
+	if flags&0x02 != 0 {
+		if len(frame) < i+4 {
+			return 0, 0, false
+		}
+		streamBytes = int64(binary.BigEndian.Uint32(frame[i : i+4]))
+	}
+
+	return frames, streamBytes, frames > 0
+}
+
+// readVBRIHeader reads the frame and byte counts from the Fraunhofer VBRI
+// tag, which always sits 32 bytes after the first frame's header.
+func readVBRIHeader(frame []byte) (int64, int64, bool) {
+	const i = 4 + 32
+
+	if len(frame) < i+18 || !bytes.Equal(frame[i:i+4], []byte("VBRI")) {
+		return 0, 0, false
+	}
+
+	streamBytes := int64(binary.BigEndian.Uint32(frame[i+10 : i+14]))
+	frames := int64(binary.BigEndian.Uint32(frame[i+14 : i+18]))
+
+	return frames, streamBytes, frames > 0
+}
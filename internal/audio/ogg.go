@@ -0,0 +1,201 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const oggPageHeaderSize = 27
+
+// Header packets are small, but comments can carry cover art. Anything
+// larger than this is not worth reassembling.
+const maxOggHeaderPacket = 1 << 20
+
+// How far back from the end of the file to look for the last page.
+const maxOggTailSearch = 64 * 1024
+
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	segments   []byte
+	length     int64 // header, segment table and body
+}
+
+func readOggPageHeader(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggPageHeaderSize)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[0:4], []byte("OggS")) || header[4] != 0 {
+		return nil, ErrMalformed
+	}
+
+	p := &oggPage{
+		headerType: header[5],
+		granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:     binary.LittleEndian.Uint32(header[14:18]),
+		segments:   make([]byte, header[26]),
+	}
+
+	_, err = io.ReadFull(r, p.segments)
+	if err != nil {
+		return nil, err
+	}
+
+	p.length = oggPageHeaderSize + int64(len(p.segments))
+	for _, n := range p.segments {
+		p.length += int64(n)
+	}
+
+	return p, nil
+}
+
+// probeOgg reads the identification and comment headers of the first logical
+// stream in an Ogg file, which must be Vorbis. The duration comes from the
+// granule position of the stream's last page.
+func probeOgg(r io.ReadSeeker, size int64) (*Info, error) {
+	packets, serial, err := readOggHeaderPackets(r, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	ident, comment := packets[0], packets[1]
+
+	if len(ident) < 30 || !bytes.Equal(ident[0:7], []byte("\x01vorbis")) {
+		return nil, ErrUnknownFormat
+	}
+
+	if len(comment) < 7 || !bytes.Equal(comment[0:7], []byte("\x03vorbis")) {
+		return nil, ErrMalformed
+	}
+
+	info := &Info{
+		Format:     FormatOgg,
+		Channels:   int(ident[11]),
+		SampleRate: int(binary.LittleEndian.Uint32(ident[12:16])),
+		Tags:       map[string]string{},
+	}
+
+	if info.Channels == 0 || info.SampleRate == 0 {
+		return nil, ErrMalformed
+	}
+
+	readVorbisComment(comment[7:], info.Tags)
+
+	granule, err := lastOggGranule(r, size, serial)
+	if err != nil {
+		return nil, err
+	}
+
+	if granule > 0 {
+		info.Duration = float64(granule) / float64(info.SampleRate)
+		info.Bitrate = bitrate(size, info.Duration)
+	} else {
+		// Fall back on the nominal bitrate from the header.
+		info.Bitrate = int(int32(binary.LittleEndian.Uint32(ident[20:24])))
+		if info.Bitrate < 0 {
+			info.Bitrate = 0
+		}
+	}
+
+	return info, nil
+}
+
+// readOggHeaderPackets reassembles the first n packets of the first logical
+// stream from the start of r, returning them and the stream's serial number.
+func readOggHeaderPackets(r io.ReadSeeker, n int) ([][]byte, uint32, error) {
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+	first := true
+
+	for len(packets) < n {
+		page, err := readOggPageHeader(r)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if first {
+			serial = page.serial
+			first = false
+		}
+
+		for _, segment := range page.segments {
+			body := make([]byte, segment)
+
+			_, err = io.ReadFull(r, body)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			// Pages from other multiplexed streams are read past but ignored.
+			if page.serial != serial || len(packets) >= n {
+				continue
+			}
+
+			current = append(current, body...)
+			if len(current) > maxOggHeaderPacket {
+				return nil, 0, ErrMalformed
+			}
+
+			// A segment shorter than 255 bytes ends the packet.
+			if segment < 255 {
+				packets = append(packets, current)
+				current = nil
+			}
+		}
+	}
+
+	return packets, serial, nil
+}
+
+// lastOggGranule finds the granule position of the last page belonging to
+// the given stream by scanning the end of the file.
+func lastOggGranule(r io.ReadSeeker, size int64, serial uint32) (int64, error) {
+	start := size - maxOggTailSearch
+	if start < 0 {
+		start = 0
+	}
+
+	_, err := r.Seek(start, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	tail := make([]byte, size-start)
+
+	_, err = io.ReadFull(r, tail)
+	if err != nil {
+		return 0, err
+	}
+
+	granule := int64(-1)
+
+	for i := 0; i+oggPageHeaderSize <= len(tail); i++ {
+		if !bytes.Equal(tail[i:i+4], []byte("OggS")) {
+			continue
+		}
+
+		page, err := readOggPageHeader(bytes.NewReader(tail[i:]))
+		if err != nil || page.serial != serial {
+			continue
+		}
+
+		// -1 means no packet finishes on this page.
+		if page.granule >= 0 {
+			granule = page.granule
+		}
+	}
+
+	return granule, nil
+}
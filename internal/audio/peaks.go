@@ -0,0 +1,136 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Peaks summarises a mono mix of a stream for drawing a waveform. For each
+// run of SamplesPerPixel samples, Data holds the minimum and maximum sample
+// scaled to 8 bits, in the layout of audiowaveform's JSON format.
+type Peaks struct {
+	SampleRate      int
+	SamplesPerPixel int
+	Data            []int8
+}
+
+// ComputePeaks decodes the WAV or FLAC file in r once and returns its peaks
+// at each of the given resolutions, in the same order. Every resolution must
+// be a multiple of the first, which must be the smallest. Formats that can
+// only be probed give ErrCannotDecode.
+func ComputePeaks(r io.ReadSeeker, samplesPerPixel []int) ([]*Peaks, error) {
+	if len(samplesPerPixel) == 0 || samplesPerPixel[0] < 1 {
+		return nil, errors.New("audio: no peak resolutions given")
+	}
+
+	finest := samplesPerPixel[0]
+
+	for _, spp := range samplesPerPixel {
+		if spp < finest || spp%finest != 0 {
+			return nil, fmt.Errorf("audio: peak resolution %d is not a multiple of %d", spp, finest)
+		}
+	}
+
+	dec, err := newDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []int8
+	var count int
+	var min, max float32
+
+	for {
+		samples, err := dec.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, ErrMalformed
+			}
+			return nil, err
+		}
+
+		for _, s := range samples {
+			if count == 0 || s < min {
+				min = s
+			}
+			if count == 0 || s > max {
+				max = s
+			}
+
+			count++
+
+			if count == finest {
+				data = append(data, quantise(min), quantise(max))
+				count = 0
+			}
+		}
+	}
+
+	// A final partial pixel still gets drawn.
+	if count > 0 {
+		data = append(data, quantise(min), quantise(max))
+	}
+
+	peaks := make([]*Peaks, len(samplesPerPixel))
+
+	for i, spp := range samplesPerPixel {
+		peaks[i] = &Peaks{
+			SampleRate:      dec.sampleRate(),
+			SamplesPerPixel: spp,
+			Data:            mergePeaks(data, spp/finest),
+		}
+	}
+
+	return peaks, nil
+}
+
+// mergePeaks combines every n pixels of data into one.
+func mergePeaks(data []int8, n int) []int8 {
+	if n == 1 {
+		return data
+	}
+
+	merged := make([]int8, 0, (len(data)/(2*n)+1)*2)
+
+	for i := 0; i < len(data); i += 2 * n {
+		end := i + 2*n
+		if end > len(data) {
+			end = len(data)
+		}
+
+		min, max := data[i], data[i+1]
+
+		for j := i + 2; j < end; j += 2 {
+			if data[j] < min {
+				min = data[j]
+			}
+			if data[j+1] > max {
+				max = data[j+1]
+			}
+		}
+
+		merged = append(merged, min, max)
+	}
+
+	return merged
+}
+
+// quantise scales a sample in [-1, 1] to 8 bits, clipping anything outside.
+func quantise(s float32) int8 {
+	v := s * 128
+
+	switch {
+	case v >= 127:
+		return 127
+	case v <= -128:
+		return -128
+	case v < 0:
+		return int8(v - 0.5)
+	default:
+		return int8(v + 0.5)
+	}
+}
@@ -0,0 +1,181 @@
+// Package audio reads technical metadata and tags from audio files without
+// decoding them. It understands WAV, MP3, FLAC and Ogg Vorbis.
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	FormatWAV  = "wav"
+	FormatMP3  = "mp3"
+	FormatFLAC = "flac"
+	FormatOgg  = "ogg"
+)
+
+var (
+	ErrUnknownFormat = errors.New("audio: unrecognised format")
+	ErrMalformed     = errors.New("audio: malformed file")
+)
+
+// Limits on the tags kept from a file, so that a hostile file can't bloat the
+// database row it is stored in.
+const (
+	maxTags           = 50
+	maxTagValueLength = 1000
+)
+
+// Info describes an audio file's stream and any tags embedded in it. Bitrate
+// is the average over the whole file in bits per second. BitsPerSample is
+// zero for compressed formats.
+type Info struct {
+	Format        string
+	Duration      float64
+	SampleRate    int
+	Channels      int
+	Bitrate       int
+	BitsPerSample int
+	Tags          map[string]string
+}
+
+// Probe identifies the format of the file in r from its contents and reads
+// its metadata. It returns ErrUnknownFormat if the file isn't one of the
+// supported formats and ErrMalformed if it is but can't be parsed.
+func Probe(r io.ReadSeeker) (*Info, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 12)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+
+	head = head[:n]
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *Info
+
+	switch {
+	case len(head) >= 12 && bytes.Equal(head[0:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		info, err = probeWAV(r, size)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		info, err = probeFLAC(r, size, 0)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		info, err = probeOgg(r, size)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		info, err = probeID3Prefixed(r, size)
+	case len(head) >= 4 && isFrameHeader(head):
+		info, err = probeMP3(r, size, 0, nil)
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrMalformed
+		}
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// probeID3Prefixed handles files starting with an ID3v2 tag. This is usual
+// for MP3, but some tools also put one in front of FLAC files.
+func probeID3Prefixed(r io.ReadSeeker, size int64) (*Info, error) {
+	tags, tagSize, err := readID3v2(r)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.Seek(tagSize, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+
+	_, err = io.ReadFull(r, magic)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(magic, []byte("fLaC")) {
+		_, err = r.Seek(tagSize, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := probeFLAC(r, size, tagSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range tags {
+			if _, exists := info.Tags[key]; !exists {
+				addTag(info.Tags, key, value)
+			}
+		}
+
+		return info, nil
+	}
+
+	return probeMP3(r, size, tagSize, tags)
+}
+
+// addTag stores a tag under its lower-cased name, ignoring empty values and
+// enforcing the tag limits.
+func addTag(tags map[string]string, key, value string) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+
+	if key == "" || value == "" || !utf8.ValidString(key) {
+		return
+	}
+
+	if _, exists := tags[key]; !exists && len(tags) >= maxTags {
+		return
+	}
+
+	if len(value) > maxTagValueLength {
+		value = value[:maxTagValueLength]
+		for !utf8.ValidString(value) {
+			value = value[:len(value)-1]
+		}
+	}
+
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "")
+	}
+
+	tags[key] = value
+}
+
+// bitrate works out the average bitrate of a stream from its length.
+func bitrate(bytes int64, duration float64) int {
+	if duration <= 0 {
+		return 0
+	}
+
+	return int(float64(bytes) * 8 / duration)
+}
@@ -0,0 +1,180 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Tags in a WAV file's LIST/INFO chunk, mapped to the names used by the
+// other formats.
+var wavInfoTags = map[string]string{
+	"INAM": "title",
+	"IART": "artist",
+	"IPRD": "album",
+	"ICRD": "date",
+	"IGNR": "genre",
+	"ICMT": "comment",
+	"ITRK": "tracknumber",
+	"ICOP": "copyright",
+	"ISFT": "encoder",
+}
+
+// WAV format codes.
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xfffe
+)
+
+// wavFormat is the contents of a WAV file's "fmt " chunk.
+type wavFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+func probeWAV(r io.ReadSeeker, size int64) (*Info, error) {
+	format, _, dataSize, tags, err := readWAVChunks(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Format:        FormatWAV,
+		SampleRate:    int(format.SampleRate),
+		Channels:      int(format.Channels),
+		BitsPerSample: int(format.BitsPerSample),
+		Bitrate:       int(format.ByteRate) * 8,
+		Tags:          tags,
+	}
+
+	if format.ByteRate > 0 {
+		info.Duration = float64(dataSize) / float64(format.ByteRate)
+	}
+
+	return info, nil
+}
+
+// readWAVChunks walks the chunks of a RIFF/WAVE file, returning its format,
+// the offset and size of its sample data, and any INFO tags.
+func readWAVChunks(r io.ReadSeeker, size int64) (*wavFormat, int64, int64, map[string]string, error) {
+	_, err := r.Seek(12, io.SeekStart)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+
+	var format *wavFormat
+	var dataOffset, dataSize int64 = -1, 0
+	tags := map[string]string{}
+
+	offset := int64(12)
+	header := make([]byte, 8)
+
+	for offset+8 <= size {
+		_, err = io.ReadFull(r, header)
+		if err != nil {
+			return nil, 0, 0, nil, err
+		}
+
+		id := string(header[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:8]))
+		body := offset + 8
+
+		switch id {
+		case "fmt ":
+			if chunkSize < 16 {
+				return nil, 0, 0, nil, ErrMalformed
+			}
+
+			var f wavFormat
+
+			err = binary.Read(r, binary.LittleEndian, &f)
+			if err != nil {
+				return nil, 0, 0, nil, err
+			}
+
+			// WAVE_FORMAT_EXTENSIBLE keeps the real format code at the start
+			// of the sub-format GUID.
+			if f.AudioFormat == wavFormatExtensible && chunkSize >= 40 {
+				ext := make([]byte, 24)
+
+				_, err = io.ReadFull(r, ext)
+				if err != nil {
+					return nil, 0, 0, nil, err
+				}
+
+				f.AudioFormat = binary.LittleEndian.Uint16(ext[8:10])
+			}
+
+			format = &f
+
+		case "data":
+			dataOffset = body
+
+			// Streaming writers leave the size unset; trust the file instead.
+			if chunkSize == 0 || chunkSize == 0xffffffff || body+chunkSize > size {
+				chunkSize = size - body
+			}
+
+			dataSize = chunkSize
+
+		case "LIST":
+			if chunkSize >= 4 && chunkSize <= 1<<20 {
+				list := make([]byte, chunkSize)
+
+				_, err = io.ReadFull(r, list)
+				if err != nil {
+					return nil, 0, 0, nil, err
+				}
+
+				if string(list[0:4]) == "INFO" {
+					readWAVInfo(list[4:], tags)
+				}
+			}
+		}
+
+		// Chunks are padded to an even length.
+		offset = body + chunkSize + chunkSize%2
+
+		_, err = r.Seek(offset, io.SeekStart)
+		if err != nil {
+			return nil, 0, 0, nil, err
+		}
+	}
+
+	if format == nil || dataOffset < 0 {
+		return nil, 0, 0, nil, ErrMalformed
+	}
+
+	if format.Channels == 0 || format.SampleRate == 0 || format.BlockAlign == 0 {
+		return nil, 0, 0, nil, ErrMalformed
+	}
+
+	return format, dataOffset, dataSize, tags, nil
+}
+
+func readWAVInfo(b []byte, tags map[string]string) {
+	for len(b) >= 8 {
+		id := string(b[0:4])
+		n := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+
+		if n > len(b) {
+			return
+		}
+
+		if name, ok := wavInfoTags[id]; ok {
+			addTag(tags, name, string(b[:n]))
+		}
+
+		n += n % 2
+		if n > len(b) {
+			return
+		}
+
+		b = b[n:]
+	}
+}
@@ -0,0 +1,295 @@
+// Package bandbook compiles the PDF charts for a list of tunes into a single
+// booklet, with a table of contents, a bookmark for each tune and numbered
+// pages.
+package bandbook
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/pdf"
+)
+
+// Book is a band book to be compiled. Its tunes appear in order.
+type Book struct {
+	Title string
+	Tunes []Tune
+}
+
+// Tune is one tune in a book, with the names of its charts in the order
+// they should appear. A tune without any charts is still listed in the
+// table of contents.
+type Tune struct {
+	Title string
+	Files []string
+}
+
+// Result describes a compiled book.
+type Result struct {
+	Pages int `json:"pages"`
+	// Skipped names the files that couldn't be read as PDFs and were left
+	// out of the book.
+	Skipped []string `json:"skipped"`
+}
+
+// Resource names of the fonts the book's own content uses. The page number
+// font is added to every copied page, so its name is unlikely to clash with
+// the page's own fonts.
+const (
+	regularFont    = pdf.Name("F1")
+	boldFont       = pdf.Name("F2")
+	pageNumberFont = pdf.Name("GazeboPageNumber")
+)
+
+// chart is a file that was read successfully, with its page count.
+type chart struct {
+	name  string
+	pages int
+}
+
+// Build compiles book, writing the PDF to w. read is called to get the
+// contents of each file, twice: once to count its pages so the table of
+// contents can be laid out, and once to copy them.
+func Build(w io.Writer, book Book, read func(name string) ([]byte, error)) (*Result, error) {
+	result := &Result{Skipped: []string{}}
+
+	charts := make([][]chart, len(book.Tunes))
+	chartPages := 0
+
+	for i, tune := range book.Tunes {
+		for _, name := range tune.Files {
+			_, pages, err := openChart(read, name)
+			if err != nil {
+				result.Skipped = append(result.Skipped, name)
+				continue
+			}
+
+			charts[i] = append(charts[i], chart{name: name, pages: len(pages)})
+			chartPages += len(pages)
+		}
+	}
+
+	tocPages := max(1, (len(book.Tunes)+entriesPerPage-1)/entriesPerPage)
+	result.Pages = tocPages + chartPages
+
+	pw := pdf.NewWriter(w)
+
+	pagesRef := pw.Alloc()
+
+	pageRefs := make([]pdf.Ref, result.Pages)
+	for i := range pageRefs {
+		pageRefs[i] = pw.Alloc()
+	}
+
+	regularRef, err := pw.Add(standardFont("Helvetica"))
+	if err != nil {
+		return nil, err
+	}
+
+	boldRef, err := pw.Add(standardFont("Helvetica-Bold"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out where each tune starts. Tunes without charts have no page,
+	// which firstPages records as -1.
+	firstPages := make([]int, len(book.Tunes))
+	page := tocPages
+
+	for i := range book.Tunes {
+		firstPages[i] = -1
+
+		for _, c := range charts[i] {
+			if firstPages[i] < 0 {
+				firstPages[i] = page
+			}
+			page += c.pages
+		}
+	}
+
+	toc := &contents{
+		title:      book.Title,
+		tunes:      book.Tunes,
+		firstPages: firstPages,
+		pageRefs:   pageRefs,
+	}
+
+	fonts := pdf.Dict{regularFont: regularRef, boldFont: boldRef}
+
+	for i := 0; i < tocPages; i++ {
+		err := toc.writePage(pw, i, pagesRef, fonts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	page = tocPages
+
+	for i := range book.Tunes {
+		for _, c := range charts[i] {
+			err := copyChart(pw, read, c, pageRefs[page:page+c.pages], page, pagesRef, regularRef)
+			if err != nil {
+				return nil, err
+			}
+			page += c.pages
+		}
+	}
+
+	kids := make(pdf.Array, len(pageRefs))
+	for i, ref := range pageRefs {
+		kids[i] = ref
+	}
+
+	err = pw.Write(pagesRef, pdf.Dict{
+		"Type":  pdf.Name("Pages"),
+		"Kids":  kids,
+		"Count": len(pageRefs),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	outlinesRef, err := writeOutlines(pw, book, firstPages, pageRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogRef, err := pw.Add(pdf.Dict{
+		"Type":     pdf.Name("Catalog"),
+		"Pages":    pagesRef,
+		"Outlines": outlinesRef,
+		"PageMode": pdf.Name("UseOutlines"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infoRef, err := pw.Add(pdf.Dict{
+		"Title":        pdf.EncodeText(book.Title),
+		"Producer":     pdf.String("Gazebo"),
+		"CreationDate": pdf.String(time.Now().UTC().Format("D:20060102150405Z")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = pw.Close(pdf.Dict{"Root": catalogRef, "Info": infoRef})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// openChart reads a file and its pages. Files without any pages are treated
+// as unreadable.
+func openChart(read func(name string) ([]byte, error), name string) (*pdf.Reader, []*pdf.Page, error) {
+	data, err := read(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := pdf.Open(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pages, err := r.Pages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(pages) == 0 {
+		return nil, nil, pdf.ErrMalformed
+	}
+
+	return r, pages, nil
+}
+
+// copyChart copies a chart's pages into the book at refs, numbering them
+// from first, which counts from zero.
+func copyChart(pw *pdf.Writer, read func(name string) ([]byte, error), c chart, refs []pdf.Ref, first int, parent, fontRef pdf.Ref) error {
+	r, pages, err := openChart(read, c.name)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) != c.pages {
+		return fmt.Errorf("bandbook: %s changed while the book was being built", c.name)
+	}
+
+	im := pw.Import(r)
+	fonts := pdf.Dict{pageNumberFont: fontRef}
+
+	for i, p := range pages {
+		err := im.ImportPage(refs[i], p, parent, pageNumber(p, first+i+1), fonts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeOutlines writes the bookmarks: one for the table of contents and one
+// for each tune that has charts.
+func writeOutlines(pw *pdf.Writer, book Book, firstPages []int, pageRefs []pdf.Ref) (pdf.Ref, error) {
+	outlinesRef := pw.Alloc()
+
+	type item struct {
+		title string
+		page  int
+	}
+
+	items := []item{{title: "Contents", page: 0}}
+
+	for i, tune := range book.Tunes {
+		if firstPages[i] >= 0 {
+			items = append(items, item{title: tune.Title, page: firstPages[i]})
+		}
+	}
+
+	refs := make([]pdf.Ref, len(items))
+	for i := range refs {
+		refs[i] = pw.Alloc()
+	}
+
+	for i, it := range items {
+		d := pdf.Dict{
+			"Title":  pdf.EncodeText(it.title),
+			"Parent": outlinesRef,
+			"Dest":   pdf.Array{pageRefs[it.page], pdf.Name("Fit")},
+		}
+
+		if i > 0 {
+			d["Prev"] = refs[i-1]
+		}
+		if i < len(refs)-1 {
+			d["Next"] = refs[i+1]
+		}
+
+		err := pw.Write(refs[i], d)
+		if err != nil {
+			return pdf.Ref{}, err
+		}
+	}
+
+	err := pw.Write(outlinesRef, pdf.Dict{
+		"Type":  pdf.Name("Outlines"),
+		"First": refs[0],
+		"Last":  refs[len(refs)-1],
+		"Count": len(refs),
+	})
+
+	return outlinesRef, err
+}
+
+func standardFont(name string) pdf.Dict {
+	return pdf.Dict{
+		"Type":     pdf.Name("Font"),
+		"Subtype":  pdf.Name("Type1"),
+		"BaseFont": pdf.Name(name),
+		"Encoding": pdf.Name("WinAnsiEncoding"),
+	}
+}
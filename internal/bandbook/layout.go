@@ -0,0 +1,205 @@
+package bandbook
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"gazebo.njvanhaute.com/internal/pdf"
+)
+
+// Table of contents layout, in points on a US Letter page.
+const (
+	pageWidth      = 612
+	pageHeight     = 792
+	margin         = 72
+	headingSize    = 20
+	entrySize      = 12
+	lineHeight     = 18
+	firstEntryY    = 680
+	entriesPerPage = (firstEntryY-margin)/lineHeight + 1
+)
+
+// Page numbers are set this far in from the bottom edge of a page.
+const (
+	pageNumberSize   = 9
+	pageNumberMargin = 18
+)
+
+// helveticaWidths are the widths of the printable ASCII characters in
+// Helvetica, in thousandths of the font size. Other characters are taken to
+// be as wide as a digit, which is close enough for laying out a line.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth returns the width of s, encoded in WinAnsiEncoding, when set in
+// Helvetica at the given size. Helvetica-Bold is a little wider, but not by
+// enough to matter for the few places it is used.
+func textWidth(s pdf.String, size float64) float64 {
+	w := 0
+
+	for _, c := range s {
+		switch {
+		case c >= 0x20 && c < 0x7f:
+			w += helveticaWidths[c-0x20]
+		case c == 0x85:
+			w += 1000
+		default:
+			w += 556
+		}
+	}
+
+	return float64(w) * size / 1000
+}
+
+// fit encodes s, cutting it short with an ellipsis if it is wider than
+// width.
+func fit(s string, size, width float64) pdf.String {
+	enc := pdf.EncodeWinAnsi(s)
+	if textWidth(enc, size) <= width {
+		return enc
+	}
+
+	runes := []rune(s)
+
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+
+		enc = pdf.EncodeWinAnsi(string(runes) + "…")
+		if textWidth(enc, size) <= width {
+			return enc
+		}
+	}
+
+	return nil
+}
+
+// num formats a coordinate for a content stream.
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// showText appends the operators that set s at (x, y).
+func showText(b *bytes.Buffer, font pdf.Name, size, x, y float64, s pdf.String) {
+	fmt.Fprintf(b, "BT %s %s Tf %s %s Td %s Tj ET\n",
+		pdf.AppendObject(nil, font), num(size), num(x), num(y), pdf.AppendObject(nil, s))
+}
+
+// contents lays out the table of contents.
+type contents struct {
+	title      string
+	tunes      []Tune
+	firstPages []int
+	pageRefs   []pdf.Ref
+}
+
+// writePage writes the nth page of the table of contents. Each entry links
+// to the tune's first page.
+func (c *contents) writePage(pw *pdf.Writer, n int, parent pdf.Ref, fonts pdf.Dict) error {
+	var b bytes.Buffer
+	var annots pdf.Array
+
+	b.WriteString("0 g\n")
+	showText(&b, boldFont, headingSize, margin, pageHeight-margin-headingSize, fit(c.title, headingSize, pageWidth-2*margin))
+
+	start := n * entriesPerPage
+	end := min(start+entriesPerPage, len(c.tunes))
+
+	for i := start; i < end; i++ {
+		y := float64(firstEntryY - (i-start)*lineHeight)
+
+		label := "–"
+		if c.firstPages[i] >= 0 {
+			label = strconv.Itoa(c.firstPages[i] + 1)
+		}
+
+		number := pdf.EncodeWinAnsi(label)
+		numberX := pageWidth - margin - textWidth(number, entrySize)
+		showText(&b, regularFont, entrySize, numberX, y, number)
+
+		title := fit(fmt.Sprintf("%d. %s", i+1, c.tunes[i].Title), entrySize, numberX-margin-24)
+		showText(&b, regularFont, entrySize, margin, y, title)
+
+		// Dot leaders run from just after the title to just before the
+		// page number.
+		dots := pdf.String(". ")
+		dotWidth := textWidth(dots, entrySize)
+		room := numberX - 6 - (margin + textWidth(title, entrySize) + 6)
+
+		if count := int(room / dotWidth); count > 0 {
+			leader := bytes.Repeat(dots, count)
+			showText(&b, regularFont, entrySize, numberX-6-float64(count)*dotWidth, y, leader)
+		}
+
+		if c.firstPages[i] >= 0 {
+			annots = append(annots, pdf.Dict{
+				"Type":    pdf.Name("Annot"),
+				"Subtype": pdf.Name("Link"),
+				"Rect":    pdf.Array{margin, y - 4, pageWidth - margin, y + entrySize},
+				"Border":  pdf.Array{0, 0, 0},
+				"Dest":    pdf.Array{c.pageRefs[c.firstPages[i]], pdf.Name("Fit")},
+			})
+		}
+	}
+
+	showText(&b, regularFont, pageNumberSize, pageWidth/2-textWidth(pdf.String(strconv.Itoa(n+1)), pageNumberSize)/2,
+		pageNumberMargin, pdf.String(strconv.Itoa(n+1)))
+
+	contentRef, err := pw.Add(&pdf.Stream{Dict: pdf.Dict{}, Data: b.Bytes()})
+	if err != nil {
+		return err
+	}
+
+	page := pdf.Dict{
+		"Type":      pdf.Name("Page"),
+		"Parent":    parent,
+		"MediaBox":  pdf.Array{0, 0, pageWidth, pageHeight},
+		"Resources": pdf.Dict{"Font": fonts},
+		"Contents":  contentRef,
+	}
+
+	if len(annots) > 0 {
+		page["Annots"] = annots
+	}
+
+	return pw.Write(c.pageRefs[n], page)
+}
+
+// pageNumber returns content that sets the number n at the bottom centre of
+// a page as it is displayed, allowing for the page's rotation.
+func pageNumber(p *pdf.Page, n int) []byte {
+	x0, y0, x1, y1 := p.Box()
+	cx, cy := (x0+x1)/2, (y0+y1)/2
+
+	label := pdf.String(strconv.Itoa(n))
+	half := textWidth(label, pageNumberSize) / 2
+
+	// The text matrix turns the text against the page's rotation, which is
+	// clockwise, and starts it half its width before the centre.
+	var a, b, c, d, x, y float64
+
+	switch ((p.Rotate % 360) + 360) % 360 {
+	case 90:
+		a, b, c, d = 0, 1, -1, 0
+		x, y = x1-pageNumberMargin, cy-half
+	case 180:
+		a, b, c, d = -1, 0, 0, -1
+		x, y = cx+half, y1-pageNumberMargin
+	case 270:
+		a, b, c, d = 0, -1, 1, 0
+		x, y = x0+pageNumberMargin, cy+half
+	default:
+		a, b, c, d = 1, 0, 0, 1
+		x, y = cx-half, y0+pageNumberMargin
+	}
+
+	return []byte(fmt.Sprintf("0 g BT %s %d Tf %s %s %s %s %s %s Tm %s Tj ET\n",
+		pdf.AppendObject(nil, pageNumberFont), pageNumberSize,
+		num(a), num(b), num(c), num(d), num(x), num(y), pdf.AppendObject(nil, label)))
+}
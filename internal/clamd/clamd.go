@@ -0,0 +1,245 @@
+// Package clamd scans files for malware by streaming them to a ClamAV daemon
+// with its INSTREAM command.
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize is how much of a file is sent to clamd in each chunk of a stream.
+const chunkSize = 64 << 10
+
+// Client scans files with the clamd listening at an address.
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// New returns a client for the clamd at address, which is either a TCP
+// address such as "localhost:3310", optionally written as
+// "tcp://localhost:3310", or a Unix socket such as "unix:///run/clamd.ctl".
+// Each scan must finish within timeout.
+func New(address string, timeout time.Duration) (*Client, error) {
+	c := &Client{network: "tcp", address: address, timeout: timeout}
+
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		c.network, c.address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "unix:"):
+		c.network, c.address = "unix", strings.TrimPrefix(address, "unix:")
+	case strings.HasPrefix(address, "tcp://"):
+		c.address = strings.TrimPrefix(address, "tcp://")
+	}
+
+	if c.address == "" {
+		return nil, fmt.Errorf("clamd: invalid address %q", address)
+	}
+
+	return c, nil
+}
+
+// Result is the outcome of a scan. Signature names the malware found in an
+// infected file.
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Error is an error reported by clamd about a scan, such as a file larger
+// than its StreamMaxLength, as opposed to a failure to reach it. Scanning the
+// same file again would fail in the same way.
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return "clamd: " + e.Message
+}
+
+// Scan sends everything read from r to clamd and returns its verdict.
+func (c *Client) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return nil, err
+	}
+
+	readErr, writeErr := writeStream(conn, r)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	if writeErr != nil {
+		// clamd stops reading and says why when a stream is too long, so
+		// its reply is more useful than the write error.
+		if reply, err := readReply(conn); err == nil && strings.HasSuffix(reply, "ERROR") {
+			return nil, &Error{Message: strings.TrimSpace(strings.TrimSuffix(reply, "ERROR"))}
+		}
+		return nil, writeErr
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseReply(reply)
+}
+
+// Ping checks that clamd is answering.
+func (c *Client) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("zPING\x00"))
+	if err != nil {
+		return err
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: unexpected reply to PING: %q", reply)
+	}
+
+	return nil
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// Closing the connection when the context is done interrupts whatever
+	// read or write is under way.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	return &contextConn{Conn: conn, stop: stop, cancel: cancel}, nil
+}
+
+// contextConn releases its context when it is closed.
+type contextConn struct {
+	net.Conn
+	stop   func() bool
+	cancel context.CancelFunc
+}
+
+func (c *contextConn) Close() error {
+	c.stop()
+	c.cancel()
+	return c.Conn.Close()
+}
+
+// writeStream sends r as a series of chunks, each preceded by its length as
+// a 4-byte big-endian integer, ending with a chunk of length zero. Only io.EOF
+// from r ends the stream; any other error reading r, including
+// io.ErrUnexpectedEOF from a file cut short, is returned as readErr without
+// ending it, so that clamd never gives a verdict on part of a file. Errors
+// sending to w are returned as writeErr.
+func writeStream(w io.Writer, r io.Reader) (readErr, writeErr error) {
+	buf := make([]byte, 4+chunkSize)
+
+	for {
+		n, err := readChunk(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+
+			_, werr := w.Write(buf[:4+n])
+			if werr != nil {
+				return nil, werr
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return nil, err
+}
+
+// readChunk fills buf from r, stopping early only if r returns an error.
+// Unlike io.ReadFull, it passes on r's error as it is, so that the end of r
+// can be told apart from r being cut short.
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n := 0
+
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// readReply reads a null-terminated reply, as asked for by prefixing the
+// command with "z".
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadBytes(0)
+	if err != nil && !(errors.Is(err, io.EOF) && len(reply) > 0) {
+		return "", err
+	}
+
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// parseReply interprets a reply to INSTREAM: "stream: OK" for a clean file,
+// "stream: <signature> FOUND" for an infected one, or a message ending in
+// "ERROR".
+func parseReply(reply string) (*Result, error) {
+	msg := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case msg == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(msg, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(msg, " FOUND")}, nil
+	case strings.HasSuffix(msg, "ERROR"):
+		return nil, &Error{Message: strings.TrimSpace(strings.TrimSuffix(msg, "ERROR"))}
+	default:
+		return nil, fmt.Errorf("clamd: unexpected reply: %q", reply)
+	}
+}
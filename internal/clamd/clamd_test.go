@@ -0,0 +1,291 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers PING and INSTREAM like clamd, finding "malware" in any
+// stream containing the EICAR test string. Streams longer than maxStream are
+// refused as clamd does once StreamMaxLength is reached. If stall is set, it
+// reads the stream but never replies.
+type fakeClamd struct {
+	maxStream int
+	stall     bool
+
+	// streams receives each complete stream the fake is sent.
+	streams chan []byte
+}
+
+func startFakeClamd(t *testing.T, network, address string, fake *fakeClamd) string {
+	t.Helper()
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	if fake.streams == nil {
+		fake.streams = make(chan []byte, 16)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go fake.serve(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+
+	cmd, err := br.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch cmd {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+		return
+	case "zINSTREAM\x00":
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var stream bytes.Buffer
+
+	for {
+		var n uint32
+
+		err := binary.Read(br, binary.BigEndian, &n)
+		if err != nil {
+			return
+		}
+
+		if n == 0 {
+			break
+		}
+
+		if stream.Len()+int(n) > f.maxStream {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+
+		_, err = io.CopyN(&stream, br, int64(n))
+		if err != nil {
+			return
+		}
+	}
+
+	f.streams <- stream.Bytes()
+
+	if f.stall {
+		io.Copy(io.Discard, br)
+		return
+	}
+
+	if bytes.Contains(stream.Bytes(), []byte(eicar)) {
+		conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+	} else {
+		conn.Write([]byte("stream: OK\x00"))
+	}
+}
+
+func TestScan(t *testing.T) {
+	fake := &fakeClamd{maxStream: 1 << 20}
+	addr := startFakeClamd(t, "tcp", "127.0.0.1:0", fake)
+
+	c, err := New("tcp://"+addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		body      []byte
+		infected  bool
+		signature string
+	}{
+		{"empty", nil, false, ""},
+		{"clean", []byte("%PDF-1.4 a harmless chart"), false, ""},
+		{"clean over several chunks", bytes.Repeat([]byte("x"), 3*chunkSize+17), false, ""},
+		{"infected", []byte(eicar), true, "Win.Test.EICAR_HDB-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := c.Scan(context.Background(), bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Infected != tt.infected || result.Signature != tt.signature {
+				t.Errorf("got %+v; want infected %v, signature %q", result, tt.infected, tt.signature)
+			}
+
+			if got := <-fake.streams; !bytes.Equal(got, tt.body) {
+				t.Errorf("clamd received %d bytes; want %d", len(got), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestScanTooLong(t *testing.T) {
+	addr := startFakeClamd(t, "tcp", "127.0.0.1:0", &fakeClamd{maxStream: 1000})
+
+	c, err := New(addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Scan(context.Background(), bytes.NewReader(make([]byte, 4<<20)))
+
+	var clamdErr *Error
+	if !errors.As(err, &clamdErr) {
+		t.Fatalf("got error %v; want a *clamd.Error", err)
+	}
+
+	if clamdErr.Message != "INSTREAM size limit exceeded." {
+		t.Errorf("got message %q", clamdErr.Message)
+	}
+}
+
+func TestScanTimeout(t *testing.T) {
+	addr := startFakeClamd(t, "tcp", "127.0.0.1:0", &fakeClamd{maxStream: 1 << 20, stall: true})
+
+	c, err := New(addr, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	_, err = c.Scan(context.Background(), strings.NewReader("hello"))
+	if err == nil {
+		t.Fatal("got no error; want a timeout")
+	}
+
+	var clamdErr *Error
+	if errors.As(err, &clamdErr) {
+		t.Errorf("got %v; a timeout isn't clamd's verdict on the file", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("scan took %v to time out", elapsed)
+	}
+}
+
+// truncatedReader returns n bytes and then io.ErrUnexpectedEOF, as a stored
+// file cut short does.
+type truncatedReader struct {
+	n int
+}
+
+func (r *truncatedReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	n := min(len(p), r.n)
+	r.n -= n
+
+	return n, nil
+}
+
+func TestScanTruncatedReader(t *testing.T) {
+	fake := &fakeClamd{maxStream: 1 << 20}
+	addr := startFakeClamd(t, "tcp", "127.0.0.1:0", fake)
+
+	c, err := New(addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{0, 10, chunkSize, chunkSize + 10} {
+		_, err = c.Scan(context.Background(), &truncatedReader{n: n})
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("after %d bytes: got error %v; want io.ErrUnexpectedEOF", n, err)
+		}
+	}
+
+	select {
+	case stream := <-fake.streams:
+		t.Errorf("clamd was sent a complete stream of %d bytes", len(stream))
+	default:
+	}
+}
+
+func TestPingUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "clamd.ctl")
+	startFakeClamd(t, "unix", sock, &fakeClamd{})
+
+	c, err := New("unix://"+sock, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		addr    string
+		valid   bool
+	}{
+		{"localhost:3310", "tcp", "localhost:3310", true},
+		{"tcp://localhost:3310", "tcp", "localhost:3310", true},
+		{"unix:///run/clamd.ctl", "unix", "/run/clamd.ctl", true},
+		{"unix:/run/clamd.ctl", "unix", "/run/clamd.ctl", true},
+		{"", "", "", false},
+		{"tcp://", "", "", false},
+	}
+
+	for _, tt := range tests {
+		c, err := New(tt.address, time.Second)
+
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("New(%q): got no error", tt.address)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.address, err)
+			continue
+		}
+
+		if c.network != tt.network || c.address != tt.addr {
+			t.Errorf("New(%q): got %s %s; want %s %s", tt.address, c.network, c.address, tt.network, tt.addr)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+type TuneAlias struct {
+	ID        int64     `json:"id"`
+	TuneID    int64     `json:"tune_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Title     string    `json:"title"`
+	Note      string    `json:"note,omitempty"`
+}
+
+type TuneAliasModel struct {
+	DB *sql.DB
+}
+
+func ValidateTuneAlias(v *validator.Validator, alias *TuneAlias) {
+	v.Check(alias.Title != "", "title", "must be provided")
+	v.Check(len(alias.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(len(alias.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
+
+func (a TuneAliasModel) Insert(alias *TuneAlias) error {
+	query := `
+		INSERT INTO tune_aliases (tune_id, title, note)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	args := []any{alias.TuneID, alias.Title, alias.Note}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return a.DB.QueryRowContext(ctx, query, args...).Scan(&alias.ID, &alias.CreatedAt)
+}
+
+func (a TuneAliasModel) Get(id int64) (*TuneAlias, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, tune_id, created_at, title, note
+		FROM tune_aliases
+		WHERE id = $1`
+
+	var alias TuneAlias
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := a.DB.QueryRowContext(ctx, query, id).Scan(
+		&alias.ID,
+		&alias.TuneID,
+		&alias.CreatedAt,
+		&alias.Title,
+		&alias.Note,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &alias, nil
+}
+
+func (a TuneAliasModel) GetAllForTune(tuneID int64) ([]*TuneAlias, error) {
+	query := `
+		SELECT id, tune_id, created_at, title, note
+		FROM tune_aliases
+		WHERE tune_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := a.DB.QueryContext(ctx, query, tuneID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	aliases := []*TuneAlias{}
+
+	for rows.Next() {
+		var alias TuneAlias
+
+		err := rows.Scan(
+			&alias.ID,
+			&alias.TuneID,
+			&alias.CreatedAt,
+			&alias.Title,
+			&alias.Note,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		aliases = append(aliases, &alias)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+func (a TuneAliasModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM tune_aliases
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := a.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/lib/pq"
+)
+
+// BandBook is a PDF compiled from the charts of a list of tunes, in order.
+// Instrument, if set, limits the charts to those meant for it.
+type BandBook struct {
+	ID                 int64     `json:"id"`
+	BandID             int64     `json:"band_id"`
+	OwnerID            int64     `json:"owner_id"`
+	CreatedAt          time.Time `json:"created_at"`
+	Title              string    `json:"title"`
+	TuneIDs            []int64   `json:"tune_ids"`
+	Instrument         string    `json:"instrument"`
+	Status             string    `json:"status"`
+	FilePath           string    `json:"-"`
+	PageCount          int       `json:"page_count"`
+	SkippedDocumentIDs []int64   `json:"skipped_document_ids"`
+}
+
+// Band book statuses. A book is pending until its PDF has been built.
+const (
+	BandBookPending = "pending"
+	BandBookReady   = "ready"
+	BandBookFailed  = "failed"
+)
+
+type BandBookModel struct {
+	DB *sql.DB
+}
+
+func ValidateBandBook(v *validator.Validator, book *BandBook) {
+	v.Check(book.Title != "", "title", "must be provided")
+	v.Check(len(book.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(len(book.TuneIDs) >= 1, "tune_ids", "must contain at least 1 tune")
+	v.Check(len(book.TuneIDs) <= 200, "tune_ids", "must not contain more than 200 tunes")
+	v.Check(validator.Unique(book.TuneIDs), "tune_ids", "must not contain duplicate values")
+
+	for _, id := range book.TuneIDs {
+		v.Check(id > 0, "tune_ids", "must contain positive integers")
+	}
+
+	v.Check(len(book.Instrument) <= 100, "instrument", "must not be more than 100 bytes long")
+}
+
+func (m BandBookModel) Insert(book *BandBook) error {
+	query := `
+		INSERT INTO band_books (band_id, owner_id, title, tune_ids, instrument, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	args := []any{book.BandID, book.OwnerID, book.Title, pq.Array(book.TuneIDs), book.Instrument, book.Status}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if book.SkippedDocumentIDs == nil {
+		book.SkippedDocumentIDs = []int64{}
+	}
+
+	return nil
+}
+
+func (m BandBookModel) Get(id int64) (*BandBook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, band_id, owner_id, created_at, title, tune_ids, instrument, status,
+			file_path, page_count, skipped_document_ids
+		FROM band_books
+		WHERE id = $1`
+
+	books, err := m.query(query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(books) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return books[0], nil
+}
+
+func (m BandBookModel) GetAllForBand(bandID int64) ([]*BandBook, error) {
+	query := `
+		SELECT id, band_id, owner_id, created_at, title, tune_ids, instrument, status,
+			file_path, page_count, skipped_document_ids
+		FROM band_books
+		WHERE band_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	return m.query(query, bandID)
+}
+
+// GetAllPending returns the books that haven't been built yet, oldest first.
+func (m BandBookModel) GetAllPending() ([]*BandBook, error) {
+	query := `
+		SELECT id, band_id, owner_id, created_at, title, tune_ids, instrument, status,
+			file_path, page_count, skipped_document_ids
+		FROM band_books
+		WHERE status = $1
+		ORDER BY created_at, id`
+
+	return m.query(query, BandBookPending)
+}
+
+// SetBuilt records the outcome of building a book: its status and, if it was
+// built, its file, page count and the documents that were left out. It
+// returns ErrRecordNotFound if the book was deleted in the meantime.
+func (m BandBookModel) SetBuilt(book *BandBook) error {
+	query := `
+		UPDATE band_books
+		SET status = $1, file_path = $2, page_count = $3, skipped_document_ids = $4
+		WHERE id = $5`
+
+	args := []any{book.Status, book.FilePath, book.PageCount, pq.Array(book.SkippedDocumentIDs), book.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m BandBookModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM band_books
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m BandBookModel) query(query string, args ...any) ([]*BandBook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	books := []*BandBook{}
+
+	for rows.Next() {
+		var book BandBook
+
+		err := rows.Scan(
+			&book.ID,
+			&book.BandID,
+			&book.OwnerID,
+			&book.CreatedAt,
+			&book.Title,
+			pq.Array(&book.TuneIDs),
+			&book.Instrument,
+			&book.Status,
+			&book.FilePath,
+			&book.PageCount,
+			pq.Array(&book.SkippedDocumentIDs),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
@@ -128,7 +128,7 @@ func (b BandMemberModel) GetAllUsersForBand(id int64) ([]*User, error) {
 	}
 
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.activated
+		SELECT users.id, users.created_at, users.name, users.email, users.activated, users.instrument
 		FROM users, band_members
 		WHERE users.id = band_members.user_id
 		AND band_members.band_id = $1`
@@ -154,6 +154,7 @@ func (b BandMemberModel) GetAllUsersForBand(id int64) ([]*User, error) {
 			&user.Email,
 			&user.Name,
 			&user.Activated,
+			&user.Instrument,
 		)
 
 		if err != nil {
@@ -170,20 +171,29 @@ func (b BandMemberModel) GetAllUsersForBand(id int64) ([]*User, error) {
 	return users, nil
 }
 
+// Delete removes the user from the band, along with their favorites on the
+// band's tunes and documents.
 func (b BandMemberModel) Delete(member *BandMember) error {
 	if member.BandID < 1 || member.UserID < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `
+	deleteMemberQuery := `
 		DELETE FROM band_members
 		WHERE band_id = $1
 		AND user_id = $2`
 
+	tx, err := b.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := b.DB.ExecContext(ctx, query, member.BandID, member.UserID)
+	result, err := tx.ExecContext(ctx, deleteMemberQuery, member.BandID, member.UserID)
 	if err != nil {
 		return err
 	}
@@ -197,5 +207,30 @@ func (b BandMemberModel) Delete(member *BandMember) error {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	deleteTuneFavoritesQuery := `
+		DELETE FROM tune_favorites
+		USING tunes
+		WHERE tunes.id = tune_favorites.tune_id
+		AND tunes.band_id = $1
+		AND tune_favorites.user_id = $2`
+
+	_, err = tx.ExecContext(ctx, deleteTuneFavoritesQuery, member.BandID, member.UserID)
+	if err != nil {
+		return err
+	}
+
+	deleteDocumentFavoritesQuery := `
+		DELETE FROM document_favorites
+		USING documents, tunes
+		WHERE documents.id = document_favorites.document_id
+		AND tunes.id = documents.tune_id
+		AND tunes.band_id = $1
+		AND document_favorites.user_id = $2`
+
+	_, err = tx.ExecContext(ctx, deleteDocumentFavoritesQuery, member.BandID, member.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -128,31 +128,28 @@ func (b BandModel) Update(band *Band) error {
 	return nil
 }
 
-func (b BandModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
-	}
+// Delete deletes a band along with its tunes, documents, recordings and
+// band books, returning the paths of the files they held.
+func (b BandModel) Delete(id int64) ([]string, error) {
+	filesQuery := `
+		SELECT v.file_path
+		FROM document_versions v
+		INNER JOIN documents d ON d.id = v.document_id
+		INNER JOIN tunes t ON t.id = d.tune_id
+		WHERE t.band_id = $1
+		UNION
+		SELECT d.file_path
+		FROM documents d
+		INNER JOIN tunes t ON t.id = d.tune_id
+		WHERE t.band_id = $1
+		UNION
+		SELECT file_path FROM recordings WHERE band_id = $1
+		UNION
+		SELECT file_path FROM band_books WHERE band_id = $1 AND file_path <> ''`
 
 	query := `
 		DELETE FROM bands
 		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := b.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
-
-	return nil
+	return deleteWithFiles(b.DB, filesQuery, query, id)
 }
@@ -0,0 +1,409 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BlobGracePeriod is how long a blob is kept after being claimed even if
+// nothing refers to it, giving the upload that claimed it time to record
+// the row that will.
+const BlobGracePeriod = 15 * time.Minute
+
+// Blob is a stored file body, named by the hex SHA-256 hash of its contents
+// so that identical files are only stored once. Document versions,
+// recordings and band books refer to blobs by file path (see BlobKey), and
+// RefCount counts those references. The count is kept by triggers in the
+// database, so rows removed by cascading deletes are counted too; documents
+// aren't counted, since a document's file is always also its latest
+// version's.
+type Blob struct {
+	Hash      string
+	Size      int64
+	RefCount  int
+	CreatedAt time.Time
+	ClaimedAt time.Time
+}
+
+// BlobKey returns the file path a blob is stored under.
+func BlobKey(hash string) string {
+	return "blobs/" + hash[:2] + "/" + hash
+}
+
+// BlobHash returns the hash of the blob stored under a file path. It returns
+// false for files stored before files were named by their contents.
+func BlobHash(path string) (string, bool) {
+	if len(path) < 64 {
+		return "", false
+	}
+
+	hash := path[len(path)-64:]
+
+	if strings.Trim(hash, "0123456789abcdef") != "" || BlobKey(hash) != path {
+		return "", false
+	}
+
+	return hash, true
+}
+
+type BlobModel struct {
+	DB *sql.DB
+}
+
+// Claim records a blob that is about to be stored or referred to, or marks
+// an existing one as just claimed so that it isn't deleted before the
+// reference to it is recorded.
+func (m BlobModel) Claim(hash string, size int64) error {
+	query := `
+		INSERT INTO blobs (hash, size)
+		VALUES ($1, $2)
+		ON CONFLICT (hash) DO UPDATE SET claimed_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, hash, size)
+	return err
+}
+
+// DeleteIfUnused deletes a blob's record if nothing refers to it and it
+// hasn't been claimed for BlobGracePeriod, calling remove to delete its file
+// first. The record stays locked while remove runs, so the blob can't be
+// claimed again until its file is gone. It returns false if the blob was
+// kept.
+func (m BlobModel) DeleteIfUnused(hash string, remove func() error) (bool, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT hash
+		FROM blobs
+		WHERE hash = $1 AND ref_count <= 0 AND claimed_at < $2
+		FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, hash, time.Now().Add(-BlobGracePeriod)).Scan(&hash)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	err = remove()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM blobs WHERE hash = $1`, hash)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetLegacyFilePaths returns the file paths of stored files that aren't
+// blobs, having been stored before files were named by their contents.
+// Quarantined files aren't included.
+func (m BlobModel) GetLegacyFilePaths() ([]string, error) {
+	query := `
+		SELECT file_path FROM documents WHERE file_path NOT LIKE 'blobs/%' AND file_path NOT LIKE 'quarantine/%'
+		UNION
+		SELECT file_path FROM document_versions WHERE file_path NOT LIKE 'blobs/%' AND file_path NOT LIKE 'quarantine/%'
+		UNION
+		SELECT file_path FROM recordings WHERE file_path NOT LIKE 'blobs/%' AND file_path NOT LIKE 'quarantine/%'
+		UNION
+		SELECT file_path FROM band_books WHERE file_path NOT LIKE 'blobs/%' AND file_path <> ''`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	paths := []string{}
+
+	for rows.Next() {
+		var path string
+
+		err := rows.Scan(&path)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// ReplaceFilePath points every row that refers to the file at oldPath to the
+// one at newPath instead.
+func (m BlobModel) ReplaceFilePath(oldPath, newPath string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	for _, table := range []string{"documents", "document_versions", "recordings", "band_books"} {
+		_, err = tx.ExecContext(ctx, `UPDATE `+table+` SET file_path = $1 WHERE file_path = $2`, newPath, oldPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Get returns a blob's record.
+func (m BlobModel) Get(hash string) (*Blob, error) {
+	query := `
+		SELECT hash, size, ref_count, created_at, claimed_at
+		FROM blobs
+		WHERE hash = $1`
+
+	var blob Blob
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash).Scan(
+		&blob.Hash,
+		&blob.Size,
+		&blob.RefCount,
+		&blob.CreatedAt,
+		&blob.ClaimedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &blob, nil
+}
+
+// GetUnused returns the hashes of blobs that nothing refers to and that
+// haven't been claimed for BlobGracePeriod.
+func (m BlobModel) GetUnused() ([]string, error) {
+	query := `
+		SELECT hash
+		FROM blobs
+		WHERE ref_count <= 0 AND claimed_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-BlobGracePeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hashes := []string{}
+
+	for rows.Next() {
+		var hash string
+
+		err := rows.Scan(&hash)
+		if err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// FileRef is a row that refers to a stored file: a document, a document
+// version, a recording or a band book.
+type FileRef struct {
+	Table string `json:"table"`
+	ID    int64  `json:"id"`
+	Path  string `json:"file_path"`
+}
+
+// GetFileRefs returns every row that refers to a stored file.
+func (m BlobModel) GetFileRefs() ([]FileRef, error) {
+	query := `
+		SELECT 'documents', id, file_path FROM documents
+		UNION ALL
+		SELECT 'document_versions', id, file_path FROM document_versions
+		UNION ALL
+		SELECT 'recordings', id, file_path FROM recordings
+		UNION ALL
+		SELECT 'band_books', id, file_path FROM band_books WHERE file_path <> ''`
+
+	// Every file is listed, so this is given longer than most queries.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	refs := []FileRef{}
+
+	for rows.Next() {
+		var ref FileRef
+
+		err := rows.Scan(&ref.Table, &ref.ID, &ref.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, ref)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// DeleteFileRef removes a row whose file has been lost, unless it has been
+// given another file since it was read. Documents and recordings are
+// deleted, as are document versions other than a document's latest, which
+// goes with the document. Band books are marked as failed, so they can be
+// asked for again.
+func (m BlobModel) DeleteFileRef(ref FileRef) error {
+	var query string
+
+	switch ref.Table {
+	case "documents":
+		query = `DELETE FROM documents WHERE id = $1 AND file_path = $2`
+	case "document_versions":
+		query = `
+			DELETE FROM document_versions v
+			USING documents d
+			WHERE v.id = $1 AND v.file_path = $2 AND d.id = v.document_id AND v.version <> d.version`
+	case "recordings":
+		query = `DELETE FROM recordings WHERE id = $1 AND file_path = $2`
+	case "band_books":
+		query = `UPDATE band_books SET status = 'failed', file_path = '' WHERE id = $1 AND file_path = $2`
+	default:
+		return fmt.Errorf("unknown file reference table %q", ref.Table)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ref.ID, ref.Path)
+	return err
+}
+
+// deleteWithFiles deletes a row with deleteQuery, returning the paths of the
+// files held by it and the rows its deletion cascades to, as found by
+// filesQuery. Both queries take the row's ID as their only parameter. The
+// files aren't removed, since other rows may share them; that is up to the
+// caller once the row is gone.
+func deleteWithFiles(db *sql.DB, filesQuery, deleteQuery string, id int64) ([]string, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, filesQuery, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	paths := []string{}
+
+	for rows.Next() {
+		var path string
+
+		err := rows.Scan(&path)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows.Close()
+
+	result, err := tx.ExecContext(ctx, deleteQuery, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,368 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/lib/pq"
+)
+
+const (
+	CustomFieldString = "string"
+	CustomFieldNumber = "number"
+	CustomFieldBool   = "bool"
+	CustomFieldEnum   = "enum"
+	CustomFieldDate   = "date"
+)
+
+// CustomFieldNameRX restricts field names to lowercase identifiers so they can
+// be used verbatim in query string parameters such as cf.capo.
+var CustomFieldNameRX = regexp.MustCompile("^[a-z][a-z0-9_]*$")
+
+var ErrInvalidCustomFieldValue = errors.New("invalid custom field value")
+
+type CustomField struct {
+	ID        int64     `json:"id"`
+	BandID    int64     `json:"band_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Required  bool      `json:"required"`
+	Options   []string  `json:"options,omitempty"`
+}
+
+// CustomFieldValues holds the values of a tune's band-defined fields and is
+// stored in the tunes.custom_fields JSONB column.
+type CustomFieldValues map[string]any
+
+// Value encodes the values as a JSON string; lib/pq would send a []byte as
+// bytea, which PostgreSQL won't accept for a jsonb parameter.
+func (c CustomFieldValues) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+
+	js, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+func (c *CustomFieldValues) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into CustomFieldValues", src)
+	}
+
+	return json.Unmarshal(b, c)
+}
+
+type CustomFieldModel struct {
+	DB *sql.DB
+}
+
+func ValidateCustomField(v *validator.Validator, field *CustomField) {
+	v.Check(field.Name != "", "name", "must be provided")
+	v.Check(len(field.Name) <= 64, "name", "must not be more than 64 bytes long")
+	v.Check(validator.Matches(field.Name, CustomFieldNameRX), "name", "must start with a lowercase letter and contain only lowercase letters, digits and underscores")
+
+	validTypes := []string{CustomFieldString, CustomFieldNumber, CustomFieldBool, CustomFieldEnum, CustomFieldDate}
+	v.Check(validator.PermittedValue(field.Type, validTypes...), "type", "invalid field type")
+
+	if field.Type == CustomFieldEnum {
+		v.Check(len(field.Options) >= 1, "options", "must contain at least 1 option")
+		v.Check(len(field.Options) <= 100, "options", "must not contain more than 100 options")
+		v.Check(validator.Unique(field.Options), "options", "must not contain duplicate values")
+
+		for _, option := range field.Options {
+			v.Check(option != "", "options", "must not contain empty values")
+			v.Check(len(option) <= 100, "options", "must not contain values more than 100 bytes long")
+		}
+	} else {
+		v.Check(len(field.Options) == 0, "options", "must only be provided for enum fields")
+	}
+}
+
+// ParseValue converts a query string value into the JSON type stored for the
+// field, so that it can be compared against tunes.custom_fields.
+func (f *CustomField) ParseValue(s string) (any, error) {
+	var value any
+
+	switch f.Type {
+	case CustomFieldNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, ErrInvalidCustomFieldValue
+		}
+		value = n
+	case CustomFieldBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, ErrInvalidCustomFieldValue
+		}
+		value = b
+	default:
+		value = s
+	}
+
+	if !f.validValue(value) {
+		return nil, ErrInvalidCustomFieldValue
+	}
+
+	return value, nil
+}
+
+func (f *CustomField) validValue(value any) bool {
+	switch f.Type {
+	case CustomFieldString:
+		s, ok := value.(string)
+		return ok && len(s) <= 1000
+	case CustomFieldNumber:
+		_, ok := value.(float64)
+		return ok
+	case CustomFieldBool:
+		_, ok := value.(bool)
+		return ok
+	case CustomFieldEnum:
+		s, ok := value.(string)
+		return ok && validator.PermittedValue(s, f.Options...)
+	case CustomFieldDate:
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(time.DateOnly, s)
+		return err == nil
+	}
+
+	return false
+}
+
+func (f *CustomField) describeType() string {
+	switch f.Type {
+	case CustomFieldEnum:
+		return "one of the field's options"
+	case CustomFieldDate:
+		return "a date in YYYY-MM-DD format"
+	case CustomFieldBool:
+		return "a boolean"
+	default:
+		return "a " + f.Type
+	}
+}
+
+// validateCustomFieldValues checks a tune's custom field values against the
+// schema defined by its band.
+func validateCustomFieldValues(v *validator.Validator, values CustomFieldValues, fields []*CustomField) {
+	known := make(map[string]*CustomField, len(fields))
+
+	for _, field := range fields {
+		known[field.Name] = field
+
+		value, ok := values[field.Name]
+		if !ok || value == nil {
+			v.Check(!field.Required, "custom_fields."+field.Name, "must be provided")
+			continue
+		}
+
+		v.Check(field.validValue(value), "custom_fields."+field.Name, "must be "+field.describeType())
+	}
+
+	for name := range values {
+		v.Check(known[name] != nil, "custom_fields."+name, "is not defined for this band")
+	}
+}
+
+func (c CustomFieldModel) Insert(field *CustomField) error {
+	query := `
+		INSERT INTO band_custom_fields (band_id, name, field_type, required, options)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version`
+
+	args := []any{field.BandID, field.Name, field.Type, field.Required, pq.Array(field.Options)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&field.ID, &field.CreatedAt, &field.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "band_custom_fields_name_key"`:
+			return ErrRecordAlreadyExists
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c CustomFieldModel) Get(id int64) (*CustomField, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, band_id, created_at, version, name, field_type, required, options
+		FROM band_custom_fields
+		WHERE id = $1`
+
+	var field CustomField
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(
+		&field.ID,
+		&field.BandID,
+		&field.CreatedAt,
+		&field.Version,
+		&field.Name,
+		&field.Type,
+		&field.Required,
+		pq.Array(&field.Options),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &field, nil
+}
+
+func (c CustomFieldModel) GetAllForBand(bandID int64) ([]*CustomField, error) {
+	query := `
+		SELECT id, band_id, created_at, version, name, field_type, required, options
+		FROM band_custom_fields
+		WHERE band_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, bandID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	fields := []*CustomField{}
+
+	for rows.Next() {
+		var field CustomField
+
+		err := rows.Scan(
+			&field.ID,
+			&field.BandID,
+			&field.CreatedAt,
+			&field.Version,
+			&field.Name,
+			&field.Type,
+			&field.Required,
+			pq.Array(&field.Options),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, &field)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func (c CustomFieldModel) Update(field *CustomField) error {
+	query := `
+		UPDATE band_custom_fields
+		SET required = $1, options = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{
+		field.Required,
+		pq.Array(field.Options),
+		field.ID,
+		field.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&field.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the field definition and strips its values from every tune
+// in the band.
+func (c CustomFieldModel) Delete(field *CustomField) error {
+	deleteFieldQuery := `
+		DELETE FROM band_custom_fields
+		WHERE id = $1`
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := tx.ExecContext(ctx, deleteFieldQuery, field.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	stripValuesQuery := `
+		UPDATE tunes
+		SET custom_fields = custom_fields - $1::text, version = version + 1
+		WHERE band_id = $2 AND custom_fields ? $1::text`
+
+	_, err = tx.ExecContext(ctx, stripValuesQuery, field.Name, field.BandID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
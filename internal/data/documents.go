@@ -3,20 +3,89 @@ package data
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/lib/pq"
 )
 
 type Document struct {
-	ID        int64     `json:"id"`
-	TuneID    int64     `json:"tune_id"`
-	OwnerID   int64     `json:"owner_id"`
-	CreatedAt time.Time `json:"created_at"`
-	FilePath  string    `json:"-"`
-	FileType  string    `json:"file_type"`
-	Title     string    `json:"title"`
+	ID         int64     `json:"id"`
+	TuneID     int64     `json:"tune_id"`
+	OwnerID    int64     `json:"owner_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	FilePath   string    `json:"-"`
+	FileType   string    `json:"file_type"`
+	Title      string    `json:"title"`
+	Favorited  *bool     `json:"favorited,omitempty"`
+	PageCount  int       `json:"page_count,omitempty"`
+	PDFInfo    PDFInfo   `json:"pdf_info,omitempty"`
+	Text       string    `json:"-"`
+	Version    int32     `json:"version"`
+	ScanStatus string    `json:"scan_status"`
+	DocumentPart
+}
+
+// Scan statuses. Files are scanned for malware in the background once they
+// have been uploaded if a scanner is configured, and can't be downloaded
+// until they are found to be clean. Files uploaded while no scanner was
+// configured are unscanned. Infected files are quarantined, and files the
+// scanner refused, such as those over its size limit, have failed.
+const (
+	ScanPending   = "pending"
+	ScanClean     = "clean"
+	ScanInfected  = "infected"
+	ScanFailed    = "failed"
+	ScanUnscanned = "unscanned"
+)
+
+// DocumentPart describes who a chart is for: the instrument it was written
+// for, its transposition (one of Transpositions), its clef (one of Clefs) and
+// the name of the part, such as "Harmony". Any of them may be empty.
+type DocumentPart struct {
+	Instrument    string `json:"instrument"`
+	Transposition string `json:"transposition"`
+	Clef          string `json:"clef"`
+	Part          string `json:"part"`
+}
+
+// DocumentFilters narrows down a tune's documents. Empty fields don't
+// filter; the part fields match case-insensitively and Text searches titles
+// and extracted text.
+type DocumentFilters struct {
+	Text          string
+	FavoritedOnly bool
+	DocumentPart
+}
+
+// PDFInfo holds the entries of a PDF's document information dictionary, such
+// as its Title and Author. It is stored as a JSON object.
+type PDFInfo map[string]string
+
+func (i PDFInfo) Value() (driver.Value, error) {
+	if i == nil {
+		return "{}", nil
+	}
+
+	js, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+func (i *PDFInfo) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into PDFInfo", src)
+	}
+
+	return json.Unmarshal(b, i)
 }
 
 type DocumentModel struct {
@@ -25,11 +94,23 @@ type DocumentModel struct {
 
 func ValidateDocument(v *validator.Validator, doc *Document) {
 	v.Check(doc.FileType != "", "file_type", "must be provided")
-	validFileTypes := []string{"pdf"}
+	validFileTypes := []string{"pdf", "mid", "musicxml", "mxl", "jpg", "png", "webp"}
 	v.Check(validator.PermittedValue(doc.FileType, validFileTypes...), "file_type", "invalid file type")
 
 	v.Check(doc.Title != "", "title", "must be provided")
 	v.Check(len(doc.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(doc.PageCount >= 0, "page_count", "must not be negative")
+
+	ValidateDocumentPart(v, doc.DocumentPart)
+	v.Check(len(doc.Text) <= 262144, "text", "must not be more than 262144 bytes long")
+}
+
+func ValidateDocumentPart(v *validator.Validator, part DocumentPart) {
+	v.Check(len(part.Instrument) <= 100, "instrument", "must not be more than 100 bytes long")
+	v.Check(part.Transposition == "" || validator.PermittedValue(part.Transposition, Transpositions...), "transposition", "must be one of C, Bb, Eb or F")
+	v.Check(part.Clef == "" || validator.PermittedValue(part.Clef, Clefs...), "clef", "must be one of treble, bass, alto or tenor")
+	v.Check(len(part.Part) <= 100, "part", "must not be more than 100 bytes long")
 }
 
 func (d DocumentModel) Get(id int64) (*Document, error) {
@@ -38,7 +119,8 @@ func (d DocumentModel) Get(id int64) (*Document, error) {
 	}
 
 	query := `
-		SELECT id, tune_id, owner_id, created_at, file_path, file_type, title
+		SELECT id, tune_id, owner_id, created_at, file_path, file_type, title, page_count, pdf_info,
+			instrument, transposition, clef, part, version, scan_status
 		FROM documents
 		WHERE id = $1`
 
@@ -55,6 +137,14 @@ func (d DocumentModel) Get(id int64) (*Document, error) {
 		&doc.FilePath,
 		&doc.FileType,
 		&doc.Title,
+		&doc.PageCount,
+		&doc.PDFInfo,
+		&doc.Instrument,
+		&doc.Transposition,
+		&doc.Clef,
+		&doc.Part,
+		&doc.Version,
+		&doc.ScanStatus,
 	)
 
 	if err != nil {
@@ -69,30 +159,85 @@ func (d DocumentModel) Get(id int64) (*Document, error) {
 	return &doc, nil
 }
 
+// Insert records the document along with its first version.
 func (d DocumentModel) Insert(doc *Document) error {
 	query := `
-		INSERT INTO documents (tune_id, owner_id, file_path, file_type, title)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at`
+		INSERT INTO documents (tune_id, owner_id, file_path, file_type, title, page_count, pdf_info, text,
+			instrument, transposition, clef, part, scan_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at, version`
+
+	args := []any{
+		doc.TuneID,
+		doc.OwnerID,
+		doc.FilePath,
+		doc.FileType,
+		doc.Title,
+		doc.PageCount,
+		doc.PDFInfo,
+		doc.Text,
+		doc.Instrument,
+		doc.Transposition,
+		doc.Clef,
+		doc.Part,
+		doc.ScanStatus,
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
 
-	args := []any{doc.TuneID, doc.OwnerID, doc.FilePath, doc.FileType, doc.Title}
+	defer tx.Rollback()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return d.DB.QueryRowContext(ctx, query, args...).Scan(&doc.ID, &doc.CreatedAt)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&doc.ID, &doc.CreatedAt, &doc.Version)
+	if err != nil {
+		return err
+	}
+
+	_, err = insertDocumentVersion(ctx, tx, doc, doc.OwnerID, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (d DocumentModel) GetAllDocsForTune(tuneID int64) ([]*Document, error) {
+// GetAllDocsForTune returns the tune's documents that match filters, oldest
+// first, flagging each with whether userID has favorited it.
+func (d DocumentModel) GetAllDocsForTune(tuneID int64, userID int64, filters DocumentFilters) ([]*Document, error) {
 	query := `
-		SELECT id, tune_id, owner_id, created_at, file_path, file_type, title
+		SELECT id, tune_id, owner_id, created_at, file_path, file_type, title, page_count, pdf_info,
+			instrument, transposition, clef, part, version, scan_status,
+			EXISTS (SELECT 1 FROM document_favorites WHERE document_favorites.document_id = documents.id AND document_favorites.user_id = $2)
 		FROM documents
-		WHERE tune_id = $1`
+		WHERE tune_id = $1
+		AND (NOT $3 OR EXISTS (SELECT 1 FROM document_favorites WHERE document_favorites.document_id = documents.id AND document_favorites.user_id = $2))
+		AND (to_tsvector('simple', title || ' ' || text) @@ plainto_tsquery('simple', $4) OR $4 = '')
+		AND (lower(instrument) = lower($5) OR $5 = '')
+		AND (transposition = $6 OR $6 = '')
+		AND (clef = $7 OR $7 = '')
+		AND (lower(part) = lower($8) OR $8 = '')
+		ORDER BY created_at, id`
+
+	args := []any{
+		tuneID,
+		userID,
+		filters.FavoritedOnly,
+		filters.Text,
+		filters.Instrument,
+		filters.Transposition,
+		filters.Clef,
+		filters.Part,
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := d.DB.QueryContext(ctx, query, tuneID)
+	rows, err := d.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -103,6 +248,7 @@ func (d DocumentModel) GetAllDocsForTune(tuneID int64) ([]*Document, error) {
 
 	for rows.Next() {
 		var doc Document
+		var favorited bool
 
 		err := rows.Scan(
 			&doc.ID,
@@ -112,12 +258,23 @@ func (d DocumentModel) GetAllDocsForTune(tuneID int64) ([]*Document, error) {
 			&doc.FilePath,
 			&doc.FileType,
 			&doc.Title,
+			&doc.PageCount,
+			&doc.PDFInfo,
+			&doc.Instrument,
+			&doc.Transposition,
+			&doc.Clef,
+			&doc.Part,
+			&doc.Version,
+			&doc.ScanStatus,
+			&favorited,
 		)
 
 		if err != nil {
 			return nil, err
 		}
 
+		doc.Favorited = &favorited
+
 		docs = append(docs, &doc)
 	}
 
@@ -128,31 +285,74 @@ func (d DocumentModel) GetAllDocsForTune(tuneID int64) ([]*Document, error) {
 	return docs, nil
 }
 
-func (d DocumentModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
-	}
-
+// GetPDFsForTunes returns the PDF documents of the given tunes that may be
+// downloaded, oldest first.
+func (d DocumentModel) GetPDFsForTunes(tuneIDs []int64) ([]*Document, error) {
 	query := `
-		DELETE FROM documents
-		WHERE id = $1`
+		SELECT id, tune_id, owner_id, created_at, file_path, file_type, title, page_count, pdf_info,
+			instrument, transposition, clef, part, version, scan_status
+		FROM documents
+		WHERE tune_id = ANY($1) AND file_type = 'pdf' AND scan_status IN ('clean', 'unscanned')
+		ORDER BY created_at, id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := d.DB.ExecContext(ctx, query, id)
+	rows, err := d.DB.QueryContext(ctx, query, pq.Array(tuneIDs))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	defer rows.Close()
+
+	docs := []*Document{}
+
+	for rows.Next() {
+		var doc Document
+
+		err := rows.Scan(
+			&doc.ID,
+			&doc.TuneID,
+			&doc.OwnerID,
+			&doc.CreatedAt,
+			&doc.FilePath,
+			&doc.FileType,
+			&doc.Title,
+			&doc.PageCount,
+			&doc.PDFInfo,
+			&doc.Instrument,
+			&doc.Transposition,
+			&doc.Clef,
+			&doc.Part,
+			&doc.Version,
+			&doc.ScanStatus,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, &doc)
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return docs, nil
+}
+
+// Delete deletes a document and its versions, returning the paths of the
+// files they held.
+func (d DocumentModel) Delete(id int64) ([]string, error) {
+	filesQuery := `
+		SELECT file_path FROM documents WHERE id = $1
+		UNION
+		SELECT file_path FROM document_versions WHERE document_id = $1`
+
+	query := `
+		DELETE FROM documents
+		WHERE id = $1`
+
+	return deleteWithFiles(d.DB, filesQuery, query, id)
 }
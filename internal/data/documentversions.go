@@ -0,0 +1,392 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+// DocumentVersion is one of the files a document has held. The document
+// itself always holds its latest version's file. RestoredFrom is set on
+// versions made by restoring an earlier one.
+type DocumentVersion struct {
+	ID           int64     `json:"id"`
+	DocumentID   int64     `json:"document_id"`
+	Version      int32     `json:"version"`
+	UploadedBy   int64     `json:"uploaded_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	FilePath     string    `json:"-"`
+	FileType     string    `json:"file_type"`
+	PageCount    int       `json:"page_count,omitempty"`
+	PDFInfo      PDFInfo   `json:"-"`
+	Text         string    `json:"-"`
+	RestoredFrom *int32    `json:"restored_from,omitempty"`
+	ScanStatus   string    `json:"scan_status"`
+}
+
+// QuarantineKey returns the file path an infected file is moved to, away
+// from the blobs that are served. Every row that held the file is moved to the
+// same quarantined copy.
+func QuarantineKey(filePath string) string {
+	return "quarantine/" + path.Base(filePath)
+}
+
+// IsQuarantineKey reports whether a file path is that of a quarantined file.
+func IsQuarantineKey(filePath string) bool {
+	return strings.HasPrefix(filePath, "quarantine/")
+}
+
+// insertDocumentVersion records the document's current file as its version
+// doc.Version.
+func insertDocumentVersion(ctx context.Context, tx *sql.Tx, doc *Document, uploadedBy int64, restoredFrom *int32) (*DocumentVersion, error) {
+	query := `
+		INSERT INTO document_versions (document_id, version, uploaded_by, file_path, file_type,
+			page_count, pdf_info, text, restored_from, scan_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at`
+
+	ver := &DocumentVersion{
+		DocumentID:   doc.ID,
+		Version:      doc.Version,
+		UploadedBy:   uploadedBy,
+		FilePath:     doc.FilePath,
+		FileType:     doc.FileType,
+		PageCount:    doc.PageCount,
+		PDFInfo:      doc.PDFInfo,
+		Text:         doc.Text,
+		RestoredFrom: restoredFrom,
+		ScanStatus:   doc.ScanStatus,
+	}
+
+	args := []any{
+		ver.DocumentID,
+		ver.Version,
+		ver.UploadedBy,
+		ver.FilePath,
+		ver.FileType,
+		ver.PageCount,
+		ver.PDFInfo,
+		ver.Text,
+		ver.RestoredFrom,
+		ver.ScanStatus,
+	}
+
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&ver.ID, &ver.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return ver, nil
+}
+
+// AddVersion gives the document a new version holding the file now set on
+// doc, which must still be at doc.Version. It returns ErrEditConflict if the
+// document has had another version added since it was read; otherwise
+// doc.Version is updated to the new version. restoredFrom, if set, is the
+// earlier version the file was restored from.
+func (d DocumentModel) AddVersion(doc *Document, uploadedBy int64, restoredFrom *int32) (*DocumentVersion, error) {
+	query := `
+		UPDATE documents
+		SET file_path = $1, file_type = $2, page_count = $3, pdf_info = $4, text = $5, scan_status = $6,
+			version = version + 1
+		WHERE id = $7 AND version = $8
+		RETURNING version`
+
+	args := []any{
+		doc.FilePath,
+		doc.FileType,
+		doc.PageCount,
+		doc.PDFInfo,
+		doc.Text,
+		doc.ScanStatus,
+		doc.ID,
+		doc.Version,
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var version int32
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	doc.Version = version
+
+	ver, err := insertDocumentVersion(ctx, tx, doc, uploadedBy, restoredFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return ver, nil
+}
+
+// GetVersions returns the document's versions, latest first.
+func (d DocumentModel) GetVersions(documentID int64) ([]*DocumentVersion, error) {
+	query := `
+		SELECT id, document_id, version, uploaded_by, created_at, file_path, file_type,
+			page_count, pdf_info, text, restored_from, scan_status
+		FROM document_versions
+		WHERE document_id = $1
+		ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.QueryContext(ctx, query, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := []*DocumentVersion{}
+
+	for rows.Next() {
+		var ver DocumentVersion
+
+		err := rows.Scan(
+			&ver.ID,
+			&ver.DocumentID,
+			&ver.Version,
+			&ver.UploadedBy,
+			&ver.CreatedAt,
+			&ver.FilePath,
+			&ver.FileType,
+			&ver.PageCount,
+			&ver.PDFInfo,
+			&ver.Text,
+			&ver.RestoredFrom,
+			&ver.ScanStatus,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, &ver)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (d DocumentModel) GetVersion(documentID int64, version int32) (*DocumentVersion, error) {
+	if version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, document_id, version, uploaded_by, created_at, file_path, file_type,
+			page_count, pdf_info, text, restored_from, scan_status
+		FROM document_versions
+		WHERE document_id = $1 AND version = $2`
+
+	var ver DocumentVersion
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := d.DB.QueryRowContext(ctx, query, documentID, version).Scan(
+		&ver.ID,
+		&ver.DocumentID,
+		&ver.Version,
+		&ver.UploadedBy,
+		&ver.CreatedAt,
+		&ver.FilePath,
+		&ver.FileType,
+		&ver.PageCount,
+		&ver.PDFInfo,
+		&ver.Text,
+		&ver.RestoredFrom,
+		&ver.ScanStatus,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &ver, nil
+}
+
+// GetVersionsPendingScan returns the document versions whose files are
+// waiting to be scanned for malware, oldest first.
+func (d DocumentModel) GetVersionsPendingScan() ([]*DocumentVersion, error) {
+	query := `
+		SELECT id, document_id, version, uploaded_by, created_at, file_path, file_type,
+			page_count, pdf_info, text, restored_from, scan_status
+		FROM document_versions
+		WHERE scan_status = 'pending'
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := []*DocumentVersion{}
+
+	for rows.Next() {
+		var ver DocumentVersion
+
+		err := rows.Scan(
+			&ver.ID,
+			&ver.DocumentID,
+			&ver.Version,
+			&ver.UploadedBy,
+			&ver.CreatedAt,
+			&ver.FilePath,
+			&ver.FileType,
+			&ver.PageCount,
+			&ver.PDFInfo,
+			&ver.Text,
+			&ver.RestoredFrom,
+			&ver.ScanStatus,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, &ver)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// SetScanStatus records the outcome of scanning a pending version's file and
+// copies it to the document if the version is still its latest. It returns
+// ErrEditConflict if the version is no longer pending or holds another file.
+//
+// If the file is infected, filePath is where it has been quarantined, and
+// every row that held the same file is moved there along with it.
+func (d DocumentModel) SetScanStatus(ver *DocumentVersion, status, filePath string) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE document_versions
+		SET scan_status = $1, file_path = $2
+		WHERE id = $3 AND scan_status = 'pending' AND file_path = $4`
+
+	result, err := tx.ExecContext(ctx, query, status, filePath, ver.ID, ver.FilePath)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	if status == ScanInfected {
+		err = quarantineFile(ctx, tx, ver.FilePath, filePath)
+		if err != nil {
+			return err
+		}
+	} else {
+		query = `
+			UPDATE documents
+			SET scan_status = $1, file_path = $2
+			WHERE id = $3 AND version = $4`
+
+		_, err = tx.ExecContext(ctx, query, status, filePath, ver.DocumentID, ver.Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	ver.ScanStatus = status
+	ver.FilePath = filePath
+
+	return nil
+}
+
+// quarantineFile marks every document, version and recording that held the
+// infected file at oldPath, whatever its status, as infected and moves it to
+// the quarantined copy at newPath, since files are shared between rows with
+// the same contents.
+func quarantineFile(ctx context.Context, tx *sql.Tx, oldPath, newPath string) error {
+	for _, table := range []string{"document_versions", "documents", "recordings"} {
+		query := `UPDATE ` + table + ` SET scan_status = $1, file_path = $2 WHERE file_path = $3`
+
+		_, err := tx.ExecContext(ctx, query, ScanInfected, newPath, oldPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FilePathInUse reports whether any document, version or recording holds the
+// file at a path.
+func (d DocumentModel) FilePathInUse(filePath string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM documents WHERE file_path = $1)
+			OR EXISTS (SELECT 1 FROM document_versions WHERE file_path = $1)
+			OR EXISTS (SELECT 1 FROM recordings WHERE file_path = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var inUse bool
+
+	err := d.DB.QueryRowContext(ctx, query, filePath).Scan(&inUse)
+	return inUse, err
+}
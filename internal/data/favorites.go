@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	FavoriteTune     = "tune"
+	FavoriteDocument = "document"
+)
+
+// Favorite is an entry in a user's list of starred tunes and documents.
+type Favorite struct {
+	Type        string    `json:"type"`
+	ID          int64     `json:"id"`
+	Title       string    `json:"title"`
+	BandID      int64     `json:"band_id"`
+	TuneID      int64     `json:"tune_id"`
+	FavoritedAt time.Time `json:"favorited_at"`
+}
+
+type FavoriteModel struct {
+	DB *sql.DB
+}
+
+func (f FavoriteModel) AddTune(userID int64, tuneID int64) error {
+	query := `
+		INSERT INTO tune_favorites (user_id, tune_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := f.DB.ExecContext(ctx, query, userID, tuneID)
+	return err
+}
+
+func (f FavoriteModel) RemoveTune(userID int64, tuneID int64) error {
+	query := `
+		DELETE FROM tune_favorites
+		WHERE user_id = $1 AND tune_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := f.DB.ExecContext(ctx, query, userID, tuneID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (f FavoriteModel) AddDocument(userID int64, documentID int64) error {
+	query := `
+		INSERT INTO document_favorites (user_id, document_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := f.DB.ExecContext(ctx, query, userID, documentID)
+	return err
+}
+
+func (f FavoriteModel) RemoveDocument(userID int64, documentID int64) error {
+	query := `
+		DELETE FROM document_favorites
+		WHERE user_id = $1 AND document_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := f.DB.ExecContext(ctx, query, userID, documentID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser returns the user's favorite tunes and documents across every
+// band they are a member of. favoriteType limits the results to tunes or
+// documents when it isn't empty.
+func (f FavoriteModel) GetAllForUser(userID int64, favoriteType string, filters Filters) ([]*Favorite, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), kind, id, title, band_id, tune_id, favorited_at
+		FROM (
+			SELECT 'tune' AS kind, tunes.id, tunes.title, tunes.band_id, tunes.id AS tune_id, tune_favorites.created_at AS favorited_at
+			FROM tune_favorites
+			INNER JOIN tunes ON tunes.id = tune_favorites.tune_id
+			WHERE tune_favorites.user_id = $1
+			UNION ALL
+			SELECT 'document', documents.id, documents.title, tunes.band_id, documents.tune_id, document_favorites.created_at
+			FROM document_favorites
+			INNER JOIN documents ON documents.id = document_favorites.document_id
+			INNER JOIN tunes ON tunes.id = documents.tune_id
+			WHERE document_favorites.user_id = $1
+		) AS favorites
+		WHERE band_id IN (SELECT band_id FROM band_members WHERE user_id = $1)
+		AND (kind = $2 OR $2 = '')
+		ORDER BY %s %s, kind ASC, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{userID, favoriteType, filters.limit(), filters.offset()}
+
+	rows, err := f.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	favorites := []*Favorite{}
+
+	for rows.Next() {
+		var favorite Favorite
+
+		err := rows.Scan(
+			&totalRecords,
+			&favorite.Type,
+			&favorite.ID,
+			&favorite.Title,
+			&favorite.BandID,
+			&favorite.TuneID,
+			&favorite.FavoritedAt,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		favorites = append(favorites, &favorite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return favorites, metadata, nil
+}
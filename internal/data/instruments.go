@@ -0,0 +1,114 @@
+package data
+
+import "strings"
+
+// Transpositions a chart can be written in, named after the note that sounds
+// when a player reads a written C.
+var Transpositions = []string{"C", "Bb", "Eb", "F"}
+
+// Clefs a chart can be written in.
+var Clefs = []string{"treble", "bass", "alto", "tenor"}
+
+// instrumentParts gives the transposition and clef charts are usually written
+// in for instruments that read something other than concert pitch in treble
+// clef. Names are lower case.
+var instrumentParts = map[string]struct{ transposition, clef string }{
+	"trumpet":            {"Bb", "treble"},
+	"cornet":             {"Bb", "treble"},
+	"flugelhorn":         {"Bb", "treble"},
+	"clarinet":           {"Bb", "treble"},
+	"bass clarinet":      {"Bb", "treble"},
+	"soprano sax":        {"Bb", "treble"},
+	"soprano saxophone":  {"Bb", "treble"},
+	"tenor sax":          {"Bb", "treble"},
+	"tenor saxophone":    {"Bb", "treble"},
+	"alto sax":           {"Eb", "treble"},
+	"alto saxophone":     {"Eb", "treble"},
+	"baritone sax":       {"Eb", "treble"},
+	"baritone saxophone": {"Eb", "treble"},
+	"bari sax":           {"Eb", "treble"},
+	"horn":               {"F", "treble"},
+	"french horn":        {"F", "treble"},
+	"english horn":       {"F", "treble"},
+	"bass":               {"C", "bass"},
+	"double bass":        {"C", "bass"},
+	"upright bass":       {"C", "bass"},
+	"bass guitar":        {"C", "bass"},
+	"electric bass":      {"C", "bass"},
+	"cello":              {"C", "bass"},
+	"trombone":           {"C", "bass"},
+	"bassoon":            {"C", "bass"},
+	"tuba":               {"C", "bass"},
+	"euphonium":          {"C", "bass"},
+	"viola":              {"C", "alto"},
+}
+
+// InstrumentPart returns the transposition and clef an instrument's charts
+// are usually written in. Instruments it doesn't know, and no instrument at
+// all, read concert pitch in treble clef.
+func InstrumentPart(instrument string) (transposition, clef string) {
+	part, ok := instrumentParts[strings.ToLower(strings.TrimSpace(instrument))]
+	if !ok {
+		return "C", "treble"
+	}
+
+	return part.transposition, part.clef
+}
+
+// chartScore rates how well a document suits a player of instrument: 3 if
+// it was written for the instrument, 2 if it has no instrument but is in the
+// right transposition and clef, 1 if it is for another instrument in the same
+// transposition and clef, and 0 if the player can't read from it. Documents
+// that don't give a transposition or clef are taken to be in concert pitch
+// and treble clef. MIDI files aren't charts at all.
+func chartScore(doc *Document, instrument string) int {
+	if doc.FileType == "mid" {
+		return 0
+	}
+
+	if instrument != "" && strings.EqualFold(strings.TrimSpace(doc.Instrument), strings.TrimSpace(instrument)) {
+		return 3
+	}
+
+	transposition, clef := InstrumentPart(instrument)
+
+	docTransposition, docClef := doc.Transposition, doc.Clef
+	if docTransposition == "" {
+		docTransposition = "C"
+	}
+	if docClef == "" {
+		docClef = "treble"
+	}
+
+	if docTransposition != transposition || docClef != clef {
+		return 0
+	}
+
+	if doc.Instrument == "" {
+		return 2
+	}
+
+	return 1
+}
+
+// ChartsFor picks the documents a player of instrument should read from:
+// those that suit it best, keeping their order. Several are returned when
+// they suit it equally well, such as the separate parts of an arrangement.
+func ChartsFor(docs []*Document, instrument string) []*Document {
+	best := 1
+	picked := []*Document{}
+
+	for _, doc := range docs {
+		score := chartScore(doc, instrument)
+
+		switch {
+		case score > best:
+			best = score
+			picked = []*Document{doc}
+		case score == best:
+			picked = append(picked, doc)
+		}
+	}
+
+	return picked
+}
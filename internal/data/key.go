@@ -45,3 +45,24 @@ func (k *Key) UnmarshalJSON(jsonValue []byte) error {
 
 	return nil
 }
+
+// Tonics of the major and minor keys with each number of sharps, from seven
+// flats to seven sharps.
+var (
+	majorTonics = []string{"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#"}
+	minorTonics = []string{"Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#", "G#", "D#", "A#"}
+)
+
+// KeyFromSignature names the key with the given key signature, as a count of
+// sharps (negative for flats). It returns false if sharps is out of range.
+func KeyFromSignature(sharps int, minor bool) (Key, bool) {
+	if sharps < -7 || sharps > 7 {
+		return "", false
+	}
+
+	if minor {
+		return Key(minorTonics[sharps+7] + " minor"), true
+	}
+
+	return Key(majorTonics[sharps+7] + " major"), true
+}
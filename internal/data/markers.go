@@ -0,0 +1,299 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// Marker marks a stretch of a recording, from Start to End in seconds,
+// optionally linked to the tune played during it.
+type Marker struct {
+	ID          int64     `json:"id"`
+	RecordingID int64     `json:"recording_id"`
+	TuneID      *int64    `json:"tune_id"`
+	CreatedBy   int64     `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	Start       float64   `json:"start"`
+	End         float64   `json:"end"`
+	Label       string    `json:"label"`
+	Version     int32     `json:"version"`
+}
+
+// TuneSegment is a marked stretch of a recording where a tune was played.
+type TuneSegment struct {
+	MarkerID       int64     `json:"marker_id"`
+	RecordingID    int64     `json:"recording_id"`
+	RecordingTitle string    `json:"recording_title"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	Start          float64   `json:"start"`
+	End            float64   `json:"end"`
+	Label          string    `json:"label"`
+}
+
+type MarkerModel struct {
+	DB *sql.DB
+}
+
+// ValidateMarker checks a marker against the recording it belongs to. The
+// end time is only checked against the recording's duration if it is known.
+func ValidateMarker(v *validator.Validator, marker *Marker, rec *Recording) {
+	v.Check(marker.Start >= 0, "start", "must not be negative")
+	v.Check(marker.End > marker.Start, "end", "must be after the start")
+
+	if rec.Duration > 0 {
+		v.Check(marker.End <= rec.Duration, "end", "must not be after the end of the recording")
+	}
+
+	v.Check(marker.Label != "" || marker.TuneID != nil, "label", "must be provided if no tune is linked")
+	v.Check(len(marker.Label) <= 500, "label", "must not be more than 500 bytes long")
+
+	if marker.TuneID != nil {
+		v.Check(*marker.TuneID > 0, "tune_id", "must be a positive integer")
+	}
+}
+
+// Insert records the marker. A linked tune must belong to the recording's
+// band, otherwise ErrTuneNotInBand is returned; the recording is linked to
+// the tune as well if it wasn't already.
+func (m MarkerModel) Insert(rec *Recording, marker *Marker) error {
+	query := `
+		INSERT INTO recording_markers (recording_id, tune_id, created_by, start_time, end_time, label)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, version`
+
+	args := []any{marker.RecordingID, marker.TuneID, marker.CreatedBy, marker.Start, marker.End, marker.Label}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if marker.TuneID != nil {
+		err = linkTunes(ctx, tx, rec.ID, rec.BandID, []int64{*marker.TuneID})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&marker.ID, &marker.CreatedAt, &marker.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m MarkerModel) Get(id int64) (*Marker, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, recording_id, tune_id, created_by, created_at, start_time, end_time, label, version
+		FROM recording_markers
+		WHERE id = $1`
+
+	var marker Marker
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&marker.ID,
+		&marker.RecordingID,
+		&marker.TuneID,
+		&marker.CreatedBy,
+		&marker.CreatedAt,
+		&marker.Start,
+		&marker.End,
+		&marker.Label,
+		&marker.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &marker, nil
+}
+
+func (m MarkerModel) GetAllForRecording(recordingID int64) ([]*Marker, error) {
+	query := `
+		SELECT id, recording_id, tune_id, created_by, created_at, start_time, end_time, label, version
+		FROM recording_markers
+		WHERE recording_id = $1
+		ORDER BY start_time, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, recordingID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	markers := []*Marker{}
+
+	for rows.Next() {
+		var marker Marker
+
+		err := rows.Scan(
+			&marker.ID,
+			&marker.RecordingID,
+			&marker.TuneID,
+			&marker.CreatedBy,
+			&marker.CreatedAt,
+			&marker.Start,
+			&marker.End,
+			&marker.Label,
+			&marker.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		markers = append(markers, &marker)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return markers, nil
+}
+
+// GetSegmentsForTune returns every marked stretch of a recording where the
+// tune was played, most recent recording first.
+func (m MarkerModel) GetSegmentsForTune(tuneID int64) ([]*TuneSegment, error) {
+	query := `
+		SELECT recording_markers.id, recordings.id, recordings.title, recordings.created_at,
+			recording_markers.start_time, recording_markers.end_time, recording_markers.label
+		FROM recording_markers
+		INNER JOIN recordings ON recordings.id = recording_markers.recording_id
+		WHERE recording_markers.tune_id = $1
+		ORDER BY recordings.created_at DESC, recordings.id DESC, recording_markers.start_time`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tuneID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	segments := []*TuneSegment{}
+
+	for rows.Next() {
+		var segment TuneSegment
+
+		err := rows.Scan(
+			&segment.MarkerID,
+			&segment.RecordingID,
+			&segment.RecordingTitle,
+			&segment.RecordedAt,
+			&segment.Start,
+			&segment.End,
+			&segment.Label,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &segment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+// Update saves changes to the marker, with the same tune rules as Insert.
+func (m MarkerModel) Update(rec *Recording, marker *Marker) error {
+	query := `
+		UPDATE recording_markers
+		SET tune_id = $1, start_time = $2, end_time = $3, label = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{marker.TuneID, marker.Start, marker.End, marker.Label, marker.ID, marker.Version}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if marker.TuneID != nil {
+		err = linkTunes(ctx, tx, rec.ID, rec.BandID, []int64{*marker.TuneID})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&marker.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m MarkerModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM recording_markers
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
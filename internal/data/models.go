@@ -14,23 +14,45 @@ var (
 )
 
 type Models struct {
-	BandMembers BandMemberModel
-	Bands       BandModel
-	Tokens      TokenModel
-	Tunes       TuneModel
-	Users       UserModel
-	Documents   DocumentModel
-	Recordings  RecordingModel
+	BandMembers   BandMemberModel
+	Bands         BandModel
+	Tokens        TokenModel
+	Tunes         TuneModel
+	Users         UserModel
+	Documents     DocumentModel
+	Recordings    RecordingModel
+	TuneAliases   TuneAliasModel
+	CustomFields  CustomFieldModel
+	SavedSearches SavedSearchModel
+	Favorites     FavoriteModel
+	Stats         StatsModel
+	Peaks         PeakModel
+	Markers       MarkerModel
+	Uploads       UploadModel
+	BandBooks     BandBookModel
+	Blobs         BlobModel
+	Quotas        QuotaModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		BandMembers: BandMemberModel{DB: db},
-		Bands:       BandModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Tunes:       TuneModel{DB: db},
-		Users:       UserModel{DB: db},
-		Documents:   DocumentModel{DB: db},
-		Recordings:  RecordingModel{DB: db},
+		BandMembers:   BandMemberModel{DB: db},
+		Bands:         BandModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Tunes:         TuneModel{DB: db},
+		Users:         UserModel{DB: db},
+		Documents:     DocumentModel{DB: db},
+		Recordings:    RecordingModel{DB: db},
+		TuneAliases:   TuneAliasModel{DB: db},
+		CustomFields:  CustomFieldModel{DB: db},
+		SavedSearches: SavedSearchModel{DB: db},
+		Favorites:     FavoriteModel{DB: db},
+		Stats:         StatsModel{DB: db},
+		Peaks:         PeakModel{DB: db},
+		Markers:       MarkerModel{DB: db},
+		Uploads:       UploadModel{DB: db},
+		BandBooks:     BandBookModel{DB: db},
+		Blobs:         BlobModel{DB: db},
+		Quotas:        QuotaModel{DB: db},
 	}
 }
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Peaks is a recording's waveform at one resolution. Data holds a minimum
+// and maximum 8-bit sample for each run of SamplesPerPixel samples.
+type Peaks struct {
+	RecordingID     int64
+	SampleRate      int
+	SamplesPerPixel int
+	Data            []int8
+}
+
+type PeakModel struct {
+	DB *sql.DB
+}
+
+// ReplaceAll stores a recording's peaks in place of any it already has and
+// marks its waveform as ready.
+func (m PeakModel) ReplaceAll(recordingID int64, peaks []*Peaks) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Peaks for long recordings can be large, so allow longer than usual.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recording_peaks WHERE recording_id = $1`, recordingID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO recording_peaks (recording_id, samples_per_pixel, sample_rate, data)
+		VALUES ($1, $2, $3, $4)`
+
+	for _, p := range peaks {
+		_, err = tx.ExecContext(ctx, query, recordingID, p.SamplesPerPixel, p.SampleRate, int8sToBytes(p.Data))
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE recordings SET waveform_status = $1 WHERE id = $2`, WaveformReady, recordingID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// The recording was deleted while its peaks were being generated.
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (m PeakModel) Get(recordingID int64, samplesPerPixel int) (*Peaks, error) {
+	query := `
+		SELECT recording_id, samples_per_pixel, sample_rate, data
+		FROM recording_peaks
+		WHERE recording_id = $1 AND samples_per_pixel = $2`
+
+	var p Peaks
+	var data []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, recordingID, samplesPerPixel).Scan(
+		&p.RecordingID,
+		&p.SamplesPerPixel,
+		&p.SampleRate,
+		&data,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	p.Data = make([]int8, len(data))
+	for i, b := range data {
+		p.Data[i] = int8(b)
+	}
+
+	return &p, nil
+}
+
+func int8sToBytes(data []int8) []byte {
+	b := make([]byte, len(data))
+	for i, v := range data {
+		b[i] = byte(v)
+	}
+
+	return b
+}
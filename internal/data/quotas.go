@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+)
+
+// StorageUsage is how much a band or user has stored and how much more they
+// may store. Files are counted once however many rows share them. A nil
+// Quota means there is no limit, in which case Remaining is nil too.
+type StorageUsage struct {
+	Used      int64  `json:"used"`
+	Quota     *int64 `json:"quota"`
+	Remaining *int64 `json:"remaining"`
+}
+
+func ValidateStorageQuota(v *validator.Validator, quota *int64) {
+	v.Check(quota == nil || *quota >= 0, "quota", "must not be negative")
+}
+
+type QuotaModel struct {
+	DB *sql.DB
+}
+
+// GetForBand returns the storage used by a band's documents, including
+// their earlier versions, its recordings and its band books. The band's own
+// quota applies if an admin has set one, and defaultQuota otherwise. Either
+// being 0 means no limit.
+func (m QuotaModel) GetForBand(bandID int64, defaultQuota int64) (*StorageUsage, error) {
+	query := `
+		SELECT b.storage_quota, COALESCE((
+			SELECT SUM(blobs.size)
+			FROM blobs
+			WHERE blobs.hash IN (
+				SELECT right(v.file_path, 64)
+				FROM document_versions v
+				INNER JOIN documents d ON d.id = v.document_id
+				INNER JOIN tunes t ON t.id = d.tune_id
+				WHERE t.band_id = b.id
+				UNION
+				SELECT right(file_path, 64) FROM recordings WHERE band_id = b.id
+				UNION
+				SELECT right(file_path, 64) FROM band_books WHERE band_id = b.id AND file_path <> ''
+			)
+		), 0)
+		FROM bands b
+		WHERE b.id = $1`
+
+	return m.get(query, bandID, defaultQuota)
+}
+
+// GetForUser returns the storage used by the files a user has uploaded, as
+// documents, document versions or recordings, in any band. The user's own
+// quota applies if an admin has set one, and defaultQuota otherwise. Either
+// being 0 means no limit.
+func (m QuotaModel) GetForUser(userID int64, defaultQuota int64) (*StorageUsage, error) {
+	query := `
+		SELECT u.storage_quota, COALESCE((
+			SELECT SUM(blobs.size)
+			FROM blobs
+			WHERE blobs.hash IN (
+				SELECT right(file_path, 64) FROM document_versions WHERE uploaded_by = u.id
+				UNION
+				SELECT right(file_path, 64) FROM recordings WHERE owner_id = u.id
+			)
+		), 0)
+		FROM users u
+		WHERE u.id = $1`
+
+	return m.get(query, userID, defaultQuota)
+}
+
+func (m QuotaModel) get(query string, id int64, defaultQuota int64) (*StorageUsage, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var usage StorageUsage
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&usage.Quota, &usage.Used)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if usage.Quota == nil {
+		usage.Quota = &defaultQuota
+	}
+
+	if *usage.Quota == 0 {
+		usage.Quota = nil
+	}
+
+	if usage.Quota != nil {
+		remaining := max(*usage.Quota-usage.Used, 0)
+		usage.Remaining = &remaining
+	}
+
+	return &usage, nil
+}
+
+// SetForBand sets a band's quota in bytes, 0 meaning no limit, or clears it
+// when quota is nil so that the default applies again.
+func (m QuotaModel) SetForBand(bandID int64, quota *int64) error {
+	return m.set(`UPDATE bands SET storage_quota = $1 WHERE id = $2`, bandID, quota)
+}
+
+// SetForUser sets a user's quota in bytes, 0 meaning no limit, or clears it
+// when quota is nil so that the default applies again.
+func (m QuotaModel) SetForUser(userID int64, quota *int64) error {
+	return m.set(`UPDATE users SET storage_quota = $1 WHERE id = $2`, userID, quota)
+}
+
+func (m QuotaModel) set(query string, id int64, quota *int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, quota, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -1,19 +1,483 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/lib/pq"
 )
 
+var ErrTuneNotInBand = errors.New("tune not in band")
+
 type Recording struct {
 	ID        int64     `json:"id"`
+	BandID    int64     `json:"band_id"`
 	OwnerID   int64     `json:"owner_id"`
 	CreatedAt time.Time `json:"created_at"`
 	FilePath  string    `json:"-"`
 	FileType  string    `json:"file_type"`
 	Title     string    `json:"title"`
+	TuneIDs   []int64   `json:"tune_ids"`
+	AudioInfo
+	WaveformStatus string `json:"waveform_status"`
+	ScanStatus     string `json:"scan_status"`
+}
+
+// Waveform statuses. Peaks are only generated for formats that can be
+// decoded; the others are unsupported from the start.
+const (
+	WaveformPending     = "pending"
+	WaveformReady       = "ready"
+	WaveformFailed      = "failed"
+	WaveformUnsupported = "unsupported"
+)
+
+// AudioInfo is the technical metadata read from a recording's file when it
+// was uploaded. Duration is in seconds and Bitrate in bits per second.
+type AudioInfo struct {
+	Duration      float64   `json:"duration"`
+	SampleRate    int       `json:"sample_rate"`
+	Channels      int       `json:"channels"`
+	Bitrate       int       `json:"bitrate"`
+	BitsPerSample int       `json:"bits_per_sample,omitempty"`
+	Tags          AudioTags `json:"tags"`
+}
+
+// AudioTags holds the tags embedded in an audio file, keyed by lower-case
+// name. It is stored as a JSON object.
+type AudioTags map[string]string
+
+func (t AudioTags) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+
+	js, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+func (t *AudioTags) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into AudioTags", src)
+	}
+
+	return json.Unmarshal(b, t)
 }
 
 type RecordingModel struct {
 	DB *sql.DB
 }
+
+func ValidateRecording(v *validator.Validator, rec *Recording) {
+	v.Check(rec.BandID != 0, "band_id", "must be provided")
+	v.Check(rec.BandID > 0, "band_id", "must be a positive integer")
+
+	v.Check(rec.FileType != "", "file_type", "must be provided")
+	validFileTypes := []string{"mp3", "wav", "flac", "ogg"}
+	v.Check(validator.PermittedValue(rec.FileType, validFileTypes...), "file_type", "invalid file type")
+
+	v.Check(rec.Title != "", "title", "must be provided")
+	v.Check(len(rec.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	ValidateRecordingTuneIDs(v, rec.TuneIDs)
+}
+
+func ValidateRecordingTuneIDs(v *validator.Validator, tuneIDs []int64) {
+	v.Check(len(tuneIDs) <= 100, "tune_ids", "must not contain more than 100 tunes")
+	v.Check(validator.Unique(tuneIDs), "tune_ids", "must not contain duplicate values")
+
+	for _, id := range tuneIDs {
+		v.Check(id > 0, "tune_ids", "must contain positive integers")
+	}
+}
+
+// Insert records the recording and links it to its tunes. Every tune must
+// belong to the recording's band, otherwise ErrTuneNotInBand is returned and
+// nothing is inserted.
+func (m RecordingModel) Insert(rec *Recording) error {
+	query := `
+		INSERT INTO recordings (band_id, owner_id, file_path, file_type, title,
+			duration, sample_rate, channels, bitrate, bits_per_sample, tags, waveform_status, scan_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at`
+
+	args := []any{
+		rec.BandID,
+		rec.OwnerID,
+		rec.FilePath,
+		rec.FileType,
+		rec.Title,
+		rec.Duration,
+		rec.SampleRate,
+		rec.Channels,
+		rec.Bitrate,
+		rec.BitsPerSample,
+		rec.Tags,
+		rec.WaveformStatus,
+		rec.ScanStatus,
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&rec.ID, &rec.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = linkTunes(ctx, tx, rec.ID, rec.BandID, rec.TuneIDs)
+	if err != nil {
+		return err
+	}
+
+	if rec.TuneIDs == nil {
+		rec.TuneIDs = []int64{}
+	}
+
+	return tx.Commit()
+}
+
+func (m RecordingModel) Get(id int64) (*Recording, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, band_id, owner_id, created_at, file_path, file_type, title,
+			duration, sample_rate, channels, bitrate, bits_per_sample, tags, waveform_status, scan_status,
+			ARRAY(SELECT tune_id FROM tune_recordings WHERE recording_id = recordings.id ORDER BY tune_id)
+		FROM recordings
+		WHERE id = $1`
+
+	var rec Recording
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&rec.ID,
+		&rec.BandID,
+		&rec.OwnerID,
+		&rec.CreatedAt,
+		&rec.FilePath,
+		&rec.FileType,
+		&rec.Title,
+		&rec.Duration,
+		&rec.SampleRate,
+		&rec.Channels,
+		&rec.Bitrate,
+		&rec.BitsPerSample,
+		&rec.Tags,
+		&rec.WaveformStatus,
+		&rec.ScanStatus,
+		pq.Array(&rec.TuneIDs),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rec, nil
+}
+
+func (m RecordingModel) GetAllForBand(bandID int64) ([]*Recording, error) {
+	query := `
+		SELECT id, band_id, owner_id, created_at, file_path, file_type, title,
+			duration, sample_rate, channels, bitrate, bits_per_sample, tags, waveform_status, scan_status,
+			ARRAY(SELECT tune_id FROM tune_recordings WHERE recording_id = recordings.id ORDER BY tune_id)
+		FROM recordings
+		WHERE band_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	return m.query(query, bandID)
+}
+
+func (m RecordingModel) GetAllForTune(tuneID int64) ([]*Recording, error) {
+	query := `
+		SELECT id, band_id, owner_id, created_at, file_path, file_type, title,
+			duration, sample_rate, channels, bitrate, bits_per_sample, tags, waveform_status, scan_status,
+			ARRAY(SELECT tune_id FROM tune_recordings WHERE recording_id = recordings.id ORDER BY tune_id)
+		FROM recordings
+		WHERE id IN (SELECT recording_id FROM tune_recordings WHERE tune_id = $1)
+		ORDER BY created_at DESC, id DESC`
+
+	return m.query(query, tuneID)
+}
+
+// GetAllWithPendingWaveforms returns the recordings whose peaks haven't been
+// generated yet, oldest first.
+func (m RecordingModel) GetAllWithPendingWaveforms() ([]*Recording, error) {
+	query := `
+		SELECT id, band_id, owner_id, created_at, file_path, file_type, title,
+			duration, sample_rate, channels, bitrate, bits_per_sample, tags, waveform_status, scan_status,
+			ARRAY(SELECT tune_id FROM tune_recordings WHERE recording_id = recordings.id ORDER BY tune_id)
+		FROM recordings
+		WHERE waveform_status = $1
+		ORDER BY created_at, id`
+
+	return m.query(query, WaveformPending)
+}
+
+// GetAllPendingScan returns the recordings whose files are waiting to be
+// scanned for malware, oldest first.
+func (m RecordingModel) GetAllPendingScan() ([]*Recording, error) {
+	query := `
+		SELECT id, band_id, owner_id, created_at, file_path, file_type, title,
+			duration, sample_rate, channels, bitrate, bits_per_sample, tags, waveform_status, scan_status,
+			ARRAY(SELECT tune_id FROM tune_recordings WHERE recording_id = recordings.id ORDER BY tune_id)
+		FROM recordings
+		WHERE scan_status = 'pending'
+		ORDER BY id`
+
+	return m.query(query)
+}
+
+// SetScanStatus records the outcome of scanning a pending recording's file.
+// It returns ErrEditConflict if the recording is no longer pending or holds
+// another file. Infected files are quarantined as DocumentModel.SetScanStatus
+// does, along with every row that held the same file.
+func (m RecordingModel) SetScanStatus(rec *Recording, status, filePath string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE recordings
+		SET scan_status = $1, file_path = $2
+		WHERE id = $3 AND scan_status = 'pending' AND file_path = $4`
+
+	result, err := tx.ExecContext(ctx, query, status, filePath, rec.ID, rec.FilePath)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	if status == ScanInfected {
+		err = quarantineFile(ctx, tx, rec.FilePath, filePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	rec.ScanStatus = status
+	rec.FilePath = filePath
+
+	return nil
+}
+
+func (m RecordingModel) SetWaveformStatus(id int64, status string) error {
+	query := `
+		UPDATE recordings
+		SET waveform_status = $1
+		WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, status, id)
+	return err
+}
+
+func (m RecordingModel) query(query string, args ...any) ([]*Recording, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	recs := []*Recording{}
+
+	for rows.Next() {
+		var rec Recording
+
+		err := rows.Scan(
+			&rec.ID,
+			&rec.BandID,
+			&rec.OwnerID,
+			&rec.CreatedAt,
+			&rec.FilePath,
+			&rec.FileType,
+			&rec.Title,
+			&rec.Duration,
+			&rec.SampleRate,
+			&rec.Channels,
+			&rec.Bitrate,
+			&rec.BitsPerSample,
+			&rec.Tags,
+			&rec.WaveformStatus,
+			&rec.ScanStatus,
+			pq.Array(&rec.TuneIDs),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		recs = append(recs, &rec)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recs, nil
+}
+
+// LinkTunes links the recording to each of the tunes, which must belong to the
+// recording's band. Tunes that are already linked are left alone.
+func (m RecordingModel) LinkTunes(rec *Recording, tuneIDs []int64) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = linkTunes(ctx, tx, rec.ID, rec.BandID, tuneIDs)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func linkTunes(ctx context.Context, tx *sql.Tx, recordingID int64, bandID int64, tuneIDs []int64) error {
+	if len(tuneIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO tune_recordings (tune_id, recording_id)
+		SELECT id, $1
+		FROM tunes
+		WHERE id = ANY($2) AND band_id = $3
+		ON CONFLICT DO NOTHING`
+
+	_, err := tx.ExecContext(ctx, query, recordingID, pq.Array(tuneIDs), bandID)
+	if err != nil {
+		return err
+	}
+
+	// Rows that were already linked aren't reported by the insert, so check
+	// the tunes directly.
+	countQuery := `
+		SELECT count(*)
+		FROM tunes
+		WHERE id = ANY($1) AND band_id = $2`
+
+	var count int
+
+	err = tx.QueryRowContext(ctx, countQuery, pq.Array(tuneIDs), bandID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count != len(tuneIDs) {
+		return ErrTuneNotInBand
+	}
+
+	return nil
+}
+
+func (m RecordingModel) UnlinkTune(recordingID int64, tuneID int64) error {
+	query := `
+		DELETE FROM tune_recordings
+		WHERE recording_id = $1 AND tune_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, recordingID, tuneID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m RecordingModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM recordings
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
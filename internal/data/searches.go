@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gazebo.njvanhaute.com/internal/validator"
+	"github.com/lib/pq"
+)
+
+// SavedSearch is a named set of tune list filters. Searches are private to
+// the user who created them unless shared with the rest of the band.
+type SavedSearch struct {
+	ID           int64             `json:"id"`
+	BandID       int64             `json:"band_id"`
+	UserID       int64             `json:"user_id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Version      int32             `json:"version"`
+	Name         string            `json:"name"`
+	Shared       bool              `json:"shared"`
+	Title        string            `json:"title"`
+	Keys         []string          `json:"keys"`
+	Statuses     []string          `json:"statuses"`
+	CustomFields CustomFieldValues `json:"custom_fields"`
+	Sort         string            `json:"sort"`
+}
+
+type SavedSearchModel struct {
+	DB *sql.DB
+}
+
+// ValidateSavedSearch checks the search's name and filters. Custom field
+// filters are checked against the band's current fields, so a search can
+// become invalid when a field it uses is deleted.
+func ValidateSavedSearch(v *validator.Validator, search *SavedSearch, fields []*CustomField) {
+	v.Check(search.Name != "", "name", "must be provided")
+	v.Check(len(search.Name) <= 200, "name", "must not be more than 200 bytes long")
+
+	v.Check(len(search.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(validator.Unique(search.Keys), "keys", "must not contain duplicate values")
+	v.Check(validator.Unique(search.Statuses), "statuses", "must not contain duplicate values")
+
+	for _, status := range search.Statuses {
+		v.Check(validator.PermittedValue(status, tuneStatuses...), "statuses", "invalid status value")
+	}
+
+	known := make(map[string]*CustomField, len(fields))
+	for _, field := range fields {
+		known[field.Name] = field
+	}
+
+	for name, value := range search.CustomFields {
+		field, ok := known[name]
+		if !ok {
+			v.AddError("custom_fields."+name, "is not defined for this band")
+			continue
+		}
+
+		v.Check(field.validValue(value), "custom_fields."+name, "must be "+field.describeType())
+	}
+
+	v.Check(search.Sort != "", "sort", "must be provided")
+}
+
+func (s SavedSearchModel) Insert(search *SavedSearch) error {
+	query := `
+		INSERT INTO saved_searches (band_id, user_id, name, shared, title, keys, statuses, custom_fields, sort)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, version`
+
+	args := []any{
+		search.BandID,
+		search.UserID,
+		search.Name,
+		search.Shared,
+		search.Title,
+		pq.Array(search.Keys),
+		pq.Array(search.Statuses),
+		search.CustomFields,
+		search.Sort,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return s.DB.QueryRowContext(ctx, query, args...).Scan(&search.ID, &search.CreatedAt, &search.Version)
+}
+
+func (s SavedSearchModel) Get(id int64) (*SavedSearch, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, band_id, user_id, created_at, version, name, shared, title, keys, statuses, custom_fields, sort
+		FROM saved_searches
+		WHERE id = $1`
+
+	var search SavedSearch
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, id).Scan(
+		&search.ID,
+		&search.BandID,
+		&search.UserID,
+		&search.CreatedAt,
+		&search.Version,
+		&search.Name,
+		&search.Shared,
+		&search.Title,
+		pq.Array(&search.Keys),
+		pq.Array(&search.Statuses),
+		&search.CustomFields,
+		&search.Sort,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &search, nil
+}
+
+// GetAllVisibleToUser returns the user's own searches in the band along with
+// any searches other members have shared with it.
+func (s SavedSearchModel) GetAllVisibleToUser(bandID int64, userID int64) ([]*SavedSearch, error) {
+	query := `
+		SELECT id, band_id, user_id, created_at, version, name, shared, title, keys, statuses, custom_fields, sort
+		FROM saved_searches
+		WHERE band_id = $1
+		AND (user_id = $2 OR shared)
+		ORDER BY name ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, bandID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	searches := []*SavedSearch{}
+
+	for rows.Next() {
+		var search SavedSearch
+
+		err := rows.Scan(
+			&search.ID,
+			&search.BandID,
+			&search.UserID,
+			&search.CreatedAt,
+			&search.Version,
+			&search.Name,
+			&search.Shared,
+			&search.Title,
+			pq.Array(&search.Keys),
+			pq.Array(&search.Statuses),
+			&search.CustomFields,
+			&search.Sort,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		searches = append(searches, &search)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return searches, nil
+}
+
+func (s SavedSearchModel) Update(search *SavedSearch) error {
+	query := `
+		UPDATE saved_searches
+		SET name = $1, shared = $2, title = $3, keys = $4, statuses = $5, custom_fields = $6, sort = $7, version = version + 1
+		WHERE id = $8 AND version = $9
+		RETURNING version`
+
+	args := []any{
+		search.Name,
+		search.Shared,
+		search.Title,
+		pq.Array(search.Keys),
+		pq.Array(search.Statuses),
+		search.CustomFields,
+		search.Sort,
+		search.ID,
+		search.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, args...).Scan(&search.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s SavedSearchModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM saved_searches
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+type TimeSignatureCount struct {
+	TimeSignature string `json:"time_signature"`
+	Count         int    `json:"count"`
+}
+
+type MonthCount struct {
+	Month string `json:"month"`
+	Count int    `json:"count"`
+}
+
+type TuneSummary struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// BandStats summarises a band's repertoire.
+type BandStats struct {
+	BandID                int64                `json:"band_id"`
+	TotalTunes            int                  `json:"total_tunes"`
+	TotalDocuments        int                  `json:"total_documents"`
+	StatusCounts          map[string]int       `json:"status_counts"`
+	KeyCounts             []KeyCount           `json:"key_counts"`
+	TimeSignatureCounts   []TimeSignatureCount `json:"time_signature_counts"`
+	TunesAddedPerMonth    []MonthCount         `json:"tunes_added_per_month"`
+	TunesWithoutDocuments []TuneSummary        `json:"tunes_without_documents"`
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// GetForBand computes the band's stats with SQL aggregates, counting only
+// tunes created in [from, to) when either bound is set. All queries run in a
+// single read-only transaction so the figures are consistent with each other.
+func (s StatsModel) GetForBand(bandID int64, from, to *time.Time) (*BandStats, error) {
+	stats := &BandStats{
+		BandID:                bandID,
+		StatusCounts:          make(map[string]int, len(tuneStatuses)),
+		KeyCounts:             []KeyCount{},
+		TimeSignatureCounts:   []TimeSignatureCount{},
+		TunesAddedPerMonth:    []MonthCount{},
+		TunesWithoutDocuments: []TuneSummary{},
+	}
+
+	for _, status := range tuneStatuses {
+		stats.StatusCounts[status] = 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	args := []any{bandID, from, to}
+
+	// Every query below filters tunes with the same conditions.
+	const inRange = `
+		tunes.band_id = $1
+		AND ($2::timestamptz IS NULL OR tunes.created_at >= $2)
+		AND ($3::timestamptz IS NULL OR tunes.created_at < $3)`
+
+	statusQuery := `
+		SELECT status, count(*)
+		FROM tunes
+		WHERE` + inRange + `
+		GROUP BY status`
+
+	rows, err := tx.QueryContext(ctx, statusQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var status string
+		var count int
+
+		err := rows.Scan(&status, &count)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		stats.StatusCounts[status] = count
+		stats.TotalTunes += count
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keyQuery := `
+		SELECT key, count(*)
+		FROM tunes, unnest(tunes.keys) AS key
+		WHERE` + inRange + `
+		GROUP BY key
+		ORDER BY count(*) DESC, key ASC`
+
+	rows, err = tx.QueryContext(ctx, keyQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var kc KeyCount
+
+		err := rows.Scan(&kc.Key, &kc.Count)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		stats.KeyCounts = append(stats.KeyCounts, kc)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	timeSignatureQuery := `
+		SELECT time_signature_upper, time_signature_lower, count(*)
+		FROM tunes
+		WHERE` + inRange + `
+		GROUP BY time_signature_upper, time_signature_lower
+		ORDER BY count(*) DESC, time_signature_lower ASC, time_signature_upper ASC`
+
+	rows, err = tx.QueryContext(ctx, timeSignatureQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var upper, lower, count int
+
+		err := rows.Scan(&upper, &lower, &count)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		stats.TimeSignatureCounts = append(stats.TimeSignatureCounts, TimeSignatureCount{
+			TimeSignature: fmt.Sprintf("%d/%d", upper, lower),
+			Count:         count,
+		})
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	monthQuery := `
+		SELECT to_char(date_trunc('month', created_at), 'YYYY-MM') AS month, count(*)
+		FROM tunes
+		WHERE` + inRange + `
+		GROUP BY month
+		ORDER BY month ASC`
+
+	rows, err = tx.QueryContext(ctx, monthQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var mc MonthCount
+
+		err := rows.Scan(&mc.Month, &mc.Count)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		stats.TunesAddedPerMonth = append(stats.TunesAddedPerMonth, mc)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	withoutDocumentsQuery := `
+		SELECT id, title
+		FROM tunes
+		WHERE` + inRange + `
+		AND NOT EXISTS (SELECT 1 FROM documents WHERE documents.tune_id = tunes.id)
+		ORDER BY title ASC, id ASC`
+
+	rows, err = tx.QueryContext(ctx, withoutDocumentsQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var ts TuneSummary
+
+		err := rows.Scan(&ts.ID, &ts.Title)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		stats.TunesWithoutDocuments = append(stats.TunesWithoutDocuments, ts)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	documentQuery := `
+		SELECT count(*)
+		FROM documents
+		INNER JOIN tunes ON tunes.id = documents.tune_id
+		WHERE` + inRange
+
+	err = tx.QueryRowContext(ctx, documentQuery, args...).Scan(&stats.TotalDocuments)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, tx.Commit()
+}
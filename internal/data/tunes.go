@@ -5,25 +5,35 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"gazebo.njvanhaute.com/internal/abc"
 	"gazebo.njvanhaute.com/internal/validator"
 	"github.com/lib/pq"
 )
 
 type Tune struct {
-	ID                 int64     `json:"id"`
-	CreatedAt          time.Time `json:"created_at"`
-	Version            int32     `json:"version"`
-	Title              string    `json:"title"`
-	Keys               []Key     `json:"keys"`
-	TimeSignatureUpper int8      `json:"time_signature_upper"`
-	TimeSignatureLower int8      `json:"time_signature_lower"`
-	BandID             int64     `json:"band_id"`
-	Status             string    `json:"status"`
+	ID                 int64             `json:"id"`
+	CreatedAt          time.Time         `json:"created_at"`
+	Version            int32             `json:"version"`
+	Title              string            `json:"title"`
+	Keys               []Key             `json:"keys"`
+	TimeSignatureUpper int8              `json:"time_signature_upper"`
+	TimeSignatureLower int8              `json:"time_signature_lower"`
+	BandID             int64             `json:"band_id"`
+	Status             string            `json:"status"`
+	CustomFields       CustomFieldValues `json:"custom_fields"`
+	Composer           string            `json:"composer"`
+	Tempo              int32             `json:"tempo"`
+	ABC                string            `json:"abc,omitempty"`
+	MatchedAlias       *string           `json:"matched_alias,omitempty"`
+	Favorited          *bool             `json:"favorited,omitempty"`
 }
 
-func ValidateTune(v *validator.Validator, tune *Tune) {
+var tuneStatuses = []string{"germinating", "seedling", "flowering"}
+
+func ValidateTune(v *validator.Validator, tune *Tune, fields []*CustomField) {
 	v.Check(tune.Title != "", "title", "must be provided")
 	v.Check(len(tune.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -41,9 +51,21 @@ func ValidateTune(v *validator.Validator, tune *Tune) {
 	v.Check(tune.BandID != 0, "band_id", "must be provided")
 	v.Check(tune.BandID > 0, "band_id", "must be a positive integer")
 
-	validStatusList := []string{"germinating", "seedling", "flowering"}
-	v.Check(validator.PermittedValue(tune.Status, validStatusList...), "status", "invalid status value")
+	v.Check(validator.PermittedValue(tune.Status, tuneStatuses...), "status", "invalid status value")
+
+	validateCustomFieldValues(v, tune.CustomFields, fields)
+
+	v.Check(len(tune.Composer) <= 500, "composer", "must not be more than 500 bytes long")
+	v.Check(tune.Tempo >= 0 && tune.Tempo <= 1000, "tempo", "must be between 0 and 1000")
+
+	v.Check(len(tune.ABC) <= 65536, "abc", "must not be more than 65536 bytes long")
 
+	if tune.ABC != "" && v.Valid() {
+		_, err := abc.Parse(tune.ABC)
+		if err != nil {
+			v.AddError("abc", err.Error())
+		}
+	}
 }
 
 type TuneModel struct {
@@ -52,11 +74,11 @@ type TuneModel struct {
 
 func (t TuneModel) Insert(tune *Tune) error {
 	query := `
-		INSERT INTO tunes (title, keys, time_signature_upper, time_signature_lower, status, band_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO tunes (title, keys, time_signature_upper, time_signature_lower, status, band_id, custom_fields, composer, tempo, abc)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at, version`
 
-	args := []any{tune.Title, pq.Array(tune.Keys), tune.TimeSignatureUpper, tune.TimeSignatureLower, tune.Status, tune.BandID}
+	args := []any{tune.Title, pq.Array(tune.Keys), tune.TimeSignatureUpper, tune.TimeSignatureLower, tune.Status, tune.BandID, tune.CustomFields, tune.Composer, tune.Tempo, tune.ABC}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -70,7 +92,7 @@ func (t TuneModel) Get(id int64) (*Tune, error) {
 	}
 
 	query := `
-		SELECT id, created_at, version, title, keys, time_signature_upper, time_signature_lower, status, band_id
+		SELECT id, created_at, version, title, keys, time_signature_upper, time_signature_lower, status, band_id, custom_fields, composer, tempo, abc
 		FROM tunes
 		WHERE id = $1`
 
@@ -90,6 +112,10 @@ func (t TuneModel) Get(id int64) (*Tune, error) {
 		&tune.TimeSignatureLower,
 		&tune.Status,
 		&tune.BandID,
+		&tune.CustomFields,
+		&tune.Composer,
+		&tune.Tempo,
+		&tune.ABC,
 	)
 
 	if err != nil {
@@ -108,21 +134,77 @@ func (t TuneModel) Get(id int64) (*Tune, error) {
 	return &tune, nil
 }
 
-func (t TuneModel) GetAll(bandId int64, title string, keys []string, statuses []string, filters Filters) ([]*Tune, Metadata, error) {
+// GetTitles returns the titles of those of the given tunes that belong to
+// the band, keyed by tune ID.
+func (t TuneModel) GetTitles(bandID int64, ids []int64) (map[int64]string, error) {
+	query := `
+		SELECT id, title
+		FROM tunes
+		WHERE band_id = $1 AND id = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, bandID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	titles := map[int64]string{}
+
+	for rows.Next() {
+		var id int64
+		var title string
+
+		err := rows.Scan(&id, &title)
+		if err != nil {
+			return nil, err
+		}
+
+		titles[id] = title
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// GetAll returns a page of the band's tunes matching the given filters. Each
+// tune is flagged with whether userID has favorited it, and favoritedOnly
+// limits the results to those tunes. ABC notation is left out to keep the
+// list small; it comes with Get.
+func (t TuneModel) GetAll(bandId int64, userID int64, title string, keys []string, statuses []string, customFields CustomFieldValues, favoritedOnly bool, filters Filters) ([]*Tune, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, version, title, keys, time_signature_upper, time_signature_lower, status, band_id
+		SELECT count(*) OVER(), id, created_at, version, title, keys, time_signature_upper, time_signature_lower, status, band_id, custom_fields, composer, tempo, matched.alias_title,
+			EXISTS (SELECT 1 FROM tune_favorites WHERE tune_favorites.tune_id = tunes.id AND tune_favorites.user_id = $6)
 		FROM tunes
+		LEFT JOIN LATERAL (
+			SELECT tune_aliases.title AS alias_title
+			FROM tune_aliases
+			WHERE tune_aliases.tune_id = tunes.id
+			AND $2 <> ''
+			AND NOT to_tsvector('simple', tunes.title) @@ plainto_tsquery('simple', $2)
+			AND to_tsvector('simple', tune_aliases.title) @@ plainto_tsquery('simple', $2)
+			ORDER BY tune_aliases.id ASC
+			LIMIT 1
+		) AS matched ON true
 		WHERE band_id = $1
-		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR matched.alias_title IS NOT NULL OR $2 = '')
 		AND (keys @> $3 OR $3 = '{}')
 		AND (status = ANY($4) or $4 = '{}')
+		AND custom_fields @> $5
+		AND (NOT $7 OR EXISTS (SELECT 1 FROM tune_favorites WHERE tune_favorites.tune_id = tunes.id AND tune_favorites.user_id = $6))
 		ORDER BY %s %s, id ASC
-		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $8 OFFSET $9`, tuneSortExpression(filters), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{bandId, title, pq.Array(keys), pq.Array(statuses), filters.limit(), filters.offset()}
+	args := []any{bandId, title, pq.Array(keys), pq.Array(statuses), customFields, userID, favoritedOnly, filters.limit(), filters.offset()}
 
 	rows, err := t.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -137,6 +219,8 @@ func (t TuneModel) GetAll(bandId int64, title string, keys []string, statuses []
 	for rows.Next() {
 		var tune Tune
 		var keys []string
+		var matchedAlias sql.NullString
+		var favorited bool
 
 		err := rows.Scan(
 			&totalRecords,
@@ -149,12 +233,23 @@ func (t TuneModel) GetAll(bandId int64, title string, keys []string, statuses []
 			&tune.TimeSignatureLower,
 			&tune.Status,
 			&tune.BandID,
+			&tune.CustomFields,
+			&tune.Composer,
+			&tune.Tempo,
+			&matchedAlias,
+			&favorited,
 		)
 
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 
+		if matchedAlias.Valid {
+			tune.MatchedAlias = &matchedAlias.String
+		}
+
+		tune.Favorited = &favorited
+
 		for _, key := range keys {
 			tune.Keys = append(tune.Keys, Key(key))
 		}
@@ -171,11 +266,24 @@ func (t TuneModel) GetAll(bandId int64, title string, keys []string, statuses []
 	return tunes, metadata, nil
 }
 
+// tuneSortExpression maps the sort column onto an ORDER BY expression. Sorts
+// on a custom field ("cf.<name>") order by the field's JSONB value, which
+// compares numbers numerically and strings lexically.
+func tuneSortExpression(f Filters) string {
+	column := f.sortColumn()
+
+	if name, ok := strings.CutPrefix(column, "cf."); ok {
+		return "custom_fields -> " + pq.QuoteLiteral(name)
+	}
+
+	return column
+}
+
 func (t TuneModel) Update(tune *Tune) error {
 	query := `
 		UPDATE tunes
-		SET title = $1, keys = $2, time_signature_upper = $3, time_signature_lower = $4, status = $5, version = version + 1
-		WHERE id = $6 AND version = $7
+		SET title = $1, keys = $2, time_signature_upper = $3, time_signature_lower = $4, status = $5, custom_fields = $6, composer = $7, tempo = $8, abc = $9, version = version + 1
+		WHERE id = $10 AND version = $11
 		RETURNING version`
 
 	args := []any{
@@ -184,6 +292,10 @@ func (t TuneModel) Update(tune *Tune) error {
 		tune.TimeSignatureUpper,
 		tune.TimeSignatureLower,
 		tune.Status,
+		tune.CustomFields,
+		tune.Composer,
+		tune.Tempo,
+		tune.ABC,
 		tune.ID,
 		tune.Version,
 	}
@@ -204,31 +316,20 @@ func (t TuneModel) Update(tune *Tune) error {
 	return nil
 }
 
-func (t TuneModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
-	}
+// Delete deletes a tune along with its documents, returning the paths of the
+// files the documents held.
+func (t TuneModel) Delete(id int64) ([]string, error) {
+	filesQuery := `
+		SELECT v.file_path
+		FROM document_versions v
+		INNER JOIN documents d ON d.id = v.document_id
+		WHERE d.tune_id = $1
+		UNION
+		SELECT file_path FROM documents WHERE tune_id = $1`
 
 	query := `
 		DELETE FROM tunes
 		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := t.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
-
-	return nil
+	return deleteWithFiles(t.DB, filesQuery, query, id)
 }
@@ -0,0 +1,196 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	UploadKindDocument  = "document"
+	UploadKindRecording = "recording"
+)
+
+// Upload is a resumable upload in progress. Info holds the same JSON
+// metadata as the "info" part of a single-shot upload, and Resource is the
+// URL of the document or recording created once the upload completes.
+type Upload struct {
+	ID        string
+	OwnerID   int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Kind      string
+	Info      json.RawMessage
+	Length    int64
+	Offset    int64
+	Resource  string
+}
+
+type UploadModel struct {
+	DB *sql.DB
+}
+
+func (m UploadModel) Insert(upload *Upload) error {
+	query := `
+		INSERT INTO uploads (id, owner_id, expires_at, kind, info, upload_length)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at`
+
+	args := []any{upload.ID, upload.OwnerID, upload.ExpiresAt, upload.Kind, string(upload.Info), upload.Length}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&upload.CreatedAt)
+}
+
+// Get returns an upload that hasn't expired.
+func (m UploadModel) Get(id string) (*Upload, error) {
+	query := `
+		SELECT id, owner_id, created_at, expires_at, kind, info, upload_length, upload_offset, resource
+		FROM uploads
+		WHERE id = $1 AND expires_at > NOW()`
+
+	var upload Upload
+	var info []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&upload.ID,
+		&upload.OwnerID,
+		&upload.CreatedAt,
+		&upload.ExpiresAt,
+		&upload.Kind,
+		&info,
+		&upload.Length,
+		&upload.Offset,
+		&upload.Resource,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	upload.Info = info
+
+	return &upload, nil
+}
+
+// UpdateOffset records how much of the upload has been received and pushes
+// back its expiry. It returns ErrEditConflict if the offset has moved on
+// since the upload was read.
+func (m UploadModel) UpdateOffset(upload *Upload, offset int64) error {
+	query := `
+		UPDATE uploads
+		SET upload_offset = $1, expires_at = $2
+		WHERE id = $3 AND upload_offset = $4`
+
+	args := []any{offset, upload.ExpiresAt, upload.ID, upload.Offset}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	upload.Offset = offset
+
+	return nil
+}
+
+// Complete records the resource created from a finished upload.
+func (m UploadModel) Complete(upload *Upload) error {
+	query := `
+		UPDATE uploads
+		SET resource = $1
+		WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, upload.Resource, upload.ID)
+	return err
+}
+
+func (m UploadModel) Delete(id string) error {
+	query := `
+		DELETE FROM uploads
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired removes uploads past their expiry, returning their IDs so
+// that any partial files can be cleaned up.
+func (m UploadModel) DeleteExpired() ([]string, error) {
+	query := `
+		DELETE FROM uploads
+		WHERE expires_at <= NOW()
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := []string{}
+
+	for rows.Next() {
+		var id string
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,190 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// tagOrientation is the EXIF tag saying which way up the camera was held.
+const tagOrientation = 0x0112
+
+// orientation returns the EXIF orientation of an image, from 1 to 8, or 1 if
+// it has none or it can't be read.
+func orientation(data []byte, format string) int {
+	var tiff []byte
+
+	switch format {
+	case FormatJPEG:
+		tiff = jpegEXIF(data)
+	case FormatPNG:
+		tiff = pngEXIF(data)
+	case FormatWebP:
+		for _, c := range webpChunks(data) {
+			if c.id == "EXIF" {
+				tiff = bytes.TrimPrefix(c.data, []byte("Exif\x00\x00"))
+				break
+			}
+		}
+	}
+
+	o := tiffOrientation(tiff)
+	if o < 1 || o > 8 {
+		return 1
+	}
+
+	return o
+}
+
+// jpegEXIF returns the TIFF data in a JPEG's APP1 segment, or nil if it has
+// none.
+func jpegEXIF(data []byte) []byte {
+	i := 2
+
+	for i+4 <= len(data) {
+		if data[i] != 0xff {
+			return nil
+		}
+
+		marker := data[i+1]
+
+		// Padding before a marker.
+		if marker == 0xff {
+			i++
+			continue
+		}
+
+		// Segments after the start of scan are image data.
+		if marker == 0xda || marker == 0xd9 {
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+
+		segment := data[i+4 : i+2+length]
+
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+
+		i += 2 + length
+	}
+
+	return nil
+}
+
+// pngEXIF returns the contents of a PNG's eXIf chunk, or nil if it has none.
+func pngEXIF(data []byte) []byte {
+	i := 8
+
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+
+		if length < 0 || length > len(data)-i-12 {
+			return nil
+		}
+
+		if kind == "eXIf" {
+			return data[i+8 : i+8+length]
+		}
+
+		if kind == "IDAT" || kind == "IEND" {
+			return nil
+		}
+
+		i += 12 + length
+	}
+
+	return nil
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of EXIF data,
+// returning 0 if there isn't one.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int64(order.Uint32(tiff[4:]))
+	if offset+2 > int64(len(tiff)) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	entries := tiff[offset+2:]
+
+	for i := 0; i < count && (i+1)*12 <= len(entries); i++ {
+		entry := entries[i*12:]
+
+		// The orientation is a SHORT held in the entry itself.
+		if order.Uint16(entry) == tagOrientation && order.Uint16(entry[2:]) == 3 {
+			return int(order.Uint16(entry[8:]))
+		}
+	}
+
+	return 0
+}
+
+// orient turns an image the right way up given its EXIF orientation.
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+
+			switch o {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // mirrored on its side
+				sx, sy = y, x
+			case 6: // turned anticlockwise, so turn it clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored on its other side
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned clockwise, so turn it anticlockwise
+				sx, sy = w-1-y, x
+			}
+
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,206 @@
+// Package images prepares uploaded photos and scans of charts for storage:
+// it identifies JPEG, PNG and WebP files, strips their metadata, turns them
+// the right way up, and makes thumbnails of them.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FormatJPEG = "jpg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+)
+
+// Limits on the images that are accepted. MaxFileSize bounds what is read
+// into memory, and MaxPixels what a small file may decode to.
+const (
+	MaxFileSize = 50 << 20
+	MaxPixels   = 50_000_000
+)
+
+// jpegQuality is used when re-encoding JPEGs. It is high enough that
+// handwriting survives being encoded a second time.
+const jpegQuality = 90
+
+var (
+	ErrUnknownFormat = errors.New("images: unrecognised format")
+	ErrMalformed     = errors.New("images: malformed file")
+	ErrTooLarge      = errors.New("images: image is too large")
+)
+
+// Format identifies an image from the first bytes of its file, returning an
+// empty string if it isn't one of the supported formats. At least 12 bytes
+// are needed to recognise WebP.
+func Format(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("\xff\xd8\xff")):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return FormatWebP
+	default:
+		return ""
+	}
+}
+
+// Info describes an image. Width and Height are as it is displayed, after
+// any rotation its orientation calls for.
+type Info struct {
+	Format      string
+	Width       int
+	Height      int
+	Orientation int
+}
+
+// Probe identifies the image in data and reads its dimensions without
+// decoding it.
+func Probe(data []byte) (*Info, error) {
+	format := Format(data)
+	if format == "" {
+		return nil, ErrUnknownFormat
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrMalformed
+	}
+
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	info := &Info{
+		Format:      format,
+		Width:       config.Width,
+		Height:      config.Height,
+		Orientation: orientation(data, format),
+	}
+
+	if info.Orientation >= 5 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	return info, nil
+}
+
+// ReadAll reads an image file, refusing files over MaxFileSize.
+func ReadAll(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxFileSize {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+// Sanitize returns a copy of the image in data with its metadata removed and
+// its pixels turned to match its orientation tag, along with the format of
+// the copy.
+//
+// JPEGs and PNGs are decoded and encoded again, which drops everything but
+// the pixels. There is no WebP encoder to hand, so WebP files have their
+// metadata chunks cut out instead, leaving the image data untouched; one that
+// needs turning is converted to a PNG.
+func Sanitize(data []byte) ([]byte, string, error) {
+	info, err := Probe(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if info.Format == FormatWebP && info.Orientation <= 1 {
+		out, err := stripWebP(data)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return out, FormatWebP, nil
+	}
+
+	img, err := decode(data, info)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+
+	switch info.Format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	default:
+		info.Format = FormatPNG
+		err = png.Encode(&buf, img)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), info.Format, nil
+}
+
+// WriteThumbnail writes a JPEG of the image in data scaled to fit within a
+// square of the given size. Images smaller than that aren't enlarged.
+// Transparent areas are shown against white, as they would be on a page.
+func WriteThumbnail(w io.Writer, data []byte, size int) error {
+	info, err := Probe(data)
+	if err != nil {
+		return err
+	}
+
+	img, err := decode(data, info)
+	if err != nil {
+		return err
+	}
+
+	width, height := fit(info.Width, info.Height, size)
+
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(thumb, thumb.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(thumb, thumb.Bounds(), img, img.Bounds(), draw.Over, nil)
+
+	return jpeg.Encode(w, thumb, &jpeg.Options{Quality: 80})
+}
+
+// fit scales width and height down to fit within a square of the given size,
+// keeping the aspect ratio.
+func fit(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+
+	return max(1, width*size/height), size
+}
+
+// decode decodes an image that has been probed and turns it the right way
+// up.
+func decode(data []byte, info *Info) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	return orient(img, info.Orientation), nil
+}
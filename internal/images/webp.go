@@ -0,0 +1,83 @@
+package images
+
+import (
+	"encoding/binary"
+)
+
+// VP8X flags saying the file has metadata chunks.
+const (
+	vp8xFlagEXIF = 0x08
+	vp8xFlagXMP  = 0x04
+)
+
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// webpChunks splits a WebP file into its chunks, stopping at the first one
+// that runs past the end of the file.
+func webpChunks(data []byte) []webpChunk {
+	if len(data) < 12 {
+		return nil
+	}
+
+	end := 8 + int64(binary.LittleEndian.Uint32(data[4:]))
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+
+	var chunks []webpChunk
+
+	for i := int64(12); i+8 <= end; {
+		id := string(data[i : i+4])
+		size := int64(binary.LittleEndian.Uint32(data[i+4:]))
+
+		if i+8+size > end {
+			break
+		}
+
+		chunks = append(chunks, webpChunk{id: id, data: data[i+8 : i+8+size]})
+
+		// Chunks are padded to an even length.
+		i += 8 + size + size&1
+	}
+
+	return chunks
+}
+
+// stripWebP rebuilds a WebP file without its EXIF and XMP chunks.
+func stripWebP(data []byte) ([]byte, error) {
+	chunks := webpChunks(data)
+	if len(chunks) == 0 {
+		return nil, ErrMalformed
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, "RIFF\x00\x00\x00\x00WEBP")
+
+	for _, c := range chunks {
+		if c.id == "EXIF" || c.id == "XMP " {
+			continue
+		}
+
+		body := c.data
+
+		if c.id == "VP8X" && len(body) > 0 {
+			body = append([]byte{}, body...)
+			body[0] &^= vp8xFlagEXIF | vp8xFlagXMP
+		}
+
+		out = append(out, c.id...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(body)))
+		out = append(out, body...)
+
+		if len(body)&1 == 1 {
+			out = append(out, 0)
+		}
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+
+	return out, nil
+}
@@ -0,0 +1,161 @@
+// Package metronome renders click tracks as WAV audio or Standard MIDI Files.
+package metronome
+
+import (
+	"errors"
+	"time"
+)
+
+// Meter is a time signature together with how its bar is grouped into beats.
+// Grouping lists the length of each beat in units of 1/Lower notes; 6/8 is
+// usually grouped 3+3 and 7/8 might be 2+2+3.
+type Meter struct {
+	Upper    int
+	Lower    int
+	Grouping []int
+}
+
+// DefaultGrouping returns the usual grouping for a time signature. Compound
+// meters such as 6/8 and 12/8 are grouped in threes, other odd eighth-note
+// meters in twos ending with a three, and everything else one beat per unit.
+func DefaultGrouping(upper, lower int) []int {
+	var grouping []int
+
+	switch {
+	case lower >= 8 && upper > 3 && upper%3 == 0:
+		for i := 0; i < upper/3; i++ {
+			grouping = append(grouping, 3)
+		}
+	case lower >= 8 && upper >= 5 && upper%2 == 1:
+		for i := 0; i < (upper-3)/2; i++ {
+			grouping = append(grouping, 2)
+		}
+		grouping = append(grouping, 3)
+	default:
+		for i := 0; i < upper; i++ {
+			grouping = append(grouping, 1)
+		}
+	}
+
+	return grouping
+}
+
+// Options describes a click track.
+//
+// BPM counts beats. When every group in the meter's grouping is the same
+// length a beat is one group, so 6/8 at 60 bpm clicks once a second on the
+// dotted quarter; when the groups are uneven a beat is one 1/Lower note.
+type Options struct {
+	Meter Meter
+	BPM   int
+	Bars  int
+	// CountIn bars are played before the track proper with a different sound.
+	CountIn int
+	// Subdivide adds a quiet click on every 1/Lower note that doesn't start a
+	// group.
+	Subdivide bool
+}
+
+// Kinds of click, from loudest to quietest.
+type clickKind int
+
+const (
+	clickDownbeat clickKind = iota
+	clickBeat
+	clickSubdivision
+	clickCountInDownbeat
+	clickCountInBeat
+)
+
+// click is a click at a position counted in 1/Lower notes from the start.
+type click struct {
+	unit int
+	kind clickKind
+}
+
+var errInvalidOptions = errors.New("metronome: invalid options")
+
+func (o Options) check() error {
+	if o.Meter.Upper < 1 || o.Meter.Lower < 1 || o.BPM < 1 || o.Bars < 0 || o.CountIn < 0 {
+		return errInvalidOptions
+	}
+
+	sum := 0
+	for _, g := range o.Meter.Grouping {
+		if g < 1 {
+			return errInvalidOptions
+		}
+		sum += g
+	}
+
+	if sum != o.Meter.Upper {
+		return errInvalidOptions
+	}
+
+	return nil
+}
+
+// unitsPerBeat is the number of 1/Lower notes in a beat.
+func (o Options) unitsPerBeat() int {
+	for _, g := range o.Meter.Grouping {
+		if g != o.Meter.Grouping[0] {
+			return 1
+		}
+	}
+
+	return o.Meter.Grouping[0]
+}
+
+// unitDuration is the length of a 1/Lower note in seconds.
+func (o Options) unitDuration() float64 {
+	return 60 / float64(o.BPM) / float64(o.unitsPerBeat())
+}
+
+func (o Options) totalUnits() int {
+	return (o.CountIn + o.Bars) * o.Meter.Upper
+}
+
+// Duration returns the length of the click track.
+func (o Options) Duration() time.Duration {
+	return time.Duration(float64(o.totalUnits()) * o.unitDuration() * float64(time.Second))
+}
+
+func (o Options) clicks() []click {
+	var clicks []click
+
+	for bar := 0; bar < o.CountIn+o.Bars; bar++ {
+		countIn := bar < o.CountIn
+		unit := bar * o.Meter.Upper
+
+		for g, length := range o.Meter.Grouping {
+			for i := 0; i < length; i++ {
+				var kind clickKind
+
+				switch {
+				case i > 0 && countIn:
+					// The count-in only marks the beats.
+					unit++
+					continue
+				case i > 0 && !o.Subdivide:
+					unit++
+					continue
+				case i > 0:
+					kind = clickSubdivision
+				case g == 0 && countIn:
+					kind = clickCountInDownbeat
+				case countIn:
+					kind = clickCountInBeat
+				case g == 0:
+					kind = clickDownbeat
+				default:
+					kind = clickBeat
+				}
+
+				clicks = append(clicks, click{unit: unit, kind: kind})
+				unit++
+			}
+		}
+	}
+
+	return clicks
+}
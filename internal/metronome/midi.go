@@ -0,0 +1,64 @@
+package metronome
+
+import (
+	"io"
+	"math"
+
+	"gazebo.njvanhaute.com/internal/midi"
+)
+
+// midiDivision is the number of ticks per quarter note.
+const midiDivision = 480
+
+// clickNotes gives the General MIDI percussion note and velocity of each kind
+// of click.
+var clickNotes = map[clickKind]struct {
+	note, velocity uint8
+}{
+	clickDownbeat:        {76, 127}, // Hi Wood Block
+	clickBeat:            {77, 100}, // Low Wood Block
+	clickSubdivision:     {42, 60},  // Closed Hi-Hat
+	clickCountInDownbeat: {37, 127}, // Side Stick
+	clickCountInBeat:     {37, 90},
+}
+
+// WriteMIDI writes the click track as a single-track Standard MIDI File on
+// the percussion channel, with the tempo and time signature set so that a
+// sequencer's bars line up with the clicks.
+func WriteMIDI(w io.Writer, opts Options) error {
+	err := opts.check()
+	if err != nil {
+		return err
+	}
+
+	unitTicks := uint32(midiDivision * 4 / opts.Meter.Lower)
+	noteTicks := unitTicks / 4
+
+	// The tempo is always given per quarter note.
+	microsPerQuarter := opts.unitDuration() * float64(opts.Meter.Lower) / 4 * 1e6
+
+	track := &midi.Track{}
+	track.Name(0, "Click")
+	track.Tempo(0, uint32(math.Round(microsPerQuarter)))
+	track.TimeSignature(0, uint8(opts.Meter.Upper), uint8(opts.Meter.Lower), uint8(24*4/opts.Meter.Lower*opts.unitsPerBeat()))
+
+	for _, c := range opts.clicks() {
+		tick := uint32(c.unit) * unitTicks
+		n := clickNotes[c.kind]
+
+		track.NoteOn(tick, midi.PercussionChannel, n.note, n.velocity)
+		track.NoteOff(tick+noteTicks, midi.PercussionChannel, n.note)
+	}
+
+	// Hold the track open to the end of the last bar.
+	track.Meta(uint32(opts.totalUnits())*unitTicks, midi.MetaEndOfTrack, nil)
+
+	file := &midi.File{
+		Format:   0,
+		Division: midiDivision,
+		Tracks:   []*midi.Track{track},
+	}
+
+	_, err = file.WriteTo(w)
+	return err
+}
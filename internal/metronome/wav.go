@@ -0,0 +1,97 @@
+package metronome
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	wavSampleRate = 44100
+	// clickLength is how long each click rings for, in seconds. Clicks closer
+	// together than this are cut short by the next one.
+	clickLength = 0.05
+)
+
+// clickSounds gives the pitch in Hz and peak amplitude of each kind of click.
+var clickSounds = map[clickKind]struct {
+	freq, amp float64
+}{
+	clickDownbeat:        {1760, 0.9},
+	clickBeat:            {1320, 0.6},
+	clickSubdivision:     {1320, 0.25},
+	clickCountInDownbeat: {880, 0.9},
+	clickCountInBeat:     {660, 0.6},
+}
+
+// WriteWAV writes the click track as a 16-bit mono WAV file at 44.1kHz.
+func WriteWAV(w io.Writer, opts Options) error {
+	err := opts.check()
+	if err != nil {
+		return err
+	}
+
+	unitSamples := opts.unitDuration() * wavSampleRate
+	totalSamples := int(math.Round(float64(opts.totalUnits()) * unitSamples))
+	dataSize := uint32(totalSamples * 2)
+
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 36+dataSize)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], 1) // mono
+	binary.LittleEndian.PutUint32(header[24:], wavSampleRate)
+	binary.LittleEndian.PutUint32(header[28:], wavSampleRate*2)
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], dataSize)
+
+	_, err = bw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	clicks := opts.clicks()
+	ringSamples := int(clickLength * wavSampleRate)
+
+	var sample [2]byte
+	pos := 0
+
+	for i := 0; i <= len(clicks); i++ {
+		// Each click plays until the next one starts, or the track ends.
+		end := totalSamples
+		if i < len(clicks) {
+			end = int(math.Round(float64(clicks[i].unit) * unitSamples))
+		}
+
+		var sound struct{ freq, amp float64 }
+		start := pos
+		if i > 0 {
+			sound = clickSounds[clicks[i-1].kind]
+		}
+
+		for ; pos < end; pos++ {
+			var s float64
+
+			if n := pos - start; i > 0 && n < ringSamples {
+				t := float64(n) / wavSampleRate
+				s = sound.amp * math.Exp(-t/(clickLength/5)) * math.Sin(2*math.Pi*sound.freq*t)
+			}
+
+			binary.LittleEndian.PutUint16(sample[:], uint16(int16(s*math.MaxInt16)))
+
+			_, err = bw.Write(sample[:])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,195 @@
+// Package midi reads and writes Standard MIDI Files.
+package midi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// Meta event types.
+const (
+	MetaText          = 0x01
+	MetaTrackName     = 0x03
+	MetaEndOfTrack    = 0x2f
+	MetaTempo         = 0x51
+	MetaTimeSignature = 0x58
+	MetaKeySignature  = 0x59
+)
+
+// PercussionChannel is the channel General MIDI reserves for drums.
+const PercussionChannel = 9
+
+// Event is a single MIDI or meta event at an absolute time in ticks. Data
+// holds the complete event as it appears in a file, without the delta time.
+type Event struct {
+	Tick uint32
+	Data []byte
+}
+
+// Track is a sequence of events. Events needn't be added in order; they are
+// sorted by tick, keeping the order they were added in for equal ticks, when
+// the file is written.
+type Track struct {
+	Events []Event
+}
+
+// File is a Standard MIDI File. Division is the number of ticks per quarter
+// note.
+type File struct {
+	Format   uint16
+	Division uint16
+	Tracks   []*Track
+}
+
+func (t *Track) Add(tick uint32, data ...byte) {
+	t.Events = append(t.Events, Event{Tick: tick, Data: data})
+}
+
+func (t *Track) NoteOn(tick uint32, channel, note, velocity uint8) {
+	t.Add(tick, 0x90|channel&0x0f, note&0x7f, velocity&0x7f)
+}
+
+func (t *Track) NoteOff(tick uint32, channel, note uint8) {
+	t.Add(tick, 0x80|channel&0x0f, note&0x7f, 0)
+}
+
+func (t *Track) ProgramChange(tick uint32, channel, program uint8) {
+	t.Add(tick, 0xc0|channel&0x0f, program&0x7f)
+}
+
+// Meta adds a meta event of the given type.
+func (t *Track) Meta(tick uint32, kind uint8, data []byte) {
+	event := []byte{0xff, kind}
+	event = appendVarint(event, uint32(len(data)))
+	event = append(event, data...)
+
+	t.Events = append(t.Events, Event{Tick: tick, Data: event})
+}
+
+// Tempo sets the tempo in microseconds per quarter note.
+func (t *Track) Tempo(tick uint32, microsPerQuarter uint32) {
+	t.Meta(tick, MetaTempo, []byte{
+		byte(microsPerQuarter >> 16),
+		byte(microsPerQuarter >> 8),
+		byte(microsPerQuarter),
+	})
+}
+
+// TimeSignature sets the time signature. clocksPerClick is the number of MIDI
+// clocks (24 to a quarter note) between metronome clicks.
+func (t *Track) TimeSignature(tick uint32, upper, lower, clocksPerClick uint8) {
+	var power uint8
+	for l := lower; l > 1; l >>= 1 {
+		power++
+	}
+
+	t.Meta(tick, MetaTimeSignature, []byte{upper, power, clocksPerClick, 8})
+}
+
+func (t *Track) Name(tick uint32, name string) {
+	t.Meta(tick, MetaTrackName, []byte(name))
+}
+
+// WriteTo writes the file in Standard MIDI File format. Each track is
+// terminated with an end of track event after its last event, or at the
+// latest end of track event added to it if that is later.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	if len(f.Tracks) == 0 {
+		return 0, errors.New("midi: file has no tracks")
+	}
+
+	if f.Format == 0 && len(f.Tracks) != 1 {
+		return 0, errors.New("midi: format 0 files must have exactly one track")
+	}
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	header := make([]byte, 14)
+	copy(header, "MThd")
+	binary.BigEndian.PutUint32(header[4:], 6)
+	binary.BigEndian.PutUint16(header[8:], f.Format)
+	binary.BigEndian.PutUint16(header[10:], uint16(len(f.Tracks)))
+	binary.BigEndian.PutUint16(header[12:], f.Division)
+
+	cw.write(header)
+
+	for _, track := range f.Tracks {
+		cw.write(track.encode())
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+
+	return cw.n, bw.Flush()
+}
+
+func (t *Track) encode() []byte {
+	events := make([]Event, len(t.Events))
+	copy(events, t.Events)
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Tick < events[j].Tick
+	})
+
+	body := []byte{}
+	var last, end uint32
+
+	for _, e := range events {
+		// An explicit end of track is replaced by the one added below, but
+		// still sets how long the track lasts.
+		if len(e.Data) >= 2 && e.Data[0] == 0xff && e.Data[1] == MetaEndOfTrack {
+			end = max(end, e.Tick)
+			continue
+		}
+
+		body = appendVarint(body, e.Tick-last)
+		body = append(body, e.Data...)
+		last = e.Tick
+	}
+
+	body = appendVarint(body, max(end, last)-last)
+	body = append(body, 0xff, MetaEndOfTrack, 0x00)
+
+	chunk := make([]byte, 8, 8+len(body))
+	copy(chunk, "MTrk")
+	binary.BigEndian.PutUint32(chunk[4:], uint32(len(body)))
+
+	return append(chunk, body...)
+}
+
+// appendVarint appends n as a MIDI variable-length quantity: seven bits per
+// byte, most significant first, with the top bit set on all but the last.
+func appendVarint(b []byte, n uint32) []byte {
+	var buf [5]byte
+	i := len(buf) - 1
+
+	buf[i] = byte(n & 0x7f)
+
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		buf[i] = byte(n&0x7f) | 0x80
+	}
+
+	return append(b, buf[i:]...)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) write(p []byte) {
+	if cw.err != nil {
+		return
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+}
@@ -0,0 +1,360 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// maxFileSize is the largest file Read will load.
+const maxFileSize = 32 << 20
+
+var (
+	// ErrNotMIDI is returned by Read when the data doesn't start with a
+	// Standard MIDI File header.
+	ErrNotMIDI = errors.New("midi: not a Standard MIDI File")
+	// ErrMalformed is returned by Read when the file is truncated or its
+	// contents can't be parsed.
+	ErrMalformed = errors.New("midi: malformed file")
+)
+
+// Read parses a Standard MIDI File. Running status is expanded, so each
+// event's Data starts with its status byte, and chunks other than tracks
+// are skipped.
+func Read(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxFileSize {
+		return nil, ErrMalformed
+	}
+
+	if len(data) < 14 || string(data[:4]) != "MThd" {
+		return nil, ErrNotMIDI
+	}
+
+	headerLen := binary.BigEndian.Uint32(data[4:])
+	if headerLen < 6 || uint64(headerLen) > uint64(len(data)-8) {
+		return nil, ErrMalformed
+	}
+
+	f := &File{
+		Format:   binary.BigEndian.Uint16(data[8:]),
+		Division: binary.BigEndian.Uint16(data[12:]),
+	}
+
+	numTracks := int(binary.BigEndian.Uint16(data[10:]))
+
+	if f.Format > 2 || f.Division == 0 {
+		return nil, ErrMalformed
+	}
+
+	rest := data[8+headerLen:]
+
+	for len(f.Tracks) < numTracks && len(rest) >= 8 {
+		id := string(rest[:4])
+		size := binary.BigEndian.Uint32(rest[4:])
+
+		if uint64(size) > uint64(len(rest)-8) {
+			return nil, ErrMalformed
+		}
+
+		chunk := rest[8 : 8+size]
+		rest = rest[8+size:]
+
+		if id != "MTrk" {
+			continue
+		}
+
+		track, err := readTrack(chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		f.Tracks = append(f.Tracks, track)
+	}
+
+	if len(f.Tracks) != numTracks {
+		return nil, ErrMalformed
+	}
+
+	return f, nil
+}
+
+func readTrack(chunk []byte) (*Track, error) {
+	r := bytes.NewReader(chunk)
+	track := &Track{}
+
+	var tick uint32
+	var running byte
+
+	for r.Len() > 0 {
+		delta, err := readVarint(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if tick+delta < tick {
+			return nil, ErrMalformed
+		}
+		tick += delta
+
+		status, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrMalformed
+		}
+
+		var event []byte
+
+		switch {
+		case status == 0xff:
+			kind, err := r.ReadByte()
+			if err != nil {
+				return nil, ErrMalformed
+			}
+
+			body, err := readVarLenData(r)
+			if err != nil {
+				return nil, err
+			}
+
+			event = append([]byte{0xff, kind}, appendVarint(nil, uint32(len(body)))...)
+			event = append(event, body...)
+			running = 0
+
+			if kind == MetaEndOfTrack {
+				track.Events = append(track.Events, Event{Tick: tick, Data: event})
+				return track, nil
+			}
+
+		case status == 0xf0 || status == 0xf7:
+			body, err := readVarLenData(r)
+			if err != nil {
+				return nil, err
+			}
+
+			event = append([]byte{status}, appendVarint(nil, uint32(len(body)))...)
+			event = append(event, body...)
+			running = 0
+
+		case status >= 0xf0:
+			return nil, ErrMalformed
+
+		default:
+			if status < 0x80 {
+				// Running status: this byte is the first data byte.
+				if running == 0 {
+					return nil, ErrMalformed
+				}
+				r.UnreadByte()
+				status = running
+			}
+
+			running = status
+
+			n := 2
+			if status&0xf0 == 0xc0 || status&0xf0 == 0xd0 {
+				n = 1
+			}
+
+			event = make([]byte, 1+n)
+			event[0] = status
+
+			_, err := io.ReadFull(r, event[1:])
+			if err != nil {
+				return nil, ErrMalformed
+			}
+		}
+
+		track.Events = append(track.Events, Event{Tick: tick, Data: event})
+	}
+
+	// Tracks are meant to finish with an end of track event, but plenty of
+	// software leaves it out.
+	return track, nil
+}
+
+func readVarint(r io.ByteReader) (uint32, error) {
+	var n uint32
+
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, ErrMalformed
+		}
+
+		n = n<<7 | uint32(b&0x7f)
+
+		if b&0x80 == 0 {
+			return n, nil
+		}
+	}
+
+	return 0, ErrMalformed
+}
+
+func readVarLenData(r *bytes.Reader) ([]byte, error) {
+	n, err := readVarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(n) > int64(r.Len()) {
+		return nil, ErrMalformed
+	}
+
+	data := make([]byte, n)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	return data, nil
+}
+
+// MetaData returns the data of a meta event of the given kind, or false if e
+// is some other event.
+func (e Event) MetaData(kind uint8) ([]byte, bool) {
+	if len(e.Data) < 3 || e.Data[0] != 0xff || e.Data[1] != kind {
+		return nil, false
+	}
+
+	r := bytes.NewReader(e.Data[2:])
+
+	n, err := readVarint(r)
+	if err != nil || int64(n) != int64(r.Len()) {
+		return nil, false
+	}
+
+	return e.Data[len(e.Data)-int(n):], true
+}
+
+// TimeSignatureEvent is a time signature change.
+type TimeSignatureEvent struct {
+	Tick  uint32 `json:"tick"`
+	Upper int    `json:"upper"`
+	Lower int    `json:"lower"`
+}
+
+// KeySignatureEvent is a key signature change, as a count of sharps
+// (negative for flats).
+type KeySignatureEvent struct {
+	Tick   uint32 `json:"tick"`
+	Sharps int    `json:"sharps"`
+	Minor  bool   `json:"minor"`
+}
+
+// TempoEvent is a tempo change.
+type TempoEvent struct {
+	Tick             uint32  `json:"tick"`
+	MicrosPerQuarter uint32  `json:"micros_per_quarter"`
+	BPM              float64 `json:"bpm"`
+}
+
+// TimeSignatures returns the file's time signature changes from all its
+// tracks, in order. Invalid events are skipped.
+func (f *File) TimeSignatures() []TimeSignatureEvent {
+	sigs := []TimeSignatureEvent{}
+
+	for _, e := range f.metaEvents(MetaTimeSignature) {
+		data, _ := e.MetaData(MetaTimeSignature)
+		if len(data) < 2 || data[0] == 0 || data[1] > 6 {
+			continue
+		}
+
+		sigs = append(sigs, TimeSignatureEvent{
+			Tick:  e.Tick,
+			Upper: int(data[0]),
+			Lower: 1 << data[1],
+		})
+	}
+
+	return sigs
+}
+
+// KeySignatures returns the file's key signature changes from all its
+// tracks, in order. Invalid events are skipped.
+func (f *File) KeySignatures() []KeySignatureEvent {
+	sigs := []KeySignatureEvent{}
+
+	for _, e := range f.metaEvents(MetaKeySignature) {
+		data, _ := e.MetaData(MetaKeySignature)
+		if len(data) < 2 || int8(data[0]) < -7 || int8(data[0]) > 7 || data[1] > 1 {
+			continue
+		}
+
+		sigs = append(sigs, KeySignatureEvent{
+			Tick:   e.Tick,
+			Sharps: int(int8(data[0])),
+			Minor:  data[1] == 1,
+		})
+	}
+
+	return sigs
+}
+
+// Tempos returns the file's tempo changes from all its tracks, in order.
+func (f *File) Tempos() []TempoEvent {
+	tempos := []TempoEvent{}
+
+	for _, e := range f.metaEvents(MetaTempo) {
+		data, _ := e.MetaData(MetaTempo)
+		if len(data) < 3 {
+			continue
+		}
+
+		micros := uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+		if micros == 0 {
+			continue
+		}
+
+		tempos = append(tempos, TempoEvent{
+			Tick:             e.Tick,
+			MicrosPerQuarter: micros,
+			BPM:              60e6 / float64(micros),
+		})
+	}
+
+	return tempos
+}
+
+// TrackNames returns the name of each track, or an empty string for tracks
+// without one.
+func (f *File) TrackNames() []string {
+	names := make([]string, len(f.Tracks))
+
+	for i, track := range f.Tracks {
+		for _, e := range track.Events {
+			if data, ok := e.MetaData(MetaTrackName); ok {
+				names[i] = string(data)
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+// metaEvents gathers meta events of one kind from every track, ordered by
+// tick and then by track.
+func (f *File) metaEvents(kind uint8) []Event {
+	var events []Event
+
+	for _, track := range f.Tracks {
+		for _, e := range track.Events {
+			if _, ok := e.MetaData(kind); ok {
+				events = append(events, e)
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Tick < events[j].Tick
+	})
+
+	return events
+}
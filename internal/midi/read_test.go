@@ -0,0 +1,204 @@
+package midi
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testFile() *File {
+	conductor := &Track{}
+	conductor.Name(0, "Reel")
+	conductor.Tempo(0, 500000)
+	conductor.TimeSignature(0, 6, 8, 36)
+	conductor.Meta(0, MetaKeySignature, []byte{0xfe, 1})
+	conductor.TimeSignature(1920, 9, 8, 36)
+
+	melody := &Track{}
+	melody.ProgramChange(0, 0, 73)
+	melody.NoteOn(0, 0, 69, 100)
+	melody.NoteOff(240, 0, 69)
+	melody.NoteOn(240, 0, 71, 80)
+	melody.NoteOff(480, 0, 71)
+
+	return &File{Format: 1, Division: 480, Tracks: []*Track{conductor, melody}}
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	_, err := testFile().WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Format != 1 || f.Division != 480 || len(f.Tracks) != 2 {
+		t.Fatalf("got format %d, division %d, %d tracks", f.Format, f.Division, len(f.Tracks))
+	}
+
+	if names := f.TrackNames(); !reflect.DeepEqual(names, []string{"Reel", ""}) {
+		t.Errorf("got track names %q", names)
+	}
+
+	wantSigs := []TimeSignatureEvent{{0, 6, 8}, {1920, 9, 8}}
+	if sigs := f.TimeSignatures(); !reflect.DeepEqual(sigs, wantSigs) {
+		t.Errorf("got time signatures %+v; want %+v", sigs, wantSigs)
+	}
+
+	wantKeys := []KeySignatureEvent{{0, -2, true}}
+	if keys := f.KeySignatures(); !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("got key signatures %+v; want %+v", keys, wantKeys)
+	}
+
+	wantTempos := []TempoEvent{{0, 500000, 120}}
+	if tempos := f.Tempos(); !reflect.DeepEqual(tempos, wantTempos) {
+		t.Errorf("got tempos %+v; want %+v", tempos, wantTempos)
+	}
+
+	// Program change, four notes and the end of track.
+	if n := len(f.Tracks[1].Events); n != 6 {
+		t.Errorf("got %d events in the melody track; want 6", n)
+	}
+}
+
+func TestReadRunningStatus(t *testing.T) {
+	track := []byte{
+		0x00, 0x90, 0x45, 0x64, // note on
+		0x60, 0x45, 0x00, // note on with velocity 0, by running status
+		0x00, 0x47, 0x50,
+		0x83, 0x60, 0x80, 0x47, 0x00, // note off after 480 ticks
+		0x00, 0xff, 0x2f, 0x00,
+	}
+
+	f, err := Read(bytes.NewReader(smf(0, 1, track)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{0, []byte{0x90, 0x45, 0x64}},
+		{96, []byte{0x90, 0x45, 0x00}},
+		{96, []byte{0x90, 0x47, 0x50}},
+		{576, []byte{0x80, 0x47, 0x00}},
+		{576, []byte{0xff, 0x2f, 0x00}},
+	}
+
+	if !reflect.DeepEqual(f.Tracks[0].Events, want) {
+		t.Errorf("got events %v; want %v", f.Tracks[0].Events, want)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrNotMIDI},
+		{"not MIDI", []byte("RIFF\x00\x00\x00\x00WAVEfmt "), ErrNotMIDI},
+		{"short header", []byte("MThd\x00\x00\x00\x04\x00\x00\x00\x01\x01\xe0"), ErrMalformed},
+		{"header past the end", []byte("MThd\x00\x00\x01\x00\x00\x00\x00\x01\x01\xe0"), ErrMalformed},
+		{"zero division", smfDivision(0, 0, 1, nil), ErrMalformed},
+		{"format 3", smf(3, 1, nil), ErrMalformed},
+		{"missing track", smf(1, 2, []byte{0x00, 0xff, 0x2f, 0x00}), ErrMalformed},
+		{"track past the end", append(smf(0, 1, nil), "MTrk\x00\x00\x10\x00\x00\xff\x2f\x00"...), ErrMalformed},
+		{"running status without a status", smf(0, 1, []byte{0x00, 0x45, 0x64}), ErrMalformed},
+		{"truncated event", smf(0, 1, []byte{0x00, 0x90, 0x45}), ErrMalformed},
+		{"varint too long", smf(0, 1, []byte{0xff, 0xff, 0xff, 0xff, 0x00}), ErrMalformed},
+		{"meta past the end", smf(0, 1, []byte{0x00, 0xff, 0x03, 0x10, 'a'}), ErrMalformed},
+		{"system common", smf(0, 1, []byte{0x00, 0xf2, 0x00, 0x00}), ErrMalformed},
+		{"tick overflow", smf(0, 1, bytes.Repeat([]byte{0xff, 0xff, 0xff, 0x7f, 0x90, 0x45, 0x00}, 17)), ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(tt.data))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+// smf builds a file with the given format and number of tracks, of which only
+// the first, if any, is included.
+func smf(format, tracks uint16, track []byte) []byte {
+	return smfDivision(format, 480, tracks, track)
+}
+
+func smfDivision(format, division, tracks uint16, track []byte) []byte {
+	b := []byte("MThd\x00\x00\x00\x06")
+	b = append(b, byte(format>>8), byte(format), byte(tracks>>8), byte(tracks), byte(division>>8), byte(division))
+
+	if track != nil {
+		n := len(track)
+		b = append(b, "MTrk"...)
+		b = append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		b = append(b, track...)
+	}
+
+	return b
+}
+
+// FuzzRead checks that Read doesn't panic on any input, and that whatever it
+// reads can be written out and read back the same.
+func FuzzRead(f *testing.F) {
+	var buf bytes.Buffer
+	testFile().WriteTo(&buf)
+
+	f.Add(buf.Bytes())
+	f.Add(smf(0, 1, []byte{0x00, 0x90, 0x45, 0x64, 0x60, 0x45, 0x00, 0x00, 0xf0, 0x02, 0x7e, 0xf7}))
+	f.Add(smf(0, 1, []byte{0x00, 0xff, 0x58, 0x04, 0x06, 0x03, 0x24, 0x08}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := Read(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		file.TimeSignatures()
+		file.KeySignatures()
+		file.Tempos()
+		file.TrackNames()
+
+		var out bytes.Buffer
+
+		// Files with no tracks can't be written.
+		if _, err := file.WriteTo(&out); err != nil {
+			return
+		}
+
+		again, err := Read(&out)
+		if err != nil {
+			t.Fatalf("reading a written file: %v", err)
+		}
+
+		if len(again.Tracks) != len(file.Tracks) {
+			t.Fatalf("got %d tracks back; want %d", len(again.Tracks), len(file.Tracks))
+		}
+
+		for i, track := range file.Tracks {
+			if got, want := withoutEnd(again.Tracks[i].Events), withoutEnd(track.Events); !reflect.DeepEqual(got, want) {
+				t.Fatalf("track %d: got events %v back; want %v", i, got, want)
+			}
+		}
+	})
+}
+
+// withoutEnd drops end of track events, which are rewritten when a file is
+// written.
+func withoutEnd(events []Event) []Event {
+	var out []Event
+
+	for _, e := range events {
+		if _, ok := e.MetaData(MetaEndOfTrack); !ok {
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,221 @@
+// Package musicxml reads the header details of MusicXML scores, both plain
+// and compressed (.mxl).
+//
+// Only what describes the piece as a whole is kept: its title and composer,
+// the part names, and the first key, time signature and tempo. The notes
+// themselves are read over, which checks the file is well formed, but not
+// kept.
+package musicxml
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxXMLSize is the most XML that will be read from a score, whether plain
+// or unpacked from a compressed file.
+const maxXMLSize = 64 << 20
+
+var (
+	// ErrNotMusicXML is returned when a file isn't MusicXML at all.
+	ErrNotMusicXML = errors.New("musicxml: not a MusicXML file")
+	// ErrUnsupported is returned for timewise scores, which are rare enough
+	// that arrangers can export a partwise one instead.
+	ErrUnsupported = errors.New("musicxml: only score-partwise files are supported")
+	// ErrMalformed is returned when a file can't be parsed.
+	ErrMalformed = errors.New("musicxml: malformed file")
+	// ErrTooLarge is returned when a score, or a compressed file's contents,
+	// is larger than is allowed.
+	ErrTooLarge = errors.New("musicxml: file is too large")
+)
+
+// Key is a key signature as a count of sharps (negative for flats) and a
+// mode such as "major" or "minor", which may be empty.
+type Key struct {
+	Fifths int    `json:"fifths"`
+	Mode   string `json:"mode,omitempty"`
+}
+
+// Time is a time signature. Compound numerators such as 3+2 are summed.
+type Time struct {
+	Beats    int `json:"beats"`
+	BeatType int `json:"beat_type"`
+}
+
+// Score is the header information of a score. Key and Time are nil if the
+// score has none, and Tempo, in quarter notes per minute, is zero if no
+// tempo is given.
+type Score struct {
+	Title    string   `json:"title"`
+	Composer string   `json:"composer"`
+	Parts    []string `json:"parts"`
+	Key      *Key     `json:"key"`
+	Time     *Time    `json:"time"`
+	Tempo    float64  `json:"tempo"`
+}
+
+// Parse reads an uncompressed MusicXML score.
+func Parse(r io.Reader) (*Score, error) {
+	lr := &io.LimitedReader{R: r, N: maxXMLSize + 1}
+
+	dec := xml.NewDecoder(lr)
+
+	score := &Score{Parts: []string{}}
+	var path []string
+	var text strings.Builder
+	var movementTitle string
+	var key *Key
+	var time *Time
+	inComposer := false
+	started := false
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			switch {
+			case lr.N <= 0 || errors.Is(err, ErrTooLarge):
+				return nil, ErrTooLarge
+			case errors.Is(err, io.EOF):
+			case !started:
+				return nil, ErrNotMusicXML
+			default:
+				return nil, ErrMalformed
+			}
+
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+
+			if !started {
+				switch name {
+				case "score-partwise":
+					started = true
+				case "score-timewise":
+					return nil, ErrUnsupported
+				default:
+					return nil, ErrNotMusicXML
+				}
+			}
+
+			path = append(path, name)
+			text.Reset()
+
+			switch name {
+			case "creator":
+				inComposer = attr(t, "type") == "composer" && score.Composer == ""
+			case "key":
+				if score.Key == nil && key == nil {
+					key = &Key{}
+				}
+			case "time":
+				if score.Time == nil && time == nil {
+					time = &Time{}
+				}
+			case "sound":
+				if tempo := attr(t, "tempo"); tempo != "" && score.Tempo == 0 {
+					f, err := strconv.ParseFloat(tempo, 64)
+					if err == nil && f > 0 && f < 10000 {
+						score.Tempo = f
+					}
+				}
+			}
+
+		case xml.CharData:
+			if text.Len() < 4096 {
+				text.Write(t)
+			}
+
+		case xml.EndElement:
+			if len(path) == 0 {
+				return nil, ErrMalformed
+			}
+
+			name := path[len(path)-1]
+			parent := ""
+			if len(path) > 1 {
+				parent = path[len(path)-2]
+			}
+
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+
+			switch {
+			case name == "work-title" && parent == "work" && score.Title == "":
+				score.Title = value
+			case name == "movement-title" && parent == "score-partwise":
+				movementTitle = value
+			case name == "creator" && inComposer:
+				score.Composer = value
+				inComposer = false
+			case name == "part-name" && parent == "score-part":
+				score.Parts = append(score.Parts, value)
+			case name == "fifths" && parent == "key" && key != nil:
+				key.Fifths, _ = strconv.Atoi(value)
+			case name == "mode" && parent == "key" && key != nil:
+				key.Mode = value
+			case name == "key" && key != nil:
+				if key.Fifths >= -7 && key.Fifths <= 7 {
+					score.Key = key
+				}
+				key = nil
+			case name == "beats" && parent == "time" && time != nil:
+				time.Beats = sumBeats(value)
+			case name == "beat-type" && parent == "time" && time != nil:
+				time.BeatType, _ = strconv.Atoi(value)
+			case name == "time" && time != nil:
+				if time.Beats > 0 && time.BeatType > 0 {
+					score.Time = time
+				}
+				time = nil
+			}
+
+			path = path[:len(path)-1]
+		}
+	}
+
+	if !started {
+		return nil, ErrNotMusicXML
+	}
+
+	if len(path) != 0 {
+		return nil, ErrMalformed
+	}
+
+	if score.Title == "" {
+		score.Title = movementTitle
+	}
+
+	return score, nil
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+// sumBeats reads a time signature numerator, adding up compound ones such
+// as 3+2. It returns 0 if the value can't be read.
+func sumBeats(s string) int {
+	sum := 0
+
+	for _, part := range strings.Split(s, "+") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return 0
+		}
+		sum += n
+	}
+
+	return sum
+}
@@ -0,0 +1,191 @@
+package musicxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// Limits on compressed files, which are zip archives. The archive's own
+// size is limited by whatever accepted the upload; these stop a small
+// archive from unpacking into something huge.
+const (
+	maxArchiveFiles     = 1000
+	maxContainerSize    = 1 << 20
+	maxCompressionRatio = 200
+)
+
+// zipMagic starts every zip archive that isn't empty.
+var zipMagic = []byte("PK\x03\x04")
+
+// IsCompressed reports whether the data, which should be at least the first
+// four bytes of a file, looks like a compressed MusicXML file.
+func IsCompressed(header []byte) bool {
+	return bytes.HasPrefix(header, zipMagic)
+}
+
+// Read reads a score from a plain or compressed MusicXML file, telling which
+// it is from its contents.
+func Read(r io.ReaderAt, size int64) (*Score, error) {
+	header := make([]byte, len(zipMagic))
+
+	n, err := r.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if IsCompressed(header[:n]) {
+		return ReadCompressed(r, size)
+	}
+
+	return Parse(io.NewSectionReader(r, 0, size))
+}
+
+// ReadCompressed reads a score from a compressed MusicXML (.mxl) file. The
+// score is found through META-INF/container.xml, or failing that is taken to
+// be the only MusicXML file at the top of the archive. Nothing is written to
+// disk, and no file is unpacked beyond the limits above, however big it
+// claims to be.
+func ReadCompressed(r io.ReaderAt, size int64) (*Score, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotMusicXML
+	}
+
+	if len(zr.File) > maxArchiveFiles {
+		return nil, ErrTooLarge
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var rootPath string
+
+	if container, ok := files["META-INF/container.xml"]; ok {
+		rootPath, err = readContainer(container)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, f := range zr.File {
+			ext := path.Ext(f.Name)
+			if !strings.Contains(f.Name, "/") && (ext == ".xml" || ext == ".musicxml") {
+				if rootPath != "" {
+					return nil, ErrMalformed
+				}
+				rootPath = f.Name
+			}
+		}
+	}
+
+	root, ok := files[rootPath]
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	rc, err := openLimited(root, maxXMLSize)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rc.Close()
+
+	return Parse(rc)
+}
+
+// readContainer returns the path of the score named in container.xml.
+func readContainer(f *zip.File) (string, error) {
+	rc, err := openLimited(f, maxContainerSize)
+	if err != nil {
+		return "", err
+	}
+
+	defer rc.Close()
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+
+	err = xml.NewDecoder(rc).Decode(&container)
+	if err != nil {
+		if errors.Is(err, ErrTooLarge) {
+			return "", err
+		}
+		return "", ErrMalformed
+	}
+
+	// The first rootfile is the score; others are alternative renderings
+	// such as PDFs.
+	for _, rf := range container.Rootfiles {
+		if rf.MediaType == "" || strings.Contains(rf.MediaType, "musicxml") {
+			return rf.FullPath, nil
+		}
+	}
+
+	return "", ErrMalformed
+}
+
+// openLimited opens a file in the archive, refusing it if it claims to be
+// larger than max or to have been compressed suspiciously well, and stopping
+// with ErrTooLarge if it turns out to be larger than max anyway.
+func openLimited(f *zip.File, max int64) (io.ReadCloser, error) {
+	if f.UncompressedSize64 > uint64(max) {
+		return nil, ErrTooLarge
+	}
+
+	if f.CompressedSize64 > 0 && f.UncompressedSize64/f.CompressedSize64 > maxCompressionRatio {
+		return nil, ErrTooLarge
+	}
+
+	if f.Method != zip.Store && f.Method != zip.Deflate {
+		return nil, ErrMalformed
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	return &limitedReadCloser{rc: rc, n: max}, nil
+}
+
+type limitedReadCloser struct {
+	rc io.ReadCloser
+	n  int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, ErrTooLarge
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	n, err := l.rc.Read(p)
+	l.n -= int64(n)
+
+	// The zip reader reports a mismatch between the data and its header
+	// as a checksum error.
+	if err != nil && !errors.Is(err, io.EOF) {
+		if errors.Is(err, zip.ErrChecksum) || errors.Is(err, zip.ErrFormat) {
+			err = ErrMalformed
+		}
+	}
+
+	return n, err
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.rc.Close()
+}
@@ -0,0 +1,228 @@
+package musicxml
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testScore = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE score-partwise PUBLIC "-//Recordare//DTD MusicXML 4.0 Partwise//EN" "http://www.musicxml.org/dtds/partwise.dtd">
+<score-partwise version="4.0">
+  <work><work-title>The Silver Spear</work-title></work>
+  <identification><creator type="composer">Trad.</creator></identification>
+  <part-list>
+    <score-part id="P1"><part-name>Fiddle</part-name></score-part>
+  </part-list>
+  <part id="P1">
+    <measure number="1">
+      <attributes>
+        <key><fifths>2</fifths><mode>major</mode></key>
+        <time><beats>2+2</beats><beat-type>4</beat-type></time>
+      </attributes>
+      <direction><sound tempo="112"/></direction>
+      <note><pitch><step>F</step><octave>5</octave></pitch><duration>1</duration></note>
+    </measure>
+  </part>
+</score-partwise>
+`
+
+const testContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container>
+  <rootfiles>
+    <rootfile full-path="score.pdf" media-type="application/pdf"/>
+    <rootfile full-path="music/reel.musicxml" media-type="application/vnd.recordare.musicxml+xml"/>
+  </rootfiles>
+</container>
+`
+
+var wantScore = &Score{
+	Title:    "The Silver Spear",
+	Composer: "Trad.",
+	Parts:    []string{"Fiddle"},
+	Key:      &Key{Fifths: 2, Mode: "major"},
+	Time:     &Time{Beats: 4, BeatType: 4},
+	Tempo:    112,
+}
+
+// archiveFile is a file to put in a test archive. Raw files are written as
+// they are, with sizes claimed by their header rather than worked out.
+type archiveFile struct {
+	name   string
+	body   string
+	method uint16
+	raw    *zip.FileHeader
+}
+
+func archive(t *testing.T, files ...archiveFile) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+
+	for _, f := range files {
+		var err error
+
+		if f.raw != nil {
+			w, err := zw.CreateRaw(f.raw)
+			if err == nil {
+				_, err = w.Write([]byte(f.body))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: f.method})
+		if err == nil {
+			_, err = w.Write([]byte(f.body))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func deflate(s string) string {
+	var b bytes.Buffer
+
+	fw, _ := flate.NewWriter(&b, flate.BestCompression)
+	fw.Write([]byte(s))
+	fw.Close()
+
+	return b.String()
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", []byte(testScore)},
+		{"compressed", archive(t,
+			archiveFile{name: "META-INF/container.xml", body: testContainer, method: zip.Deflate},
+			archiveFile{name: "music/reel.musicxml", body: testScore, method: zip.Deflate},
+		)},
+		{"compressed without a container", archive(t,
+			archiveFile{name: "reel.xml", body: testScore, method: zip.Store},
+			archiveFile{name: "images/cover.xml", body: "<svg/>", method: zip.Store},
+		)},
+	}
+
+	for _, tt := range tests {
+		score, err := Read(bytes.NewReader(tt.data), int64(len(tt.data)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(score, wantScore) {
+			t.Errorf("%s: got %+v; want %+v", tt.name, score, wantScore)
+		}
+	}
+}
+
+func TestReadCompressedLimits(t *testing.T) {
+	manyFiles := make([]archiveFile, maxArchiveFiles+1)
+	for i := range manyFiles {
+		manyFiles[i] = archiveFile{name: fmt.Sprintf("f%d.txt", i), method: zip.Store}
+	}
+
+	// Whitespace compresses far better than any real score.
+	padded := strings.Replace(testScore, "<part-list>", "<part-list>"+strings.Repeat(" ", 4<<20), 1)
+
+	// A file that claims to be small and unpacks to more.
+	big := strings.Replace(testScore, "</part>", strings.Repeat(`<measure number="2"/>`, 50000)+"</part>", 1)
+	liar := deflate(big)
+
+	tests := []struct {
+		name  string
+		files []archiveFile
+		err   error
+	}{
+		{"too many files", manyFiles, ErrTooLarge},
+		{"compressed too well", []archiveFile{{name: "reel.xml", body: padded, method: zip.Deflate}}, ErrTooLarge},
+		{
+			"claims to be too large",
+			[]archiveFile{{body: deflate("x"), raw: &zip.FileHeader{
+				Name: "reel.xml", Method: zip.Deflate, CompressedSize64: 3, UncompressedSize64: maxXMLSize + 1,
+			}}},
+			ErrTooLarge,
+		},
+		{
+			"larger than it claims",
+			[]archiveFile{{body: liar, raw: &zip.FileHeader{
+				Name: "reel.xml", Method: zip.Deflate, CRC32: crc32.ChecksumIEEE([]byte(big)),
+				CompressedSize64: uint64(len(liar)), UncompressedSize64: uint64(len(liar)) * 10,
+			}}},
+			ErrMalformed,
+		},
+		{
+			"container too large",
+			[]archiveFile{{name: "META-INF/container.xml", body: "<container>" + strings.Repeat(" ", maxContainerSize) + "</container>", method: zip.Store}},
+			ErrTooLarge,
+		},
+		{
+			"unsupported compression method",
+			[]archiveFile{{body: "xz data", raw: &zip.FileHeader{
+				Name: "reel.xml", Method: 95, CompressedSize64: 7, UncompressedSize64: 7,
+			}}},
+			ErrMalformed,
+		},
+		{
+			"two scores and no container",
+			[]archiveFile{{name: "a.xml", body: testScore}, {name: "b.musicxml", body: testScore}},
+			ErrMalformed,
+		},
+		{
+			"container names a missing score",
+			[]archiveFile{{name: "META-INF/container.xml", body: testContainer}},
+			ErrMalformed,
+		},
+		{"no score", []archiveFile{{name: "readme.txt", body: "hello"}}, ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		data := archive(t, tt.files...)
+
+		_, err := ReadCompressed(bytes.NewReader(data), int64(len(data)))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"empty", "", ErrNotMusicXML},
+		{"other XML", "<html><body/></html>", ErrNotMusicXML},
+		{"timewise", "<score-timewise/>", ErrUnsupported},
+		{"unclosed", "<score-partwise><part-list>", ErrMalformed},
+		{"not a zip", "PK\x03\x04 but nothing more", ErrNotMusicXML},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(strings.NewReader(tt.data), int64(len(tt.data)))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The built-in encodings of simple fonts, as the character each code
+// stands for. Zero means the code has no character.
+var (
+	winAnsiEncoding  [256]rune
+	macRomanEncoding [256]rune
+	standardEncoding [256]rune
+)
+
+// winAnsiCodes maps characters back to their codes in WinAnsiEncoding.
+var winAnsiCodes = map[rune]byte{}
+
+// glyphRunes maps glyph names, as used in encoding differences, to the
+// characters they stand for.
+var glyphRunes = map[string]rune{}
+
+// latin1Names are the glyph names of U+00A0 to U+00FF.
+var latin1Names = strings.Fields(`
+	space exclamdown cent sterling currency yen brokenbar section
+	dieresis copyright ordfeminine guillemotleft logicalnot hyphen registered macron
+	degree plusminus twosuperior threesuperior acute mu paragraph periodcentered
+	cedilla onesuperior ordmasculine guillemotright onequarter onehalf threequarters questiondown
+	Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla
+	Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+	Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply
+	Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls
+	agrave aacute acircumflex atilde adieresis aring ae ccedilla
+	egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis
+	eth ntilde ograve oacute ocircumflex otilde odieresis divide
+	oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis`)
+
+// asciiNames are the glyph names of U+0020 to U+007E.
+var asciiNames = strings.Fields(`
+	space exclam quotedbl numbersign dollar percent ampersand quotesingle
+	parenleft parenright asterisk plus comma hyphen period slash
+	zero one two three four five six seven eight nine colon semicolon less equal greater question
+	at A B C D E F G H I J K L M N O P Q R S T U V W X Y Z
+	bracketleft backslash bracketright asciicircum underscore grave
+	a b c d e f g h i j k l m n o p q r s t u v w x y z
+	braceleft bar braceright asciitilde`)
+
+// otherGlyphs are the glyph names outside ASCII and Latin-1 that turn up in
+// Western documents.
+var otherGlyphs = map[string]rune{
+	"quoteleft": '‘', "quoteright": '’', "quotesinglbase": '‚',
+	"quotedblleft": '“', "quotedblright": '”', "quotedblbase": '„',
+	"endash": '–', "emdash": '—', "bullet": '•', "ellipsis": '…',
+	"dagger": '†', "daggerdbl": '‡', "perthousand": '‰', "trademark": '™',
+	"guilsinglleft": '‹', "guilsinglright": '›', "florin": 'ƒ', "fraction": '⁄',
+	"Euro": '€', "minus": '−', "fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ',
+	"OE": 'Œ', "oe": 'œ', "Scaron": 'Š', "scaron": 'š', "Zcaron": 'Ž', "zcaron": 'ž',
+	"Ydieresis": 'Ÿ', "Lslash": 'Ł', "lslash": 'ł', "dotlessi": 'ı',
+	"circumflex": 'ˆ', "tilde": '˜', "caron": 'ˇ', "breve": '˘', "dotaccent": '˙',
+	"ring": '˚', "ogonek": '˛', "hungarumlaut": '˝', "nbspace": ' ',
+	"sharp": '♯', "flat": '♭', "natural": '♮',
+}
+
+func init() {
+	for i, name := range asciiNames {
+		glyphRunes[name] = rune(0x20 + i)
+	}
+
+	for i, name := range latin1Names {
+		if _, ok := glyphRunes[name]; !ok {
+			glyphRunes[name] = rune(0xa0 + i)
+		}
+	}
+
+	for name, r := range otherGlyphs {
+		glyphRunes[name] = r
+	}
+
+	for c := 0x20; c < 0x7f; c++ {
+		winAnsiEncoding[c] = rune(c)
+		macRomanEncoding[c] = rune(c)
+		standardEncoding[c] = rune(c)
+	}
+
+	for i, r := range []rune("€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ") {
+		winAnsiEncoding[0x80+i] = r
+	}
+
+	for c := 0xa0; c <= 0xff; c++ {
+		winAnsiEncoding[c] = rune(c)
+	}
+
+	for code, c := range winAnsiEncoding {
+		if c != 0 {
+			winAnsiCodes[c] = byte(code)
+		}
+	}
+
+	for i, r := range []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ") {
+		macRomanEncoding[0x80+i] = r
+	}
+
+	standardEncoding['\''] = '’'
+	standardEncoding['`'] = '‘'
+
+	for c, r := range map[int]rune{
+		0xa1: '¡', 0xa2: '¢', 0xa3: '£', 0xa5: '¥', 0xa7: '§', 0xa9: '\'', 0xaa: '“',
+		0xab: '«', 0xae: 'ﬁ', 0xaf: 'ﬂ', 0xb1: '–', 0xb2: '†', 0xb3: '‡', 0xb4: '·',
+		0xb6: '¶', 0xb7: '•', 0xb8: '‚', 0xb9: '„', 0xba: '”', 0xbb: '»', 0xbc: '…',
+		0xbd: '‰', 0xbf: '¿', 0xd0: '—', 0xe1: 'Æ', 0xe8: 'Ł', 0xe9: 'Ø', 0xea: 'Œ',
+		0xf1: 'æ', 0xf5: 'ı', 0xf8: 'ł', 0xf9: 'ø', 0xfa: 'œ', 0xfb: 'ß',
+	} {
+		standardEncoding[c] = r
+	}
+}
+
+// glyphRune returns the character a glyph name stands for, understanding
+// the uniXXXX and uXXXX forms as well as the usual names.
+func glyphRune(name string) (rune, bool) {
+	if r, ok := glyphRunes[name]; ok {
+		return r, true
+	}
+
+	// Variants such as a.sc or A.alt stand for their base glyph.
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return glyphRune(name[:i])
+	}
+
+	hex := ""
+
+	switch {
+	case strings.HasPrefix(name, "uni") && len(name) == 7:
+		hex = name[3:]
+	case strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7:
+		hex = name[1:]
+	}
+
+	if hex != "" {
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err == nil && n > 0 && n <= 0x10ffff {
+			return rune(n), true
+		}
+	}
+
+	return 0, false
+}
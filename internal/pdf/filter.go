@@ -0,0 +1,301 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"io"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// maxDecodedSize bounds the decoded size of a single stream, so that a small
+// file can't inflate into something huge.
+const maxDecodedSize = 64 << 20
+
+// DecodeStream returns a stream's contents with its filters undone.
+func (r *Reader) DecodeStream(s *Stream) ([]byte, error) {
+	return r.decodeStream(s)
+}
+
+func (r *Reader) decodeStream(s *Stream) ([]byte, error) {
+	var filters, parms Array
+
+	filter, err := r.Resolve(s.Dict["Filter"])
+	if err != nil {
+		return nil, err
+	}
+
+	switch f := filter.(type) {
+	case Name:
+		filters = Array{f}
+	case Array:
+		filters = f
+	}
+
+	parm, err := r.Resolve(s.Dict["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+
+	switch p := parm.(type) {
+	case Dict:
+		parms = Array{p}
+	case Array:
+		parms = p
+	}
+
+	data := s.Data
+
+	for i, f := range filters {
+		name, _ := r.name(f)
+
+		var parm Dict
+		if i < len(parms) {
+			parm, _ = r.dict(parms[i])
+		}
+
+		data, err = r.applyFilter(name, parm, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (r *Reader) applyFilter(name Name, parm Dict, data []byte) ([]byte, error) {
+	switch name {
+	case "FlateDecode", "Fl":
+		out, err := inflate(data)
+		if err != nil {
+			return nil, err
+		}
+		return r.unpredict(out, parm)
+
+	case "LZWDecode", "LZW":
+		// Only the default early change is supported.
+		if early, ok := r.integer(parm["EarlyChange"]); ok && early == 0 {
+			return nil, ErrUnsupportedFilter
+		}
+
+		out, err := readLimited(lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8))
+		if err != nil {
+			return nil, err
+		}
+		return r.unpredict(out, parm)
+
+	case "ASCIIHexDecode", "AHx":
+		return asciiHexDecode(data)
+
+	case "ASCII85Decode", "A85":
+		return ascii85Decode(data)
+
+	default:
+		return nil, ErrUnsupportedFilter
+	}
+}
+
+// inflate undoes Flate compression, keeping whatever could be read from a
+// truncated or corrupt stream, since PDF writers often get the end wrong.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// Some writers leave out the zlib header.
+		return readLimited(flate.NewReader(bytes.NewReader(data)))
+	}
+
+	return readLimited(zr)
+}
+
+// readLimited reads r to the end, keeping what was read before any error
+// other than the data being too large.
+func readLimited(r io.Reader) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+
+	if len(out) > maxDecodedSize {
+		return nil, ErrTooLarge
+	}
+
+	if err != nil && len(out) == 0 && !errors.Is(err, io.EOF) {
+		return nil, ErrMalformed
+	}
+
+	return out, nil
+}
+
+// unpredict undoes a PNG predictor, which is applied to data before it is
+// compressed. TIFF predictors are rarely used and aren't supported.
+func (r *Reader) unpredict(data []byte, parm Dict) ([]byte, error) {
+	predictor, _ := r.integer(parm["Predictor"])
+	if predictor < 2 {
+		return data, nil
+	}
+
+	if predictor < 10 {
+		return nil, ErrUnsupportedFilter
+	}
+
+	columns, colors, bits := int64(1), int64(1), int64(8)
+
+	if n, ok := r.integer(parm["Columns"]); ok {
+		columns = n
+	}
+	if n, ok := r.integer(parm["Colors"]); ok {
+		colors = n
+	}
+	if n, ok := r.integer(parm["BitsPerComponent"]); ok {
+		bits = n
+	}
+
+	if columns < 1 || columns > 1<<20 || colors < 1 || colors > 32 || bits < 1 || bits > 16 {
+		return nil, ErrMalformed
+	}
+
+	bpp := int(max(1, (colors*bits+7)/8))
+	rowSize := int((columns*colors*bits + 7) / 8)
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowSize)
+
+	for len(data) > rowSize {
+		kind := data[0]
+		row := append([]byte{}, data[1:rowSize+1]...)
+		data = data[rowSize+1:]
+
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+
+		out = append(out, row...)
+		prev = row
+	}
+
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var out []byte
+	var high byte
+	odd := false
+
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+
+		if isSpace(c) {
+			continue
+		}
+
+		v, ok := hexDigit(c)
+		if !ok {
+			return nil, ErrMalformed
+		}
+
+		if odd {
+			out = append(out, high<<4|v)
+		} else {
+			high = v
+		}
+		odd = !odd
+	}
+
+	if odd {
+		out = append(out, high<<4)
+	}
+
+	return out, nil
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	var out []byte
+	var group [5]byte
+	n := 0
+
+	flush := func(count int) {
+		var v uint32
+		for i := 0; i < 5; i++ {
+			v = v*85 + uint32(group[i]-'!')
+		}
+
+		b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		out = append(out, b[:count-1]...)
+	}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		switch {
+		case isSpace(c):
+			continue
+		case c == '~':
+			i = len(data)
+			continue
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			return nil, ErrMalformed
+		}
+
+		group[n] = c
+		n++
+
+		if n == 5 {
+			flush(5)
+			n = 0
+		}
+	}
+
+	if n == 1 {
+		return nil, ErrMalformed
+	}
+
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			group[i] = 'u'
+		}
+		flush(n)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"testing"
+)
+
+func TestDecodeStream(t *testing.T) {
+	var deflated bytes.Buffer
+	fw, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	fw.Write([]byte("no zlib header"))
+	fw.Close()
+
+	// Rows of two bytes with the Sub, Up, Average and Paeth PNG predictors.
+	predicted := zlibBytes("\x01\x01\x01" + "\x02\x01\x01" + "\x03\x02\x02" + "\x04\x01\x01")
+
+	tests := []struct {
+		name string
+		dict Dict
+		data []byte
+		want string
+	}{
+		{"unfiltered", Dict{}, []byte("plain"), "plain"},
+		{"Flate", Dict{"Filter": Name("FlateDecode")}, zlibBytes("Hello, Flate"), "Hello, Flate"},
+		{"Flate without a zlib header", Dict{"Filter": Name("FlateDecode")}, deflated.Bytes(), "no zlib header"},
+		{
+			"Flate with PNG predictors",
+			Dict{"Filter": Name("FlateDecode"), "DecodeParms": Dict{"Predictor": int64(12), "Columns": int64(2)}},
+			predicted,
+			"\x01\x02\x02\x03\x03\x05\x04\x06",
+		},
+		// The example from section 7.4.4.2 of the PDF specification.
+		{"LZW", Dict{"Filter": Name("LZWDecode")}, []byte{0x80, 0x0b, 0x60, 0x50, 0x22, 0x0c, 0x0c, 0x85, 0x01}, "-----A---B"},
+		{"ASCIIHex", Dict{"Filter": Name("ASCIIHexDecode")}, []byte("48 65 6c\n6C 6f 7>"), "Hellop"},
+		{"ASCII85", Dict{"Filter": Name("A85")}, []byte("87cURD_*#-6q/=~>"), "Hello, PDF!"},
+		{"ASCII85 zeros", Dict{"Filter": Name("ASCII85Decode")}, []byte("z!!~>"), "\x00\x00\x00\x00\x00"},
+		{
+			"filter chain",
+			Dict{"Filter": Array{Name("ASCIIHexDecode"), Name("FlateDecode")}},
+			[]byte(hexString(zlibBytes("chained"))),
+			"chained",
+		},
+	}
+
+	r := &Reader{objects: map[int]Object{}, loading: map[int]bool{}}
+
+	for _, tt := range tests {
+		got, err := r.DecodeStream(&Stream{Dict: tt.dict, Data: tt.data})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Writers often get the end of a Flate stream wrong, so what could be read of
+// it is kept.
+func TestDecodeStreamTruncatedFlate(t *testing.T) {
+	const want = "cut short, but kept"
+
+	r := &Reader{objects: map[int]Object{}, loading: map[int]bool{}}
+
+	got, err := r.DecodeStream(&Stream{Dict: Dict{"Filter": Name("Fl")}, Data: zlibBytes(want)[:14]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) == 0 || !bytes.HasPrefix([]byte(want), got) {
+		t.Errorf("got %q; want the start of %q", got, want)
+	}
+}
+
+func TestDecodeStreamInvalid(t *testing.T) {
+	bomb := zlibBytes(string(make([]byte, maxDecodedSize+1)))
+
+	tests := []struct {
+		name string
+		dict Dict
+		data []byte
+		err  error
+	}{
+		{"unknown filter", Dict{"Filter": Name("JBIG2Decode")}, nil, ErrUnsupportedFilter},
+		{"LZW without early change", Dict{"Filter": Name("LZWDecode"), "DecodeParms": Dict{"EarlyChange": int64(0)}}, nil, ErrUnsupportedFilter},
+		{"TIFF predictor", Dict{"Filter": Name("FlateDecode"), "DecodeParms": Dict{"Predictor": int64(2)}}, zlibBytes("x"), ErrUnsupportedFilter},
+		{"too many columns", Dict{"Filter": Name("FlateDecode"), "DecodeParms": Dict{"Predictor": int64(12), "Columns": int64(1 << 21)}}, zlibBytes("x"), ErrMalformed},
+		{"not Flate", Dict{"Filter": Name("FlateDecode")}, []byte("definitely not deflate data"), ErrMalformed},
+		{"bad hex", Dict{"Filter": Name("AHx")}, []byte("4g>"), ErrMalformed},
+		{"bad ASCII85", Dict{"Filter": Name("A85")}, []byte("87cU{~>"), ErrMalformed},
+		{"ASCII85 with one character left", Dict{"Filter": Name("A85")}, []byte("87cURD~>"), ErrMalformed},
+		{"decompression bomb", Dict{"Filter": Name("FlateDecode")}, bomb, ErrTooLarge},
+	}
+
+	r := &Reader{objects: map[int]Object{}, loading: map[int]bool{}}
+
+	for _, tt := range tests {
+		_, err := r.DecodeStream(&Stream{Dict: tt.dict, Data: tt.data})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func hexString(b []byte) string {
+	const digits = "0123456789ABCDEF"
+
+	out := make([]byte, 0, 2*len(b)+1)
+	for _, c := range b {
+		out = append(out, digits[c>>4], digits[c&0x0f])
+	}
+
+	return string(append(out, '>'))
+}
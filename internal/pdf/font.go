@@ -0,0 +1,333 @@
+package pdf
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// maxCMapEntries bounds the mappings read from a ToUnicode CMap.
+const maxCMapEntries = 100_000
+
+// font turns the codes in a shown string into text.
+type font struct {
+	// composite fonts use two-byte codes unless their CMap says otherwise.
+	composite bool
+	toUnicode *cmap
+	// encoding is used by simple fonts for codes the CMap doesn't cover.
+	encoding *[256]rune
+}
+
+type codespace struct {
+	lo, hi []byte
+}
+
+type bfrange struct {
+	lo, hi uint32
+	n      int
+	// Either dst, the first of a run of characters, or list, one string
+	// per code, is set.
+	dst  []rune
+	list []string
+}
+
+// cmap is a ToUnicode CMap.
+type cmap struct {
+	codespaces []codespace
+	chars      map[string]string
+	ranges     []bfrange
+}
+
+// loadFont reads the font with the given resource name.
+func (r *Reader) loadFont(resources Dict, name Name) *font {
+	fonts, _ := r.dict(resources["Font"])
+
+	ref, isRef := fonts[name].(Ref)
+	if isRef {
+		if f, ok := r.fonts[ref]; ok {
+			return f
+		}
+	}
+
+	d, _ := r.dict(fonts[name])
+
+	f := &font{}
+
+	subtype, _ := r.name(d["Subtype"])
+	f.composite = subtype == "Type0"
+
+	if s, ok := r.streamObject(d["ToUnicode"]); ok {
+		data, err := r.decodeStream(s)
+		if err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+
+	if !f.composite {
+		f.encoding = r.simpleEncoding(d)
+	}
+
+	if isRef {
+		r.fonts[ref] = f
+	}
+
+	return f
+}
+
+// streamObject resolves o and returns it if it is a stream.
+func (r *Reader) streamObject(o Object) (*Stream, bool) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return nil, false
+	}
+
+	s, ok := o.(*Stream)
+	return s, ok
+}
+
+// simpleEncoding works out a simple font's encoding from its base encoding
+// and differences. Fonts that don't say are taken to use WinAnsiEncoding,
+// which is what they usually turn out to use.
+func (r *Reader) simpleEncoding(d Dict) *[256]rune {
+	enc := winAnsiEncoding
+
+	setBase := func(name Name) {
+		switch name {
+		case "MacRomanEncoding":
+			enc = macRomanEncoding
+		case "StandardEncoding":
+			enc = standardEncoding
+		}
+	}
+
+	encoding, _ := r.Resolve(d["Encoding"])
+
+	switch e := encoding.(type) {
+	case Name:
+		setBase(e)
+
+	case Dict:
+		if base, ok := r.name(e["BaseEncoding"]); ok {
+			setBase(base)
+		}
+
+		diffs, _ := r.array(e["Differences"])
+		code := int64(-1)
+
+		for _, o := range diffs {
+			switch o := o.(type) {
+			case int64:
+				code = o
+			case Name:
+				if code >= 0 && code < 256 {
+					if c, ok := glyphRune(string(o)); ok {
+						enc[code] = c
+					}
+				}
+				code++
+			}
+		}
+	}
+
+	return &enc
+}
+
+// decode turns a shown string into text.
+func (f *font) decode(s String) string {
+	var b strings.Builder
+
+	for len(s) > 0 {
+		n := f.codeLength(s)
+		code := s[:n]
+		s = s[n:]
+
+		if f.toUnicode != nil {
+			if text, ok := f.toUnicode.lookup(code); ok {
+				b.WriteString(text)
+				continue
+			}
+		}
+
+		if f.encoding != nil && n == 1 {
+			if c := f.encoding[code[0]]; c != 0 {
+				b.WriteRune(c)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// codeLength returns the length of the code at the start of s.
+func (f *font) codeLength(s String) int {
+	if f.toUnicode != nil && len(f.toUnicode.codespaces) > 0 {
+		for _, cs := range f.toUnicode.codespaces {
+			n := len(cs.lo)
+			if n <= len(s) && inCodespace(s[:n], cs) {
+				return n
+			}
+		}
+	}
+
+	if f.composite && len(s) >= 2 {
+		return 2
+	}
+
+	return 1
+}
+
+func inCodespace(code []byte, cs codespace) bool {
+	for i, c := range code {
+		if c < cs.lo[i] || c > cs.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cmap) lookup(code []byte) (string, bool) {
+	if text, ok := c.chars[string(code)]; ok {
+		return text, true
+	}
+
+	v := codeValue(code)
+
+	for _, rg := range c.ranges {
+		if rg.n != len(code) || v < rg.lo || v > rg.hi {
+			continue
+		}
+
+		offset := v - rg.lo
+
+		if rg.list != nil {
+			if int(offset) < len(rg.list) {
+				return rg.list[offset], true
+			}
+			return "", false
+		}
+
+		dst := append([]rune{}, rg.dst...)
+		dst[len(dst)-1] += rune(offset)
+
+		return string(dst), true
+	}
+
+	return "", false
+}
+
+func codeValue(code []byte) uint32 {
+	var v uint32
+	for _, c := range code {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// utf16Text decodes the UTF-16BE a CMap maps codes to.
+func utf16Text(s String) []rune {
+	u := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+
+	// A single byte is sometimes given for a character below 256.
+	if len(s) == 1 {
+		u = append(u, uint16(s[0]))
+	}
+
+	return utf16.Decode(u)
+}
+
+// parseCMap reads the codespaces and mappings from a ToUnicode CMap,
+// skipping anything it doesn't understand.
+func parseCMap(data []byte) *cmap {
+	c := &cmap{chars: map[string]string{}}
+	l := &lexer{data: data}
+
+	entries := 0
+
+	// next returns the next object, or nil at the end of the data or on a
+	// syntax error.
+	next := func() Object {
+		o, _ := l.object()
+		return o
+	}
+
+	for entries < maxCMapEntries {
+		o, err := l.object()
+		if err != nil {
+			break
+		}
+
+		kw, _ := o.(keyword)
+
+		switch kw {
+		case "begincodespacerange":
+			for {
+				lo, ok := next().(String)
+				if !ok {
+					break
+				}
+
+				hi, ok := next().(String)
+				if !ok {
+					break
+				}
+
+				if len(lo) > 0 && len(lo) <= 4 && len(lo) == len(hi) {
+					c.codespaces = append(c.codespaces, codespace{lo: lo, hi: hi})
+				}
+			}
+
+		case "beginbfchar":
+			for entries < maxCMapEntries {
+				src, ok1 := next().(String)
+				if !ok1 {
+					break
+				}
+
+				switch dst := next().(type) {
+				case String:
+					c.chars[string(src)] = string(utf16Text(dst))
+				case Name:
+					if r, ok := glyphRune(string(dst)); ok {
+						c.chars[string(src)] = string(r)
+					}
+				}
+				entries++
+			}
+
+		case "beginbfrange":
+			for entries < maxCMapEntries {
+				lo, ok1 := next().(String)
+				if !ok1 {
+					break
+				}
+
+				hi, ok2 := next().(String)
+				if !ok2 || len(lo) == 0 || len(lo) > 4 || len(lo) != len(hi) {
+					break
+				}
+
+				rg := bfrange{lo: codeValue(lo), hi: codeValue(hi), n: len(lo)}
+
+				switch dst := next().(type) {
+				case String:
+					rg.dst = utf16Text(dst)
+				case Array:
+					rg.list = []string{}
+					for _, d := range dst {
+						s, _ := d.(String)
+						rg.list = append(rg.list, string(utf16Text(s)))
+					}
+				}
+
+				if rg.hi >= rg.lo && (len(rg.dst) > 0 || rg.list != nil) {
+					c.ranges = append(c.ranges, rg)
+				}
+				entries++
+			}
+		}
+	}
+
+	return c
+}
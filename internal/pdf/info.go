@@ -0,0 +1,174 @@
+package pdf
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Limits on what is kept from the document information dictionary.
+const (
+	maxInfoEntries     = 50
+	maxInfoValueLength = 1000
+)
+
+// Info returns the document information dictionary's text entries, such as
+// Title and Author. Dates are converted to RFC 3339.
+func (r *Reader) Info() map[string]string {
+	info := map[string]string{}
+
+	d, ok := r.dict(r.trailer["Info"])
+	if !ok {
+		return info
+	}
+
+	for k, v := range d {
+		if len(info) >= maxInfoEntries {
+			break
+		}
+
+		v, err := r.Resolve(v)
+		if err != nil {
+			continue
+		}
+
+		s, ok := v.(String)
+		if !ok {
+			continue
+		}
+
+		text := strings.TrimSpace(infoText(TextString(s)))
+
+		if k == "CreationDate" || k == "ModDate" {
+			if t, ok := parseDate(text); ok {
+				text = t.Format(time.RFC3339)
+			}
+		}
+
+		if text == "" {
+			continue
+		}
+
+		if len(text) > maxInfoValueLength {
+			text = truncate(text, maxInfoValueLength)
+		}
+
+		key := infoText(string(k))
+		if key == "" {
+			continue
+		}
+
+		info[key] = text
+	}
+
+	return info
+}
+
+// infoText removes control characters from an information dictionary entry,
+// such as the NUL that often ends UTF-16 strings, so that it can be stored as
+// JSON. Tabs and line breaks become spaces.
+func infoText(s string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c == '\t' || c == '\n' || c == '\r':
+			return ' '
+		case unicode.IsControl(c) || c == unicode.ReplacementChar:
+			return -1
+		default:
+			return c
+		}
+	}, s)
+}
+
+// TextString decodes a PDF text string, which is UTF-16BE or UTF-8 if it
+// starts with a byte order mark and PDFDocEncoding otherwise.
+func TextString(s String) string {
+	switch {
+	case len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff:
+		u := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(u))
+
+	case len(s) >= 3 && s[0] == 0xef && s[1] == 0xbb && s[2] == 0xbf:
+		return strings.ToValidUTF8(string(s[3:]), "�")
+
+	default:
+		var b strings.Builder
+		for _, c := range s {
+			b.WriteRune(pdfDocEncoding(c))
+		}
+		return b.String()
+	}
+}
+
+var (
+	pdfDocAccents     = []rune("˘ˇˆ˙˝˛˚˜")
+	pdfDocPunctuation = []rune("•†‡…—–ƒ⁄‹›−‰„“”‘’‚™ﬁﬂŁŒŠŸŽıłœšž")
+)
+
+// pdfDocEncoding decodes a byte of PDFDocEncoding, which is Latin-1 apart
+// from a few typographic characters.
+func pdfDocEncoding(c byte) rune {
+	switch {
+	case c >= 0x18 && c <= 0x1f:
+		return pdfDocAccents[c-0x18]
+	case c >= 0x80 && c <= 0x9e:
+		return pdfDocPunctuation[c-0x80]
+	case c == 0xa0:
+		return '€'
+	default:
+		return rune(c)
+	}
+}
+
+// parseDate parses a PDF date, such as D:20240131120000+01'00'. Everything
+// after the year is optional.
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(s, "D:")
+
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+
+	if digits < 4 || digits%2 != 0 {
+		return time.Time{}, false
+	}
+
+	// Fill in the parts that were left out.
+	stamp := s[:digits] + "0101000000"[digits-4:]
+
+	t, err := time.Parse("20060102150405", stamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	zone := strings.ReplaceAll(s[digits:], "'", "")
+
+	if len(zone) >= 5 && (zone[0] == '+' || zone[0] == '-') {
+		offset, err := time.Parse("-0700", zone[:5])
+		if err == nil {
+			_, secs := offset.Zone()
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone("", secs))
+		}
+	}
+
+	return t, true
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
@@ -0,0 +1,24 @@
+package pdf
+
+import "testing"
+
+func TestInfoText(t *testing.T) {
+	tests := []struct {
+		s    String
+		want string
+	}{
+		{String("Reel Set"), "Reel Set"},
+		{String("Reel\x00Set\x07"), "ReelSet"},
+		{String("Line one\r\nLine\ttwo"), "Line one  Line two"},
+		{String("\xfe\xff\x00R\x00e\x00e\x00l\x00\x00"), "Reel"},
+		{String("\xfe\xff\xd8\x00\x00A"), "A"},
+		{String("\xef\xbb\xbfCaf\xc3\xa9\x00"), "Café"},
+		{String("\x80 \x18"), "• ˘"},
+	}
+
+	for _, tt := range tests {
+		if got := infoText(TextString(tt.s)); got != tt.want {
+			t.Errorf("infoText(TextString(%q)): got %q; want %q", tt.s, got, tt.want)
+		}
+	}
+}
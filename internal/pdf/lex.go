@@ -0,0 +1,411 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// maxNesting bounds how deeply arrays and dictionaries may be nested.
+const maxNesting = 64
+
+// keyword is a bare word in a file, such as obj or true, or an operator in
+// a content stream. Delimiters such as [ and << are returned as keywords
+// too.
+type keyword string
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isRegular(c byte) bool {
+	return !isSpace(c) && !isDelimiter(c)
+}
+
+// skipSpace skips whitespace and comments.
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token reads the next token: an int64, float64, String, Name or keyword.
+// It returns io.EOF at the end of the data.
+func (l *lexer) token() (Object, error) {
+	l.skipSpace()
+
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+
+	switch c {
+	case '(':
+		l.pos++
+		return l.literalString()
+
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return keyword("<<"), nil
+		}
+		l.pos++
+		return l.hexString()
+
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return keyword(">>"), nil
+		}
+		l.pos++
+		return nil, ErrMalformed
+
+	case '[', ']', '{', '}':
+		l.pos++
+		return keyword(c), nil
+
+	case ')':
+		l.pos++
+		return nil, ErrMalformed
+
+	case '/':
+		l.pos++
+		return l.name(), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && isRegular(l.data[l.pos]) {
+		l.pos++
+	}
+
+	word := l.data[start:l.pos]
+
+	if n, ok := parseNumber(word); ok {
+		return n, nil
+	}
+
+	return keyword(word), nil
+}
+
+// parseNumber parses an integer or real number, returning false if word
+// isn't one.
+func parseNumber(word []byte) (Object, bool) {
+	if len(word) == 0 {
+		return nil, false
+	}
+
+	digits, dots := 0, 0
+
+	for i, c := range word {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.':
+			dots++
+		case (c == '-' || c == '+') && i == 0:
+		default:
+			return nil, false
+		}
+	}
+
+	if digits == 0 || dots > 1 {
+		return nil, false
+	}
+
+	if dots == 0 {
+		i, err := strconv.ParseInt(string(word), 10, 64)
+		if err == nil {
+			return i, true
+		}
+	}
+
+	f, err := strconv.ParseFloat(string(word), 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return f, true
+}
+
+func (l *lexer) name() Name {
+	var b []byte
+
+	for l.pos < len(l.data) && isRegular(l.data[l.pos]) {
+		c := l.data[l.pos]
+		l.pos++
+
+		if c == '#' && l.pos+2 <= len(l.data) {
+			if v, ok := unhex(l.data[l.pos], l.data[l.pos+1]); ok {
+				b = append(b, v)
+				l.pos += 2
+				continue
+			}
+		}
+
+		b = append(b, c)
+	}
+
+	return Name(b)
+}
+
+func (l *lexer) literalString() (String, error) {
+	var b []byte
+	depth := 1
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(b), nil
+			}
+		case '\r':
+			// End of line markers within strings are read as \n.
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, ErrMalformed
+			}
+
+			e := l.data[l.pos]
+			l.pos++
+
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					// Unknown escapes, including \( \) and \\, stand for
+					// the character itself.
+					c = e
+				}
+			}
+		}
+
+		b = append(b, c)
+	}
+
+	return nil, ErrMalformed
+}
+
+func (l *lexer) hexString() (String, error) {
+	var b []byte
+	var high byte
+	odd := false
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		if c == '>' {
+			if odd {
+				b = append(b, high<<4)
+			}
+			return String(b), nil
+		}
+
+		if isSpace(c) {
+			continue
+		}
+
+		v, ok := hexDigit(c)
+		if !ok {
+			return nil, ErrMalformed
+		}
+
+		if odd {
+			b = append(b, high<<4|v)
+		} else {
+			high = v
+		}
+		odd = !odd
+	}
+
+	return nil, ErrMalformed
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func unhex(a, b byte) (byte, bool) {
+	x, ok1 := hexDigit(a)
+	y, ok2 := hexDigit(b)
+	return x<<4 | y, ok1 && ok2
+}
+
+// object reads a whole object. References are recognised, and keywords other
+// than true, false and null are returned as they are, so that callers can
+// handle obj, stream and content stream operators.
+func (l *lexer) object() (Object, error) {
+	return l.nested(0)
+}
+
+func (l *lexer) nested(depth int) (Object, error) {
+	if depth > maxNesting {
+		return nil, ErrMalformed
+	}
+
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case int64:
+		// Look ahead for "gen R".
+		save := l.pos
+
+		gen, err := l.token()
+		if g, ok := gen.(int64); ok && err == nil {
+			r, err := l.token()
+			if kw, ok := r.(keyword); ok && err == nil && kw == "R" {
+				return Ref{Num: int(tok), Gen: int(g)}, nil
+			}
+		}
+
+		l.pos = save
+		return tok, nil
+
+	case keyword:
+		switch tok {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "[":
+			a := Array{}
+			for {
+				o, err := l.nested(depth + 1)
+				if err != nil {
+					return nil, endOfData(err)
+				}
+				if kw, ok := o.(keyword); ok && kw == "]" {
+					return a, nil
+				}
+				a = append(a, o)
+			}
+		case "<<":
+			d := Dict{}
+			for {
+				k, err := l.nested(depth + 1)
+				if err != nil {
+					return nil, endOfData(err)
+				}
+				if kw, ok := k.(keyword); ok && kw == ">>" {
+					return d, nil
+				}
+
+				key, ok := k.(Name)
+				if !ok {
+					return nil, ErrMalformed
+				}
+
+				v, err := l.nested(depth + 1)
+				if err != nil {
+					return nil, endOfData(err)
+				}
+				if kw, ok := v.(keyword); ok && kw == ">>" {
+					// A key without a value; treat it as null.
+					return d, nil
+				}
+
+				// Null values are the same as missing entries.
+				if v != nil {
+					d[key] = v
+				}
+			}
+		}
+	}
+
+	return tok, nil
+}
+
+// endOfData turns running out of data in the middle of an object into
+// ErrMalformed.
+func endOfData(err error) error {
+	if err == io.EOF {
+		return ErrMalformed
+	}
+	return err
+}
+
+// hasKeywordAt reports whether data has the keyword at i, followed by
+// something that ends it.
+func hasKeywordAt(data []byte, i int, kw string) bool {
+	if i < 0 || !bytes.HasPrefix(data[i:], []byte(kw)) {
+		return false
+	}
+
+	end := i + len(kw)
+	return end == len(data) || !isRegular(data[end])
+}
@@ -0,0 +1,115 @@
+package pdf
+
+// maxPageTreeDepth bounds how deeply the page tree may be nested.
+const maxPageTreeDepth = 64
+
+// Page is a page of a document. The attributes a page can inherit from the
+// nodes above it in the page tree are filled in from them when the page
+// doesn't set them itself.
+type Page struct {
+	Ref       Ref
+	Dict      Dict
+	Resources Dict
+	MediaBox  Array
+	CropBox   Array
+	Rotate    int64
+}
+
+// Pages returns the document's pages in order.
+func (r *Reader) Pages() ([]*Page, error) {
+	catalog, ok := r.Catalog()
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	root, ok := catalog["Pages"].(Ref)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	var pages []*Page
+
+	visited := map[Ref]bool{}
+
+	var walk func(ref Ref, inherited Page, depth int) error
+	walk = func(ref Ref, inherited Page, depth int) error {
+		if visited[ref] || depth > maxPageTreeDepth {
+			return ErrMalformed
+		}
+		visited[ref] = true
+
+		node, ok := r.dict(ref)
+		if !ok {
+			return ErrMalformed
+		}
+
+		if d, ok := r.dict(node["Resources"]); ok {
+			inherited.Resources = d
+		}
+		if a, ok := r.array(node["MediaBox"]); ok {
+			inherited.MediaBox = a
+		}
+		if a, ok := r.array(node["CropBox"]); ok {
+			inherited.CropBox = a
+		}
+		if n, ok := r.integer(node["Rotate"]); ok {
+			inherited.Rotate = n
+		}
+
+		kids, hasKids := r.array(node["Kids"])
+
+		if t, _ := r.name(node["Type"]); t == "Page" || (t != "Pages" && !hasKids) {
+			page := inherited
+			page.Ref = ref
+			page.Dict = node
+			pages = append(pages, &page)
+			return nil
+		}
+
+		for _, kid := range kids {
+			kidRef, ok := kid.(Ref)
+			if !ok {
+				return ErrMalformed
+			}
+
+			err := walk(kidRef, inherited, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := walk(root, Page{}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+// Box returns the visible area of the page as its lower left and upper right
+// corners: the crop box, or the media box if there isn't one. A page without
+// a usable media box is taken to be US Letter.
+func (p *Page) Box() (x0, y0, x1, y1 float64) {
+	box := p.CropBox
+	if len(box) != 4 {
+		box = p.MediaBox
+	}
+
+	if len(box) != 4 {
+		return 0, 0, 612, 792
+	}
+
+	var n [4]float64
+
+	for i := range n {
+		var ok bool
+		if n[i], ok = toNumber(box[i]); !ok {
+			return 0, 0, 612, 792
+		}
+	}
+
+	return min(n[0], n[2]), min(n[1], n[3]), max(n[0], n[2]), max(n[1], n[3])
+}
@@ -0,0 +1,234 @@
+// Package pdf reads PDF files: their objects, page tree, document
+// information and text. It copes with the usual damage found in the wild,
+// such as wrong cross-reference offsets, by scanning the file for its
+// objects, but doesn't support encrypted files.
+package pdf
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+// MaxFileSize is the largest file that will be read. Files are held in
+// memory while they are read.
+const MaxFileSize = 100 << 20
+
+var (
+	// ErrNotPDF is returned when a file doesn't start with a PDF header.
+	ErrNotPDF = errors.New("pdf: not a PDF file")
+	// ErrMalformed is returned when a file can't be parsed.
+	ErrMalformed = errors.New("pdf: malformed file")
+	// ErrEncrypted is returned for encrypted files.
+	ErrEncrypted = errors.New("pdf: file is encrypted")
+	// ErrTooLarge is returned when a file, or a stream in it, is larger than
+	// is allowed.
+	ErrTooLarge = errors.New("pdf: file is too large")
+	// ErrUnsupportedFilter is returned when a stream is compressed in a way
+	// that can't be decoded.
+	ErrUnsupportedFilter = errors.New("pdf: unsupported stream filter")
+)
+
+// Object is a PDF object: nil for null, bool, int64, float64, String, Name,
+// Array, Dict, *Stream or Ref.
+type Object any
+
+// String is a PDF string, which holds bytes rather than text.
+type String []byte
+
+// Name is a PDF name, without its leading slash.
+type Name string
+
+type Array []Object
+
+type Dict map[Name]Object
+
+// Stream is a stream object. Data is the stream's contents as they are in
+// the file, still encoded with its filters.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Ref is a reference to an indirect object.
+type Ref struct {
+	Num int
+	Gen int
+}
+
+func (r Ref) String() string {
+	return strconv.Itoa(r.Num) + " " + strconv.Itoa(r.Gen) + " R"
+}
+
+// Reader reads the objects in a PDF file.
+type Reader struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer Dict
+	rebuilt bool
+
+	objects    map[int]Object
+	loading    map[int]bool
+	objStreams map[int]*objStream
+	fonts      map[Ref]*font
+}
+
+// ReadAll reads a PDF file into memory, refusing files over MaxFileSize.
+func ReadAll(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxFileSize {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+// Open reads the cross-reference information of the PDF file in data. The
+// data must not be changed while the Reader is in use.
+func Open(data []byte) (*Reader, error) {
+	if !hasHeader(data) {
+		return nil, ErrNotPDF
+	}
+
+	r := &Reader{
+		data:       data,
+		objects:    map[int]Object{},
+		loading:    map[int]bool{},
+		objStreams: map[int]*objStream{},
+		fonts:      map[Ref]*font{},
+	}
+
+	err := r.loadXref()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := r.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+
+	if _, ok := r.Catalog(); !ok {
+		return nil, ErrMalformed
+	}
+
+	return r, nil
+}
+
+// hasHeader reports whether data starts with a PDF header. Some producers
+// put junk before it, which readers are expected to skip.
+func hasHeader(data []byte) bool {
+	limit := min(len(data), 1024)
+
+	for i := 0; i+5 <= limit; i++ {
+		if string(data[i:i+5]) == "%PDF-" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Trailer returns the file's trailer dictionary.
+func (r *Reader) Trailer() Dict {
+	return r.trailer
+}
+
+// Catalog returns the document catalog, the root of the file's objects.
+func (r *Reader) Catalog() (Dict, bool) {
+	return r.dict(r.trailer["Root"])
+}
+
+// Resolve follows references until it reaches a direct object. A reference
+// to a missing object resolves to null, as the PDF specification says.
+func (r *Reader) Resolve(o Object) (Object, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o, nil
+		}
+
+		var err error
+		o, err = r.object(ref.Num)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrMalformed
+}
+
+// dict resolves o and returns it if it is a dictionary, or the dictionary of
+// a stream.
+func (r *Reader) dict(o Object) (Dict, bool) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return nil, false
+	}
+
+	switch o := o.(type) {
+	case Dict:
+		return o, true
+	case *Stream:
+		return o.Dict, true
+	default:
+		return nil, false
+	}
+}
+
+// array resolves o and returns it if it is an array.
+func (r *Reader) array(o Object) (Array, bool) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return nil, false
+	}
+
+	a, ok := o.(Array)
+	return a, ok
+}
+
+// name resolves o and returns it if it is a name.
+func (r *Reader) name(o Object) (Name, bool) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return "", false
+	}
+
+	n, ok := o.(Name)
+	return n, ok
+}
+
+// number resolves o and returns it if it is a number.
+func (r *Reader) number(o Object) (float64, bool) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return 0, false
+	}
+
+	return toNumber(o)
+}
+
+// integer resolves o and returns it if it is an integer.
+func (r *Reader) integer(o Object) (int64, bool) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return 0, false
+	}
+
+	i, ok := o.(int64)
+	return i, ok
+}
+
+func toNumber(o Object) (float64, bool) {
+	switch o := o.(type) {
+	case int64:
+		return float64(o), true
+	case float64:
+		return o, true
+	default:
+		return 0, false
+	}
+}
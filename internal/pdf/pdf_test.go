@@ -0,0 +1,320 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// onePage holds the objects of a one-page document: the catalog, the page
+// tree, the page, its content, its font and the information dictionary.
+var onePage = []string{
+	"<< /Type /Catalog /Pages 2 0 R >>",
+	"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+	"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+	stream("", "BT /F1 12 Tf 72 720 Td (The Kesh Jig) Tj ET"),
+	"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	"<< /Title <FEFF0054006800650020004B00650073006800000000> /Author (Trad.) /CreationDate (D:20240131120000+01'00') >>",
+}
+
+// stream writes a stream object with the given extra dictionary entries.
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< /Length %d %s >>\nstream\n%s\nendstream", len(data), dict, data)
+}
+
+// buildPDF writes objects numbered from 1 with a cross-reference table, and a
+// trailer with the given extra entries.
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(objects))
+
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := b.Len()
+
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+
+	return b.Bytes()
+}
+
+// buildCompressedPDF writes objects numbered from 1 with a cross-reference
+// stream compressed with the PNG Up predictor, as PDF 1.5 writers do. Objects
+// other than streams are packed into a Flate-compressed object stream.
+func buildCompressedPDF(trailer string, objects ...string) []byte {
+	var b, header, body bytes.Buffer
+
+	b.WriteString("%PDF-1.5\n")
+
+	objStmNum := len(objects) + 1
+	xrefNum := objStmNum + 1
+
+	rows := [][]int{{0, 0, 255}}
+	n := 0
+
+	for i, o := range objects {
+		if strings.Contains(o, "stream\n") {
+			rows = append(rows, []int{1, b.Len(), 0})
+			fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+			continue
+		}
+
+		rows = append(rows, []int{2, objStmNum, n})
+		n++
+
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(o + "\n")
+	}
+
+	objStm := zlibBytes(header.String() + body.String())
+
+	rows = append(rows, []int{1, b.Len(), 0})
+	fmt.Fprintf(&b, "%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n",
+		objStmNum, n, header.Len(), len(objStm), objStm)
+
+	xrefOffset := b.Len()
+	rows = append(rows, []int{1, xrefOffset, 0})
+
+	var table []byte
+	prev := make([]byte, 4)
+
+	for _, row := range rows {
+		cur := []byte{byte(row[0]), byte(row[1] >> 8), byte(row[1]), byte(row[2])}
+
+		table = append(table, 2)
+		for i := range cur {
+			table = append(table, cur[i]-prev[i])
+		}
+
+		prev = cur
+	}
+
+	xref := zlibBytes(string(table))
+
+	fmt.Fprintf(&b, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 2 1] /Root 1 0 R %s /Filter /FlateDecode /DecodeParms << /Columns 4 /Predictor 12 >> /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+		xrefNum, xrefNum+1, trailer, len(xref), xref)
+
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	return b.Bytes()
+}
+
+func zlibBytes(s string) []byte {
+	var b bytes.Buffer
+
+	zw := zlib.NewWriter(&b)
+	zw.Write([]byte(s))
+	zw.Close()
+
+	return b.Bytes()
+}
+
+func TestOpen(t *testing.T) {
+	classic := buildPDF("/Info 6 0 R", onePage...)
+
+	// Point startxref somewhere wrong, so the table has to be rebuilt.
+	broken := bytes.Replace(classic, []byte("startxref\n"), []byte("startxref\n1"), 1)
+
+	// An incremental update that gives the document a new title.
+	update := bytes.NewBuffer(bytes.Clone(classic))
+	updateOffset := update.Len()
+	fmt.Fprintf(update, "6 0 obj\n<< /Title (Banish Misfortune) >>\nendobj\n")
+	xrefOffset := update.Len()
+	fmt.Fprintf(update, "xref\n6 1\n%010d 00000 n \ntrailer\n<< /Size 7 /Root 1 0 R /Info 6 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n",
+		updateOffset, bytes.LastIndex(classic, []byte("xref\n0 7")), xrefOffset)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		rebuilt bool
+		title   string
+	}{
+		{"cross-reference table", classic, false, "The Kesh"},
+		{"rebuilt cross-reference table", broken, true, "The Kesh"},
+		{"incremental update", update.Bytes(), false, "Banish Misfortune"},
+		{"cross-reference stream", buildCompressedPDF("/Info 6 0 R", onePage...), false, "The Kesh"},
+		{"junk before the header", append([]byte("\x00\x00junk\n"), classic...), true, "The Kesh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Open(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pages, err := r.Pages()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(pages) != 1 {
+				t.Fatalf("got %d pages; want 1", len(pages))
+			}
+
+			if _, _, x1, y1 := pages[0].Box(); x1 != 612 || y1 != 792 {
+				t.Errorf("got page size %v x %v; want 612 x 792", x1, y1)
+			}
+
+			info := r.Info()
+			if info["Title"] != tt.title {
+				t.Errorf("got title %q; want %q", info["Title"], tt.title)
+			}
+
+			text, err := r.Text(1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(text, "The Kesh Jig") {
+				t.Errorf("got text %q; want it to contain %q", text, "The Kesh Jig")
+			}
+
+			if r.rebuilt != tt.rebuilt {
+				t.Errorf("got rebuilt %v; want %v", r.rebuilt, tt.rebuilt)
+			}
+		})
+	}
+}
+
+func TestOpenInfo(t *testing.T) {
+	r, err := Open(buildPDF("/Info 6 0 R", onePage...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := r.Info()
+
+	want := map[string]string{
+		"Title":        "The Kesh",
+		"Author":       "Trad.",
+		"CreationDate": "2024-01-31T12:00:00+01:00",
+	}
+
+	for k, v := range want {
+		if info[k] != v {
+			t.Errorf("%s: got %q; want %q", k, info[k], v)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrNotPDF},
+		{"not a PDF", []byte("<html>" + strings.Repeat(" ", 1024) + "%PDF-1.4</html>"), ErrNotPDF},
+		{"header only", []byte("%PDF-1.4\n%%EOF\n"), ErrMalformed},
+		{"no catalog", buildPDF("", "42"), ErrMalformed},
+		{"encrypted", buildPDF("/Encrypt << /Filter /Standard /V 2 /R 3 >>", onePage...), ErrEncrypted},
+		{"encrypted with a cross-reference stream", buildCompressedPDF("/Encrypt << /Filter /Standard /V 4 /R 4 >>", onePage...), ErrEncrypted},
+	}
+
+	for _, tt := range tests {
+		_, err := Open(tt.data)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestOpenCyclicPageTree(t *testing.T) {
+	r, err := Open(buildPDF("",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Pages /Kids [2 0 R] /Count 1 >>",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Pages()
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("got %v; want ErrMalformed", err)
+	}
+}
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Object
+	}{
+		{"42", int64(42)},
+		{"-3.5", -3.5},
+		{".5", 0.5},
+		{"/Name#20With#23Hash", Name("Name With#Hash")},
+		{`(a \(nested (string)\) \101\n)`, String("a (nested (string)) A\n")},
+		{"(line\\\ncontinued)", String("linecontinued")},
+		{"<48 65 6C6C 6F7>", String("Hellop")},
+		{"[1 2 0 R (x)]", Array{int64(1), Ref{Num: 2}, String("x")}},
+		{"<< /A 1 /B null /C [true false] >>", Dict{"A": int64(1), "C": Array{true, false}}},
+		{"% a comment\n7", int64(7)},
+	}
+
+	for _, tt := range tests {
+		l := &lexer{data: []byte(tt.in)}
+
+		got, err := l.object()
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+
+		if fmt.Sprintf("%#v", got) != fmt.Sprintf("%#v", tt.want) {
+			t.Errorf("%q: got %#v; want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLexerInvalid(t *testing.T) {
+	tests := []string{
+		"[1 2",
+		"<< /A 1",
+		"<< 1 2 >>",
+		"(unterminated",
+		strings.Repeat("[", maxNesting+2) + strings.Repeat("]", maxNesting+2),
+	}
+
+	for _, in := range tests {
+		l := &lexer{data: []byte(in)}
+
+		_, err := l.object()
+		if !errors.Is(err, ErrMalformed) {
+			t.Errorf("%q: got %v; want ErrMalformed", in, err)
+		}
+	}
+}
+
+// FuzzOpen checks that nothing read from a file can make the reader panic or
+// loop forever.
+func FuzzOpen(f *testing.F) {
+	f.Add(buildPDF("/Info 6 0 R", onePage...))
+	f.Add(buildCompressedPDF("/Info 6 0 R", onePage...))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 1 0 R >> endobj trailer << /Root 1 0 R >>"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := Open(data)
+		if err != nil {
+			return
+		}
+
+		r.Pages()
+		r.Info()
+		r.Text(1000)
+	})
+}
@@ -0,0 +1,303 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+)
+
+// Limits on text extraction. Form XObjects can draw each other, so both how
+// deeply they nest and how much content is decoded in all are bounded.
+const (
+	maxFormDepth   = 8
+	maxContentSize = 64 << 20
+	maxOperands    = 1000
+)
+
+// TJ adjustments wider than this, in thousandths of the font size, are
+// taken to be spaces between words.
+const wordGap = 200
+
+// textWriter gathers the text of a document, turning moves to a new line
+// into line breaks and large gaps into spaces.
+type textWriter struct {
+	b        strings.Builder
+	max      int
+	decoded  int
+	lastLine float64
+}
+
+func (w *textWriter) full() bool {
+	return w.b.Len() >= w.max || w.decoded >= maxContentSize
+}
+
+func (w *textWriter) write(s string) {
+	for _, c := range s {
+		switch {
+		case c == '\t' || c == '\n' || c == '\r':
+			w.space()
+		case unicode.IsControl(c) || c == unicode.ReplacementChar:
+		default:
+			w.b.WriteRune(c)
+		}
+	}
+}
+
+func (w *textWriter) last() byte {
+	s := w.b.String()
+	if s == "" {
+		return '\n'
+	}
+	return s[len(s)-1]
+}
+
+func (w *textWriter) space() {
+	if c := w.last(); c != ' ' && c != '\n' {
+		w.b.WriteByte(' ')
+	}
+}
+
+func (w *textWriter) newline() {
+	if w.last() != '\n' {
+		w.b.WriteByte('\n')
+	}
+}
+
+// Text returns the document's text, page by page, up to about max bytes.
+// It is meant for searching rather than reading: the order is the order the
+// text is drawn in, which usually but not always follows the layout. Pages
+// whose content can't be read are skipped.
+func (r *Reader) Text(max int) (string, error) {
+	pages, err := r.Pages()
+	if err != nil {
+		return "", err
+	}
+
+	w := &textWriter{max: max}
+
+	for _, page := range pages {
+		if w.full() {
+			break
+		}
+
+		contents, err := r.Resolve(page.Dict["Contents"])
+		if err != nil {
+			continue
+		}
+
+		var streams []Object
+
+		switch c := contents.(type) {
+		case *Stream:
+			streams = []Object{c}
+		case Array:
+			streams = c
+		}
+
+		// A page's content may be split between streams at any point, even
+		// in the middle of an operator, so they are joined before reading.
+		var data []byte
+
+		for _, s := range streams {
+			stream, ok := r.streamObject(s)
+			if !ok {
+				continue
+			}
+
+			decoded, err := r.decodeStream(stream)
+			if err != nil {
+				continue
+			}
+
+			data = append(data, decoded...)
+			data = append(data, '\n')
+		}
+
+		w.decoded += len(data)
+
+		r.contentText(w, data, page.Resources, 0)
+
+		w.newline()
+		w.b.WriteByte('\n')
+	}
+
+	return tidyText(w.b.String(), max), nil
+}
+
+// contentText writes the text shown by a content stream.
+func (r *Reader) contentText(w *textWriter, data []byte, resources Dict, depth int) {
+	l := &lexer{data: data}
+
+	var operands []Object
+	f := &font{encoding: &winAnsiEncoding}
+
+	for !w.full() {
+		o, err := l.object()
+		if err != nil {
+			return
+		}
+
+		op, isOp := o.(keyword)
+		if !isOp {
+			if len(operands) >= maxOperands {
+				operands = operands[:0]
+			}
+			operands = append(operands, o)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 1 {
+				if name, ok := operands[0].(Name); ok {
+					f = r.loadFont(resources, name)
+				}
+			}
+
+		case "Tj":
+			if s, ok := lastString(operands); ok {
+				w.write(f.decode(s))
+			}
+
+		case "'", "\"":
+			w.newline()
+			if s, ok := lastString(operands); ok {
+				w.write(f.decode(s))
+			}
+
+		case "TJ":
+			if len(operands) >= 1 {
+				a, _ := operands[len(operands)-1].(Array)
+				for _, item := range a {
+					switch item := item.(type) {
+					case String:
+						w.write(f.decode(item))
+					default:
+						if n, ok := toNumber(item); ok && n < -wordGap {
+							w.space()
+						}
+					}
+				}
+			}
+
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := toNumber(operands[0])
+				ty, _ := toNumber(operands[1])
+
+				switch {
+				case ty != 0:
+					w.newline()
+				case tx != 0:
+					w.space()
+				}
+			}
+
+		case "T*":
+			w.newline()
+
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := toNumber(operands[5])
+				if y != w.lastLine {
+					w.newline()
+				} else {
+					w.space()
+				}
+				w.lastLine = y
+			}
+
+		case "BT":
+			w.space()
+
+		case "Do":
+			if len(operands) >= 1 && depth < maxFormDepth {
+				if name, ok := operands[0].(Name); ok {
+					r.formText(w, resources, name, depth)
+				}
+			}
+
+		case "ID":
+			skipInlineImage(l)
+		}
+
+		operands = operands[:0]
+	}
+}
+
+// formText writes the text drawn by a form XObject.
+func (r *Reader) formText(w *textWriter, resources Dict, name Name, depth int) {
+	xobjects, _ := r.dict(resources["XObject"])
+
+	s, ok := r.streamObject(xobjects[name])
+	if !ok {
+		return
+	}
+
+	if subtype, _ := r.name(s.Dict["Subtype"]); subtype != "Form" {
+		return
+	}
+
+	data, err := r.decodeStream(s)
+	if err != nil {
+		return
+	}
+
+	w.decoded += len(data)
+
+	formResources, ok := r.dict(s.Dict["Resources"])
+	if !ok {
+		formResources = resources
+	}
+
+	r.contentText(w, data, formResources, depth+1)
+}
+
+func lastString(operands []Object) (String, bool) {
+	if len(operands) == 0 {
+		return nil, false
+	}
+
+	s, ok := operands[len(operands)-1].(String)
+	return s, ok
+}
+
+// skipInlineImage skips the data of an inline image, which follows the ID
+// operator and runs up to an EI operator on its own.
+func skipInlineImage(l *lexer) {
+	data := l.data
+
+	for i := l.pos + 1; i+2 <= len(data); i++ {
+		if data[i] == 'E' && data[i+1] == 'I' && isSpace(data[i-1]) && (i+2 == len(data) || isSpace(data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+
+	l.pos = len(data)
+}
+
+// tidyText trims each line, keeps at most one blank line between
+// paragraphs, and cuts the text to at most max bytes.
+func tidyText(s string, max int) string {
+	var b bytes.Buffer
+	blank := true
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			if !blank {
+				b.WriteByte('\n')
+			}
+			blank = true
+			continue
+		}
+
+		b.WriteString(line)
+		b.WriteByte('\n')
+		blank = false
+	}
+
+	return truncate(strings.TrimSpace(b.String()), max)
+}
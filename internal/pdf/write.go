@@ -0,0 +1,407 @@
+package pdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Writer writes a PDF file object by object. Objects are given references
+// with Alloc and written with Write, in any order; Close writes the
+// cross-reference table and trailer.
+type Writer struct {
+	w       *bufio.Writer
+	n       int64
+	offsets []int64
+	err     error
+}
+
+// NewWriter starts a PDF file on w.
+func NewWriter(w io.Writer) *Writer {
+	pw := &Writer{w: bufio.NewWriter(w)}
+
+	// The comment of high bytes marks the file as binary.
+	pw.writeString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	return pw
+}
+
+func (w *Writer) writeString(s string) {
+	if w.err != nil {
+		return
+	}
+
+	n, err := w.w.WriteString(s)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.err = err
+}
+
+// Alloc reserves a reference for an object that will be written later.
+func (w *Writer) Alloc() Ref {
+	w.offsets = append(w.offsets, -1)
+	return Ref{Num: len(w.offsets)}
+}
+
+// Write writes the object for a reference from Alloc. Streams are written
+// with their Length set to match their data.
+func (w *Writer) Write(ref Ref, o Object) error {
+	if ref.Num < 1 || ref.Num > len(w.offsets) || w.offsets[ref.Num-1] >= 0 {
+		return fmt.Errorf("pdf: object %d written twice or never allocated", ref.Num)
+	}
+
+	w.offsets[ref.Num-1] = w.n
+
+	w.writeString(strconv.Itoa(ref.Num) + " 0 obj\n")
+
+	if s, ok := o.(*Stream); ok {
+		d := Dict{}
+		for k, v := range s.Dict {
+			d[k] = v
+		}
+		d["Length"] = int64(len(s.Data))
+
+		w.write(AppendObject(nil, d))
+		w.writeString("\nstream\n")
+		w.write(s.Data)
+		w.writeString("\nendstream")
+	} else {
+		w.write(AppendObject(nil, o))
+	}
+
+	w.writeString("\nendobj\n")
+
+	return w.err
+}
+
+// Add allocates a reference for an object and writes it.
+func (w *Writer) Add(o Object) (Ref, error) {
+	ref := w.Alloc()
+	return ref, w.Write(ref, o)
+}
+
+// Close writes the cross-reference table and the trailer, which should hold
+// at least the Root entry. Objects that were allocated but never written are
+// written as null.
+func (w *Writer) Close(trailer Dict) error {
+	for i, offset := range w.offsets {
+		if offset < 0 {
+			w.Write(Ref{Num: i + 1}, nil)
+		}
+	}
+
+	start := w.n
+
+	w.writeString("xref\n0 " + strconv.Itoa(len(w.offsets)+1) + "\n")
+	w.writeString("0000000000 65535 f\r\n")
+
+	for _, offset := range w.offsets {
+		w.writeString(fmt.Sprintf("%010d 00000 n\r\n", offset))
+	}
+
+	t := Dict{}
+	for k, v := range trailer {
+		t[k] = v
+	}
+	t["Size"] = int64(len(w.offsets) + 1)
+
+	w.writeString("trailer\n")
+	w.write(AppendObject(nil, t))
+	w.writeString("\nstartxref\n" + strconv.FormatInt(start, 10) + "\n%%EOF\n")
+
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.w.Flush()
+}
+
+// AppendObject appends the PDF syntax for a direct object to b. Strings are
+// written in hex, so they never need escaping. Go ints are accepted as
+// integers for convenience.
+func AppendObject(b []byte, o Object) []byte {
+	switch o := o.(type) {
+	case nil:
+		return append(b, "null"...)
+	case bool:
+		return strconv.AppendBool(b, o)
+	case int:
+		return strconv.AppendInt(b, int64(o), 10)
+	case int64:
+		return strconv.AppendInt(b, o, 10)
+	case float64:
+		return strconv.AppendFloat(b, o, 'f', -1, 64)
+	case String:
+		b = append(b, '<')
+		for _, c := range o {
+			b = append(b, "0123456789abcdef"[c>>4], "0123456789abcdef"[c&15])
+		}
+		return append(b, '>')
+	case Name:
+		b = append(b, '/')
+		for _, c := range []byte(o) {
+			if c < 0x21 || c > 0x7e || c == '#' || isDelimiter(c) {
+				b = append(b, '#', "0123456789abcdef"[c>>4], "0123456789abcdef"[c&15])
+			} else {
+				b = append(b, c)
+			}
+		}
+		return b
+	case Array:
+		b = append(b, '[')
+		for i, item := range o {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+			b = AppendObject(b, item)
+		}
+		return append(b, ']')
+	case Dict:
+		keys := make([]Name, 0, len(o))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		b = append(b, "<<"...)
+		for _, k := range keys {
+			b = AppendObject(b, k)
+			b = append(b, ' ')
+			b = AppendObject(b, o[k])
+			b = append(b, ' ')
+		}
+		return append(b, ">>"...)
+	case Ref:
+		return append(b, o.String()...)
+	default:
+		return append(b, "null"...)
+	}
+}
+
+// EncodeText encodes s as a PDF text string: PDFDocEncoding if it is plain
+// ASCII and UTF-16BE otherwise.
+func EncodeText(s string) String {
+	ascii := true
+	for _, c := range s {
+		if c >= 0x80 || c < 0x20 {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		return String(s)
+	}
+
+	out := String{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u>>8), byte(u))
+	}
+
+	return out
+}
+
+// EncodeWinAnsi encodes s for showing with a simple font that uses
+// WinAnsiEncoding, replacing characters it can't encode with '?'.
+func EncodeWinAnsi(s string) String {
+	out := make(String, 0, len(s))
+
+	for _, c := range s {
+		code, ok := winAnsiCodes[c]
+		if !ok {
+			code = '?'
+		}
+		out = append(out, code)
+	}
+
+	return out
+}
+
+// Importer copies objects from a Reader into a Writer, renumbering them.
+// Each object is copied once however often it is referred to.
+type Importer struct {
+	w     *Writer
+	r     *Reader
+	refs  map[int]Ref
+	queue []int
+}
+
+// Import starts copying objects from r into w.
+func (w *Writer) Import(r *Reader) *Importer {
+	return &Importer{w: w, r: r, refs: map[int]Ref{}}
+}
+
+// Copy returns o with the references in it replaced by references to copies
+// in the writer. The referenced objects are written by Flush.
+func (im *Importer) Copy(o Object) Object {
+	switch o := o.(type) {
+	case Ref:
+		if ref, ok := im.refs[o.Num]; ok {
+			return ref
+		}
+
+		ref := im.w.Alloc()
+		im.refs[o.Num] = ref
+		im.queue = append(im.queue, o.Num)
+
+		return ref
+
+	case Array:
+		a := make(Array, len(o))
+		for i, item := range o {
+			a[i] = im.Copy(item)
+		}
+		return a
+
+	case Dict:
+		d := make(Dict, len(o))
+		for k, v := range o {
+			d[k] = im.Copy(v)
+		}
+		return d
+
+	case *Stream:
+		d := make(Dict, len(o.Dict))
+		for k, v := range o.Dict {
+			if k != "Length" {
+				d[k] = im.Copy(v)
+			}
+		}
+		return &Stream{Dict: d, Data: o.Data}
+
+	default:
+		return o
+	}
+}
+
+// Flush writes the objects that copies refer to, and those they refer to in
+// turn. Pages and the page tree aren't copied this way, since they would
+// bring in the whole source document; references to them become null.
+func (im *Importer) Flush() error {
+	for len(im.queue) > 0 {
+		num := im.queue[0]
+		im.queue = im.queue[1:]
+
+		o, err := im.r.object(num)
+		if err != nil {
+			o = nil
+		}
+
+		if d, ok := o.(Dict); ok {
+			switch t, _ := d["Type"].(Name); t {
+			case "Page", "Pages", "Catalog":
+				o = nil
+			}
+		}
+
+		err = im.w.Write(im.refs[num], im.Copy(o))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pageKeys are the page entries that are copied along with a page. Others,
+// such as annotations and structure, refer to parts of the source document
+// that aren't copied.
+var pageKeys = []Name{"TrimBox", "BleedBox", "ArtBox", "Group", "UserUnit"}
+
+// ImportPage writes a copy of a page to ref, as a child of parent. The
+// overlay, if any, is content drawn over the page, using fonts from
+// overlayFonts, which are references in the writer.
+func (im *Importer) ImportPage(ref Ref, p *Page, parent Ref, overlay []byte, overlayFonts Dict) error {
+	page := Dict{
+		"Type":   Name("Page"),
+		"Parent": parent,
+	}
+
+	mediaBox := p.MediaBox
+	if len(mediaBox) != 4 {
+		mediaBox = Array{int64(0), int64(0), int64(612), int64(792)}
+	}
+	page["MediaBox"] = im.Copy(mediaBox)
+
+	if len(p.CropBox) == 4 {
+		page["CropBox"] = im.Copy(p.CropBox)
+	}
+
+	if p.Rotate%360 != 0 {
+		page["Rotate"] = p.Rotate
+	}
+
+	for _, k := range pageKeys {
+		if v, ok := p.Dict[k]; ok {
+			page[k] = im.Copy(v)
+		}
+	}
+
+	// The fonts are copied into a dictionary of the page's own, so that the
+	// overlay's can be added without touching resources shared with other
+	// pages.
+	resources := Dict{}
+	for k, v := range p.Resources {
+		resources[k] = v
+	}
+
+	fonts := Dict{}
+	if d, ok := im.r.dict(p.Resources["Font"]); ok {
+		for k, v := range d {
+			fonts[k] = v
+		}
+	}
+	resources["Font"] = fonts
+
+	copied := im.Copy(resources).(Dict)
+	for k, v := range overlayFonts {
+		copied["Font"].(Dict)[k] = v
+	}
+	page["Resources"] = copied
+
+	var contents Array
+
+	switch c, _ := im.r.Resolve(p.Dict["Contents"]); c := c.(type) {
+	case Array:
+		contents = im.Copy(c).(Array)
+	case *Stream:
+		contents = Array{im.Copy(p.Dict["Contents"])}
+	}
+
+	if len(overlay) > 0 {
+		// The page's content is wrapped in q and Q so that whatever state it
+		// leaves behind doesn't affect the overlay.
+		before, err := im.w.Add(&Stream{Dict: Dict{}, Data: []byte("q\n")})
+		if err != nil {
+			return err
+		}
+
+		after, err := im.w.Add(&Stream{Dict: Dict{}, Data: append([]byte("\nQ\n"), overlay...)})
+		if err != nil {
+			return err
+		}
+
+		contents = append(append(Array{before}, contents...), after)
+	}
+
+	page["Contents"] = contents
+
+	err := im.w.Write(ref, page)
+	if err != nil {
+		return err
+	}
+
+	return im.Flush()
+}
@@ -0,0 +1,678 @@
+package pdf
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// maxObjectNumber bounds object numbers, so that a hostile cross-reference
+// table can't claim billions of objects.
+const maxObjectNumber = 10_000_000
+
+type xrefEntry struct {
+	// compressed entries are in an object stream; the others are at an
+	// offset in the file.
+	compressed bool
+	offset     int64
+	stream     int
+	index      int
+}
+
+// objStream is a decoded object stream: objects packed together so that
+// they can be compressed.
+type objStream struct {
+	data    []byte
+	first   int
+	offsets []int
+}
+
+// loadXref reads the cross-reference tables or streams, starting from the
+// last in the file and following each one's Prev. If they can't be read,
+// the table is rebuilt by scanning the file for objects.
+func (r *Reader) loadXref() error {
+	r.xref = map[int]xrefEntry{}
+	r.trailer = Dict{}
+
+	offset, ok := findStartxref(r.data)
+
+	seen := map[int64]bool{}
+
+	for ok && !seen[offset] {
+		seen[offset] = true
+
+		trailer, err := r.readXrefSection(offset)
+		if err != nil {
+			return r.rebuildXref()
+		}
+
+		// Newer sections come first and take precedence.
+		for k, v := range trailer {
+			if _, ok := r.trailer[k]; !ok {
+				r.trailer[k] = v
+			}
+		}
+
+		offset, ok = 0, false
+		if prev, isInt := trailer["Prev"].(int64); isInt {
+			offset, ok = prev, true
+		}
+	}
+
+	if _, ok := r.trailer["Root"]; !ok {
+		return r.rebuildXref()
+	}
+
+	return nil
+}
+
+// findStartxref returns the offset given after the last startxref keyword.
+func findStartxref(data []byte) (int64, bool) {
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i < 0 {
+		return 0, false
+	}
+
+	l := &lexer{data: data, pos: i + len("startxref")}
+
+	tok, err := l.token()
+	offset, ok := tok.(int64)
+	if err != nil || !ok || offset < 0 || offset >= int64(len(data)) {
+		return 0, false
+	}
+
+	return offset, true
+}
+
+// readXrefSection reads the cross-reference table or stream at offset,
+// returning its trailer.
+func (r *Reader) readXrefSection(offset int64) (Dict, error) {
+	if offset < 0 || offset >= int64(len(r.data)) {
+		return nil, ErrMalformed
+	}
+
+	l := &lexer{data: r.data, pos: int(offset)}
+	l.skipSpace()
+
+	if hasKeywordAt(r.data, l.pos, "xref") {
+		l.pos += len("xref")
+		return r.readXrefTable(l)
+	}
+
+	return r.readXrefStream(offset)
+}
+
+func (r *Reader) readXrefTable(l *lexer) (Dict, error) {
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return nil, ErrMalformed
+		}
+
+		if kw, ok := tok.(keyword); ok && kw == "trailer" {
+			break
+		}
+
+		start, ok1 := tok.(int64)
+
+		tok, err = l.token()
+		count, ok2 := tok.(int64)
+
+		if err != nil || !ok1 || !ok2 || start < 0 || count < 0 || start+count > maxObjectNumber {
+			return nil, ErrMalformed
+		}
+
+		for i := int64(0); i < count; i++ {
+			offTok, _ := l.token()
+			genTok, _ := l.token()
+			kindTok, err := l.token()
+			if err != nil {
+				return nil, ErrMalformed
+			}
+
+			off, ok1 := offTok.(int64)
+			_, ok2 := genTok.(int64)
+			kind, ok3 := kindTok.(keyword)
+
+			if !ok1 || !ok2 || !ok3 || (kind != "n" && kind != "f") {
+				return nil, ErrMalformed
+			}
+
+			num := int(start + i)
+
+			if _, ok := r.xref[num]; kind == "n" && !ok {
+				r.xref[num] = xrefEntry{offset: off}
+			}
+		}
+	}
+
+	o, err := l.object()
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	trailer, ok := o.(Dict)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	// Hybrid files keep compressed objects in a stream the table points to.
+	if stm, ok := trailer["XRefStm"].(int64); ok {
+		_, err := r.readXrefStream(stm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return trailer, nil
+}
+
+func (r *Reader) readXrefStream(offset int64) (Dict, error) {
+	o, _, err := r.readObjectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := o.(*Stream)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	if t, _ := s.Dict["Type"].(Name); t != "XRef" {
+		return nil, ErrMalformed
+	}
+
+	var widths [3]int
+
+	w, ok := s.Dict["W"].(Array)
+	if !ok || len(w) < 3 {
+		return nil, ErrMalformed
+	}
+
+	rowSize := 0
+	for i := range widths {
+		n, ok := w[i].(int64)
+		if !ok || n < 0 || n > 8 {
+			return nil, ErrMalformed
+		}
+		widths[i] = int(n)
+		rowSize += int(n)
+	}
+
+	if rowSize == 0 {
+		return nil, ErrMalformed
+	}
+
+	size, _ := s.Dict["Size"].(int64)
+
+	index := Array{int64(0), size}
+	if a, ok := s.Dict["Index"].(Array); ok {
+		index = a
+	}
+
+	data, err := r.decodeStream(s)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	row := 0
+
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+
+		if !ok1 || !ok2 || start < 0 || count < 0 || start+count > maxObjectNumber {
+			return nil, ErrMalformed
+		}
+
+		for j := int64(0); j < count; j++ {
+			if (row+1)*rowSize > len(data) {
+				return s.Dict, nil
+			}
+
+			fields := data[row*rowSize:]
+			row++
+
+			var values [3]int64
+			for k, width := range widths {
+				for _, b := range fields[:width] {
+					values[k] = values[k]<<8 | int64(b)
+				}
+				fields = fields[width:]
+			}
+
+			// The type defaults to 1 when its field is left out.
+			if widths[0] == 0 {
+				values[0] = 1
+			}
+
+			num := int(start + j)
+			if _, ok := r.xref[num]; ok {
+				continue
+			}
+
+			switch values[0] {
+			case 1:
+				r.xref[num] = xrefEntry{offset: values[1]}
+			case 2:
+				r.xref[num] = xrefEntry{compressed: true, stream: int(values[1]), index: int(values[2])}
+			}
+		}
+	}
+
+	return s.Dict, nil
+}
+
+// readObjectAt reads the indirect object whose header is at offset,
+// returning it along with its object number.
+func (r *Reader) readObjectAt(offset int64) (Object, int, error) {
+	if offset < 0 || offset >= int64(len(r.data)) {
+		return nil, 0, ErrMalformed
+	}
+
+	l := &lexer{data: r.data, pos: int(offset)}
+
+	numTok, _ := l.token()
+	genTok, _ := l.token()
+	objTok, err := l.token()
+	if err != nil {
+		return nil, 0, ErrMalformed
+	}
+
+	num, ok1 := numTok.(int64)
+	_, ok2 := genTok.(int64)
+	kw, ok3 := objTok.(keyword)
+
+	if !ok1 || !ok2 || !ok3 || kw != "obj" {
+		return nil, 0, ErrMalformed
+	}
+
+	o, err := l.object()
+	if err != nil {
+		return nil, 0, endOfData(err)
+	}
+
+	dict, isDict := o.(Dict)
+	if !isDict {
+		return o, int(num), nil
+	}
+
+	save := l.pos
+
+	tok, err := l.token()
+	if kw, ok := tok.(keyword); err != nil || !ok || kw != "stream" {
+		l.pos = save
+		return o, int(num), nil
+	}
+
+	// The data starts after the end of line that follows the keyword.
+	if l.pos < len(r.data) && r.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(r.data) && r.data[l.pos] == '\n' {
+		l.pos++
+	}
+
+	start := l.pos
+	end := -1
+
+	if length, ok := r.streamLength(dict, int(num)); ok && length >= 0 && int64(start)+length <= int64(len(r.data)) {
+		after := &lexer{data: r.data, pos: start + int(length)}
+		after.skipSpace()
+
+		if hasKeywordAt(r.data, after.pos, "endstream") {
+			end = start + int(length)
+		}
+	}
+
+	// The length is often wrong, so fall back to looking for the end.
+	if end < 0 {
+		i := bytes.Index(r.data[start:], []byte("endstream"))
+		if i < 0 {
+			return nil, 0, ErrMalformed
+		}
+
+		end = start + i
+		if end > start && r.data[end-1] == '\n' {
+			end--
+		}
+		if end > start && r.data[end-1] == '\r' {
+			end--
+		}
+	}
+
+	return &Stream{Dict: dict, Data: r.data[start:end]}, int(num), nil
+}
+
+// streamLength reads a stream's Length, which may be an indirect object. A
+// stream whose length refers to itself has no usable length.
+func (r *Reader) streamLength(dict Dict, num int) (int64, bool) {
+	switch length := dict["Length"].(type) {
+	case int64:
+		return length, true
+	case Ref:
+		if length.Num == num || r.loading[length.Num] {
+			return 0, false
+		}
+		return r.integer(length)
+	}
+
+	return 0, false
+}
+
+// object returns the indirect object with the given number, or null if there
+// isn't one.
+func (r *Reader) object(num int) (Object, error) {
+	if o, ok := r.objects[num]; ok {
+		return o, nil
+	}
+
+	if r.loading[num] {
+		return nil, ErrMalformed
+	}
+
+	r.loading[num] = true
+	defer delete(r.loading, num)
+
+	o, err := r.loadObject(num)
+	if err == ErrMalformed && !r.rebuilt {
+		// The table may be wrong; find the objects for ourselves.
+		err = r.rebuildXref()
+		if err == nil {
+			o, err = r.loadObject(num)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.objects[num] = o
+
+	return o, nil
+}
+
+func (r *Reader) loadObject(num int) (Object, error) {
+	entry, ok := r.xref[num]
+	if !ok {
+		return nil, nil
+	}
+
+	if entry.compressed {
+		return r.objectFromStream(entry.stream, entry.index)
+	}
+
+	o, got, err := r.readObjectAt(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if got != num {
+		return nil, ErrMalformed
+	}
+
+	return o, nil
+}
+
+func (r *Reader) objectFromStream(streamNum, index int) (Object, error) {
+	stm, err := r.objStream(streamNum)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(stm.offsets) {
+		return nil, ErrMalformed
+	}
+
+	start := stm.first + stm.offsets[index]
+	if start < 0 || start > len(stm.data) {
+		return nil, ErrMalformed
+	}
+
+	l := &lexer{data: stm.data, pos: start}
+
+	o, err := l.object()
+	if err != nil {
+		return nil, endOfData(err)
+	}
+
+	return o, nil
+}
+
+func (r *Reader) objStream(num int) (*objStream, error) {
+	if stm, ok := r.objStreams[num]; ok {
+		return stm, nil
+	}
+
+	o, err := r.object(num)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := o.(*Stream)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	stm, _, err := r.parseObjStream(s)
+	if err != nil {
+		return nil, err
+	}
+
+	r.objStreams[num] = stm
+
+	return stm, nil
+}
+
+// parseObjStream decodes an object stream, returning it along with the
+// numbers of the objects in it.
+func (r *Reader) parseObjStream(s *Stream) (*objStream, []int, error) {
+	n, ok1 := s.Dict["N"].(int64)
+	first, ok2 := s.Dict["First"].(int64)
+
+	if !ok1 || !ok2 || n < 0 || n > maxObjectNumber || first < 0 {
+		return nil, nil, ErrMalformed
+	}
+
+	data, err := r.decodeStream(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if first > int64(len(data)) {
+		return nil, nil, ErrMalformed
+	}
+
+	l := &lexer{data: data[:first]}
+
+	stm := &objStream{data: data, first: int(first)}
+	var nums []int
+
+	for i := int64(0); i < n; i++ {
+		numTok, _ := l.token()
+		offTok, err := l.token()
+		if err != nil {
+			return nil, nil, ErrMalformed
+		}
+
+		num, ok1 := numTok.(int64)
+		off, ok2 := offTok.(int64)
+
+		if !ok1 || !ok2 || off < 0 {
+			return nil, nil, ErrMalformed
+		}
+
+		nums = append(nums, int(num))
+		stm.offsets = append(stm.offsets, int(off))
+	}
+
+	return stm, nums, nil
+}
+
+// rebuildXref builds the cross-reference table by scanning the file for
+// objects, for files whose tables are missing or wrong. Later definitions of
+// an object replace earlier ones, as incremental updates do.
+func (r *Reader) rebuildXref() error {
+	r.rebuilt = true
+	r.xref = map[int]xrefEntry{}
+	r.objects = map[int]Object{}
+	r.objStreams = map[int]*objStream{}
+
+	data := r.data
+	var streams []int
+
+	for i := 0; i < len(data); {
+		j := bytes.Index(data[i:], []byte("obj"))
+		if j < 0 {
+			break
+		}
+
+		at := i + j
+		i = at + 3
+
+		if !hasKeywordAt(data, at, "obj") {
+			continue
+		}
+
+		offset, num, ok := objectHeaderBefore(data, at)
+		if !ok {
+			continue
+		}
+
+		r.xref[num] = xrefEntry{offset: int64(offset)}
+	}
+
+	trailer := Dict{}
+	trailerOffset := int64(-1)
+
+	// Take the trailer from the last trailer dictionary or cross-reference
+	// stream in the file.
+	for num, entry := range r.xref {
+		o, _, err := r.readObjectAt(entry.offset)
+		if err != nil {
+			continue
+		}
+
+		s, ok := o.(*Stream)
+		if !ok {
+			continue
+		}
+
+		t, _ := s.Dict["Type"].(Name)
+
+		switch t {
+		case "XRef":
+			if _, ok := s.Dict["Root"]; ok && entry.offset > trailerOffset {
+				trailer = s.Dict
+				trailerOffset = entry.offset
+			}
+		case "ObjStm":
+			streams = append(streams, num)
+		}
+	}
+
+	for i := len(data); i > 0; {
+		j := bytes.LastIndex(data[:i], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+
+		i = j
+
+		if int64(j) < trailerOffset {
+			break
+		}
+
+		l := &lexer{data: data, pos: j + len("trailer")}
+
+		o, err := l.object()
+		if d, ok := o.(Dict); err == nil && ok {
+			if _, ok := d["Root"]; ok {
+				trailer = d
+				break
+			}
+		}
+	}
+
+	// Objects in object streams are only found through their streams.
+	for _, num := range streams {
+		o, _, err := r.readObjectAt(r.xref[num].offset)
+		if err != nil {
+			continue
+		}
+
+		stm, nums, err := r.parseObjStream(o.(*Stream))
+		if err != nil {
+			continue
+		}
+
+		r.objStreams[num] = stm
+
+		for index, n := range nums {
+			if _, ok := r.xref[n]; !ok {
+				r.xref[n] = xrefEntry{compressed: true, stream: num, index: index}
+			}
+		}
+	}
+
+	if _, ok := trailer["Root"]; !ok {
+		catalog, ok := r.findCatalog()
+		if !ok {
+			return ErrMalformed
+		}
+		trailer = Dict{"Root": catalog}
+	}
+
+	r.trailer = trailer
+
+	return nil
+}
+
+// objectHeaderBefore reads the "num gen" before an obj keyword at i,
+// returning the offset the header starts at and the object number.
+func objectHeaderBefore(data []byte, i int) (int, int, bool) {
+	readInt := func(end int) (int, int, bool) {
+		for end > 0 && isSpace(data[end-1]) {
+			end--
+		}
+
+		start := end
+		for start > 0 && data[start-1] >= '0' && data[start-1] <= '9' {
+			start--
+		}
+
+		if start == end || end-start > 10 {
+			return 0, 0, false
+		}
+
+		n, err := strconv.Atoi(string(data[start:end]))
+		return start, n, err == nil
+	}
+
+	genStart, _, ok := readInt(i)
+	if !ok {
+		return 0, 0, false
+	}
+
+	numStart, num, ok := readInt(genStart)
+	if !ok || num > maxObjectNumber {
+		return 0, 0, false
+	}
+
+	if numStart > 0 && isRegular(data[numStart-1]) {
+		return 0, 0, false
+	}
+
+	return numStart, num, true
+}
+
+// findCatalog looks through every object for the document catalog.
+func (r *Reader) findCatalog() (Ref, bool) {
+	for num := range r.xref {
+		d, ok := r.dict(Ref{Num: num})
+		if t, _ := d["Type"].(Name); ok && t == "Catalog" {
+			return Ref{Num: num}, true
+		}
+	}
+
+	return Ref{}, false
+}
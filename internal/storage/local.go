@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Local keeps files in a directory on the local filesystem, each key being a
+// path within it.
+type Local struct {
+	root string
+}
+
+// NewLocal returns storage rooted at the directory root, which is created
+// when the first file is stored.
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+func (l *Local) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file under a temporary name and renames it into place, so
+// that readers never see part of it.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, err := io.Copy(tmp, io.LimitReader(contextReader{ctx, r}, size))
+	if err != nil {
+		return err
+	}
+
+	if n != size {
+		return io.ErrUnexpectedEOF
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (File, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, localError(err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &localFile{File: f, stat: stat}, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (*Info, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, localError(err)
+	}
+
+	return &Info{Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// List walks the directory named by prefix; unlike in a bucket, a prefix
+// can't stop part way through a name. Files left behind by a Put that never
+// finished are included.
+func (l *Local) List(ctx context.Context, prefix string, fn func(key string, info Info) error) error {
+	dir, err := l.path(prefix)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Nothing has been stored under the prefix yet.
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			return ctx.Err()
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			// The file was deleted after its directory was read.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(l.root, path)
+		if err != nil {
+			return err
+		}
+
+		return fn(filepath.ToSlash(rel), Info{Size: stat.Size(), ModTime: stat.ModTime()})
+	})
+}
+
+func localError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+type localFile struct {
+	*os.File
+	stat fs.FileInfo
+}
+
+func (f *localFile) Size() int64 {
+	return f.stat.Size()
+}
+
+func (f *localFile) ModTime() time.Time {
+	return f.stat.ModTime()
+}
+
+// contextReader stops reading from r once ctx is done, so that a cancelled
+// Put doesn't keep copying.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	err := cr.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+		err  error
+	}{
+		{"docs/a", "docs/a", nil},
+		{"./docs/a", "docs/a", nil},
+		{"docs//a/", "docs/a", nil},
+		{"docs/x/../a", "docs/a", nil},
+		{"docs/..a", "docs/..a", nil},
+		{"", "", ErrInvalidKey},
+		{".", "", ErrInvalidKey},
+		{"..", "", ErrInvalidKey},
+		{"../a", "", ErrInvalidKey},
+		{"docs/../../a", "", ErrInvalidKey},
+		{"docs/..", "", ErrInvalidKey},
+		{"/etc/passwd", "", ErrInvalidKey},
+		{`docs\..\..\a`, "", ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		got, err := CleanKey(tt.key)
+		if got != tt.want || err != tt.err {
+			t.Errorf("CleanKey(%q): got %q, %v; want %q, %v", tt.key, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "files")
+	l := NewLocal(root)
+	ctx := context.Background()
+
+	err := l.Put(ctx, "docs/a", strings.NewReader("hello"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := l.Open(ctx, "./docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(got) != "hello" || f.Size() != 5 {
+		t.Errorf("got %q, size %d, %v; want %q", got, f.Size(), err, "hello")
+	}
+
+	err = l.Put(ctx, "docs/short", strings.NewReader("hi"), 5)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Put of a short body: got %v; want io.ErrUnexpectedEOF", err)
+	}
+
+	if _, err = l.Stat(ctx, "docs/short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after a short Put: got %v; want ErrNotFound", err)
+	}
+
+	for _, key := range []string{"../outside", "docs/../../outside", "/outside"} {
+		err = l.Put(ctx, key, strings.NewReader("x"), 1)
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): got %v; want ErrInvalidKey", key, err)
+		}
+
+		if _, err = l.Open(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q): got %v; want ErrInvalidKey", key, err)
+		}
+
+		if err = l.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q): got %v; want ErrInvalidKey", key, err)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(parent, "outside")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was written outside the root: %v", err)
+	}
+
+	var keys []string
+
+	err = l.List(ctx, "docs/", func(key string, info Info) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil || len(keys) != 1 || keys[0] != "docs/a" {
+		t.Errorf("List: got %v, %v; want [docs/a]", keys, err)
+	}
+
+	err = l.List(ctx, "recordings/", func(key string, info Info) error {
+		t.Errorf("unexpected file %s", key)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("listing a prefix with nothing stored: %v", err)
+	}
+
+	if err = l.Delete(ctx, "docs/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = l.Delete(ctx, "docs/a"); err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+
+	if _, err = l.Open(ctx, "docs/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: got %v; want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,521 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures storage in an S3-compatible bucket.
+type S3Config struct {
+	// Endpoint is the service's base URL, such as
+	// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// PathStyle puts the bucket in the URL's path rather than its host
+	// name, as MinIO and most other self-hosted services expect.
+	PathStyle bool
+
+	// Client makes the requests. http.DefaultClient is used if it is nil.
+	Client *http.Client
+}
+
+// S3 keeps files as objects in an S3-compatible bucket, each key being an
+// object key. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	endpoint *url.URL
+	cfg      S3Config
+	client   *http.Client
+}
+
+// NewS3 returns storage in the bucket described by cfg.
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid S3 endpoint: %w", err)
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, errors.New("storage: S3 endpoint must be an http or https URL")
+	}
+
+	if cfg.Bucket == "" {
+		return nil, errors.New("storage: S3 bucket must be set")
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3{endpoint: endpoint, cfg: cfg, client: client}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	// The body is sent with a known length, so that it can be streamed
+	// rather than held in memory.
+	req, err := s.newRequest(ctx, http.MethodPut, key, io.NopCloser(io.LimitReader(r, size)))
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (File, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3File{s: s, ctx: ctx, key: key, info: *info}, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*Info, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body.Close()
+
+	info := &Info{Size: res.ContentLength}
+
+	if info.Size < 0 {
+		return nil, fmt.Errorf("storage: no length given for %s", key)
+	}
+
+	info.ModTime, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+
+	return info, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	res.Body.Close()
+
+	return nil
+}
+
+// getRange fetches bytes start to end inclusive of an object, or from start
+// to the end of the object if end is negative.
+func (s *S3) getRange(ctx context.Context, key string, start, end int64) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if end < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A service that ignores Range sends the whole object, which is only
+	// what was asked for if it starts at the beginning.
+	if res.StatusCode != http.StatusPartialContent && start != 0 {
+		res.Body.Close()
+		return nil, fmt.Errorf("storage: range request for %s answered with %s", key, res.Status)
+	}
+
+	return res.Body, nil
+}
+
+// List pages through the bucket with ListObjectsV2.
+func (s *S3) List(ctx context.Context, prefix string, fn func(key string, info Info) error) error {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+	}
+
+	for {
+		req, err := s.newBucketRequest(ctx, http.MethodGet, query)
+		if err != nil {
+			return err
+		}
+
+		res, err := s.do(req)
+		if err != nil {
+			return err
+		}
+
+		var page struct {
+			Contents []struct {
+				Key          string `xml:"Key"`
+				LastModified string `xml:"LastModified"`
+				Size         int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("storage: reading S3 listing: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			modTime, _ := time.Parse(time.RFC3339, obj.LastModified)
+
+			err = fn(obj.Key, Info{Size: obj.Size, ModTime: modTime})
+			if err != nil {
+				return err
+			}
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+func (s *S3) newRequest(ctx context.Context, method, key string, body io.ReadCloser) (*http.Request, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.request(ctx, method, key, nil, body)
+}
+
+func (s *S3) newBucketRequest(ctx context.Context, method string, query url.Values) (*http.Request, error) {
+	return s.request(ctx, method, "", query, nil)
+}
+
+func (s *S3) request(ctx context.Context, method, key string, query url.Values, body io.ReadCloser) (*http.Request, error) {
+	u := *s.endpoint
+	u.Fragment = ""
+
+	base := strings.TrimSuffix(u.Path, "/")
+
+	switch {
+	case s.cfg.PathStyle && key == "":
+		u.Path = base + "/" + s.cfg.Bucket
+	case s.cfg.PathStyle:
+		u.Path = base + "/" + s.cfg.Bucket + "/" + key
+	default:
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+
+	u.RawPath = uriEncode(u.Path, false)
+
+	// The query is sent exactly as it is signed.
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// do signs and sends a request, turning error responses into errors.
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	// HEAD responses have no body, so the status is all there is to go on.
+	xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body)
+
+	if body.Code == "" {
+		return nil, fmt.Errorf("storage: S3 %s %s: %s", req.Method, req.URL.Path, res.Status)
+	}
+
+	return nil, fmt.Errorf("storage: S3 %s %s: %s: %s", req.Method, req.URL.Path, body.Code, body.Message)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req. Bodies
+// aren't hashed, so that they can be streamed.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := signingKey(s.cfg.SecretKey, date, s.cfg.Region, "s3")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// signingKey derives the key that requests to service in region are signed
+// with on date.
+func signingKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery encodes a query string as Signature Version 4 requires,
+// with the parameters sorted by name.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var params []string
+
+	for _, name := range names {
+		for _, value := range query[name] {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// uriEncode escapes s as Signature Version 4 requires: every byte other than
+// letters, digits and "-._~" is percent-encoded, as is "/" if encodeSlash is
+// set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// s3File reads an object with ranged GET requests. Reads stream from a
+// single request until the file is seeked elsewhere.
+type s3File struct {
+	s    *S3
+	ctx  context.Context
+	key  string
+	info Info
+
+	pos  int64
+	body io.ReadCloser
+}
+
+func (f *s3File) Size() int64 {
+	return f.info.Size
+}
+
+func (f *s3File) ModTime() time.Time {
+	return f.info.ModTime
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	if f.pos >= f.info.Size {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		body, err := f.s.getRange(f.ctx, f.key, f.pos, -1)
+		if err != nil {
+			return 0, err
+		}
+
+		f.body = body
+	}
+
+	n, err := f.body.Read(p)
+	f.pos += int64(n)
+
+	if errors.Is(err, io.EOF) && f.pos < f.info.Size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		pos += f.pos
+	case io.SeekEnd:
+		pos += f.info.Size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+
+	if pos < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+
+	if pos != f.pos {
+		f.closeBody()
+		f.pos = pos
+	}
+
+	return pos, nil
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("storage: negative offset")
+	}
+
+	if off >= f.info.Size {
+		return 0, io.EOF
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	end := min(off+int64(len(p)), f.info.Size)
+
+	body, err := f.s.getRange(f.ctx, f.key, off, end-1)
+	if err != nil {
+		return 0, err
+	}
+
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p[:end-off])
+	if err != nil {
+		return n, err
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (f *s3File) Close() error {
+	f.closeBody()
+	return nil
+}
+
+func (f *s3File) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
@@ -0,0 +1,408 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory bucket served with path-style URLs. Listings are
+// split into pages of pageSize objects. If truncate is set, object bodies are
+// cut off half way through.
+type fakeS3 struct {
+	bucket   string
+	pageSize int
+	truncate bool
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	lists   int
+}
+
+var fakeModTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newFakeS3(t *testing.T, fake *fakeS3) *S3 {
+	t.Helper()
+
+	fake.objects = map[string][]byte{}
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	s, err := NewS3(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    fake.bucket,
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "secret",
+		PathStyle: true,
+		Client:    srv.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || r.Header.Get("X-Amz-Date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>Unsigned request</Message></Error>")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code></Error>")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if key == "" {
+		f.list(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+	case http.MethodGet, http.MethodHead:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if f.truncate && r.Method == http.MethodGet {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body[:len(body)/2])
+			return
+		}
+
+		http.ServeContent(w, r, key, fakeModTime, bytes.NewReader(body))
+	case http.MethodDelete:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	f.lists++
+
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+	end := min(start+f.pageSize, len(keys))
+
+	type object struct {
+		Key          string
+		LastModified string
+		Size         int
+	}
+
+	page := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{IsTruncated: end < len(keys)}
+
+	for _, key := range keys[start:end] {
+		page.Contents = append(page.Contents, object{key, fakeModTime.Format(time.RFC3339), len(f.objects[key])})
+	}
+
+	if page.IsTruncated {
+		page.NextContinuationToken = strconv.Itoa(end)
+	}
+
+	xml.NewEncoder(w).Encode(page)
+}
+
+func TestS3(t *testing.T) {
+	s := newFakeS3(t, &fakeS3{bucket: "gazebo", pageSize: 1000})
+	ctx := context.Background()
+
+	body := []byte("0123456789abcdefghij")
+	key := "docs/set list+notes 1.pdf"
+
+	err := s.Put(ctx, key, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put(ctx, "docs/empty", bytes.NewReader(nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size != int64(len(body)) || !info.ModTime.Equal(fakeModTime) {
+		t.Errorf("got %+v; want size %d, modified %v", info, len(body), fakeModTime)
+	}
+
+	f, err := s.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	got, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(got, body) {
+		t.Errorf("ReadAll: got %q, %v; want %q", got, err, body)
+	}
+
+	_, err = f.Seek(-5, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = io.ReadAll(f)
+	if err != nil || string(got) != "fghij" {
+		t.Errorf("ReadAll after Seek: got %q, %v; want %q", got, err, "fghij")
+	}
+
+	readAtTests := []struct {
+		off  int64
+		size int
+		want string
+		err  error
+	}{
+		{0, 4, "0123", nil},
+		{10, 3, "abc", nil},
+		{16, 10, "ghij", io.EOF},
+		{20, 1, "", io.EOF},
+	}
+
+	for _, tt := range readAtTests {
+		p := make([]byte, tt.size)
+
+		n, err := f.ReadAt(p, tt.off)
+		if string(p[:n]) != tt.want || err != tt.err {
+			t.Errorf("ReadAt(%d bytes, %d): got %q, %v; want %q, %v", tt.size, tt.off, p[:n], err, tt.want, tt.err)
+		}
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Stat(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete: got %v; want ErrNotFound", err)
+	}
+
+	_, err = s.Open(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: got %v; want ErrNotFound", err)
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+
+	err = s.Put(ctx, "../escape", bytes.NewReader(body), int64(len(body)))
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Put with an invalid key: got %v; want ErrInvalidKey", err)
+	}
+}
+
+func TestS3List(t *testing.T) {
+	fake := &fakeS3{bucket: "gazebo", pageSize: 2}
+	s := newFakeS3(t, fake)
+	ctx := context.Background()
+
+	want := []string{"docs/a", "docs/b", "docs/c", "docs/d", "docs/e"}
+
+	for _, key := range append([]string{"recordings/a"}, want...) {
+		err := s.Put(ctx, key, strings.NewReader(key), int64(len(key)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+
+	err := s.List(ctx, "docs/", func(key string, info Info) error {
+		if info.Size != int64(len(key)) || !info.ModTime.Equal(fakeModTime) {
+			t.Errorf("%s: got %+v", key, info)
+		}
+
+		got = append(got, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if fake.lists != 3 {
+		t.Errorf("listed %d pages; want 3", fake.lists)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+
+	err = s.List(ctx, "docs/", func(key string, info Info) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("got %v after %d calls; want the callback's error after 1", err, calls)
+	}
+}
+
+func TestS3TruncatedRead(t *testing.T) {
+	s := newFakeS3(t, &fakeS3{bucket: "gazebo", truncate: true})
+	ctx := context.Background()
+
+	body := bytes.Repeat([]byte("x"), 1000)
+
+	err := s.Put(ctx, "docs/a", bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.Open(ctx, "docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	_, err = io.ReadAll(f)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v; want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestS3ErrorResponse(t *testing.T) {
+	s := newFakeS3(t, &fakeS3{bucket: "gazebo"})
+	s.cfg.AccessKey = "someone-else"
+
+	err := s.Put(context.Background(), "docs/a", strings.NewReader("a"), 1)
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied: Unsigned request") {
+		t.Errorf("got %v; want the service's error code and message", err)
+	}
+}
+
+// The signing key is checked against the example in the AWS documentation,
+// "Examples of how to derive a signing key for Signature Version 4".
+func TestSigningKey(t *testing.T) {
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		cfg       S3Config
+		method    string
+		key       string
+		query     url.Values
+		url       string
+		signature string
+	}{
+		{
+			name:      "object, path style",
+			cfg:       S3Config{Endpoint: "http://localhost:9000", Bucket: "gazebo", PathStyle: true},
+			method:    http.MethodPut,
+			key:       "docs/a b+c.pdf",
+			url:       "http://localhost:9000/gazebo/docs/a%20b%2Bc.pdf",
+			signature: "7a0f56a25438bb44d4e293e024ba73faf3816bac61b594801544b95a39a0d35c",
+		},
+		{
+			name:      "listing, virtual host",
+			cfg:       S3Config{Endpoint: "https://s3.eu-west-1.amazonaws.com", Region: "eu-west-1", Bucket: "gazebo"},
+			method:    http.MethodGet,
+			query:     url.Values{"prefix": {"docs/"}, "list-type": {"2"}},
+			url:       "https://gazebo.s3.eu-west-1.amazonaws.com/?list-type=2&prefix=docs%2F",
+			signature: "33d4f1834b5b487da08f115494d55e7c48219655fde54373e233a33ae5e6d9fd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.AccessKey = "AKIDEXAMPLE"
+			tt.cfg.SecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+
+			s, err := NewS3(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := s.request(context.Background(), tt.method, tt.key, tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if req.URL.String() != tt.url {
+				t.Errorf("got URL %s; want %s", req.URL, tt.url)
+			}
+
+			s.sign(req, now)
+
+			want := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240501/%s/s3/aws4_request, "+
+				"SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s", s.cfg.Region, tt.signature)
+
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("got Authorization %s; want %s", got, want)
+			}
+		})
+	}
+}
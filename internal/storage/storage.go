@@ -0,0 +1,80 @@
+// Package storage keeps the files the API stores, such as documents and
+// recordings, in a local directory or an S3-compatible bucket.
+//
+// Files are named by keys: slash-separated relative paths such as
+// "docs/6f1c...". A file is written once under a key and never modified, so
+// readers can cache what they read by key.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no file is stored under a key.
+	ErrNotFound = errors.New("storage: file not found")
+
+	// ErrInvalidKey is returned for keys that aren't relative paths within
+	// the store, such as those starting with "/" or containing "..".
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Storage is somewhere files are kept.
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing any file
+	// already there. The file only appears once it has been written in
+	// full.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Open opens the file stored under key. Reads made through the
+	// returned File use ctx.
+	Open(ctx context.Context, key string) (File, error)
+
+	// Stat returns the size and modification time of the file stored under
+	// key.
+	Stat(ctx context.Context, key string) (*Info, error)
+
+	// Delete removes the file stored under key. Deleting a file that doesn't
+	// exist isn't an error.
+	Delete(ctx context.Context, key string) error
+
+	// List calls fn with each file whose key starts with prefix, stopping
+	// at the first error fn returns. Files stored while the listing is
+	// under way may or may not be included.
+	List(ctx context.Context, prefix string, fn func(key string, info Info) error) error
+}
+
+// File is a stored file opened for reading.
+type File interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Size() int64
+	ModTime() time.Time
+}
+
+// Info describes a stored file.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// CleanKey returns the canonical form of key, so that "./docs/x" and
+// "docs/x" name the same file.
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+
+	key = path.Clean(key)
+
+	if key == "." || key == ".." || strings.HasPrefix(key, "../") {
+		return "", ErrInvalidKey
+	}
+
+	return key, nil
+}
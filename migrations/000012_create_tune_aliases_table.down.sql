@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tune_aliases;
\ No newline at end of file
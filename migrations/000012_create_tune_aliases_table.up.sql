@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS tune_aliases (
+    id bigserial PRIMARY KEY,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    note text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS tune_aliases_tune_id_idx ON tune_aliases (tune_id);
+CREATE INDEX IF NOT EXISTS tune_aliases_title_idx ON tune_aliases USING GIN (to_tsvector('simple', title));
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tunes_custom_fields_idx;
+ALTER TABLE tunes DROP COLUMN IF EXISTS custom_fields;
+DROP TABLE IF EXISTS band_custom_fields;
\ No newline at end of file
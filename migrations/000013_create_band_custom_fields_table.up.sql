@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS band_custom_fields (
+    id bigserial PRIMARY KEY,
+    band_id bigint NOT NULL REFERENCES bands ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    name text NOT NULL,
+    field_type text NOT NULL,
+    required bool NOT NULL DEFAULT false,
+    options text[] NOT NULL DEFAULT '{}',
+    CONSTRAINT band_custom_fields_name_key UNIQUE (band_id, name)
+);
+
+ALTER TABLE tunes ADD COLUMN custom_fields jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS tunes_custom_fields_idx ON tunes USING GIN (custom_fields);
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id bigserial PRIMARY KEY,
+    band_id bigint NOT NULL REFERENCES bands ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    name text NOT NULL,
+    shared bool NOT NULL DEFAULT false,
+    title text NOT NULL DEFAULT '',
+    keys text[] NOT NULL DEFAULT '{}',
+    statuses text[] NOT NULL DEFAULT '{}',
+    custom_fields jsonb NOT NULL DEFAULT '{}',
+    sort text NOT NULL DEFAULT 'id'
+);
+
+CREATE INDEX IF NOT EXISTS saved_searches_band_id_idx ON saved_searches (band_id);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS document_favorites;
+DROP TABLE IF EXISTS tune_favorites;
\ No newline at end of file
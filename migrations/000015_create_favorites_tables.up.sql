@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS tune_favorites (
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    tune_id bigint REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT tune_favorites_pkey PRIMARY KEY (user_id, tune_id)
+);
+
+CREATE TABLE IF NOT EXISTS document_favorites (
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    document_id bigint REFERENCES documents ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT document_favorites_pkey PRIMARY KEY (user_id, document_id)
+);
\ No newline at end of file
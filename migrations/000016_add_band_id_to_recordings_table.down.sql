@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tune_recordings_recording_id_idx;
+DROP INDEX IF EXISTS recordings_band_id_idx;
+ALTER TABLE recordings DROP COLUMN IF EXISTS band_id;
\ No newline at end of file
@@ -0,0 +1,10 @@
+ALTER TABLE recordings ADD COLUMN band_id bigint REFERENCES bands ON DELETE CASCADE;
+
+UPDATE recordings r SET band_id = t.band_id FROM tune_recordings tr JOIN tunes t ON t.id = tr.tune_id WHERE tr.recording_id = r.id;
+
+DELETE FROM recordings WHERE band_id IS NULL;
+
+ALTER TABLE recordings ALTER COLUMN band_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS recordings_band_id_idx ON recordings (band_id);
+CREATE INDEX IF NOT EXISTS tune_recordings_recording_id_idx ON tune_recordings (recording_id);
\ No newline at end of file
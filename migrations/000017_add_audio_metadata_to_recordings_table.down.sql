@@ -0,0 +1,6 @@
+ALTER TABLE recordings DROP COLUMN IF EXISTS tags;
+ALTER TABLE recordings DROP COLUMN IF EXISTS bits_per_sample;
+ALTER TABLE recordings DROP COLUMN IF EXISTS bitrate;
+ALTER TABLE recordings DROP COLUMN IF EXISTS channels;
+ALTER TABLE recordings DROP COLUMN IF EXISTS sample_rate;
+ALTER TABLE recordings DROP COLUMN IF EXISTS duration;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE recordings ADD COLUMN duration double precision NOT NULL DEFAULT 0;
+ALTER TABLE recordings ADD COLUMN sample_rate integer NOT NULL DEFAULT 0;
+ALTER TABLE recordings ADD COLUMN channels integer NOT NULL DEFAULT 0;
+ALTER TABLE recordings ADD COLUMN bitrate integer NOT NULL DEFAULT 0;
+ALTER TABLE recordings ADD COLUMN bits_per_sample integer NOT NULL DEFAULT 0;
+ALTER TABLE recordings ADD COLUMN tags jsonb NOT NULL DEFAULT '{}';
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE recordings DROP COLUMN IF EXISTS waveform_status;
+
+DROP TABLE IF EXISTS recording_peaks;
\ No newline at end of file
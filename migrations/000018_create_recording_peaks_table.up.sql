@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS recording_peaks (
+    recording_id bigint NOT NULL REFERENCES recordings ON DELETE CASCADE,
+    samples_per_pixel integer NOT NULL,
+    sample_rate integer NOT NULL,
+    data bytea NOT NULL,
+    PRIMARY KEY (recording_id, samples_per_pixel)
+);
+
+ALTER TABLE recordings ADD COLUMN waveform_status text NOT NULL DEFAULT 'pending';
+
+UPDATE recordings SET waveform_status = 'unsupported' WHERE file_type NOT IN ('wav', 'flac');
\ No newline at end of file
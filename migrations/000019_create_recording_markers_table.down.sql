@@ -0,0 +1 @@
+DROP TABLE IF EXISTS recording_markers;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS recording_markers (
+    id bigserial PRIMARY KEY,
+    recording_id bigint NOT NULL REFERENCES recordings ON DELETE CASCADE,
+    tune_id bigint REFERENCES tunes ON DELETE SET NULL,
+    created_by bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    start_time double precision NOT NULL,
+    end_time double precision NOT NULL,
+    label text NOT NULL DEFAULT '',
+    CONSTRAINT recording_markers_times_check CHECK (start_time >= 0 AND end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS recording_markers_recording_id_idx ON recording_markers (recording_id, start_time);
+CREATE INDEX IF NOT EXISTS recording_markers_tune_id_idx ON recording_markers (tune_id);
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS uploads (
+    id uuid PRIMARY KEY,
+    owner_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) with time zone NOT NULL,
+    kind text NOT NULL,
+    info jsonb NOT NULL,
+    upload_length bigint NOT NULL,
+    upload_offset bigint NOT NULL DEFAULT 0,
+    resource text NOT NULL DEFAULT '',
+    CONSTRAINT uploads_offset_check CHECK (upload_offset >= 0 AND upload_offset <= upload_length)
+);
+
+CREATE INDEX IF NOT EXISTS uploads_expires_at_idx ON uploads (expires_at);
\ No newline at end of file
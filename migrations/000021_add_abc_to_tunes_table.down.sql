@@ -0,0 +1 @@
+ALTER TABLE tunes DROP COLUMN IF EXISTS abc;
\ No newline at end of file
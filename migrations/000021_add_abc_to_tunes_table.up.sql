@@ -0,0 +1 @@
+ALTER TABLE tunes ADD COLUMN abc text NOT NULL DEFAULT '';
\ No newline at end of file
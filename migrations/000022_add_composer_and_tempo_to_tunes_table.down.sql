@@ -0,0 +1,2 @@
+ALTER TABLE tunes DROP COLUMN IF EXISTS tempo;
+ALTER TABLE tunes DROP COLUMN IF EXISTS composer;
\ No newline at end of file
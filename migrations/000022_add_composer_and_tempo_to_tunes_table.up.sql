@@ -0,0 +1,2 @@
+ALTER TABLE tunes ADD COLUMN composer text NOT NULL DEFAULT '';
+ALTER TABLE tunes ADD COLUMN tempo integer NOT NULL DEFAULT 0;
\ No newline at end of file
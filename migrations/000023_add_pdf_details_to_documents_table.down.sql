@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS documents_text_idx;
+ALTER TABLE documents DROP COLUMN IF EXISTS text;
+ALTER TABLE documents DROP COLUMN IF EXISTS pdf_info;
+ALTER TABLE documents DROP COLUMN IF EXISTS page_count;
\ No newline at end of file
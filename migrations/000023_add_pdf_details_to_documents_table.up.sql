@@ -0,0 +1,4 @@
+ALTER TABLE documents ADD COLUMN page_count integer NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN pdf_info jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE documents ADD COLUMN text text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS documents_text_idx ON documents USING GIN (to_tsvector('simple', title || ' ' || text));
\ No newline at end of file
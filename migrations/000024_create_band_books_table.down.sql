@@ -0,0 +1 @@
+DROP TABLE IF EXISTS band_books;
\ No newline at end of file
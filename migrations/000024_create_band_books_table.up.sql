@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS band_books (
+    id bigserial PRIMARY KEY,
+    band_id bigint NOT NULL REFERENCES bands ON DELETE CASCADE,
+    owner_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    tune_ids bigint[] NOT NULL,
+    instrument text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT 'pending',
+    file_path text NOT NULL DEFAULT '',
+    page_count integer NOT NULL DEFAULT 0,
+    skipped_document_ids bigint[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS band_books_band_id_idx ON band_books (band_id);
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_clef_check;
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_transposition_check;
+ALTER TABLE documents DROP COLUMN IF EXISTS part;
+ALTER TABLE documents DROP COLUMN IF EXISTS clef;
+ALTER TABLE documents DROP COLUMN IF EXISTS transposition;
+ALTER TABLE documents DROP COLUMN IF EXISTS instrument;
\ No newline at end of file
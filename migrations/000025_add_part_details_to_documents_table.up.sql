@@ -0,0 +1,6 @@
+ALTER TABLE documents ADD COLUMN instrument text NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN transposition text NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN clef text NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN part text NOT NULL DEFAULT '';
+ALTER TABLE documents ADD CONSTRAINT documents_transposition_check CHECK (transposition IN ('', 'C', 'Bb', 'Eb', 'F'));
+ALTER TABLE documents ADD CONSTRAINT documents_clef_check CHECK (clef IN ('', 'treble', 'bass', 'alto', 'tenor'));
\ No newline at end of file
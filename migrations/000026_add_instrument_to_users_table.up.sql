@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN instrument text NOT NULL DEFAULT '';
\ No newline at end of file
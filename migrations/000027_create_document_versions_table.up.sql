@@ -0,0 +1,20 @@
+ALTER TABLE documents ADD COLUMN version integer NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS document_versions (
+    id bigserial PRIMARY KEY,
+    document_id bigint NOT NULL REFERENCES documents ON DELETE CASCADE,
+    version integer NOT NULL,
+    uploaded_by bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    file_path text NOT NULL,
+    file_type text NOT NULL,
+    page_count integer NOT NULL DEFAULT 0,
+    pdf_info jsonb NOT NULL DEFAULT '{}',
+    text text NOT NULL DEFAULT '',
+    restored_from integer,
+    UNIQUE (document_id, version)
+);
+
+INSERT INTO document_versions (document_id, version, uploaded_by, created_at, file_path, file_type, page_count, pdf_info, text)
+SELECT id, version, owner_id, created_at, file_path, file_type, page_count, pdf_info, text
+FROM documents;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS band_books_blob_refs ON band_books;
+DROP TRIGGER IF EXISTS recordings_blob_refs ON recordings;
+DROP TRIGGER IF EXISTS document_versions_blob_refs ON document_versions;
+DROP FUNCTION IF EXISTS count_blob_refs;
+DROP TABLE IF EXISTS blobs;
\ No newline at end of file
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS blobs (
+    hash text PRIMARY KEY,
+    size bigint NOT NULL,
+    ref_count integer NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    claimed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS blobs_unused_idx ON blobs (claimed_at) WHERE ref_count = 0;
+
+CREATE OR REPLACE FUNCTION count_blob_refs() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.file_path LIKE 'blobs/%' THEN
+        UPDATE blobs SET ref_count = ref_count - 1 WHERE hash = right(OLD.file_path, 64);
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.file_path LIKE 'blobs/%' THEN
+        UPDATE blobs SET ref_count = ref_count + 1 WHERE hash = right(NEW.file_path, 64);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER document_versions_blob_refs
+AFTER INSERT OR DELETE OR UPDATE OF file_path ON document_versions
+FOR EACH ROW EXECUTE FUNCTION count_blob_refs();
+
+CREATE TRIGGER recordings_blob_refs
+AFTER INSERT OR DELETE OR UPDATE OF file_path ON recordings
+FOR EACH ROW EXECUTE FUNCTION count_blob_refs();
+
+CREATE TRIGGER band_books_blob_refs
+AFTER INSERT OR DELETE OR UPDATE OF file_path ON band_books
+FOR EACH ROW EXECUTE FUNCTION count_blob_refs();
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS recordings_owner_id_idx;
+DROP INDEX IF EXISTS document_versions_uploaded_by_idx;
+ALTER TABLE bands DROP COLUMN IF EXISTS storage_quota;
+ALTER TABLE users DROP COLUMN IF EXISTS storage_quota;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
\ No newline at end of file
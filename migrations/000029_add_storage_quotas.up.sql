@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin boolean NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_quota bigint;
+ALTER TABLE bands ADD COLUMN IF NOT EXISTS storage_quota bigint;
+
+CREATE INDEX IF NOT EXISTS document_versions_uploaded_by_idx ON document_versions (uploaded_by);
+CREATE INDEX IF NOT EXISTS recordings_owner_id_idx ON recordings (owner_id);
\ No newline at end of file
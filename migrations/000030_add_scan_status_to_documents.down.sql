@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS document_versions_scan_pending_idx;
+ALTER TABLE document_versions DROP COLUMN IF EXISTS scan_status;
+ALTER TABLE documents DROP COLUMN IF EXISTS scan_status;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS scan_status text NOT NULL DEFAULT 'unscanned';
+ALTER TABLE document_versions ADD COLUMN IF NOT EXISTS scan_status text NOT NULL DEFAULT 'unscanned';
+
+CREATE INDEX IF NOT EXISTS document_versions_scan_pending_idx ON document_versions (id) WHERE scan_status = 'pending';
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS recordings_scan_pending_idx;
+ALTER TABLE recordings DROP COLUMN IF EXISTS scan_status;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE recordings ADD COLUMN IF NOT EXISTS scan_status text NOT NULL DEFAULT 'unscanned';
+
+CREATE INDEX IF NOT EXISTS recordings_scan_pending_idx ON recordings (id) WHERE scan_status = 'pending';
\ No newline at end of file